@@ -5,10 +5,11 @@ package main
 
 import "github.com/go-gl/mathgl/mgl32"
 
-// BlockData stores UV texture coordinates for each face of a block.
+// BlockData stores the name of a block and the UV texture coordinates for each face.
 // UV coordinates are represented as multiples of BLOCK_DATA_UV_SPACE
 // (i.e., tile indices in a texture atlas).
 type BlockData struct {
+	name     string     // Display name, such as in the HUD
 	side0UV  mgl32.Vec2 // Texture coordinates for side 0 (typically -X or West face)
 	side1UV  mgl32.Vec2 // Texture coordinates for side 1 (typically +X or East face)
 	side2UV  mgl32.Vec2 // Texture coordinates for side 2 (typically -Z or North face)
@@ -23,8 +24,43 @@ const (
 	BLOCK_DIRT  = 1 // Standard dirt block
 	BLOCK_GRASS = 2 // Grass block with dirt sides and bottom
 	BLOCK_STONE = 3 // Stone block
+	BLOCK_WATER = 4 // Fluid block, its flow level is stored separately in the chunk
+
+	BLOCK_COAL_ORE    = 5 // Coal ore, placed in veins by the ore generator
+	BLOCK_IRON_ORE    = 6 // Iron ore
+	BLOCK_GOLD_ORE    = 7 // Gold ore
+	BLOCK_DIAMOND_ORE = 8 // Diamond ore, the rarest and deepest
+)
+
+// Face indices used to look up per-face texture coordinates with FaceUV.
+const (
+	FACE_SIDE0  = 0
+	FACE_SIDE1  = 1
+	FACE_SIDE2  = 2
+	FACE_SIDE3  = 3
+	FACE_TOP    = 4
+	FACE_BOTTOM = 5
 )
 
+// FaceUV returns the atlas tile of one face of the block.
+// face: One of the FACE_* constants
+func (data *BlockData) FaceUV(face int) mgl32.Vec2 {
+	switch face {
+	case FACE_SIDE0:
+		return data.side0UV
+	case FACE_SIDE1:
+		return data.side1UV
+	case FACE_SIDE2:
+		return data.side2UV
+	case FACE_SIDE3:
+		return data.side3UV
+	case FACE_TOP:
+		return data.topUV
+	default:
+		return data.bottomUV
+	}
+}
+
 // BLOCK_DATA_UV_SPACE defines the normalized size of a single texture tile
 // in the texture atlas (64px tile / 1024px atlas = 0.0625).
 const BLOCK_DATA_UV_SPACE = 64.0 / 1024.0
@@ -32,6 +68,7 @@ const BLOCK_DATA_UV_SPACE = 64.0 / 1024.0
 // blockDirtData defines the texture coordinates for a dirt block.
 // All faces use the same dirt texture (tile 0,0 in the atlas).
 var blockDirtData = BlockData{
+	name:     "dirt",
 	side0UV:  mgl32.Vec2{0, 0},
 	side1UV:  mgl32.Vec2{0, 0},
 	side2UV:  mgl32.Vec2{0, 0},
@@ -44,6 +81,7 @@ var blockDirtData = BlockData{
 // Sides use grass side texture (tile 1,0), top uses grass top texture (tile 2,0),
 // and bottom uses dirt texture (tile 0,0).
 var blockGrassData = BlockData{
+	name:     "grass",
 	side0UV:  mgl32.Vec2{1, 0},
 	side1UV:  mgl32.Vec2{1, 0},
 	side2UV:  mgl32.Vec2{1, 0},
@@ -55,6 +93,7 @@ var blockGrassData = BlockData{
 // blockStoneData defines the texture coordinates for a stone block.
 // All faces use the same stone texture (tile 3,0 in the atlas).
 var blockStoneData = BlockData{
+	name:     "stone",
 	side0UV:  mgl32.Vec2{3, 0},
 	side1UV:  mgl32.Vec2{3, 0},
 	side2UV:  mgl32.Vec2{3, 0},
@@ -63,6 +102,67 @@ var blockStoneData = BlockData{
 	bottomUV: mgl32.Vec2{3, 0},
 }
 
+// blockWaterData defines the texture coordinates for a water block.
+// All faces use the same water texture (tile 4,0 in the atlas).
+var blockWaterData = BlockData{
+	name:     "water",
+	side0UV:  mgl32.Vec2{4, 0},
+	side1UV:  mgl32.Vec2{4, 0},
+	side2UV:  mgl32.Vec2{4, 0},
+	side3UV:  mgl32.Vec2{4, 0},
+	topUV:    mgl32.Vec2{4, 0},
+	bottomUV: mgl32.Vec2{4, 0},
+}
+
+// blockCoalOreData defines the texture coordinates for coal ore.
+// All faces use the same coal ore texture (tile 8,0 in the atlas),
+// the stone texture with dark clusters like the other ore tiles.
+var blockCoalOreData = BlockData{
+	name:     "coal ore",
+	side0UV:  mgl32.Vec2{8, 0},
+	side1UV:  mgl32.Vec2{8, 0},
+	side2UV:  mgl32.Vec2{8, 0},
+	side3UV:  mgl32.Vec2{8, 0},
+	topUV:    mgl32.Vec2{8, 0},
+	bottomUV: mgl32.Vec2{8, 0},
+}
+
+// blockIronOreData defines the texture coordinates for iron ore.
+// All faces use the same iron ore texture (tile 9,0 in the atlas).
+var blockIronOreData = BlockData{
+	name:     "iron ore",
+	side0UV:  mgl32.Vec2{9, 0},
+	side1UV:  mgl32.Vec2{9, 0},
+	side2UV:  mgl32.Vec2{9, 0},
+	side3UV:  mgl32.Vec2{9, 0},
+	topUV:    mgl32.Vec2{9, 0},
+	bottomUV: mgl32.Vec2{9, 0},
+}
+
+// blockGoldOreData defines the texture coordinates for gold ore.
+// All faces use the same gold ore texture (tile 10,0 in the atlas).
+var blockGoldOreData = BlockData{
+	name:     "gold ore",
+	side0UV:  mgl32.Vec2{10, 0},
+	side1UV:  mgl32.Vec2{10, 0},
+	side2UV:  mgl32.Vec2{10, 0},
+	side3UV:  mgl32.Vec2{10, 0},
+	topUV:    mgl32.Vec2{10, 0},
+	bottomUV: mgl32.Vec2{10, 0},
+}
+
+// blockDiamondOreData defines the texture coordinates for diamond ore.
+// All faces use the same diamond ore texture (tile 11,0 in the atlas).
+var blockDiamondOreData = BlockData{
+	name:     "diamond ore",
+	side0UV:  mgl32.Vec2{11, 0},
+	side1UV:  mgl32.Vec2{11, 0},
+	side2UV:  mgl32.Vec2{11, 0},
+	side3UV:  mgl32.Vec2{11, 0},
+	topUV:    mgl32.Vec2{11, 0},
+	bottomUV: mgl32.Vec2{11, 0},
+}
+
 // blockData is a lookup map that associates block type IDs with their
 // corresponding BlockData. Note: BLOCK_AIR is intentionally omitted as
 // air blocks have no visual representation.
@@ -70,4 +170,37 @@ var blockData = map[int]BlockData{
 	BLOCK_DIRT:  blockDirtData,
 	BLOCK_GRASS: blockGrassData,
 	BLOCK_STONE: blockStoneData,
+	BLOCK_WATER: blockWaterData,
+
+	BLOCK_COAL_ORE:    blockCoalOreData,
+	BLOCK_IRON_ORE:    blockIronOreData,
+	BLOCK_GOLD_ORE:    blockGoldOreData,
+	BLOCK_DIAMOND_ORE: blockDiamondOreData,
+}
+
+// BlockName returns the display name of a block type.
+// blockID: Block type ID
+func BlockName(blockID int) string {
+	if blockID == BLOCK_AIR {
+		return "air"
+	}
+	if data, found := blockData[blockID]; found {
+		return data.name
+	}
+	return "unknown"
+}
+
+// BlockByName returns the type ID of the block with a display name.
+// Returns false if no block has that name.
+// name: Display name, such as "stone" or "air"
+func BlockByName(name string) (int, bool) {
+	if name == "air" {
+		return BLOCK_AIR, true
+	}
+	for blockID, data := range blockData {
+		if data.name == name {
+			return blockID, true
+		}
+	}
+	return 0, false
 }
@@ -0,0 +1,169 @@
+// Implements the feedback for the block the camera aims at: a crosshair in
+// the screen centre, a wireframe box slightly larger than the targeted block
+// with the face the camera ray hit outlined in a brighter color, and a HUD
+// line naming the block. The target is picked again every frame.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Block target constants.
+const (
+	TARGET_REACH           = 8.0   // Longest distance a block can be targeted from in blocks
+	TARGET_BOX_INFLATE     = 0.002 // Amount the outline box is larger than the block on each side
+	TARGET_FACE_INFLATE    = 0.004 // Amount the face outline sits in front of the face
+	CROSSHAIR_SIZE         = 10    // Length of the crosshair arms from the centre in pixels
+	CROSSHAIR_THICKNESS    = 2     // Width of the crosshair bars in pixels
+	CROSSHAIR_SCALE_HEIGHT = 1080  // Window height per crosshair scale step
+)
+
+// Colors of the target feedback.
+var (
+	TARGET_BOX_COLOR  = mgl32.Vec3{0.05, 0.05, 0.05} // Edges of the targeted block
+	TARGET_FACE_COLOR = mgl32.Vec3{1.0, 1.0, 1.0}    // Outline of the hit face
+	CROSSHAIR_COLOR   = mgl32.Vec3{1.0, 1.0, 1.0}    // Crosshair bars
+)
+
+// BlockTarget tracks and highlights the block the camera aims at.
+type BlockTarget struct {
+	hit            RaycastHit // Targeted block, valid if found is set
+	found          bool       // A block is within reach of the camera ray
+	lineMaterial   *Material  // World space lines
+	screenMaterial *Material  // Screen space triangles
+	outline        Mesh       // Box and face outline relative to the targeted block, rebuilt when the target changes
+	crosshair      Mesh       // Crosshair bars, rebuilt every frame
+}
+
+// Initialize looks up the materials of the outline and the crosshair.
+// materials: Library holding the "lines" and "screen" materials
+func (target *BlockTarget) Initialize(materials *MaterialLibrary) {
+	target.lineMaterial = materials.Material("lines")
+	target.screenMaterial = materials.Material("screen")
+}
+
+// Update casts the camera ray and rebuilds the outline if the target changed.
+// gameWorld: World the ray is cast into
+// camera: Camera the ray starts at
+func (target *BlockTarget) Update(gameWorld *GameWorld, camera *Camera) {
+	hit, found := gameWorld.Raycast(camera.position, camera.front, TARGET_REACH)
+	changed := found != target.found || hit.block != target.hit.block || hit.normal != target.hit.normal
+	target.hit, target.found = hit, found
+	if !changed || !found {
+		return
+	}
+
+	// The outline is built around the origin and moved to the block by RenderOutline
+	target.outline.vertices = target.outline.vertices[:0]
+	block := mgl32.Vec3{}
+	inflate := mgl32.Vec3{TARGET_BOX_INFLATE, TARGET_BOX_INFLATE, TARGET_BOX_INFLATE}
+	addBoxLines(&target.outline, block.Sub(inflate), block.Add(mgl32.Vec3{1.0, 1.0, 1.0}).Add(inflate), TARGET_BOX_COLOR)
+
+	// The hit face: the side of the block on the normal's axis, moved out along the normal
+	axis := -1
+	for i, component := range hit.normal {
+		if component != 0 {
+			axis = i
+		}
+	}
+	if axis >= 0 {
+		corners := [4]mgl32.Vec3{}
+		u, v := (axis+1)%3, (axis+2)%3
+		for i, offset := range [4][2]float32{{0, 0}, {1, 0}, {1, 1}, {0, 1}} {
+			corner := block
+			corner[u] += offset[0]
+			corner[v] += offset[1]
+			if hit.normal[axis] > 0 {
+				corner[axis] += 1.0 + TARGET_FACE_INFLATE
+			} else {
+				corner[axis] -= TARGET_FACE_INFLATE
+			}
+			corners[i] = corner
+		}
+		for i := range corners {
+			addLine(&target.outline, corners[i], corners[(i+1)%4], TARGET_FACE_COLOR)
+		}
+	}
+	target.outline.PrepareArrayData()
+	target.outline.UpdateVAO()
+}
+
+// Describe names the targeted block for the HUD.
+func (target *BlockTarget) Describe() string {
+	if !target.found {
+		return "Target none"
+	}
+	hit := target.hit
+	return fmt.Sprintf("Target %s (%d) at %s, face %s, %.1f blocks",
+		BlockName(hit.blockID), hit.blockID, hit.block, normalName(hit.normal), hit.distance)
+}
+
+// RenderOutline draws the outline of the targeted block into the scene.
+// loop: Game loop providing the material setup
+func (target *BlockTarget) RenderOutline(loop *GameLoop) {
+	if !target.found {
+		return
+	}
+	loop.UseMaterialAt(target.lineMaterial, target.hit.block.Vec3())
+	target.outline.RenderLines()
+}
+
+// RenderCrosshair draws the crosshair in the centre of the current framebuffer.
+// loop: Game loop providing the material setup and window size
+func (target *BlockTarget) RenderCrosshair(loop *GameLoop) {
+	width, height := loop.window.width, loop.window.height
+	scale := max(1, height/CROSSHAIR_SCALE_HEIGHT+1)
+	size, thickness := CROSSHAIR_SIZE*scale, CROSSHAIR_THICKNESS*scale
+	centerX, centerY := width/2, height/2
+
+	target.crosshair.vertices = target.crosshair.vertices[:0]
+	left, top := centerX-thickness/2, centerY-thickness/2
+	addScreenRect(&target.crosshair, centerX-size, top, centerX+size, top+thickness, width, height, CROSSHAIR_COLOR)
+	addScreenRect(&target.crosshair, left, centerY-size, left+thickness, centerY+size, width, height, CROSSHAIR_COLOR)
+	target.crosshair.PrepareArrayData()
+	target.crosshair.UpdateVAO()
+
+	loop.UseMaterial(target.screenMaterial)
+	target.crosshair.Render()
+}
+
+// addBoxLines appends the twelve edges of an axis-aligned box to a line mesh.
+// mesh: Line mesh
+// low, high: Opposite corners of the box
+// color: Line color
+func addBoxLines(mesh *Mesh, low, high, color mgl32.Vec3) {
+	corner := func(i int) mgl32.Vec3 {
+		result := low
+		for axis := range 3 {
+			if i&(1<<axis) != 0 {
+				result[axis] = high[axis]
+			}
+		}
+		return result
+	}
+
+	// Corners are numbered by the axes they are high on; edges join corners one bit apart
+	for i := range 8 {
+		for axis := range 3 {
+			if i&(1<<axis) == 0 {
+				addLine(mesh, corner(i), corner(i|1<<axis), color)
+			}
+		}
+	}
+}
+
+// normalName names a face normal, such as "+Y", or "inside" for the zero normal.
+func normalName(normal [3]int) string {
+	for axis, component := range normal {
+		switch {
+		case component > 0:
+			return "+" + string(rune('X'+axis))
+		case component < 0:
+			return "-" + string(rune('X'+axis))
+		}
+	}
+	return "inside"
+}
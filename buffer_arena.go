@@ -0,0 +1,350 @@
+// Implements a shared vertex buffer arena for chunk meshes.
+// All chunk meshes live in one large vertex buffer. An ArenaAllocator hands out
+// ranges of it from a free list, and the BufferArena draws the visible ranges
+// with one multi-draw call per model matrix instead of binding a buffer per
+// chunk. Chunks of the same render region share a model matrix, so a frame
+// needs a few dozen calls rather than one per chunk.
+// When the free space becomes too fragmented (or runs out) the live ranges are
+// compacted into a new buffer on the GPU.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// MESH_VERTEX_FLOATS is the number of float32 values of one interleaved vertex.
+const MESH_VERTEX_FLOATS = 11
+
+// ArenaBlock is a range of vertices reserved in an arena.
+// Its offset changes when the arena is compacted.
+type ArenaBlock struct {
+	offset int // First vertex of the range
+	count  int // Number of vertices in the range
+}
+
+// ArenaRange is a range of free vertices.
+type ArenaRange struct {
+	offset int // First vertex of the range
+	count  int // Number of vertices in the range
+}
+
+// ArenaBatch is a group of queued ranges drawn with the same model matrix.
+type ArenaBatch struct {
+	model  mgl32.Mat4 // Model matrix of the ranges
+	firsts []int32    // First vertex of each queued range
+	counts []int32    // Vertex count of each queued range
+}
+
+// ArenaMove describes a range that has to be copied when the arena is compacted.
+type ArenaMove struct {
+	from  int // First vertex in the old layout
+	to    int // First vertex in the new layout
+	count int // Number of vertices to copy
+}
+
+// ArenaStats summarizes the usage of an arena.
+type ArenaStats struct {
+	capacity    int // Total number of vertices
+	used        int // Vertices in live blocks
+	blocks      int // Number of live blocks
+	freeRanges  int // Number of separate free ranges
+	largestFree int // Vertices in the largest free range
+	draws       int // Ranges submitted by the last draw
+	batches     int // Multi-draw calls of the last draw (one per model matrix)
+	drawn       int // Vertices submitted by the last draw
+	grows       int // Number of times the buffer was enlarged
+	compactions int // Number of times the buffer was compacted (including grows)
+}
+
+// ArenaAllocator manages the ranges of an arena without touching OpenGL.
+// Free ranges are kept sorted by offset and merged with their neighbours.
+type ArenaAllocator struct {
+	capacity int                  // Total number of vertices
+	free     []ArenaRange         // Free ranges sorted by offset
+	blocks   map[*ArenaBlock]bool // Live blocks
+	used     int                  // Vertices in live blocks
+}
+
+// Initialize creates an empty allocator.
+// capacity: Total number of vertices
+func (allocator *ArenaAllocator) Initialize(capacity int) {
+	allocator.capacity = capacity
+	allocator.free = []ArenaRange{{0, capacity}}
+	allocator.blocks = make(map[*ArenaBlock]bool)
+	allocator.used = 0
+}
+
+// Allocate reserves a range of vertices using the smallest free range that fits.
+// count: Number of vertices (must be positive)
+// Returns nil if no free range is large enough.
+func (allocator *ArenaAllocator) Allocate(count int) *ArenaBlock {
+	best := -1
+	for i, free := range allocator.free {
+		if free.count >= count && (best < 0 || free.count < allocator.free[best].count) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+
+	// Take the start of the free range, drop the range if nothing is left
+	block := &ArenaBlock{allocator.free[best].offset, count}
+	allocator.free[best].offset += count
+	allocator.free[best].count -= count
+	if allocator.free[best].count == 0 {
+		allocator.free = append(allocator.free[:best], allocator.free[best+1:]...)
+	}
+
+	allocator.blocks[block] = true
+	allocator.used += count
+	return block
+}
+
+// Free returns a block's range to the free list, merging it with adjacent free ranges.
+// block: Block returned by Allocate (nil is ignored)
+func (allocator *ArenaAllocator) Free(block *ArenaBlock) {
+	if block == nil || !allocator.blocks[block] {
+		return
+	}
+	delete(allocator.blocks, block)
+	allocator.used -= block.count
+
+	// Insert at the sorted position
+	index := sort.Search(len(allocator.free), func(i int) bool {
+		return allocator.free[i].offset > block.offset
+	})
+	allocator.free = append(allocator.free, ArenaRange{})
+	copy(allocator.free[index+1:], allocator.free[index:])
+	allocator.free[index] = ArenaRange{block.offset, block.count}
+
+	// Merge with the following range, then with the preceding one
+	if index+1 < len(allocator.free) && allocator.free[index].offset+allocator.free[index].count == allocator.free[index+1].offset {
+		allocator.free[index].count += allocator.free[index+1].count
+		allocator.free = append(allocator.free[:index+1], allocator.free[index+2:]...)
+	}
+	if index > 0 && allocator.free[index-1].offset+allocator.free[index-1].count == allocator.free[index].offset {
+		allocator.free[index-1].count += allocator.free[index].count
+		allocator.free = append(allocator.free[:index], allocator.free[index+1:]...)
+	}
+}
+
+// Compact moves all live blocks to the start of the arena, in their current order,
+// leaving one free range at the end. The capacity may be changed at the same time.
+// capacity: New total number of vertices (at least the used count)
+// Returns the copies needed to move the data, with adjacent copies merged.
+func (allocator *ArenaAllocator) Compact(capacity int) []ArenaMove {
+	blocks := make([]*ArenaBlock, 0, len(allocator.blocks))
+	for block := range allocator.blocks {
+		blocks = append(blocks, block)
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].offset < blocks[j].offset
+	})
+
+	moves := []ArenaMove{}
+	offset := 0
+	for _, block := range blocks {
+		last := len(moves) - 1
+		if last >= 0 && moves[last].from+moves[last].count == block.offset && moves[last].to+moves[last].count == offset {
+			moves[last].count += block.count
+		} else {
+			moves = append(moves, ArenaMove{block.offset, offset, block.count})
+		}
+		block.offset = offset
+		offset += block.count
+	}
+
+	allocator.capacity = capacity
+	allocator.free = allocator.free[:0]
+	if offset < capacity {
+		allocator.free = append(allocator.free, ArenaRange{offset, capacity - offset})
+	}
+	return moves
+}
+
+// Stats returns the current usage of the allocator.
+func (allocator *ArenaAllocator) Stats() ArenaStats {
+	stats := ArenaStats{
+		capacity:   allocator.capacity,
+		used:       allocator.used,
+		blocks:     len(allocator.blocks),
+		freeRanges: len(allocator.free),
+	}
+	for _, free := range allocator.free {
+		stats.largestFree = max(stats.largestFree, free.count)
+	}
+	return stats
+}
+
+// Fragmentation returns the share of free space outside the largest free range (0 to 1).
+func (stats ArenaStats) Fragmentation() float64 {
+	free := stats.capacity - stats.used
+	if free == 0 {
+		return 0.0
+	}
+	return 1.0 - float64(stats.largestFree)/float64(free)
+}
+
+// String formats the statistics for the "arena" command.
+func (stats ArenaStats) String() string {
+	return fmt.Sprintf(
+		"%d of %d vertices used (%.1f of %.1f MiB), %d blocks, %d free ranges, %.0f%% fragmented, %d draw ranges in %d batches (%d vertices), %d grows, %d compactions",
+		stats.used, stats.capacity,
+		float64(stats.used*MESH_VERTEX_FLOATS*4)/(1<<20), float64(stats.capacity*MESH_VERTEX_FLOATS*4)/(1<<20),
+		stats.blocks, stats.freeRanges, stats.Fragmentation()*100.0, stats.draws, stats.batches, stats.drawn, stats.grows, stats.compactions,
+	)
+}
+
+// BufferArena is one vertex buffer shared by many meshes.
+// Must only be used from the main thread.
+type BufferArena struct {
+	allocator   ArenaAllocator     // Bookkeeping of the buffer's ranges
+	buffer      VertexBuffer       // Vertex buffer holding all meshes
+	batches     []ArenaBatch       // Batches of the queued ranges in order of their first range, reused across frames
+	batchCount  int                // Batches in use since the last Draw
+	batchIndex  map[mgl32.Mat4]int // Batch of each model matrix queued since the last Draw
+	current     int                // Batch receiving the ranges of AddDraw
+	draws       int                // Ranges submitted by the last Draw
+	calls       int                // Multi-draw calls issued by the last Draw
+	drawn       int                // Vertices submitted by the last Draw
+	grows       int                // Number of times the buffer was enlarged
+	compactions int                // Number of times the buffer was compacted
+}
+
+// Initialize creates the buffer.
+// capacity: Initial number of vertices, the buffer grows when it is full
+func (arena *BufferArena) Initialize(capacity int) {
+	arena.allocator.Initialize(capacity)
+	arena.buffer = renderBackend.CreateVertexBuffer(capacity)
+	arena.batchIndex = make(map[mgl32.Mat4]int)
+}
+
+// Store uploads vertex data into the arena, replacing a previously stored block.
+// block: Block holding the previous data (nil if there is none), freed by this call
+// arrayData: Interleaved vertex data as produced by Mesh.PrepareArrayData
+// Returns the block holding the new data, nil for empty data.
+func (arena *BufferArena) Store(block *ArenaBlock, arrayData []float32) *ArenaBlock {
+	arena.allocator.Free(block)
+
+	count := len(arrayData) / MESH_VERTEX_FLOATS
+	if count == 0 {
+		return nil
+	}
+
+	block = arena.allocator.Allocate(count)
+	if block == nil {
+		arena.makeRoom(count)
+		block = arena.allocator.Allocate(count)
+	}
+
+	renderBackend.WriteVertices(arena.buffer, block.offset, arrayData)
+	return block
+}
+
+// makeRoom compacts the arena so a range of count vertices fits, doubling the
+// buffer as often as needed when the total free space is too small.
+// count: Number of vertices that must fit afterwards
+func (arena *BufferArena) makeRoom(count int) {
+	capacity := arena.allocator.capacity
+	for capacity-arena.allocator.used < count {
+		capacity *= 2
+	}
+	if capacity != arena.allocator.capacity {
+		arena.grows++
+	}
+	arena.Compact(capacity)
+}
+
+// Compact copies all live blocks back to back into a new buffer of the given size.
+// capacity: Number of vertices of the new buffer
+func (arena *BufferArena) Compact(capacity int) {
+	moves := arena.allocator.Compact(capacity)
+	buffer := renderBackend.CreateVertexBuffer(capacity)
+	renderBackend.CopyVertices(arena.buffer, buffer, moves)
+	renderBackend.DeleteVertexBuffer(arena.buffer)
+	arena.buffer = buffer
+	arena.compactions++
+}
+
+// BeginBatch selects the batch of a model matrix for the following ranges,
+// starting a new batch if no range was queued with it since the last Draw.
+// Ranges queued by AddDraw belong to the last batch selected.
+// model: Model matrix of the following ranges
+func (arena *BufferArena) BeginBatch(model mgl32.Mat4) {
+	if index, found := arena.batchIndex[model]; found {
+		arena.current = index
+		return
+	}
+
+	// Reuse the slices of a batch from an earlier frame
+	if arena.batchCount == len(arena.batches) {
+		arena.batches = append(arena.batches, ArenaBatch{})
+	}
+	batch := &arena.batches[arena.batchCount]
+	batch.model = model
+	batch.firsts = batch.firsts[:0]
+	batch.counts = batch.counts[:0]
+
+	arena.current = arena.batchCount
+	arena.batchIndex[model] = arena.batchCount
+	arena.batchCount++
+}
+
+// AddDraw queues a range of a block for the next Draw, in the current batch.
+// Ranges that continue the previously queued range of the batch are merged into it.
+// block: Block containing the range
+// first: First vertex relative to the block
+// count: Number of vertices
+func (arena *BufferArena) AddDraw(block *ArenaBlock, first, count int) {
+	batch := &arena.batches[arena.current]
+	start := int32(block.offset + first)
+	last := len(batch.firsts) - 1
+	if last >= 0 && batch.firsts[last]+batch.counts[last] == start {
+		batch.counts[last] += int32(count)
+		return
+	}
+	batch.firsts = append(batch.firsts, start)
+	batch.counts = append(batch.counts, int32(count))
+}
+
+// Draw renders all queued ranges as triangles, one glMultiDrawArrays call per
+// batch after uploading the batch's model matrix, and clears the queue.
+// shader: Active shader program receiving the "model" uniform
+func (arena *BufferArena) Draw(shader *Shader) {
+	arena.draws = 0
+	arena.calls = 0
+	arena.drawn = 0
+	for i := range arena.batchCount {
+		batch := &arena.batches[i]
+		if len(batch.firsts) == 0 {
+			continue
+		}
+		for _, count := range batch.counts {
+			arena.drawn += int(count)
+		}
+		arena.draws += len(batch.firsts)
+
+		shader.UniformSetMat4("model", &batch.model)
+		renderBackend.MultiDrawTriangles(arena.buffer, batch.firsts, batch.counts)
+		arena.calls++
+	}
+
+	arena.batchCount = 0
+	clear(arena.batchIndex)
+}
+
+// Stats returns the usage of the arena and the size of the last draw.
+func (arena *BufferArena) Stats() ArenaStats {
+	stats := arena.allocator.Stats()
+	stats.draws = arena.draws
+	stats.batches = arena.calls
+	stats.drawn = arena.drawn
+	stats.grows = arena.grows
+	stats.compactions = arena.compactions
+	return stats
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// arenaStep is one allocation or free in an allocator test.
+type arenaStep struct {
+	allocate string // Name of the block to allocate ("" frees instead)
+	free     string // Name of the block to free
+	count    int    // Vertices to allocate
+	offset   int    // Expected offset of the allocated block (-1 when nothing fits)
+}
+
+// TestArenaAllocator runs allocations and frees in mixed orders and checks
+// the offsets handed out and the free list left behind.
+func TestArenaAllocator(t *testing.T) {
+	cases := []struct {
+		name  string       // Description of the case
+		steps []arenaStep  // Operations on an allocator of 100 vertices
+		free  []ArenaRange // Expected free list afterwards
+		used  int          // Expected vertices in live blocks
+	}{
+		{
+			"merge with both neighbours",
+			[]arenaStep{
+				{allocate: "a", count: 10, offset: 0},
+				{allocate: "b", count: 10, offset: 10},
+				{allocate: "c", count: 10, offset: 20},
+				{free: "a"},
+				{free: "c"},
+				{free: "b"},
+			},
+			[]ArenaRange{{0, 100}},
+			0,
+		},
+		{
+			"merge with the following range",
+			[]arenaStep{
+				{allocate: "a", count: 10, offset: 0},
+				{allocate: "b", count: 10, offset: 10},
+				{free: "b"},
+			},
+			[]ArenaRange{{10, 90}},
+			10,
+		},
+		{
+			"merge with the preceding range",
+			[]arenaStep{
+				{allocate: "a", count: 10, offset: 0},
+				{allocate: "b", count: 10, offset: 10},
+				{allocate: "c", count: 80, offset: 20},
+				{free: "a"},
+				{free: "b"},
+			},
+			[]ArenaRange{{0, 20}},
+			80,
+		},
+		{
+			"free between live blocks",
+			[]arenaStep{
+				{allocate: "a", count: 10, offset: 0},
+				{allocate: "b", count: 10, offset: 10},
+				{allocate: "c", count: 10, offset: 20},
+				{free: "b"},
+			},
+			[]ArenaRange{{10, 10}, {30, 70}},
+			20,
+		},
+		{
+			"smallest free range that fits",
+			[]arenaStep{
+				{allocate: "a", count: 10, offset: 0},
+				{allocate: "b", count: 20, offset: 10},
+				{allocate: "c", count: 10, offset: 30},
+				{allocate: "d", count: 10, offset: 40},
+				{free: "d"},
+				{free: "b"},
+				{allocate: "e", count: 15, offset: 10},
+				{allocate: "f", count: 50, offset: 40},
+				{allocate: "g", count: 20, offset: -1},
+			},
+			[]ArenaRange{{25, 5}, {90, 10}},
+			85,
+		},
+		{
+			"exact fit and double free",
+			[]arenaStep{
+				{allocate: "a", count: 100, offset: 0},
+				{allocate: "b", count: 1, offset: -1},
+				{free: "a"},
+				{free: "a"},
+				{free: "b"},
+			},
+			[]ArenaRange{{0, 100}},
+			0,
+		},
+	}
+
+	for _, testCase := range cases {
+		allocator := ArenaAllocator{}
+		allocator.Initialize(100)
+		blocks := map[string]*ArenaBlock{}
+		for i, step := range testCase.steps {
+			if step.allocate == "" {
+				allocator.Free(blocks[step.free])
+				continue
+			}
+			block := allocator.Allocate(step.count)
+			blocks[step.allocate] = block
+			switch {
+			case step.offset < 0 && block != nil:
+				t.Errorf("%s: step %d got %v, expected no space", testCase.name, i, *block)
+			case step.offset >= 0 && block == nil:
+				t.Errorf("%s: step %d found no space, expected offset %d", testCase.name, i, step.offset)
+			case block != nil && (block.offset != step.offset || block.count != step.count):
+				t.Errorf("%s: step %d got %v, expected %d at %d", testCase.name, i, *block, step.count, step.offset)
+			}
+		}
+		if !slices.Equal(allocator.free, testCase.free) {
+			t.Errorf("%s: free ranges %v, expected %v", testCase.name, allocator.free, testCase.free)
+		}
+		if stats := allocator.Stats(); stats.used != testCase.used {
+			t.Errorf("%s: %d vertices used, expected %d", testCase.name, stats.used, testCase.used)
+		}
+	}
+}
+
+// TestArenaAllocatorCompact frees blocks in between, compacts into the same
+// and into a larger capacity and checks that every live range keeps its data.
+func TestArenaAllocatorCompact(t *testing.T) {
+	allocator := ArenaAllocator{}
+	allocator.Initialize(100)
+	buffer := make([]int, 100)
+	blocks := []*ArenaBlock{}
+	for i, count := range []int{10, 5, 20, 5, 30, 10} {
+		block := allocator.Allocate(count)
+		for vertex := range count {
+			buffer[block.offset+vertex] = i + 1
+		}
+		blocks = append(blocks, block)
+	}
+	allocator.Free(blocks[0])
+	allocator.Free(blocks[3])
+	blocks[0], blocks[3] = nil, nil
+
+	// Apply the moves like CopyVertices does, from the old buffer into a new one
+	compact := func(capacity int) []ArenaMove {
+		moves := allocator.Compact(capacity)
+		compacted := make([]int, capacity)
+		for _, move := range moves {
+			copy(compacted[move.to:move.to+move.count], buffer[move.from:move.from+move.count])
+		}
+		buffer = compacted
+		return moves
+	}
+	check := func(stage string) {
+		for i, block := range blocks {
+			if block == nil {
+				continue
+			}
+			for vertex := range block.count {
+				if buffer[block.offset+vertex] != i+1 {
+					t.Fatalf("%s: block %d lost its data at vertex %d", stage, i, vertex)
+				}
+			}
+		}
+	}
+
+	// Blocks 1 and 2 move together, as do 4 and 5
+	moves := compact(100)
+	if expected := []ArenaMove{{10, 0, 25}, {40, 25, 40}}; !slices.Equal(moves, expected) {
+		t.Errorf("moves %v, expected %v", moves, expected)
+	}
+	if expected := []ArenaRange{{65, 35}}; !slices.Equal(allocator.free, expected) {
+		t.Errorf("free ranges %v after compacting, expected %v", allocator.free, expected)
+	}
+	check("compact")
+
+	// Growing keeps the packed blocks in place and frees the new space
+	moves = compact(200)
+	if expected := []ArenaMove{{0, 0, 65}}; !slices.Equal(moves, expected) {
+		t.Errorf("moves %v when growing, expected %v", moves, expected)
+	}
+	if stats := allocator.Stats(); stats.capacity != 200 || stats.used != 65 || stats.largestFree != 135 || stats.Fragmentation() != 0 {
+		t.Errorf("stats %+v after growing", stats)
+	}
+	check("grow")
+	if block := allocator.Allocate(135); block == nil || block.offset != 65 {
+		t.Errorf("allocation after growing got %v, expected 135 at 65", block)
+	}
+	if len(allocator.free) != 0 {
+		t.Errorf("free ranges %v in a full arena", allocator.free)
+	}
+}
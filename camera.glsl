@@ -0,0 +1,12 @@
+// Per-frame camera data shared by all programs (see uniforms.go).
+// Rendering is camera-relative: model matrices place meshes relative to the
+// camera and the view matrix only rotates.
+#pragma once
+
+layout(std140) uniform Camera {
+    mat4 projection;
+    mat4 view;
+    mat4 skyInverseViewProjection; // Inverse of projection * camera rotation
+    vec4 cameraPosition; // xyz = camera position in render space (the origin)
+    vec4 cameraClip; // x = near, y = far
+};
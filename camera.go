@@ -1,5 +1,7 @@
 // A first-person camera system.
 // The Camera struct provides FPS-style movement with mouse look and keyboard controls.
+// The position is kept in float64 so the camera moves smoothly far from the
+// world origin; rendering happens relative to it (see RelativePosition).
 package main
 
 import (
@@ -7,12 +9,13 @@ import (
 
 	"github.com/go-gl/glfw/v3.3/glfw"
 	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
 )
 
 // Camera represents a first-person camera in 3D space.
 // It maintains position, orientation, and movement parameters for navigation.
 type Camera struct {
-	position         mgl32.Vec3 // Current camera position in world space
+	position         mgl64.Vec3 // Current camera position in world space
 	front            mgl32.Vec3 // Forward direction vector (normalized)
 	up               mgl32.Vec3 // Up direction vector (normalized)
 	right            mgl32.Vec3 // Right direction vector (normalized)
@@ -27,7 +30,7 @@ type Camera struct {
 // InitializeDefaultValues sets up the camera with standard starting values.
 // This includes position above ground (Y=60), looking north, with default speeds.
 func (camera *Camera) InitializeDefaultValues() {
-	camera.position = mgl32.Vec3{0.0, 60.0, 0.0}
+	camera.position = mgl64.Vec3{0.0, 60.0, 0.0}
 	camera.front = mgl32.Vec3{0.0, 0.0, 1.0}
 	camera.up = mgl32.Vec3{0.0, 1.0, 0.0}
 	camera.right = mgl32.Vec3{-1.0, 0.0, 0.0}
@@ -65,11 +68,48 @@ func (camera *Camera) UpdateCameraVectors() {
 	camera.up = camera.right.Cross(camera.front).Normalize()
 }
 
+// LookAlong points the camera in a direction with a given up vector, which
+// also works straight up or down where yaw and pitch cannot express the roll.
+// Yaw and pitch are left unchanged; the next mouse movement returns to them.
+// front: Viewing direction (normalized)
+// up: Direction that is up on screen, perpendicular to front (normalized)
+func (camera *Camera) LookAlong(front, up mgl32.Vec3) {
+	camera.front = front
+	camera.up = up
+	camera.right = front.Cross(up).Normalize()
+}
+
 // GetViewMatrix constructs and returns a view matrix for rendering.
-// This matrix transforms world coordinates to camera/view space.
+// Rendering is camera-relative: the matrix only rotates, it transforms
+// positions relative to the camera (see RelativePosition) to view space.
 func (camera *Camera) GetViewMatrix() mgl32.Mat4 {
-	// LookAt creates a view matrix looking from position to position+front
-	return mgl32.LookAtV(camera.position, camera.position.Add(camera.front), camera.up)
+	// LookAt creates a view matrix looking from the origin along front
+	return mgl32.LookAtV(mgl32.Vec3{}, camera.front, camera.up)
+}
+
+// RelativePosition converts a world position to the camera-relative space
+// everything is rendered in. The difference is taken in float64, so nearby
+// positions stay exact in float32 however far the camera is from the origin.
+// position: Position in world space
+func (camera *Camera) RelativePosition(position mgl64.Vec3) mgl32.Vec3 {
+	return vec3To32(position.Sub(camera.position))
+}
+
+// ModelMatrix returns the model matrix of a mesh whose vertices are relative
+// to a world position, such as a chunk mesh relative to the chunk origin.
+// origin: World position of the mesh origin
+func (camera *Camera) ModelMatrix(origin mgl64.Vec3) mgl32.Mat4 {
+	return mgl32.Translate3D(camera.RelativePosition(origin).Elem())
+}
+
+// vec3To64 widens a vector to float64.
+func vec3To64(vector mgl32.Vec3) mgl64.Vec3 {
+	return mgl64.Vec3{float64(vector[0]), float64(vector[1]), float64(vector[2])}
+}
+
+// vec3To32 narrows a vector to float32.
+func vec3To32(vector mgl64.Vec3) mgl32.Vec3 {
+	return mgl32.Vec3{float32(vector[0]), float32(vector[1]), float32(vector[2])}
 }
 
 // ProcessMouseMovement updates camera orientation based on mouse input.
@@ -100,36 +140,42 @@ func (camera *Camera) ProcessMouseMovement(xpos, ypos float64) {
 // Uses WASD for horizontal movement, Space/Control for vertical movement.
 // deltaTime: Time since last frame (in seconds) for frame-rate independent movement.
 func (camera *Camera) ProcessKeyboard(window *Window, deltaTime float64) {
+	// Headless runs have no window to read keys from
+	if window.windowObj == nil {
+		return
+	}
+
 	// Calculate movement distance for this frame
-	velocity := camera.movementSpeed * float32(deltaTime)
+	velocity := float64(camera.movementSpeed) * deltaTime
+	front, right, up := vec3To64(camera.front), vec3To64(camera.right), vec3To64(camera.up)
 
 	// Forward movement (W key)
 	if window.windowObj.GetKey(glfw.KeyW) == glfw.Press {
-		camera.position = camera.position.Add(camera.front.Mul(velocity))
+		camera.position = camera.position.Add(front.Mul(velocity))
 	}
 
 	// Backward movement (S key)
 	if window.windowObj.GetKey(glfw.KeyS) == glfw.Press {
-		camera.position = camera.position.Add(camera.front.Mul(-velocity))
+		camera.position = camera.position.Add(front.Mul(-velocity))
 	}
 
 	// Left strafe (A key)
 	if window.windowObj.GetKey(glfw.KeyA) == glfw.Press {
-		camera.position = camera.position.Add(camera.right.Mul(-velocity))
+		camera.position = camera.position.Add(right.Mul(-velocity))
 	}
 
 	// Right strafe (D key)
 	if window.windowObj.GetKey(glfw.KeyD) == glfw.Press {
-		camera.position = camera.position.Add(camera.right.Mul(velocity))
+		camera.position = camera.position.Add(right.Mul(velocity))
 	}
 
 	// Ascend (Space key)
 	if window.windowObj.GetKey(glfw.KeySpace) == glfw.Press {
-		camera.position = camera.position.Add(camera.up.Mul(velocity))
+		camera.position = camera.position.Add(up.Mul(velocity))
 	}
 
 	// Descend (Left Control key)
 	if window.windowObj.GetKey(glfw.KeyLeftControl) == glfw.Press {
-		camera.position = camera.position.Add(camera.up.Mul(-velocity))
+		camera.position = camera.position.Add(up.Mul(-velocity))
 	}
 }
@@ -0,0 +1,344 @@
+// Implements screenshots and off-screen captures.
+// F2 (or the "screenshot" command) reads the finished frame back and saves it
+// as a timestamped PNG. Started with -capture or -panorama, the game renders a
+// seed and camera pose into framebuffers of a headless OpenGL context (see
+// headless_context.go) without opening a window, waits until the world around
+// the camera has loaded, and writes a screenshot and/or the six faces of a
+// cubemap panorama. The images are reproducible, which makes them suitable for
+// documentation and bug reports.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// Capture constants.
+const (
+	SCREENSHOT_DIRECTORY   = "screenshots"         // Directory screenshots are saved to
+	SCREENSHOT_TIME_FORMAT = "2006-01-02_15.04.05" // File name of a screenshot (time layout)
+	CAPTURE_SETTLE_TIMEOUT = 5 * time.Minute       // Longest wait for the world around the camera to load
+	CAPTURE_DEFAULT_CAMERA = "0,75,0,275,-15"      // Camera pose of captures if none is given
+)
+
+// CameraPose is a camera position and viewing direction.
+type CameraPose struct {
+	position mgl64.Vec3 // Camera position in world space
+	yaw      float32    // Camera yaw in degrees
+	pitch    float32    // Camera pitch in degrees
+}
+
+// CubeFace is one face of a cubemap panorama.
+type CubeFace struct {
+	name  string     // File suffix, "px" for positive X and so on
+	front mgl32.Vec3 // Direction the camera looks in
+	up    mgl32.Vec3 // Direction that is up in the image
+}
+
+// cubeFaces lists the panorama faces. Side faces are upright; the top face has
+// its bottom edge and the bottom face its top edge towards +Z, so the faces
+// line up in the cross layout of PanoramaCross.
+var cubeFaces = [6]CubeFace{
+	{"px", mgl32.Vec3{1.0, 0.0, 0.0}, mgl32.Vec3{0.0, 1.0, 0.0}},
+	{"nx", mgl32.Vec3{-1.0, 0.0, 0.0}, mgl32.Vec3{0.0, 1.0, 0.0}},
+	{"py", mgl32.Vec3{0.0, 1.0, 0.0}, mgl32.Vec3{0.0, 0.0, -1.0}},
+	{"ny", mgl32.Vec3{0.0, -1.0, 0.0}, mgl32.Vec3{0.0, 0.0, 1.0}},
+	{"pz", mgl32.Vec3{0.0, 0.0, 1.0}, mgl32.Vec3{0.0, 1.0, 0.0}},
+	{"nz", mgl32.Vec3{0.0, 0.0, -1.0}, mgl32.Vec3{0.0, 1.0, 0.0}},
+}
+
+// panoramaCrossCells places the faces (indices into cubeFaces) on a 4x3 grid,
+// -1 leaves a cell empty. The middle row turns right from +X.
+var panoramaCrossCells = [3][4]int{
+	{-1, 2, -1, -1},
+	{0, 4, 1, 5},
+	{-1, 3, -1, -1},
+}
+
+// CaptureOptions configures an off-screen capture run.
+type CaptureOptions struct {
+	seed           int64      // Seed of the generated world
+	pose           CameraPose // Camera position and direction
+	timeOfDay      float64    // World time in ticks, the clock is frozen
+	width, height  int        // Size of the screenshot in pixels
+	renderDistance int        // Render distance in chunks (0 keeps the default)
+	buildLimits    [2]int     // Lower and upper build limit of the world (both 0 keep the defaults)
+	screenshotFile string     // PNG file the screenshot is written to ("" for none)
+	panoramaPrefix string     // Path prefix of the panorama files ("" for none)
+	panoramaSize   int        // Edge length of the panorama faces in pixels
+}
+
+// ParseCameraPose parses "x,y,z" or "x,y,z,yaw,pitch" (degrees).
+func ParseCameraPose(text string) (CameraPose, error) {
+	fields := strings.Split(text, ",")
+	if len(fields) != 3 && len(fields) != 5 {
+		return CameraPose{}, fmt.Errorf("camera pose %q: expected x,y,z or x,y,z,yaw,pitch", text)
+	}
+
+	values := make([]float64, len(fields))
+	for i, field := range fields {
+		value, err := parseFiniteFloat(strings.TrimSpace(field))
+		if err != nil {
+			return CameraPose{}, fmt.Errorf("camera pose %q: invalid number %q", text, field)
+		}
+		values[i] = value
+	}
+
+	pose := CameraPose{position: mgl64.Vec3{values[0], values[1], values[2]}}
+	if len(values) == 5 {
+		pose.yaw, pose.pitch = float32(values[3]), float32(values[4])
+	}
+	if math.IsInf(float64(pose.yaw), 0) {
+		return CameraPose{}, fmt.Errorf("camera pose %q: yaw out of range", text)
+	}
+	if pose.pitch < -89.0 || pose.pitch > 89.0 {
+		return CameraPose{}, fmt.Errorf("camera pose %q: pitch must be between -89 and 89", text)
+	}
+	return pose, nil
+}
+
+// ParseTimeOfDay parses a time in ticks or one of the names of the "time set" command.
+func ParseTimeOfDay(text string) (float64, error) {
+	if ticks, named := worldTimeNames[text]; named {
+		return ticks, nil
+	}
+	ticks, err := parseFiniteFloat(text)
+	if err != nil {
+		return 0.0, fmt.Errorf("invalid time of day %q", text)
+	}
+	return ticks, nil
+}
+
+// ParseImageSize parses "<width>x<height>".
+func ParseImageSize(text string) (int, int, error) {
+	var width, height int
+	if _, err := fmt.Sscanf(text, "%dx%d", &width, &height); err != nil || width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid image size %q, expected e.g. 1280x720", text)
+	}
+	return width, height, nil
+}
+
+// ApplyCameraPose moves the camera and stops the clock at a time of day.
+// The camera goroutine is told about the new position at once, so it does
+// not start loading around the old one.
+// pose: Camera position and direction
+// timeOfDay: World time in ticks
+func (loop *GameLoop) ApplyCameraPose(pose CameraPose, timeOfDay float64) {
+	loop.camera.position = pose.position
+	loop.camera.yaw = pose.yaw
+	loop.camera.pitch = pose.pitch
+	loop.camera.UpdateCameraVectors()
+	loop.gameWorld.SyncCameraRoutine()
+	loop.gameWorld.time.Set(timeOfDay)
+	loop.gameWorld.time.frozen = true
+	loop.animations.Reset()
+}
+
+// RenderSettledFrame advances the world until the area around the camera has
+// settled (see GameWorld.Settled), then renders the frame to capture into the
+// bound framebuffer. Nothing is drawn while waiting, frames can be slow on
+// software OpenGL and the world only needs its ticks.
+// timeout: Longest time to wait for the world
+// afterFrame: Called after each rendered frame, e.g. to drop recorded calls (may be nil)
+func (loop *GameLoop) RenderSettledFrame(timeout time.Duration, afterFrame func()) error {
+	// Tick so generated chunks are picked up, fluids flow and changed chunks are remeshed
+	deadline := time.Now().Add(timeout)
+	for !loop.gameWorld.Settled() {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("world did not settle within %v", timeout)
+		}
+		loop.gameWorld.Update(1.0 / WORLD_TICK_RATE)
+		time.Sleep(time.Millisecond)
+	}
+
+	// One frame uploads the finished meshes, the frame after it is the picture
+	loop.UpdateRoutine(0.0)
+	if afterFrame != nil {
+		afterFrame()
+	}
+	loop.UpdateRoutine(0.0)
+	return nil
+}
+
+// ReadFrame reads the finished frame back from the framebuffer it was drawn to.
+func (loop *GameLoop) ReadFrame() *image.RGBA {
+	return renderBackend.ReadPixels(renderBackend.DrawFramebuffer(), loop.window.width, loop.window.height)
+}
+
+// SaveScreenshot reads the finished frame back and writes it to a new file in
+// SCREENSHOT_DIRECTORY. Encoding runs in the background so the game does not stall.
+func (loop *GameLoop) SaveScreenshot() {
+	img := loop.ReadFrame()
+	file, err := timestampedFile(SCREENSHOT_DIRECTORY, ".png", time.Now())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	go func() {
+		if err := SaveImagePNG(file, img); err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println("screenshot saved to", file)
+	}()
+}
+
+// timestampedFile creates a directory and returns an unused file name in it
+// named after a time, such as a screenshot's.
+// directory: Directory the file goes to
+// extension: File extension including the dot
+// now: Time the file is named after
+func timestampedFile(directory, extension string, now time.Time) (string, error) {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory %q: %v", directory, err)
+	}
+
+	// Several files within one second get a counter
+	base := filepath.Join(directory, now.Format(SCREENSHOT_TIME_FORMAT))
+	file := base + extension
+	for i := 2; ; i++ {
+		if _, err := os.Stat(file); errors.Is(err, fs.ErrNotExist) {
+			return file, nil
+		}
+		file = fmt.Sprintf("%s_%d%s", base, i, extension)
+	}
+}
+
+// RenderOffscreen renders the settled world around the camera into an
+// off-screen framebuffer and reads the image back.
+// width, height: Size of the image in pixels
+func (loop *GameLoop) RenderOffscreen(width, height int) (*image.RGBA, error) {
+	target := RenderTarget{}
+	target.Create(width, height, true)
+	defer target.Delete()
+
+	// The post chain writes its result to the framebuffer bound before the frame
+	previous := renderBackend.DrawFramebuffer()
+	renderBackend.BindFramebuffer(target.framebuffer)
+	defer renderBackend.BindFramebuffer(previous)
+
+	loop.window.width, loop.window.height = width, height
+	if err := loop.RenderSettledFrame(CAPTURE_SETTLE_TIMEOUT, nil); err != nil {
+		return nil, err
+	}
+	return renderBackend.ReadPixels(target.framebuffer, width, height), nil
+}
+
+// CapturePanorama renders the six faces of a cubemap around the camera, in the
+// order of cubeFaces, with a 90 degree field of view. The vignette is turned
+// off so the faces join without dark seams.
+// size: Edge length of the faces in pixels
+func (loop *GameLoop) CapturePanorama(size int) ([6]*image.RGBA, error) {
+	faces := [6]*image.RGBA{}
+
+	savedCamera := *loop.camera
+	defer func() { *loop.camera = savedCamera }()
+	loop.camera.FOV = 90.0
+
+	if vignette := loop.post.Pass("vignette"); vignette != nil {
+		enabled := vignette.enabled
+		vignette.enabled = false
+		defer func() { vignette.enabled = enabled }()
+	}
+
+	for i, face := range cubeFaces {
+		loop.camera.LookAlong(face.front, face.up)
+		img, err := loop.RenderOffscreen(size, size)
+		if err != nil {
+			return faces, fmt.Errorf("panorama face %s: %v", face.name, err)
+		}
+		faces[i] = img
+	}
+	return faces, nil
+}
+
+// PanoramaCross arranges the faces of a panorama as an unfolded cube
+// (see panoramaCrossCells), e.g. for a quick look at all of them.
+// faces: Square faces of equal size in the order of cubeFaces
+func PanoramaCross(faces [6]*image.RGBA) *image.RGBA {
+	size := faces[0].Bounds().Dx()
+	cross := image.NewRGBA(image.Rect(0, 0, 4*size, 3*size))
+	for row, cells := range panoramaCrossCells {
+		for column, face := range cells {
+			if face < 0 {
+				continue
+			}
+			cell := image.Rect(column*size, row*size, (column+1)*size, (row+1)*size)
+			draw.Draw(cross, cell, faces[face], image.Point{}, draw.Src)
+		}
+	}
+	return cross
+}
+
+// RunCapture renders a world off-screen without opening a window and writes
+// the requested images. Must run on the main thread instead of the game.
+// options: World, camera and output files
+func RunCapture(options CaptureOptions) error {
+	destroyContext, err := CreateHeadlessContext()
+	if err != nil {
+		return err
+	}
+	defer destroyContext()
+
+	// A fresh world in a temporary directory, so the seed is used and the player's save is untouched
+	saveDirectory, err := os.MkdirTemp("", "capture-world")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(saveDirectory)
+
+	loop := &GameLoop{}
+	loop.gameWorld.saveDirectory = saveDirectory
+	loop.gameWorld.seed = options.seed
+	loop.gameWorld.minHeight, loop.gameWorld.maxHeight = options.buildLimits[0], options.buildLimits[1]
+	if options.renderDistance > 0 {
+		loop.gameWorld.renderDistance = options.renderDistance
+	}
+	loop.Initialize(&Window{width: options.width, height: options.height})
+	defer loop.Shutdown()
+	loop.hud.visible = false // Pictures show the world only
+	loop.ApplyCameraPose(options.pose, options.timeOfDay)
+
+	if options.screenshotFile != "" {
+		img, err := loop.RenderOffscreen(options.width, options.height)
+		if err != nil {
+			return err
+		}
+		if err := SaveImagePNG(options.screenshotFile, img); err != nil {
+			return err
+		}
+		fmt.Println("capture:", options.screenshotFile, "written")
+	}
+
+	if options.panoramaPrefix != "" {
+		faces, err := loop.CapturePanorama(options.panoramaSize)
+		if err != nil {
+			return err
+		}
+		for i, face := range cubeFaces {
+			file := options.panoramaPrefix + "_" + face.name + ".png"
+			if err := SaveImagePNG(file, faces[i]); err != nil {
+				return err
+			}
+			fmt.Println("capture:", file, "written")
+		}
+		file := options.panoramaPrefix + "_cross.png"
+		if err := SaveImagePNG(file, PanoramaCross(faces)); err != nil {
+			return err
+		}
+		fmt.Println("capture:", file, "written")
+	}
+	return nil
+}
@@ -1,449 +1,690 @@
-// Each Chunk represents a 16x16x256 region of blocks with procedurally generated terrain
-// and optimized mesh generation using face culling.
+// Each Chunk represents a 16x16x16 section of the world with procedurally generated
+// terrain and optimized mesh generation using face culling. Chunks are stacked in
+// all three directions, the world's build limits decide how far down and up they go.
+// Mesh vertices are relative to the origin of the chunk's render region and
+// placed in the world by the region's model matrix, so they keep their precision
+// however far the chunk is from the world origin.
 
 package main
 
 import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
 	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
 	"github.com/ojrac/opensimplex-go"
 )
 
-// Chunk represents a 16x16x256 block region in the world.
+// CHUNK_SEA_LEVEL is the height up to which low terrain is flooded with water sources.
+const CHUNK_SEA_LEVEL = 42
+
+// ChunkMeshState describes how far a chunk's mesh is from being drawn.
+type ChunkMeshState int
+
+// Chunk mesh states.
+const (
+	CHUNK_MESH_GENERATING ChunkMeshState = iota // Terrain or the first mesh is still being built
+	CHUNK_MESH_DIRTY                            // A newer mesh is being built or waits for its upload
+	CHUNK_MESH_UPLOADED                         // The arena holds the current mesh
+)
+
+// ChunkPass selects which faces of a chunk mesh a draw covers.
+type ChunkPass int
+
+// Chunk passes, drawn in this order.
+const (
+	CHUNK_PASS_SOLID  ChunkPass = iota // Faces of solid blocks, drawn opaque
+	CHUNK_PASS_LIQUID                  // Faces of water blocks, drawn blended over the solid faces
+)
+
+// ChunkBlocks holds the block data of a chunk that is not all air.
+type ChunkBlocks struct {
+	ids         [CHUNK_SIZE][CHUNK_SIZE][CHUNK_SIZE]int   // Block IDs indexed [X][Z][Y], Y is vertical
+	fluidLevels [CHUNK_SIZE][CHUNK_SIZE][CHUNK_SIZE]uint8 // Fluid level of each water block, same layout as ids
+}
+
+// Chunk represents a 16x16x16 block region in the world.
 // It contains block data, a renderable mesh, and manages mesh generation.
 type Chunk struct {
-	position    mgl32.Vec2       // Chunk position in chunk coordinates (X,Z)
-	blocks      [16][16][256]int // 3D array of block IDs (X, Y, Z) where Y is vertical
-	mesh        Mesh             // Renderable mesh data for this chunk
-	isMeshDirty bool             // Flag indicating if mesh needs to be regenerated
+	position      ChunkPos          // Chunk position in chunk coordinates
+	blocks        *ChunkBlocks      // Block data, nil while every block is air
+	blocksMutex   sync.RWMutex      // Guards the block IDs between SetBlock and mesher goroutines
+	mesh          Mesh              // Renderable mesh data for this chunk, relative to Origin
+	arenaBlock    *ArenaBlock       // Range of the world's buffer arena holding the uploaded mesh
+	isMeshDirty   bool              // Flag indicating if mesh needs to be regenerated
+	isGenerated   atomic.Bool       // Set once terrain generation and the first mesh are done
+	isModified    bool              // Blocks changed since the chunk was generated or saved (main thread only)
+	world         *GameWorld        // World notified when generation completes (may be nil)
+	seed          int64             // Seed of the terrain noise
+	ores          []OreVein         // Ore veins placed into the terrain (shared, read only)
+	floor         int               // Height of the bedrock layer, the world's lower build limit
+	saveDirectory string            // Directory a saved copy of the chunk is loaded from ("" always generates)
+	lod           atomic.Int32      // Requested level of detail (0 = full, n = 2^n blocks per cell)
+	meshLOD       int               // Level of detail the current mesh was built with
+	liquidFirst   int               // First vertex of the water faces in the mesh, the solid faces come before
+	meshBorders   int               // Faces (bits in chunkFaces order) meshed against the neighbouring chunk, -1 for a mesh that ignores its neighbours
+	meshMutex     sync.Mutex        // Guards mesh, isMeshDirty, meshLOD, liquidFirst, meshBorders and the visibility between mesher goroutines and rendering
+	visibility    SectionVisibility // Face connectivity of the chunk
+	hasVisibility bool              // Set once visibility has been computed
+
+	meshRequests       atomic.Uint64 // Number of mesh builds started, used to order overlapping builds
+	appliedMeshRequest uint64        // Build number of the mesh currently in use
 }
 
-// Generate creates procedural terrain for the chunk using OpenSimplex noise.
+// Generate loads the chunk from its save file, or creates procedural terrain
+// for it using OpenSimplex noise if it was never saved.
 // Runs asynchronously in a goroutine to prevent blocking the main thread.
-// Terrain features include height-based layering (stone, dirt, grass) and caves.
+// Terrain features include height-based layering (stone, dirt, grass), caves and ore veins.
 func (chunk *Chunk) Generate() {
 	go func() {
-		// Initialize noise generator with seed 0
-		noise := opensimplex.New(0)
-
-		// Convert chunk position to world coordinates (chunks are 16 blocks wide)
-		blockPos := chunk.position.Mul(16)
-
-		// Noise scales for different terrain features
-		scale := 0.01     // Scale for terrain height variation
-		caveScale := 0.04 // Scale for cave generation (smaller = larger caves)
-
-		// Generate blocks for each column in the chunk
-		for x := range 16 {
-			for y := range 16 {
-				// Calculate height using 2D noise (creates rolling hills)
-				height := 50 + noise.Eval2(
-					float64(int(blockPos[0])+x)*scale,
-					float64(int(blockPos[1])+y)*scale,
-				)*30.0
-
-				// Fill blocks from bottom up to calculated height
-				for z := range int(height) {
-					// Default to stone
-					chunk.blocks[x][y][z] = BLOCK_STONE
-
-					// Create dirt layer on top of stone
-					if (int(height) - z) < 5 {
-						chunk.blocks[x][y][z] = BLOCK_DIRT
-					}
+		job := profiler.BeginJob("generate")
+
+		// Chunks changed in an earlier session are loaded instead of generated
+		loaded := false
+		if chunk.saveDirectory != "" {
+			var err error
+			loaded, err = chunk.Load(chunk.saveDirectory)
+			if err != nil {
+				fmt.Println(err)
+			}
+		}
+		if !loaded {
+			chunk.generateTerrain()
+		}
+
+		job.End()
+
+		// Update mesh after generation completes
+		chunk.UpdateMesh()
+
+		// Let the world know that the blocks are ready for simulation
+		chunk.isGenerated.Store(true)
+
+		// The LOD may have changed while the first mesh was being built
+		if int(chunk.lod.Load()) != chunk.MeshLOD() {
+			chunk.UpdateMesh()
+		}
+		if chunk.world != nil {
+			chunk.world.NotifyChunkGenerated(chunk)
+		}
+	}()
+}
 
-					// Create grass layer on very top
-					if (int(height) - z) <= 1 {
-						chunk.blocks[x][y][z] = BLOCK_GRASS
+// generateTerrain fills the chunk with the part of the noise terrain it covers.
+// Terrain height only depends on the column, so stacked chunks fit together.
+func (chunk *Chunk) generateTerrain() {
+	// Initialize noise generator with the world seed
+	noise := opensimplex.New(chunk.seed)
+
+	// World position of the chunk's first block
+	origin := chunk.position.Origin()
+
+	// Noise scales for different terrain features
+	scale := 0.01     // Scale for terrain height variation
+	caveScale := 0.04 // Scale for cave generation (smaller = larger caves)
+
+	// Generate blocks for each column in the chunk
+	for x := range CHUNK_SIZE {
+		for z := range CHUNK_SIZE {
+			// Calculate height using 2D noise (creates rolling hills)
+			height := int(50 + noise.Eval2(
+				float64(origin.x+x)*scale,
+				float64(origin.z+z)*scale,
+			)*30.0)
+
+			for y := range CHUNK_SIZE {
+				worldY := origin.y + y
+				local := LocalPos{x, y, z}
+
+				switch {
+				case worldY == chunk.floor:
+					// Bedrock layer at the bottom of the world
+					chunk.SetBlock(local, BLOCK_STONE)
+
+				case worldY < height:
+					// Stone, with a dirt layer on top and grass on the very top
+					blockID := BLOCK_STONE
+					if height-worldY < 5 {
+						blockID = BLOCK_DIRT
+					}
+					if height-worldY <= 1 {
+						blockID = BLOCK_GRASS
 					}
 
 					// Generate caves using 3D noise
 					caveValue := noise.Eval3(
-						float64(int(blockPos[0])+x)*caveScale,
-						float64(int(blockPos[1])+y)*caveScale,
-						float64(z)*caveScale,
+						float64(origin.x+x)*caveScale,
+						float64(origin.z+z)*caveScale,
+						float64(worldY)*caveScale,
 					)
 
 					// Create air blocks where cave noise exceeds threshold
 					if caveValue > 0.6 {
-						chunk.blocks[x][y][z] = BLOCK_AIR
+						blockID = BLOCK_AIR
 					}
-				}
+					chunk.SetBlock(local, blockID)
 
-				// Ensure bedrock layer at bottom (z=0)
-				chunk.blocks[x][y][0] = BLOCK_STONE
+				case worldY < CHUNK_SEA_LEVEL:
+					// Flood everything between the terrain and sea level with water sources
+					chunk.SetBlock(local, BLOCK_WATER)
+					chunk.SetFluidLevel(local, FLUID_LEVEL_SOURCE)
+				}
 			}
 		}
+	}
 
-		// Update mesh after generation completes
-		chunk.UpdateMesh()
-	}()
+	// Replace stone with the veins reaching into the chunk
+	chunk.placeOres()
 }
 
-// UpdateMesh generates a renderable mesh from the chunk's block data.
-// Implements face culling by only generating faces between air and solid blocks.
-func (chunk *Chunk) UpdateMesh() {
-	// Start with empty mesh
-	chunk.mesh = Mesh{}
+// Block returns the block ID at a position inside the chunk.
+// Once generated, blocks only change on the main thread, which reads them without locking.
+func (chunk *Chunk) Block(local LocalPos) int {
+	if chunk.blocks == nil {
+		return BLOCK_AIR
+	}
+	return chunk.blocks.ids[local.x][local.z][local.y]
+}
 
-	// Convert chunk position to world coordinates for vertex positioning
-	blockPos := chunk.position.Mul(16)
+// SetBlock replaces the block ID at a position inside the chunk, allocating
+// the block data when the first block other than air is placed.
+func (chunk *Chunk) SetBlock(local LocalPos, blockID int) {
+	chunk.blocksMutex.Lock()
+	defer chunk.blocksMutex.Unlock()
+	if chunk.blocks == nil {
+		if blockID == BLOCK_AIR {
+			return
+		}
+		chunk.blocks = &ChunkBlocks{}
+	}
+	chunk.blocks.ids[local.x][local.z][local.y] = blockID
+}
 
-	// Iterate through all blocks in the chunk
-	for x := range 16 {
-		for y := range 16 {
-			for z := range 256 {
-				blockID := chunk.blocks[x][y][z]
+// FluidLevel returns the fluid level stored at a position inside the chunk.
+func (chunk *Chunk) FluidLevel(local LocalPos) int {
+	if chunk.blocks == nil {
+		return 0
+	}
+	return int(chunk.blocks.fluidLevels[local.x][local.z][local.y])
+}
 
-				// Skip air blocks (no faces to render)
-				if blockID == BLOCK_AIR {
+// SetFluidLevel stores the fluid level at a position inside the chunk.
+// All-air chunks hold no water, so their levels stay 0.
+func (chunk *Chunk) SetFluidLevel(local LocalPos, level int) {
+	if chunk.blocks == nil {
+		return
+	}
+	chunk.blocks.fluidLevels[local.x][local.z][local.y] = uint8(level)
+}
+
+// chunkFace describes one face of a block (or LOD cell) for the mesher:
+// which neighbour hides it, its normal and the two triangles that form it.
+type chunkFace struct {
+	face      int           // FACE_* index used to look up the atlas tile
+	neighbour [3]int        // Offset of the neighbour in chunk index space (X, Z, height)
+	normal    mgl32.Vec3    // Outward face normal in world space
+	corners   [6]mgl32.Vec3 // Vertex positions relative to the cell origin, in cells
+	uvs       [6]mgl32.Vec2 // Tile-relative texture coordinates of each corner
+}
+
+// chunkFaces lists all six faces in the order they are meshed.
+var chunkFaces = [6]chunkFace{
+	// SIDE 0 (-Z face - typically "north" side)
+	{
+		FACE_SIDE0, [3]int{0, -1, 0}, mgl32.Vec3{0.0, 0.0, -1.0},
+		[6]mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {1, 1, 0}, {1, 0, 0}, {0, 1, 0}},
+		[6]mgl32.Vec2{{0, 1}, {1, 1}, {0, 0}, {1, 0}, {1, 1}, {0, 0}},
+	},
+	// SIDE 1 (-X face - typically "west" side)
+	{
+		FACE_SIDE1, [3]int{-1, 0, 0}, mgl32.Vec3{-1.0, 0.0, 0.0},
+		[6]mgl32.Vec3{{0, 0, 0}, {0, 0, 1}, {0, 1, 0}, {0, 1, 1}, {0, 0, 1}, {0, 1, 0}},
+		[6]mgl32.Vec2{{0, 1}, {1, 1}, {0, 0}, {1, 0}, {1, 1}, {0, 0}},
+	},
+	// SIDE 2 (+X face - typically "east" side)
+	{
+		FACE_SIDE2, [3]int{1, 0, 0}, mgl32.Vec3{1.0, 0.0, 0.0},
+		[6]mgl32.Vec3{{1, 0, 0}, {1, 0, 1}, {1, 1, 0}, {1, 1, 1}, {1, 0, 1}, {1, 1, 0}},
+		[6]mgl32.Vec2{{0, 1}, {1, 1}, {0, 0}, {1, 0}, {1, 1}, {0, 0}},
+	},
+	// SIDE 3 (+Z face - typically "south" side)
+	{
+		FACE_SIDE3, [3]int{0, 1, 0}, mgl32.Vec3{0.0, 0.0, 1.0},
+		[6]mgl32.Vec3{{0, 0, 1}, {1, 0, 1}, {0, 1, 1}, {1, 1, 1}, {1, 0, 1}, {0, 1, 1}},
+		[6]mgl32.Vec2{{0, 1}, {1, 1}, {0, 0}, {1, 0}, {1, 1}, {0, 0}},
+	},
+	// TOP face (+Y direction)
+	{
+		FACE_TOP, [3]int{0, 0, 1}, mgl32.Vec3{0.0, 1.0, 0.0},
+		[6]mgl32.Vec3{{0, 1, 0}, {0, 1, 1}, {1, 1, 0}, {1, 1, 0}, {0, 1, 1}, {1, 1, 1}},
+		[6]mgl32.Vec2{{0, 0}, {0, 1}, {1, 0}, {1, 0}, {0, 1}, {1, 1}},
+	},
+	// BOTTOM face (-Y direction)
+	{
+		FACE_BOTTOM, [3]int{0, 0, -1}, mgl32.Vec3{0.0, -1.0, 0.0},
+		[6]mgl32.Vec3{{0, 0, 0}, {0, 0, 1}, {1, 0, 0}, {1, 0, 0}, {0, 0, 1}, {1, 0, 1}},
+		[6]mgl32.Vec2{{0, 0}, {0, 1}, {1, 0}, {1, 0}, {0, 1}, {1, 1}},
+	},
+}
+
+// axis returns the index space axis (0 to 2) the face points along.
+func (face *chunkFace) axis() int {
+	for axis, step := range face.neighbour {
+		if step != 0 {
+			return axis
+		}
+	}
+	return 0
+}
+
+// sampleCell returns the block representing a scale×scale×scale cell for LOD meshing.
+// A cell is solid when at least half of it is solid and then shows its topmost solid
+// block (so hills keep their grass). Mostly-wet cells become water, the rest is air.
+// x, y, z: Cell origin in chunk index space (Y is the horizontal Z axis, Z is height)
+// scale: Cell edge length in blocks (1 returns the block itself)
+func (chunk *Chunk) sampleCell(x, y, z, scale int) int {
+	blocks := &chunk.blocks.ids
+	if scale == 1 {
+		return blocks[x][y][z]
+	}
+
+	solidCount := 0
+	waterCount := 0
+	topBlock := BLOCK_AIR
+	topHeight := -1
+
+	// The surface block often sits in the mostly-air cell above, so the search
+	// for the visible block reaches one cell higher than the counted volume
+	// (as far as the chunk goes)
+	searchTop := min(z+2*scale, CHUNK_SIZE)
+	for cellX := x; cellX < x+scale; cellX++ {
+		for cellY := y; cellY < y+scale; cellY++ {
+			for cellZ := z; cellZ < searchTop; cellZ++ {
+				blockID := blocks[cellX][cellY][cellZ]
+				if blockID != BLOCK_AIR && blockID != BLOCK_WATER && cellZ > topHeight {
+					topHeight = cellZ
+					topBlock = blockID
+				}
+				if cellZ >= z+scale {
 					continue
 				}
 
-				// Calculate world position of this block
-				vertexPos := mgl32.Vec3{
-					float32(int(blockPos[0]) + x),
-					float32(z),
-					float32(int(blockPos[1]) + y),
+				switch blockID {
+				case BLOCK_AIR:
+				case BLOCK_WATER:
+					waterCount++
+				default:
+					solidCount++
 				}
+			}
+		}
+	}
 
-				// Default vertex color (white - actual coloring from textures)
-				color := mgl32.Vec3{1.0, 1.0, 1.0}
+	volume := scale * scale * scale
+	if solidCount*2 >= volume {
+		return topBlock
+	}
+	if (solidCount+waterCount)*2 >= volume {
+		return BLOCK_WATER
+	}
+	return BLOCK_AIR
+}
 
-				// Helper function to check if a neighboring block is occupied (non-air)
-				isBlockOccupied := func(x, y, z int) bool {
-					// Check bounds - if outside chunk, treat as unoccupied
-					// (allows faces on chunk edges to always render)
-					if x < 0 {
-						return false
-					}
-					if x >= 16 {
-						return false
-					}
-					if y < 0 {
-						return false
-					}
-					if y >= 16 {
-						return false
-					}
-					if z < 0 {
-						return false
-					}
-					if z >= 256 {
-						return false
-					}
+// sampleBorder samples the layer of LOD cells that a neighbouring chunk sees
+// across one of its faces, indexed u * cellCount + v by the two other axes
+// in index space order after the face's axis (see chunkFace.axis).
+// face: Face of the neighbour, this chunk lies across it
+// cellCount: Number of cells along each axis
+// scale: Cell edge length in blocks
+func (chunk *Chunk) sampleBorder(face *chunkFace, cellCount, scale int) []int {
+	border := make([]int, cellCount*cellCount)
+	chunk.blocksMutex.RLock()
+	defer chunk.blocksMutex.RUnlock()
+	if chunk.blocks == nil {
+		return border
+	}
 
-					// Block is occupied if it's not air
-					return chunk.blocks[x][y][z] != BLOCK_AIR
-				}
+	axis := face.axis()
+	cell := [3]int{}
+	if face.neighbour[axis] < 0 {
+		cell[axis] = cellCount - 1
+	}
+	for u := range cellCount {
+		for v := range cellCount {
+			cell[(axis+1)%3], cell[(axis+2)%3] = u, v
+			border[u*cellCount+v] = chunk.sampleCell(cell[0]*scale, cell[1]*scale, cell[2]*scale, scale)
+		}
+	}
+	return border
+}
 
-				// SIDE 0 (-Z face - typically "north" side)
-				// Only generate face if neighboring block in -Z direction is air/unoccupied
-				if !isBlockOccupied(x, y-1, z) {
-					// Add two triangles forming a quad for this face
-					// Triangle 1
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{0.0, 0.0, 0.0}), color, mgl32.Vec3{0.0, 0.0, -1.0},
-						mgl32.Vec2{
-							(blockData[blockID].side0UV[0] + 0) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side0UV[1] + 1) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{1.0, 0.0, 0.0}), color, mgl32.Vec3{0.0, 0.0, -1.0},
-						mgl32.Vec2{
-							(blockData[blockID].side0UV[0] + 1) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side0UV[1] + 1) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{0.0, 1.0, 0.0}), color, mgl32.Vec3{0.0, 0.0, -1.0},
-						mgl32.Vec2{
-							(blockData[blockID].side0UV[0] + 0) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side0UV[1] + 0) * BLOCK_DATA_UV_SPACE,
-						},
-					)
+// meshNeighbours returns the neighbouring chunks a mesh at a LOD level is built
+// against, in chunkFaces order: the generated neighbours requested at the same
+// level. Other faces (nil) keep their border walls.
+// lod: LOD level of the mesh
+func (chunk *Chunk) meshNeighbours(lod int) [6]*Chunk {
+	neighbours := [6]*Chunk{}
+	if chunk.world == nil {
+		return neighbours
+	}
+	for faceIndex, face := range chunkFaces {
+		neighbour := chunk.world.GetChunk(chunk.position.Add(face.neighbour[0], face.neighbour[2], face.neighbour[1]))
+		if neighbour != nil && neighbour.isGenerated.Load() && int(neighbour.lod.Load()) == lod {
+			neighbours[faceIndex] = neighbour
+		}
+	}
+	return neighbours
+}
 
-					// Triangle 2
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{1.0, 1.0, 0.0}), color, mgl32.Vec3{0.0, 0.0, -1.0},
-						mgl32.Vec2{
-							(blockData[blockID].side0UV[0] + 1) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side0UV[1] + 0) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{1.0, 0.0, 0.0}), color, mgl32.Vec3{0.0, 0.0, -1.0},
-						mgl32.Vec2{
-							(blockData[blockID].side0UV[0] + 1) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side0UV[1] + 1) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{0.0, 1.0, 0.0}), color, mgl32.Vec3{0.0, 0.0, -1.0},
-						mgl32.Vec2{
-							(blockData[blockID].side0UV[0] + 0) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side0UV[1] + 0) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-				}
+// neighbourBorders returns the bit mask of the faces that have a neighbour.
+func neighbourBorders(neighbours [6]*Chunk) int {
+	borders := 0
+	for faceIndex, neighbour := range neighbours {
+		if neighbour != nil {
+			borders |= 1 << faceIndex
+		}
+	}
+	return borders
+}
 
-				// SIDE 1 (-X face - typically "west" side)
-				if !isBlockOccupied(x-1, y, z) {
-					// Similar pattern for -X face
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{0.0, 0.0, 0.0}), color, mgl32.Vec3{-1.0, 0.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].side1UV[0] + 0) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side1UV[1] + 1) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{0.0, 0.0, 1.0}), color, mgl32.Vec3{-1.0, 0.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].side1UV[0] + 1) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side1UV[1] + 1) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{0.0, 1.0, 0.0}), color, mgl32.Vec3{-1.0, 0.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].side1UV[0] + 0) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side1UV[1] + 0) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{0.0, 1.0, 1.0}), color, mgl32.Vec3{-1.0, 0.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].side1UV[0] + 1) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side1UV[1] + 0) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{0.0, 0.0, 1.0}), color, mgl32.Vec3{-1.0, 0.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].side1UV[0] + 1) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side1UV[1] + 1) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{0.0, 1.0, 0.0}), color, mgl32.Vec3{-1.0, 0.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].side1UV[0] + 0) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side1UV[1] + 0) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-				}
+// BordersStale reports whether a neighbouring chunk finished generating or
+// changed its LOD level since the mesh was built, so that a border of the mesh
+// no longer matches it.
+func (chunk *Chunk) BordersStale() bool {
+	chunk.meshMutex.Lock()
+	lod, borders := chunk.meshLOD, chunk.meshBorders
+	chunk.meshMutex.Unlock()
+	return borders >= 0 && neighbourBorders(chunk.meshNeighbours(lod)) != borders
+}
 
-				// SIDE 2 (+X face - typically "east" side)
-				if !isBlockOccupied(x+1, y, z) {
-					// Similar pattern for +X face
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{1.0, 0.0, 0.0}), color, mgl32.Vec3{0.0, 0.0, 1.0},
-						mgl32.Vec2{
-							(blockData[blockID].side2UV[0] + 0) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side2UV[1] + 1) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{1.0, 0.0, 1.0}), color, mgl32.Vec3{0.0, 0.0, 1.0},
-						mgl32.Vec2{
-							(blockData[blockID].side2UV[0] + 1) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side2UV[1] + 1) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{1.0, 1.0, 0.0}), color, mgl32.Vec3{0.0, 0.0, 1.0},
-						mgl32.Vec2{
-							(blockData[blockID].side2UV[0] + 0) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side2UV[1] + 0) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{1.0, 1.0, 1.0}), color, mgl32.Vec3{0.0, 0.0, 1.0},
-						mgl32.Vec2{
-							(blockData[blockID].side2UV[0] + 1) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side2UV[1] + 0) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{1.0, 0.0, 1.0}), color, mgl32.Vec3{0.0, 0.0, 1.0},
-						mgl32.Vec2{
-							(blockData[blockID].side2UV[0] + 1) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side2UV[1] + 1) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{1.0, 1.0, 0.0}), color, mgl32.Vec3{0.0, 0.0, 1.0},
-						mgl32.Vec2{
-							(blockData[blockID].side2UV[0] + 0) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side2UV[1] + 0) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-				}
+// RemeshStaleBorders rebuilds the mesh in the background when its borders no
+// longer match the neighbours (see BordersStale). Chunks still generating or
+// with a rebuild in flight are left alone, they pick the neighbours up themselves.
+func (chunk *Chunk) RemeshStaleBorders() {
+	if !chunk.isGenerated.Load() {
+		return
+	}
+	chunk.meshMutex.Lock()
+	pending := chunk.appliedMeshRequest != chunk.meshRequests.Load()
+	chunk.meshMutex.Unlock()
+	if !pending && chunk.BordersStale() {
+		go chunk.UpdateMesh()
+	}
+}
 
-				// SIDE 3 (+Z face - typically "south" side)
-				if !isBlockOccupied(x, y+1, z) {
-					// Similar pattern for +Z face
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{0.0, 0.0, 1.0}), color, mgl32.Vec3{1.0, 0.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].side3UV[0] + 0) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side3UV[1] + 1) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{1.0, 0.0, 1.0}), color, mgl32.Vec3{1.0, 0.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].side3UV[0] + 1) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side3UV[1] + 1) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{0.0, 1.0, 1.0}), color, mgl32.Vec3{1.0, 0.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].side3UV[0] + 0) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side3UV[1] + 0) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{1.0, 1.0, 1.0}), color, mgl32.Vec3{1.0, 0.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].side3UV[0] + 1) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side3UV[1] + 0) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{1.0, 0.0, 1.0}), color, mgl32.Vec3{1.0, 0.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].side3UV[0] + 1) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side3UV[1] + 1) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{0.0, 1.0, 1.0}), color, mgl32.Vec3{1.0, 0.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].side3UV[0] + 0) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].side3UV[1] + 0) * BLOCK_DATA_UV_SPACE,
-						},
-					)
+// UpdateMesh generates a renderable mesh from the chunk's block data.
+// Implements face culling: solid blocks show the faces next to air or water,
+// water shows the faces next to air. The water faces follow the solid ones so
+// both can be drawn with their own material (see ChunkPass).
+// The chunk's LOD level selects the cell size: LOD n meshes cells of 2^n blocks.
+// Faces on the chunk border are culled against the cells of generated neighbours
+// meshed at the same LOD. Towards other neighbours solid faces are always emitted:
+// these border walls act as skirts that hide cracks between chunks of different LOD.
+// All-air chunks are not meshed at all and let sight through in every direction.
+// Safe to call from any goroutine; the newest request wins if several overlap.
+func (chunk *Chunk) UpdateMesh() {
+	defer profiler.BeginJob("mesh").End()
+
+	requestID := chunk.meshRequests.Add(1)
+	lod := int(chunk.lod.Load())
+	scale := 1 << lod
+
+	// Sample the chunk into a grid of LOD cells, the main thread may be changing blocks
+	cellCount := CHUNK_SIZE / scale
+	var cells []int
+	chunk.blocksMutex.RLock()
+	if chunk.blocks != nil {
+		cells = make([]int, cellCount*cellCount*cellCount)
+		cellIndex := func(x, y, z int) int {
+			return (x*cellCount+y)*cellCount + z
+		}
+		for x := range cellCount {
+			for y := range cellCount {
+				for z := range cellCount {
+					cells[cellIndex(x, y, z)] = chunk.sampleCell(x*scale, y*scale, z*scale, scale)
 				}
+			}
+		}
+	}
+	chunk.blocksMutex.RUnlock()
+
+	mesh := Mesh{}
+	liquid := Mesh{}
+	visibility := SECTION_VISIBILITY_ALL
+	borders := -1
+	if cells != nil {
+		// The layers of cells across the faces, from the neighbours the borders are culled against
+		neighbours := chunk.meshNeighbours(lod)
+		borders = neighbourBorders(neighbours)
+		borderCells := [6][]int{}
+		for faceIndex, neighbour := range neighbours {
+			if neighbour != nil {
+				borderCells[faceIndex] = neighbour.sampleBorder(&chunkFaces[faceIndex], cellCount, scale)
+			}
+		}
 
-				// TOP face (+Y direction)
-				if !isBlockOccupied(x, y, z+1) {
-					// Add two triangles for top face (different winding order for top)
-					// Triangle 1
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{0.0, 1.0, 0.0}), color, mgl32.Vec3{0.0, 1.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].topUV[0] + 0) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].topUV[1] + 0) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{0.0, 1.0, 1.0}), color, mgl32.Vec3{0.0, 1.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].topUV[0] + 0) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].topUV[1] + 1) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{1.0, 1.0, 0.0}), color, mgl32.Vec3{0.0, 1.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].topUV[0] + 1) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].topUV[1] + 0) * BLOCK_DATA_UV_SPACE,
-						},
-					)
+		// Vertices are relative to the region origin, the chunk lies this far from it
+		origin := chunk.position.Origin()
+		region := chunk.position.Region().Origin()
+		offset := mgl32.Vec3{float32(origin.x - region.x), float32(origin.y - region.y), float32(origin.z - region.z)}
 
-					// Triangle 2
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{1.0, 1.0, 0.0}), color, mgl32.Vec3{0.0, 1.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].topUV[0] + 1) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].topUV[1] + 0) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{0.0, 1.0, 1.0}), color, mgl32.Vec3{0.0, 1.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].topUV[0] + 0) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].topUV[1] + 1) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{1.0, 1.0, 1.0}), color, mgl32.Vec3{0.0, 1.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].topUV[0] + 1) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].topUV[1] + 1) * BLOCK_DATA_UV_SPACE,
-						},
-					)
+		// Default vertex color (white - actual coloring from textures)
+		color := mgl32.Vec3{1.0, 1.0, 1.0}
+		meshCells(&mesh, &liquid, cells, borderCells, cellCount, scale, offset, color)
+
+		// Connectivity comes from the same cells as the mesh, otherwise a coarse
+		// surface could lie in a chunk the full resolution blocks seal off
+		visibility = computeVisibility(cells, cellCount, scale)
+	}
+
+	// Prepare the mesh data for OpenGL rendering, water last
+	liquidFirst := len(mesh.vertices)
+	mesh.vertices = append(mesh.vertices, liquid.vertices...)
+	mesh.PrepareArrayData()
+
+	// Swap the new mesh in, it is uploaded to the arena on the next draw.
+	// An older request finishing after a newer one is dropped.
+	chunk.meshMutex.Lock()
+	if requestID > chunk.appliedMeshRequest {
+		chunk.appliedMeshRequest = requestID
+		chunk.mesh = mesh
+		chunk.meshLOD = lod
+		chunk.liquidFirst = liquidFirst
+		chunk.meshBorders = borders
+		chunk.visibility = visibility
+		chunk.hasVisibility = true
+
+		// Mark mesh as dirty so it gets uploaded before next render
+		chunk.isMeshDirty = true
+	}
+	chunk.meshMutex.Unlock()
+}
+
+// meshCells appends the faces of a grid of LOD cells to two meshes.
+// mesh: Mesh receiving the faces of solid cells
+// liquid: Mesh receiving the faces of water cells
+// cells: Sampled LOD cells, indexed (x * cellCount + y) * cellCount + z
+// borders: Cells across each face in chunkFaces order (see sampleBorder), nil where unknown
+// cellCount: Number of cells along each axis
+// scale: Cell edge length in blocks
+// offset: Position of the first cell relative to the mesh origin
+// color: Vertex color
+func meshCells(mesh, liquid *Mesh, cells []int, borders [6][]int, cellCount, scale int, offset, color mgl32.Vec3) {
+	cellIndex := func(x, y, z int) int {
+		return (x*cellCount+y)*cellCount + z
+	}
+	cellSize := float32(scale)
+
+	// Helper function to check if a neighbouring cell hides a face: water hides
+	// water faces only, so the ground under a lake is meshed
+	isFaceHidden := func(blockID, faceIndex, x, y, z int) bool {
+		neighbour := BLOCK_AIR
+		if x < 0 || x >= cellCount || y < 0 || y >= cellCount || z < 0 || z >= cellCount {
+			// Outside the chunk without a neighbour, solid faces render (allows faces
+			// on chunk edges to always render) and water faces do not, so a lake spanning
+			// several chunks shows no walls between them through its surface
+			border := borders[faceIndex]
+			if border == nil {
+				return blockID == BLOCK_WATER
+			}
+			axis := chunkFaces[faceIndex].axis()
+			cell := [3]int{x, y, z}
+			neighbour = border[cell[(axis+1)%3]*cellCount+cell[(axis+2)%3]]
+		} else {
+			neighbour = cells[cellIndex(x, y, z)]
+		}
+		return neighbour != BLOCK_AIR && (neighbour != BLOCK_WATER || blockID == BLOCK_WATER)
+	}
+
+	for x := range cellCount {
+		for y := range cellCount {
+			for z := range cellCount {
+				blockID := cells[cellIndex(x, y, z)]
+
+				// Skip air cells (no faces to render)
+				if blockID == BLOCK_AIR {
+					continue
+				}
+				data := blockData[blockID]
+				target := mesh
+				if blockID == BLOCK_WATER {
+					target = liquid
 				}
 
-				// BOTTOM face (-Y direction)
-				if !isBlockOccupied(x, y, z-1) {
-					// Similar pattern for bottom face (uses topUV coordinates for simplicity)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{0.0, 0.0, 0.0}), color, mgl32.Vec3{0.0, -1.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].topUV[0] + 0) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].topUV[1] + 0) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{0.0, 0.0, 1.0}), color, mgl32.Vec3{0.0, -1.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].topUV[0] + 0) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].topUV[1] + 1) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{1.0, 0.0, 0.0}), color, mgl32.Vec3{0.0, -1.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].topUV[0] + 1) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].topUV[1] + 0) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{1.0, 0.0, 0.0}), color, mgl32.Vec3{0.0, -1.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].topUV[0] + 1) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].topUV[1] + 0) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{0.0, 0.0, 1.0}), color, mgl32.Vec3{0.0, -1.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].topUV[0] + 0) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].topUV[1] + 1) * BLOCK_DATA_UV_SPACE,
-						},
-					)
-					chunk.mesh.AddVertex(
-						vertexPos.Add(mgl32.Vec3{1.0, 0.0, 1.0}), color, mgl32.Vec3{0.0, -1.0, 0.0},
-						mgl32.Vec2{
-							(blockData[blockID].topUV[0] + 1) * BLOCK_DATA_UV_SPACE,
-							(blockData[blockID].topUV[1] + 1) * BLOCK_DATA_UV_SPACE,
-						},
-					)
+				// Position of this cell relative to the mesh origin
+				vertexPos := offset.Add(mgl32.Vec3{float32(x * scale), float32(z * scale), float32(y * scale)})
+
+				for faceIndex := range chunkFaces {
+					face := &chunkFaces[faceIndex]
+
+					// Only generate face if the neighbouring cell lets it be seen
+					if isFaceHidden(blockID, faceIndex, x+face.neighbour[0], y+face.neighbour[1], z+face.neighbour[2]) {
+						continue
+					}
+
+					// Add two triangles forming a quad for this face
+					tile := data.FaceUV(face.face)
+					for corner := range face.corners {
+						target.AddVertex(
+							vertexPos.Add(face.corners[corner].Mul(cellSize)), color, face.normal,
+							mgl32.Vec2{
+								(tile[0] + face.uvs[corner][0]) * BLOCK_DATA_UV_SPACE,
+								(tile[1] + face.uvs[corner][1]) * BLOCK_DATA_UV_SPACE,
+							},
+						)
+					}
 				}
 			}
 		}
 	}
+}
 
-	// Prepare the mesh data for OpenGL rendering
-	chunk.mesh.PrepareArrayData()
+// computeVisibility builds the visibility graph of a meshed chunk.
+// Air and water let sight through, every other cell is opaque.
+// cells: Sampled LOD cells, indexed (x * cellCount + y) * cellCount + z
+// cellCount: Number of cells along each axis
+// scale: Cell edge length in blocks
+func computeVisibility(cells []int, cellCount, scale int) SectionVisibility {
+	return ComputeSectionVisibility(func(x, y, z int) bool {
+		blockID := cells[((x/scale)*cellCount+z/scale)*cellCount+y/scale]
+		return blockID != BLOCK_AIR && blockID != BLOCK_WATER
+	})
+}
+
+// Origin returns the world position the chunk's mesh vertices are relative to,
+// the first block of its render region. Vertices stay below 128 blocks, so
+// float32 keeps them exact, and the chunks of a region share a model matrix.
+func (chunk *Chunk) Origin() mgl64.Vec3 {
+	return chunk.position.Region().Origin().Vec3()
+}
 
-	// Mark mesh as dirty so VAO gets updated before next render
-	chunk.isMeshDirty = true
+// Visibility returns the visibility graph of the chunk.
+// The second value is false until the chunk has been meshed once.
+func (chunk *Chunk) Visibility() (SectionVisibility, bool) {
+	chunk.meshMutex.Lock()
+	defer chunk.meshMutex.Unlock()
+	return chunk.visibility, chunk.hasVisibility
 }
 
-// Render draws the chunk's mesh to the screen.
-// Updates the VAO if the mesh has changed since last render.
-func (chunk *Chunk) Render() {
-	// Update VAO if mesh data has changed
+// MeshLOD returns the LOD level of the chunk's current mesh.
+func (chunk *Chunk) MeshLOD() int {
+	chunk.meshMutex.Lock()
+	defer chunk.meshMutex.Unlock()
+	return chunk.meshLOD
+}
+
+// MeshSettled reports whether the chunk is generated and its newest mesh,
+// built at the requested LOD, is the current one.
+func (chunk *Chunk) MeshSettled() bool {
+	if !chunk.isGenerated.Load() {
+		return false
+	}
+	chunk.meshMutex.Lock()
+	settled := chunk.appliedMeshRequest == chunk.meshRequests.Load() && chunk.meshLOD == int(chunk.lod.Load())
+	chunk.meshMutex.Unlock()
+	return settled && !chunk.BordersStale()
+}
+
+// MeshState reports whether the chunk is generating, has a mesh change
+// pending (rebuild, LOD change or upload) or is up to date on the GPU.
+func (chunk *Chunk) MeshState() ChunkMeshState {
+	if !chunk.isGenerated.Load() {
+		return CHUNK_MESH_GENERATING
+	}
+	chunk.meshMutex.Lock()
+	defer chunk.meshMutex.Unlock()
+	if chunk.isMeshDirty || chunk.appliedMeshRequest != chunk.meshRequests.Load() || chunk.meshLOD != int(chunk.lod.Load()) {
+		return CHUNK_MESH_DIRTY
+	}
+	return CHUNK_MESH_UPLOADED
+}
+
+// SetLOD changes the chunk's LOD level and rebuilds its mesh in the background
+// if the terrain is already generated. Chunks still generating pick it up themselves.
+// lod: New LOD level (0 = full resolution)
+// Returns whether the level changed.
+func (chunk *Chunk) SetLOD(lod int) bool {
+	if int(chunk.lod.Swap(int32(lod))) == lod {
+		return false
+	}
+	if chunk.isGenerated.Load() {
+		go chunk.UpdateMesh()
+	}
+	return true
+}
+
+// QueueDraw uploads the chunk's mesh to the arena if it changed and queues
+// the faces of a pass for the arena's next draw, in the batch of its region's
+// model matrix.
+// arena: Buffer arena holding all chunk meshes
+// camera: Camera the model matrix is relative to
+// pass: Faces to draw
+func (chunk *Chunk) QueueDraw(arena *BufferArena, camera *Camera, pass ChunkPass) {
+	chunk.meshMutex.Lock()
+	defer chunk.meshMutex.Unlock()
+
+	// Move the new mesh into the arena, replacing the old one
 	if chunk.isMeshDirty == true {
-		chunk.mesh.UpdateVAO()
+		scope := profiler.Begin("upload")
+		chunk.arenaBlock = arena.Store(chunk.arenaBlock, chunk.mesh.arrayData)
+		scope.End()
 		chunk.isMeshDirty = false
-	}
 
-	// Render the mesh
-	chunk.mesh.Render()
+		// The GPU holds the only copy needed from now on
+		chunk.mesh.arrayData = nil
+	}
+	if chunk.arenaBlock == nil {
+		return
+	}
+	first, count := 0, chunk.liquidFirst
+	if pass == CHUNK_PASS_LIQUID {
+		first, count = chunk.liquidFirst, chunk.arenaBlock.count-chunk.liquidFirst
+	}
+	if count == 0 {
+		return
+	}
+	arena.BeginBatch(camera.ModelMatrix(chunk.Origin()))
+	arena.AddDraw(chunk.arenaBlock, first, count)
 }
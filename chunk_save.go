@@ -0,0 +1,148 @@
+// Implements saving and loading of single chunks. A chunk whose blocks changed
+// after it was generated is written to its own file in the save directory's
+// chunk folder, and loaded from there instead of being generated again.
+// Chunks that were never changed are not saved, the seed recreates them.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Chunk file constants.
+const (
+	WORLD_CHUNK_DIRECTORY = "chunks" // Folder of the chunk files inside the save directory
+	CHUNK_FILE_MAGIC      = "VXC1"   // First bytes of every chunk file, changed with the format
+	CHUNK_FILE_EMPTY      = 0        // Flag of a chunk file without block data (all air)
+	CHUNK_FILE_BLOCKS     = 1        // Flag of a chunk file followed by block IDs and fluid levels
+)
+
+// ChunkFile is the block data of a chunk file after the magic and the flag.
+// Both arrays are stored in the layout of ChunkBlocks, little-endian.
+type ChunkFile struct {
+	IDs         [CHUNK_SIZE][CHUNK_SIZE][CHUNK_SIZE]uint16 // Block IDs
+	FluidLevels [CHUNK_SIZE][CHUNK_SIZE][CHUNK_SIZE]uint8  // Fluid levels
+}
+
+// chunkFilePath returns the path of a chunk's file, named after its position.
+// saveDirectory: Save directory of the world
+// position: Chunk position
+func chunkFilePath(saveDirectory string, position ChunkPos) string {
+	name := fmt.Sprintf("%d_%d_%d.bin", position.x, position.y, position.z)
+	return filepath.Join(saveDirectory, WORLD_CHUNK_DIRECTORY, name)
+}
+
+// Save writes the chunk's blocks and fluid levels to its file.
+// Returns an error if the folder or file cannot be written.
+// saveDirectory: Save directory of the world
+func (chunk *Chunk) Save(saveDirectory string) error {
+	content := bytes.Buffer{}
+	content.WriteString(CHUNK_FILE_MAGIC)
+	if chunk.blocks == nil {
+		content.WriteByte(CHUNK_FILE_EMPTY)
+	} else {
+		content.WriteByte(CHUNK_FILE_BLOCKS)
+		file := ChunkFile{FluidLevels: chunk.blocks.fluidLevels}
+		for x := range CHUNK_SIZE {
+			for z := range CHUNK_SIZE {
+				for y := range CHUNK_SIZE {
+					file.IDs[x][z][y] = uint16(chunk.blocks.ids[x][z][y])
+				}
+			}
+		}
+		if err := binary.Write(&content, binary.LittleEndian, &file); err != nil {
+			return fmt.Errorf("failed to encode chunk %s: %v", chunk.position, err)
+		}
+	}
+
+	path := chunkFilePath(saveDirectory, chunk.position)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create chunk directory %q: %v", filepath.Dir(path), err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a half-written chunk
+	if err := os.WriteFile(path+".tmp", content.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write chunk %q: %v", path, err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// Load replaces the chunk's blocks with the content of its file.
+// Returns false without an error when the chunk was never saved.
+// saveDirectory: Save directory of the world
+func (chunk *Chunk) Load(saveDirectory string) (bool, error) {
+	path := chunkFilePath(saveDirectory, chunk.position)
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read chunk %q: %v", path, err)
+	}
+
+	header := len(CHUNK_FILE_MAGIC) + 1
+	if len(content) < header || string(content[:len(CHUNK_FILE_MAGIC)]) != CHUNK_FILE_MAGIC {
+		return false, fmt.Errorf("chunk %q is not a chunk file", path)
+	}
+	switch content[header-1] {
+	case CHUNK_FILE_EMPTY:
+		chunk.blocks = nil
+		return true, nil
+	case CHUNK_FILE_BLOCKS:
+	default:
+		return false, fmt.Errorf("chunk %q has unknown flag %d", path, content[header-1])
+	}
+
+	file := ChunkFile{}
+	reader := bytes.NewReader(content[header:])
+	if err := binary.Read(reader, binary.LittleEndian, &file); err != nil {
+		return false, fmt.Errorf("failed to decode chunk %q: %v", path, err)
+	}
+
+	blocks := &ChunkBlocks{fluidLevels: file.FluidLevels}
+	for x := range CHUNK_SIZE {
+		for z := range CHUNK_SIZE {
+			for y := range CHUNK_SIZE {
+				blockID := int(file.IDs[x][z][y])
+				if _, known := blockData[blockID]; !known && blockID != BLOCK_AIR {
+					return false, fmt.Errorf("chunk %q holds unknown block %d", path, blockID)
+				}
+				blocks.ids[x][z][y] = blockID
+			}
+		}
+	}
+	chunk.blocks = blocks
+	return true, nil
+}
+
+// SaveChunks writes every generated chunk whose blocks changed since it was
+// generated or last saved.
+// Returns the first error; the remaining chunks are still saved.
+func (gameWorld *GameWorld) SaveChunks() error {
+	gameWorld.chunksMutex.RLock()
+	modified := []*Chunk{}
+	for _, chunk := range gameWorld.chunks {
+		if chunk.isModified && chunk.isGenerated.Load() {
+			modified = append(modified, chunk)
+		}
+	}
+	gameWorld.chunksMutex.RUnlock()
+
+	var firstErr error
+	for _, chunk := range modified {
+		if err := chunk.Save(gameWorld.saveDirectory); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		chunk.isModified = false
+	}
+	return firstErr
+}
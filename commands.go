@@ -0,0 +1,119 @@
+// Implements a small text command system for debugging and world control.
+// Commands are typed into the terminal the game was started from; lines are read
+// on a background goroutine and executed on the main thread between frames.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CommandHandler runs a command with its arguments (the command name excluded).
+// Returns a message to print or an error describing incorrect usage.
+type CommandHandler func(args []string) (string, error)
+
+// Command couples a handler with its usage text.
+type Command struct {
+	usage   string         // Short usage line shown by "help"
+	handler CommandHandler // Function executing the command
+}
+
+// CommandRegistry holds all known commands and the queue of lines to run.
+type CommandRegistry struct {
+	commands map[string]Command // Registered commands by name
+	pending  chan string        // Lines read from stdin, waiting for the main thread
+}
+
+// Initialize creates an empty registry with the built-in "help" command.
+func (registry *CommandRegistry) Initialize() {
+	registry.commands = make(map[string]Command)
+	registry.pending = make(chan string, 64)
+
+	registry.Register("help", "help - list all commands", func(args []string) (string, error) {
+		names := make([]string, 0, len(registry.commands))
+		for name := range registry.commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		lines := make([]string, 0, len(names))
+		for _, name := range names {
+			lines = append(lines, registry.commands[name].usage)
+		}
+		return strings.Join(lines, "\n"), nil
+	})
+}
+
+// Register adds a command to the registry, replacing any command with the same name.
+// name: Word typed to run the command
+// usage: Usage line shown by "help"
+// handler: Function executing the command
+func (registry *CommandRegistry) Register(name, usage string, handler CommandHandler) {
+	registry.commands[name] = Command{usage, handler}
+}
+
+// Execute parses and runs a single command line.
+// Returns the command output or an error for unknown commands and bad arguments.
+func (registry *CommandRegistry) Execute(line string) (string, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	command, exists := registry.commands[fields[0]]
+	if !exists {
+		return "", fmt.Errorf("unknown command %q, type \"help\" for a list", fields[0])
+	}
+
+	output, err := command.handler(fields[1:])
+	if err != nil {
+		return "", fmt.Errorf("%v\nusage: %s", err, command.usage)
+	}
+	return output, nil
+}
+
+// ListenStdin starts a goroutine that queues every line typed into the terminal.
+func (registry *CommandRegistry) ListenStdin() {
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			registry.pending <- scanner.Text()
+		}
+	}()
+}
+
+// ProcessPending runs all queued command lines and prints their results.
+// Must be called from the main thread, since commands may touch GL state.
+func (registry *CommandRegistry) ProcessPending() {
+	for {
+		select {
+		case line := <-registry.pending:
+			output, err := registry.Execute(line)
+			if err != nil {
+				fmt.Println(err)
+			} else if output != "" {
+				fmt.Println(output)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// parseFiniteFloat parses a command argument as a number. NaN and infinities,
+// which strconv.ParseFloat accepts, are rejected: they would pass every range
+// check and corrupt the setting they end up in.
+// text: Argument to parse
+func parseFiniteFloat(text string) (float64, error) {
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0.0, fmt.Errorf("invalid value %q", text)
+	}
+	return value, nil
+}
@@ -0,0 +1,408 @@
+// Implements the debug overlays used to inspect meshing and chunk streaming.
+// Each overlay is toggled with a function key (see GameLoop.KeyPress) or the
+// "debug" command:
+//
+//	F3 wireframe - mesh edges drawn over the world
+//	F4 borders   - chunk corners, chunk rings and chunk coordinates around the camera
+//	F5 normals   - one line per face of the chunks around the camera
+//	F6 states    - map of the chunks in render distance, colored by mesh state
+//	F7 faces     - world colored by face direction instead of textured
+//
+// Lines and the map are rebuilt from the world every frame, which is simple
+// and fast enough for a debugging aid.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// Debug overlay constants.
+const (
+	DEBUG_BORDER_RADIUS = 2   // Chunks around the camera chunk that get border lines and labels
+	DEBUG_NORMAL_RADIUS = 1   // Chunks around the camera chunk whose face normals are drawn
+	DEBUG_NORMAL_LENGTH = 0.4 // Length of a normal line in blocks
+	DEBUG_LABEL_HEIGHT  = 1.5 // Height of the chunk coordinate digits in blocks
+	DEBUG_MAP_CELL      = 6   // Largest size of one chunk on the mesh state map in pixels
+	DEBUG_MAP_MARGIN    = 10  // Distance of the map from the top right window corner in pixels
+)
+
+// Colors of the debug overlays.
+var (
+	DEBUG_BORDER_COLOR       = mgl32.Vec3{1.0, 0.85, 0.1} // Corners of the chunks around the camera
+	DEBUG_CAMERA_CHUNK_COLOR = mgl32.Vec3{0.2, 0.5, 1.0}  // Corners and chunk rings of the camera column
+	DEBUG_LABEL_COLOR        = mgl32.Vec3{1.0, 1.0, 1.0}  // Chunk coordinates
+	DEBUG_MAP_BACKGROUND     = mgl32.Vec3{0.0, 0.0, 0.0}  // Behind the mesh state map and the camera marker
+	DEBUG_MAP_CAMERA_COLOR   = mgl32.Vec3{1.0, 1.0, 1.0}  // Frame around the camera chunk on the map
+)
+
+// DEBUG_MESH_STATE_COLORS colors the mesh state map, indexed by ChunkMeshState.
+var DEBUG_MESH_STATE_COLORS = [3]mgl32.Vec3{
+	{0.8, 0.2, 0.2},  // CHUNK_MESH_GENERATING
+	{0.95, 0.8, 0.2}, // CHUNK_MESH_DIRTY
+	{0.2, 0.75, 0.3}, // CHUNK_MESH_UPLOADED
+}
+
+// debugDigitSegments lists the strokes of the label glyphs, seven-segment style.
+// Glyphs are one unit wide and two units tall, the origin is the bottom left.
+var debugDigitSegments = map[rune][][4]float32{
+	'0': {{0, 2, 1, 2}, {1, 2, 1, 0}, {1, 0, 0, 0}, {0, 0, 0, 2}},
+	'1': {{1, 2, 1, 0}},
+	'2': {{0, 2, 1, 2}, {1, 2, 1, 1}, {1, 1, 0, 1}, {0, 1, 0, 0}, {0, 0, 1, 0}},
+	'3': {{0, 2, 1, 2}, {1, 2, 1, 0}, {1, 0, 0, 0}, {0, 1, 1, 1}},
+	'4': {{0, 2, 0, 1}, {0, 1, 1, 1}, {1, 2, 1, 0}},
+	'5': {{1, 2, 0, 2}, {0, 2, 0, 1}, {0, 1, 1, 1}, {1, 1, 1, 0}, {1, 0, 0, 0}},
+	'6': {{1, 2, 0, 2}, {0, 2, 0, 0}, {0, 0, 1, 0}, {1, 0, 1, 1}, {1, 1, 0, 1}},
+	'7': {{0, 2, 1, 2}, {1, 2, 1, 0}},
+	'8': {{0, 2, 1, 2}, {1, 2, 1, 0}, {1, 0, 0, 0}, {0, 0, 0, 2}, {0, 1, 1, 1}},
+	'9': {{1, 1, 0, 1}, {0, 1, 0, 2}, {0, 2, 1, 2}, {1, 2, 1, 0}, {1, 0, 0, 0}},
+	'-': {{0, 1, 1, 1}},
+	',': {{0.5, 0, 0.2, -0.5}},
+}
+
+// DebugOverlays holds the switches and the geometry of the debug overlays.
+type DebugOverlays struct {
+	wireframe         bool      // Draw mesh edges over the world (F3)
+	chunkBorders      bool      // Draw chunk borders and coordinates around the camera (F4)
+	normals           bool      // Draw face normals around the camera (F5)
+	meshStates        bool      // Draw the mesh state map (F6)
+	faceDirection     bool      // Color the world by face direction (F7)
+	wireframeMaterial *Material // Mesh edges
+	lineMaterial      *Material // World space lines
+	screenMaterial    *Material // Screen space triangles
+	faceMaterial      *Material // Face direction coloring of the world
+	lines             Mesh      // World space lines, rebuilt every frame
+	screen            Mesh      // Screen space triangles, rebuilt every frame
+}
+
+// debugToggle couples an overlay switch with its name and key.
+type debugToggle struct {
+	name    string // Name used by the "debug" command
+	key     string // Function key toggling it
+	enabled *bool  // The switch
+}
+
+// Initialize looks up the materials of the overlays. All overlays start off.
+// materials: Library holding the "wireframe", "lines", "screen" and "faces" materials
+func (overlays *DebugOverlays) Initialize(materials *MaterialLibrary) {
+	overlays.wireframeMaterial = materials.Material("wireframe")
+	overlays.lineMaterial = materials.Material("lines")
+	overlays.screenMaterial = materials.Material("screen")
+	overlays.faceMaterial = materials.Material("faces")
+}
+
+// toggles lists the overlay switches in key order.
+func (overlays *DebugOverlays) toggles() []debugToggle {
+	return []debugToggle{
+		{"wireframe", "F3", &overlays.wireframe},
+		{"borders", "F4", &overlays.chunkBorders},
+		{"normals", "F5", &overlays.normals},
+		{"states", "F6", &overlays.meshStates},
+		{"faces", "F7", &overlays.faceDirection},
+	}
+}
+
+// Toggle switches an overlay on or off and prints its new state.
+// name: Overlay name (see toggles)
+func (overlays *DebugOverlays) Toggle(name string) {
+	for _, toggle := range overlays.toggles() {
+		if toggle.name == name {
+			*toggle.enabled = !*toggle.enabled
+			fmt.Printf("debug %s %v\n", toggle.name, *toggle.enabled)
+			return
+		}
+	}
+}
+
+// WorldMaterial returns the material the world is drawn with: the face
+// direction material while that mode is on, otherwise the given material.
+// material: Material the world normally uses
+func (overlays *DebugOverlays) WorldMaterial(material *Material) *Material {
+	if overlays.faceDirection {
+		return overlays.faceMaterial
+	}
+	return material
+}
+
+// RegisterCommands adds the "debug" command to a registry.
+func (overlays *DebugOverlays) RegisterCommands(registry *CommandRegistry) {
+	registry.Register(
+		"debug",
+		"debug [<wireframe | borders | normals | states | faces> <on|off>] - list or toggle the debug overlays",
+		func(args []string) (string, error) {
+			switch {
+			case len(args) == 0:
+			case len(args) == 2 && (args[1] == "on" || args[1] == "off"):
+				found := false
+				for _, toggle := range overlays.toggles() {
+					if toggle.name == args[0] {
+						*toggle.enabled = args[1] == "on"
+						found = true
+					}
+				}
+				if !found {
+					return "", fmt.Errorf("unknown overlay %q", args[0])
+				}
+			default:
+				return "", fmt.Errorf("invalid arguments")
+			}
+
+			lines := []string{}
+			for _, toggle := range overlays.toggles() {
+				lines = append(lines, fmt.Sprintf("  %-3s %-9s %v", toggle.key, toggle.name, *toggle.enabled))
+			}
+			return strings.Join(lines, "\n"), nil
+		},
+	)
+}
+
+// RenderDebugOverlays draws the enabled overlays over the world.
+// Called after the world has been drawn, before post-processing.
+func (loop *GameLoop) RenderDebugOverlays() {
+	overlays := &loop.debug
+
+	// Draw the visible chunks a second time as outlines
+	if overlays.wireframe {
+		loop.UseMaterial(overlays.wireframeMaterial)
+		loop.gameWorld.Render(loop.currentShader)
+		loop.gameWorld.RenderLiquids(loop.currentShader)
+	}
+
+	// Lines are relative to the origin of the camera's chunk
+	cameraChunk := ChunkPosAt(loop.camera.position)
+	overlays.lines.vertices = overlays.lines.vertices[:0]
+	if overlays.chunkBorders {
+		addChunkBorderLines(&overlays.lines, &loop.gameWorld, loop.camera)
+	}
+	if overlays.normals {
+		addNormalLines(&overlays.lines, &loop.gameWorld, loop.camera.position)
+	}
+	if len(overlays.lines.vertices) > 0 {
+		overlays.lines.PrepareArrayData()
+		overlays.lines.UpdateVAO()
+		loop.UseMaterialAt(overlays.lineMaterial, cameraChunk.Origin().Vec3())
+		overlays.lines.RenderLines()
+	}
+
+	if overlays.meshStates {
+		overlays.screen.vertices = overlays.screen.vertices[:0]
+		addMeshStateMap(&overlays.screen, &loop.gameWorld, loop.window.width, loop.window.height)
+		overlays.screen.PrepareArrayData()
+		overlays.screen.UpdateVAO()
+		loop.UseMaterial(overlays.screenMaterial)
+		overlays.screen.Render()
+	}
+}
+
+// addLine appends one line segment to a line mesh.
+// mesh: Line mesh
+// from, to: End points
+// color: Line color
+func addLine(mesh *Mesh, from, to, color mgl32.Vec3) {
+	normal := mgl32.Vec3{0.0, 1.0, 0.0}
+	mesh.AddVertex(from, color, normal, mgl32.Vec2{})
+	mesh.AddVertex(to, color, normal, mgl32.Vec2{})
+}
+
+// addChunkBorderLines appends the borders of the chunks around the camera:
+// vertical lines at every chunk corner between the build limits, rings at the
+// chunk boundaries of the camera's column, and the coordinate of each chunk of
+// the camera's layer at its center, facing the camera.
+// Positions are relative to the origin of the camera's chunk.
+// mesh: Line mesh
+// gameWorld: World providing the build limits
+// camera: Camera the borders are placed around
+func addChunkBorderLines(mesh *Mesh, gameWorld *GameWorld, camera *Camera) {
+	cameraChunk := ChunkPosAt(camera.position)
+	origin := cameraChunk.Origin()
+	bottom, top := float32(gameWorld.minHeight-origin.y), float32(gameWorld.maxHeight-origin.y)
+
+	for x := -DEBUG_BORDER_RADIUS; x <= DEBUG_BORDER_RADIUS+1; x++ {
+		for z := -DEBUG_BORDER_RADIUS; z <= DEBUG_BORDER_RADIUS+1; z++ {
+			color := DEBUG_BORDER_COLOR
+			if (x == 0 || x == 1) && (z == 0 || z == 1) {
+				color = DEBUG_CAMERA_CHUNK_COLOR
+			}
+			corner := mgl32.Vec3{float32(x * CHUNK_SIZE), 0.0, float32(z * CHUNK_SIZE)}
+			addLine(mesh, mgl32.Vec3{corner[0], bottom, corner[2]}, mgl32.Vec3{corner[0], top, corner[2]}, color)
+		}
+	}
+
+	// Chunk boundaries of the camera column
+	for height := gameWorld.minHeight; height <= gameWorld.maxHeight; height += CHUNK_SIZE {
+		y := float32(height - origin.y)
+		corners := [4]mgl32.Vec3{{0, y, 0}, {CHUNK_SIZE, y, 0}, {CHUNK_SIZE, y, CHUNK_SIZE}, {0, y, CHUNK_SIZE}}
+		for i := range corners {
+			addLine(mesh, corners[i], corners[(i+1)%4], DEBUG_CAMERA_CHUNK_COLOR)
+		}
+	}
+
+	// Chunk coordinates at eye height
+	eyeHeight := float32(camera.position[1] - float64(origin.y))
+	for x := -DEBUG_BORDER_RADIUS; x <= DEBUG_BORDER_RADIUS; x++ {
+		for z := -DEBUG_BORDER_RADIUS; z <= DEBUG_BORDER_RADIUS; z++ {
+			center := mgl32.Vec3{float32(x*CHUNK_SIZE + CHUNK_SIZE/2), eyeHeight, float32(z*CHUNK_SIZE + CHUNK_SIZE/2)}
+			label := cameraChunk.Add(x, 0, z)
+			addLineText(mesh, fmt.Sprintf("%d,%d,%d", label.x, label.y, label.z), center, camera.right, camera.up, DEBUG_LABEL_HEIGHT, DEBUG_LABEL_COLOR)
+		}
+	}
+}
+
+// addLineText appends text drawn with line strokes (digits, '-' and ',').
+// mesh: Line mesh
+// text: Text to draw, other characters leave a gap
+// center: Center of the text in world space
+// right, up: Directions of the text's baseline and of its glyphs' height
+// height: Glyph height in blocks
+// color: Line color
+func addLineText(mesh *Mesh, text string, center, right, up mgl32.Vec3, height float32, color mgl32.Vec3) {
+	scale := height / 2.0
+	advance := float32(1.5)
+	width := float32(len(text))*advance - 0.5
+
+	// Glyph units to world space, centered on the text
+	point := func(x, y float32) mgl32.Vec3 {
+		return center.Add(right.Mul((x - width/2.0) * scale)).Add(up.Mul((y - 1.0) * scale))
+	}
+	for i, character := range text {
+		offset := float32(i) * advance
+		for _, stroke := range debugDigitSegments[character] {
+			addLine(mesh, point(offset+stroke[0], stroke[1]), point(offset+stroke[2], stroke[3]), color)
+		}
+	}
+}
+
+// debugDirectionColor colors a normal the way the face direction mode does:
+// X red, Y green, Z blue, negative directions darker.
+func debugDirectionColor(normal mgl32.Vec3) mgl32.Vec3 {
+	color := mgl32.Vec3{float32(math.Abs(float64(normal[0]))), float32(math.Abs(float64(normal[1]))), float32(math.Abs(float64(normal[2])))}
+	if normal[0]+normal[1]+normal[2] < 0.0 {
+		color = color.Mul(0.45)
+	}
+	return color
+}
+
+// addNormalLines appends one line per mesh face of the chunks around the
+// camera, from the face center along its normal. Positions are relative to
+// the origin of the camera's chunk.
+// mesh: Line mesh
+// gameWorld: World holding the chunk meshes
+// position: Camera position
+func addNormalLines(mesh *Mesh, gameWorld *GameWorld, position mgl64.Vec3) {
+	cameraChunk := ChunkPosAt(position)
+	for x := -DEBUG_NORMAL_RADIUS; x <= DEBUG_NORMAL_RADIUS; x++ {
+		for y := -DEBUG_NORMAL_RADIUS; y <= DEBUG_NORMAL_RADIUS; y++ {
+			for z := -DEBUG_NORMAL_RADIUS; z <= DEBUG_NORMAL_RADIUS; z++ {
+				chunk := gameWorld.GetChunk(cameraChunk.Add(x, y, z))
+				if chunk == nil {
+					continue
+				}
+
+				// Faces are two triangles sharing a diagonal; the mean of their six
+				// vertices is the center of the face (relative to the chunk origin)
+				offset := mgl32.Vec3{float32(x * CHUNK_SIZE), float32(y * CHUNK_SIZE), float32(z * CHUNK_SIZE)}
+				chunk.meshMutex.Lock()
+				vertices := chunk.mesh.vertices
+				for face := 0; face+6 <= len(vertices); face += 6 {
+					center := mgl32.Vec3{}
+					for _, vertex := range vertices[face : face+6] {
+						center = center.Add(vertex.position)
+					}
+					center = center.Mul(1.0 / 6.0).Add(offset)
+					normal := vertices[face].normal
+					addLine(mesh, center, center.Add(normal.Mul(DEBUG_NORMAL_LENGTH)), debugDirectionColor(normal))
+				}
+				chunk.meshMutex.Unlock()
+			}
+		}
+	}
+}
+
+// addScreenRect appends a rectangle to a mesh drawn with the "screen" material,
+// converting pixels (origin top left) to clip space.
+// mesh: Screen space triangle mesh
+// x0, y0, x1, y1: Opposite corners in pixels
+// width, height: Window size in pixels
+// color: Rectangle color
+func addScreenRect(mesh *Mesh, x0, y0, x1, y1, width, height int, color mgl32.Vec3) {
+	toClip := func(x, y int) mgl32.Vec3 {
+		return mgl32.Vec3{float32(x)/float32(width)*2.0 - 1.0, 1.0 - float32(y)/float32(height)*2.0, 0.0}
+	}
+	normal := mgl32.Vec3{0.0, 0.0, 1.0}
+	a, b, c, d := toClip(x0, y0), toClip(x1, y0), toClip(x1, y1), toClip(x0, y1)
+	for _, corner := range []mgl32.Vec3{a, d, c, a, c, b} {
+		mesh.AddVertex(corner, color, normal, mgl32.Vec2{})
+	}
+}
+
+// addMeshStateMap appends the mesh state map: one square per chunk column within
+// render distance in the top right corner, +X to the right and +Z down,
+// colored by DEBUG_MESH_STATE_COLORS and darker for coarser LOD meshes.
+// A column shows its least advanced chunk and its coarsest mesh.
+// mesh: Screen space triangle mesh
+// gameWorld: World whose chunks are shown
+// width, height: Window size in pixels
+func addMeshStateMap(mesh *Mesh, gameWorld *GameWorld, width, height int) {
+	side := 2*gameWorld.renderDistance + 1
+	if side <= 0 || width <= 0 || height <= 0 {
+		return
+	}
+	cell := max(min(DEBUG_MAP_CELL, height/3/side), 1)
+	left := width - DEBUG_MAP_MARGIN - side*cell
+	top := DEBUG_MAP_MARGIN
+
+	rect := func(x0, y0, x1, y1 int, color mgl32.Vec3) {
+		addScreenRect(mesh, x0, y0, x1, y1, width, height, color)
+	}
+	rect(left-2, top-2, left+side*cell+2, top+side*cell+2, DEBUG_MAP_BACKGROUND)
+
+	// The render area is centered on the camera chunk; right after the camera
+	// entered another chunk the render list still lags behind by a cell
+	cameraChunk := ChunkPosAt(gameWorld.currentCamera.position)
+	origin := cameraChunk.Add(-gameWorld.renderDistance, 0, -gameWorld.renderDistance)
+	if column, row := cameraChunk.x-origin.x, cameraChunk.z-origin.z; column >= 0 && column < side && row >= 0 && row < side {
+		x, y := left+column*cell, top+row*cell
+		rect(x-1, y-1, x+cell+1, y+cell+1, DEBUG_MAP_CAMERA_COLOR)
+	}
+
+	// Merge the chunks of every column
+	states := make([]ChunkMeshState, side*side)
+	lods := make([]int, side*side)
+	loaded := make([]bool, side*side)
+	for _, chunk := range gameWorld.frameChunks {
+		column := chunk.position.x - origin.x
+		row := chunk.position.z - origin.z
+		if column < 0 || column >= side || row < 0 || row >= side {
+			continue
+		}
+		index := row*side + column
+		state := chunk.MeshState()
+		if !loaded[index] || state < states[index] {
+			states[index] = state
+		}
+		lods[index] = max(lods[index], chunk.MeshLOD())
+		loaded[index] = true
+	}
+
+	// A one pixel gap keeps neighbouring cells apart when they are large enough
+	gap := 0
+	if cell >= 4 {
+		gap = 1
+	}
+	for index, state := range states {
+		if !loaded[index] {
+			continue
+		}
+		color := DEBUG_MESH_STATE_COLORS[state]
+		if state != CHUNK_MESH_GENERATING {
+			color = color.Mul(1.0 - 0.15*float32(lods[index]))
+		}
+		x, y := left+index%side*cell, top+index/side*cell
+		rect(x+gap, y+gap, x+cell, y+cell, color)
+	}
+}
@@ -0,0 +1,8 @@
+// Depth buffer helpers
+#pragma once
+
+// Converts a depth buffer value (0..1) of a perspective projection to the view distance
+float linearizeDepth(float depth, float near, float far) {
+    float ndc = depth * 2.0 - 1.0;
+    return 2.0 * near * far / (far + near - ndc * (far - near));
+}
@@ -0,0 +1,248 @@
+// Implements a cellular-automaton fluid simulation for water blocks.
+// Every water block carries a level: 0 is a source block, 1-7 are flowing
+// blocks that get thinner the further they are from their source. Fluid falls
+// down first and spreads sideways when it lands. Only cells that were touched
+// recently are "active" and get processed, so settled water costs nothing.
+
+package main
+
+import (
+	"sort"
+)
+
+// Fluid level constants. Lower levels are stronger (closer to the source).
+const (
+	FLUID_LEVEL_SOURCE  = 0  // Source block, never drains on its own
+	FLUID_LEVEL_FALLING = 1  // Level given to water falling down from above
+	FLUID_LEVEL_MAX     = 7  // Thinnest flowing level, does not spread any further
+	FLUID_LEVEL_NONE    = -1 // Marks a cell without water
+)
+
+// FluidWorld is the block storage the fluid simulation reads and writes.
+// GameWorld implements it for the running game, but any grid can be used,
+// which lets the simulation run headless without a window or GL context.
+type FluidWorld interface {
+	// GetBlock returns the block ID at a world position and whether that
+	// position is currently loaded.
+	GetBlock(block BlockPos) (int, bool)
+	// SetBlock replaces the block ID at a world position.
+	SetBlock(block BlockPos, blockID int)
+	// GetFluidLevel returns the fluid level stored at a world position.
+	GetFluidLevel(block BlockPos) int
+	// SetFluidLevel stores the fluid level at a world position.
+	SetFluidLevel(block BlockPos, level int)
+}
+
+// fluidHorizontalOffsets lists the four horizontal neighbours in a fixed order
+// so that spreading is deterministic.
+var fluidHorizontalOffsets = [4]BlockPos{
+	{-1, 0, 0}, {1, 0, 0}, {0, 0, -1}, {0, 0, 1},
+}
+
+// fluidCellLess orders cells by Y, then X, then Z. Processing cells in a fixed
+// order keeps every tick deterministic regardless of map iteration order.
+func fluidCellLess(a, b BlockPos) bool {
+	if a.y != b.y {
+		return a.y < b.y
+	}
+	if a.x != b.x {
+		return a.x < b.x
+	}
+	return a.z < b.z
+}
+
+// FluidSimulator advances water on a fixed tick.
+// Each tick reads the world state from before the tick, collects the changes
+// of every active cell and then applies them all at once.
+type FluidSimulator struct {
+	world   FluidWorld        // Block storage the simulation runs on
+	active  map[BlockPos]bool // Cells to process on the next tick
+	changed []BlockPos        // Cells modified by the last tick, in deterministic order
+}
+
+// Initialize prepares the simulator to run on the given world.
+func (simulator *FluidSimulator) Initialize(world FluidWorld) {
+	simulator.world = world
+	simulator.active = make(map[BlockPos]bool)
+	simulator.changed = nil
+}
+
+// Wake marks a cell as active so it is processed on the next tick.
+// Should be called whenever a block next to fluid changes.
+func (simulator *FluidSimulator) Wake(cell BlockPos) {
+	simulator.active[cell] = true
+}
+
+// WakeNeighbours marks a cell and its six face neighbours as active.
+func (simulator *FluidSimulator) WakeNeighbours(cell BlockPos) {
+	simulator.active[cell] = true
+	for _, neighbour := range cell.Neighbours() {
+		simulator.active[neighbour] = true
+	}
+}
+
+// PlaceSource puts a water source block at the given position and wakes it.
+func (simulator *FluidSimulator) PlaceSource(cell BlockPos) {
+	simulator.world.SetBlock(cell, BLOCK_WATER)
+	simulator.world.SetFluidLevel(cell, FLUID_LEVEL_SOURCE)
+	simulator.WakeNeighbours(cell)
+}
+
+// ActiveCount returns how many cells are waiting to be processed.
+func (simulator *FluidSimulator) ActiveCount() int {
+	return len(simulator.active)
+}
+
+// Changed returns the cells modified by the last call to Tick.
+func (simulator *FluidSimulator) Changed() []BlockPos {
+	return simulator.changed
+}
+
+// levelAt returns the fluid level at a cell, or FLUID_LEVEL_NONE when
+// the cell holds no water or is not loaded.
+func (simulator *FluidSimulator) levelAt(cell BlockPos) int {
+	blockID, loaded := simulator.world.GetBlock(cell)
+	if !loaded || blockID != BLOCK_WATER {
+		return FLUID_LEVEL_NONE
+	}
+	return simulator.world.GetFluidLevel(cell)
+}
+
+// isOpen reports whether fluid can flow into a cell (loaded air).
+func (simulator *FluidSimulator) isOpen(cell BlockPos) bool {
+	blockID, loaded := simulator.world.GetBlock(cell)
+	return loaded && blockID == BLOCK_AIR
+}
+
+// isResting reports whether water in a cell lies on something it can spread over:
+// a solid block or a water source. Water above air or flowing water keeps falling.
+func (simulator *FluidSimulator) isResting(cell BlockPos) bool {
+	below := cell.Add(BlockPos{0, -1, 0})
+	blockID, loaded := simulator.world.GetBlock(below)
+	if !loaded || blockID == BLOCK_AIR {
+		return false
+	}
+	if blockID == BLOCK_WATER {
+		return simulator.world.GetFluidLevel(below) == FLUID_LEVEL_SOURCE
+	}
+	return true
+}
+
+// supportedLevel computes the level a flowing cell should have from its
+// neighbours: water above feeds it as falling water, otherwise it is one
+// level thinner than its strongest horizontal neighbour.
+func (simulator *FluidSimulator) supportedLevel(cell BlockPos) int {
+	if simulator.levelAt(cell.Add(BlockPos{0, 1, 0})) != FLUID_LEVEL_NONE {
+		return FLUID_LEVEL_FALLING
+	}
+
+	best := FLUID_LEVEL_NONE
+	for _, offset := range fluidHorizontalOffsets {
+		neighbour := cell.Add(offset)
+		level := simulator.levelAt(neighbour)
+		if level == FLUID_LEVEL_NONE || level >= FLUID_LEVEL_MAX {
+			continue
+		}
+
+		// Water only spreads sideways once it rests on something,
+		// so a neighbour that is still falling does not feed this cell.
+		if !simulator.isResting(neighbour) {
+			continue
+		}
+
+		if best == FLUID_LEVEL_NONE || level+1 < best {
+			best = level + 1
+		}
+	}
+	return best
+}
+
+// proposeLevel records a pending change, keeping the strongest water
+// when several cells want to write into the same position.
+func proposeLevel(updates map[BlockPos]int, cell BlockPos, level int) {
+	current, exists := updates[cell]
+	if !exists || current == FLUID_LEVEL_NONE || (level != FLUID_LEVEL_NONE && level < current) {
+		updates[cell] = level
+	}
+}
+
+// Tick advances the simulation by one step.
+// Returns the number of cells that changed.
+func (simulator *FluidSimulator) Tick() int {
+	// Sort the active set so updates happen in the same order every run
+	cells := make([]BlockPos, 0, len(simulator.active))
+	for cell := range simulator.active {
+		cells = append(cells, cell)
+	}
+	sort.Slice(cells, func(i, j int) bool { return fluidCellLess(cells[i], cells[j]) })
+	simulator.active = make(map[BlockPos]bool)
+
+	// Collect changes against the state from before this tick
+	updates := make(map[BlockPos]int)
+	for _, cell := range cells {
+		level := simulator.levelAt(cell)
+		if level == FLUID_LEVEL_NONE {
+			continue
+		}
+
+		// Flowing water follows its neighbours and dries up without support
+		if level != FLUID_LEVEL_SOURCE {
+			supported := simulator.supportedLevel(cell)
+			if supported != level {
+				proposeLevel(updates, cell, supported)
+			}
+			if supported == FLUID_LEVEL_NONE {
+				continue
+			}
+			level = supported
+		}
+
+		// Fall down if the block below is open
+		below := cell.Add(BlockPos{0, -1, 0})
+		if simulator.isOpen(below) {
+			proposeLevel(updates, below, FLUID_LEVEL_FALLING)
+			continue
+		}
+
+		// Otherwise spread sideways while the water is thick enough
+		if level >= FLUID_LEVEL_MAX || !simulator.isResting(cell) {
+			continue
+		}
+		for _, offset := range fluidHorizontalOffsets {
+			neighbour := cell.Add(offset)
+			if simulator.isOpen(neighbour) {
+				proposeLevel(updates, neighbour, level+1)
+				continue
+			}
+			neighbourLevel := simulator.levelAt(neighbour)
+			if neighbourLevel > level+1 {
+				proposeLevel(updates, neighbour, level+1)
+			}
+		}
+	}
+
+	// Apply every change and wake the area around it for the next tick
+	simulator.changed = simulator.changed[:0]
+	for cell, level := range updates {
+		if level == simulator.levelAt(cell) {
+			continue
+		}
+		simulator.changed = append(simulator.changed, cell)
+	}
+	sort.Slice(simulator.changed, func(i, j int) bool {
+		return fluidCellLess(simulator.changed[i], simulator.changed[j])
+	})
+	for _, cell := range simulator.changed {
+		level := updates[cell]
+		if level == FLUID_LEVEL_NONE {
+			simulator.world.SetBlock(cell, BLOCK_AIR)
+			simulator.world.SetFluidLevel(cell, 0)
+		} else {
+			simulator.world.SetBlock(cell, BLOCK_WATER)
+			simulator.world.SetFluidLevel(cell, level)
+		}
+		simulator.WakeNeighbours(cell)
+	}
+
+	return len(simulator.changed)
+}
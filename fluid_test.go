@@ -0,0 +1,174 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testFluidWorld is a FluidWorld backed by maps. Blocks inside the loaded box
+// default to air, blocks outside it are not loaded.
+type testFluidWorld struct {
+	low, high BlockPos         // Corners of the loaded box, inclusive
+	blocks    map[BlockPos]int // Block IDs other than air
+	levels    map[BlockPos]int // Fluid levels
+}
+
+// newTestFluidWorld creates a loaded box with a stone floor at its lowest layer.
+func newTestFluidWorld(low, high BlockPos) *testFluidWorld {
+	world := &testFluidWorld{low, high, map[BlockPos]int{}, map[BlockPos]int{}}
+	for x := low.x; x <= high.x; x++ {
+		for z := low.z; z <= high.z; z++ {
+			world.blocks[BlockPos{x, low.y, z}] = BLOCK_STONE
+		}
+	}
+	return world
+}
+
+// GetBlock returns the block ID at a position and whether it lies in the loaded box.
+func (world *testFluidWorld) GetBlock(block BlockPos) (int, bool) {
+	if block.x < world.low.x || block.y < world.low.y || block.z < world.low.z ||
+		block.x > world.high.x || block.y > world.high.y || block.z > world.high.z {
+		return BLOCK_AIR, false
+	}
+	return world.blocks[block], true
+}
+
+// SetBlock replaces the block ID at a position.
+func (world *testFluidWorld) SetBlock(block BlockPos, blockID int) {
+	if blockID == BLOCK_AIR {
+		delete(world.blocks, block)
+		return
+	}
+	world.blocks[block] = blockID
+}
+
+// GetFluidLevel returns the fluid level stored at a position.
+func (world *testFluidWorld) GetFluidLevel(block BlockPos) int {
+	return world.levels[block]
+}
+
+// SetFluidLevel stores the fluid level at a position.
+func (world *testFluidWorld) SetFluidLevel(block BlockPos, level int) {
+	world.levels[block] = level
+}
+
+// level returns the water level at a block, or FLUID_LEVEL_NONE without water.
+func (world *testFluidWorld) level(block BlockPos) int {
+	if world.blocks[block] != BLOCK_WATER {
+		return FLUID_LEVEL_NONE
+	}
+	return world.levels[block]
+}
+
+// settleFluids ticks until nothing changes and returns the number of ticks run.
+func settleFluids(t *testing.T, simulator *FluidSimulator) int {
+	t.Helper()
+	for ticks := 1; ticks <= 500; ticks++ {
+		if simulator.Tick() == 0 && simulator.ActiveCount() == 0 {
+			return ticks
+		}
+	}
+	t.Fatalf("water still flowing after 500 ticks, %d cells active", simulator.ActiveCount())
+	return 0
+}
+
+// TestFluidSourceSpreads checks that a source on a flat floor spreads one level
+// per block up to FLUID_LEVEL_MAX and then stops.
+func TestFluidSourceSpreads(t *testing.T) {
+	world := newTestFluidWorld(BlockPos{-12, 0, -12}, BlockPos{12, 4, 12})
+	simulator := FluidSimulator{}
+	simulator.Initialize(world)
+	simulator.PlaceSource(BlockPos{0, 1, 0})
+	settleFluids(t, &simulator)
+
+	for x := -12; x <= 12; x++ {
+		for z := -12; z <= 12; z++ {
+			block := BlockPos{x, 1, z}
+			expected := abs(x) + abs(z)
+			if expected > FLUID_LEVEL_MAX {
+				expected = FLUID_LEVEL_NONE
+			}
+			if level := world.level(block); level != expected {
+				t.Errorf("level at %s is %d, expected %d", block, level, expected)
+			}
+		}
+	}
+	if simulator.Tick() != 0 {
+		t.Errorf("settled water changed on another tick")
+	}
+}
+
+// TestFluidFallsDown checks that water over a shaft falls to the floor as
+// falling water and only spreads once it lands.
+func TestFluidFallsDown(t *testing.T) {
+	world := newTestFluidWorld(BlockPos{-4, 0, -4}, BlockPos{4, 10, 4})
+	simulator := FluidSimulator{}
+	simulator.Initialize(world)
+	simulator.PlaceSource(BlockPos{0, 8, 0})
+	settleFluids(t, &simulator)
+
+	for y := 1; y < 8; y++ {
+		if level := world.level(BlockPos{0, y, 0}); level != FLUID_LEVEL_FALLING {
+			t.Errorf("level at height %d is %d, expected falling water", y, level)
+		}
+	}
+	if level := world.level(BlockPos{1, 1, 0}); level != FLUID_LEVEL_FALLING+1 {
+		t.Errorf("level next to the landing point is %d, expected %d", level, FLUID_LEVEL_FALLING+1)
+	}
+	if level := world.level(BlockPos{1, 2, 0}); level != FLUID_LEVEL_NONE {
+		t.Errorf("falling water spread sideways in the air (level %d)", level)
+	}
+}
+
+// TestFluidDrains checks that flowing water dries up after its source is removed.
+func TestFluidDrains(t *testing.T) {
+	world := newTestFluidWorld(BlockPos{-10, 0, -10}, BlockPos{10, 6, 10})
+	simulator := FluidSimulator{}
+	simulator.Initialize(world)
+	source := BlockPos{0, 4, 0}
+	simulator.PlaceSource(source)
+	settleFluids(t, &simulator)
+	if world.level(BlockPos{3, 1, 0}) == FLUID_LEVEL_NONE {
+		t.Fatalf("the source did not flood the floor")
+	}
+
+	world.SetBlock(source, BLOCK_AIR)
+	world.SetFluidLevel(source, 0)
+	simulator.WakeNeighbours(source)
+	settleFluids(t, &simulator)
+
+	for block := range world.blocks {
+		if world.blocks[block] == BLOCK_WATER {
+			t.Errorf("water left at %s with level %d", block, world.levels[block])
+		}
+	}
+}
+
+// TestFluidDeterministic checks that two identical worlds change the same
+// cells in the same order on every tick.
+func TestFluidDeterministic(t *testing.T) {
+	run := func() [][]BlockPos {
+		world := newTestFluidWorld(BlockPos{-10, 0, -10}, BlockPos{10, 8, 10})
+		world.blocks[BlockPos{2, 1, 0}] = BLOCK_STONE
+		world.blocks[BlockPos{-1, 1, 3}] = BLOCK_STONE
+		simulator := FluidSimulator{}
+		simulator.Initialize(world)
+		simulator.PlaceSource(BlockPos{0, 6, 0})
+		simulator.PlaceSource(BlockPos{3, 1, 3})
+
+		changes := [][]BlockPos{}
+		for range 100 {
+			simulator.Tick()
+			changes = append(changes, append([]BlockPos{}, simulator.Changed()...))
+		}
+		return changes
+	}
+
+	first, second := run(), run()
+	if len(first[0]) == 0 {
+		t.Fatalf("the first tick changed nothing")
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("the two runs changed different cells")
+	}
+}
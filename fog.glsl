@@ -0,0 +1,19 @@
+// Distance fog (see sky.go for the modes)
+#pragma once
+
+uniform int fogMode;
+uniform float fogStart;
+uniform float fogEnd;
+uniform float fogDensity;
+uniform vec3 fogColor;
+
+// Fades a color into the fog color with the distance from the camera
+vec3 applyFog(vec3 color, float distance) {
+    float fogFactor = 1.0; // 1 = no fog, 0 = only fog
+    if (fogMode == 1) {
+        fogFactor = clamp((fogEnd - distance) / (fogEnd - fogStart), 0.0, 1.0);
+    } else if (fogMode == 2) {
+        fogFactor = clamp(exp(-fogDensity * distance), 0.0, 1.0);
+    }
+    return mix(fogColor, color, fogFactor);
+}
@@ -8,33 +8,59 @@ import (
 	"fmt"
 
 	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/glfw/v3.3/glfw"
 	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// Camera clip plane distances used by the projection matrix.
+const (
+	CAMERA_NEAR = 0.01
+	CAMERA_FAR  = 1000.0
 )
 
 // GameLoop is the central coordinator for game systems including rendering,
 // input processing, world management, and the main game update cycle.
 type GameLoop struct {
-	openGLVersion    string     // OpenGL version string retrieved from driver
-	basicShader      Shader     // Primary shader program for rendering
-	triangleMesh     Mesh       // Simple test mesh (triangle) for debugging/rendering
-	clearColor       mgl32.Vec4 // Background clear color (RGBA)
-	window           *Window    // Reference to the application window
-	currentShader    *Shader    // Currently active shader program
-	camera           *Camera    // Main camera for view control
-	projection       mgl32.Mat4 // Projection matrix (perspective)
-	model            mgl32.Mat4 // Model matrix (world transform)
-	cursorPrevPosX   float64    // Previous mouse X position for delta calculation
-	cursorPrevPosY   float64    // Previous mouse Y position for delta calculation
-	cursorFirstFrame bool       // Flag for ignoring first mouse input frame
-	gameWorld        GameWorld  // Main game world containing chunks and entities
-	textureAtlas     uint32     // OpenGL texture ID for the block texture atlas
+	openGLVersion    string          // OpenGL version string retrieved from driver
+	triangleMesh     Mesh            // Simple test mesh (triangle) for debugging/rendering
+	clearColor       mgl32.Vec4      // Background clear color (RGBA)
+	window           *Window         // Reference to the application window
+	currentShader    *Shader         // Currently active shader program
+	camera           *Camera         // Main camera for view control
+	projection       mgl32.Mat4      // Projection matrix (perspective)
+	model            mgl32.Mat4      // Model matrix UseMaterial uploads (identity: vertices are camera-relative or in screen space)
+	cursorPrevPosX   float64         // Previous mouse X position for delta calculation
+	cursorPrevPosY   float64         // Previous mouse Y position for delta calculation
+	cursorFirstFrame bool            // Flag for ignoring first mouse input frame
+	gameWorld        GameWorld       // Main game world containing chunks and entities
+	materials        MaterialLibrary // Materials loaded from MATERIAL_FILE
+	worldMaterial    *Material       // Material of the solid chunk faces
+	liquidMaterial   *Material       // Material of the water faces, blended over the solid ones
+	debugMaterial    *Material       // Material of debug geometry such as the test triangle
+	sky              Sky             // Procedural sky drawn behind the world
+	fog              Fog             // Distance fog parameters for the world shader
+	daylight         Daylight        // Light and sky colors for the current time of day
+	commands         CommandRegistry // Text commands typed into the terminal
+	shadowMap        ShadowMap       // Cascaded shadow maps for the sun/moon light
+	post             PostChain       // Off-screen HDR scene and post-processing passes
+	cameraUniforms   CameraUniforms  // Camera data shared by all programs this frame
+	cameraBuffer     UniformBuffer   // Uniform buffer holding cameraUniforms
+	screenshotQueued bool            // Save the next finished frame as a screenshot
+	debug            DebugOverlays   // Debug overlays toggled with F3-F7
+	hud              HUD             // On-screen statistics toggled with F1
+	target           BlockTarget     // Block the camera aims at
+	profilerGraph    ProfilerGraph   // Frame profiler graph toggled with F8
+	particles        ParticleSystem  // Block debris, rain and snow
+	animations       TextureAnimator // Animated tiles of the block atlas
 }
 
 // Initialize sets up the game loop with OpenGL, shaders, camera, and world systems.
 // window: The application window to render to and receive input from.
 func (loop *GameLoop) Initialize(window *Window) {
-	// Initialize OpenGL bindings
-	if err := gl.Init(); err != nil {
+	// Initialize the graphics API bindings
+	version, err := renderBackend.Init()
+	if err != nil {
 		panic(err)
 	}
 
@@ -44,29 +70,60 @@ func (loop *GameLoop) Initialize(window *Window) {
 	loop.camera = &Camera{}
 	loop.camera.InitializeDefaultValues()
 
-	// Register mouse callback for camera control
+	// Register mouse callback for camera control and key callback for hotkeys
 	window.cursorCallbacks = append(window.cursorCallbacks, loop.CursorMove)
+	window.keyCallbacks = append(window.keyCallbacks, loop.KeyPress)
+	window.mouseCallbacks = append(window.mouseCallbacks, loop.MousePress)
 
 	// Log OpenGL version for debugging
-	version := gl.GoStr(gl.GetString(gl.VERSION))
 	fmt.Println("OpenGL version", version)
 
-	// Load shader from files ("basic.glsl_vert", "basic.glsl_frag")
-	loop.basicShader.LoadFile("basic")
+	// Share the camera data with every program through a uniform buffer
+	loop.cameraBuffer.Initialize(CAMERA_UNIFORM_BINDING, CAMERA_UNIFORM_FLOATS)
+
+	// Load the materials (shaders, textures and render state) from their data file
+	loop.materials.Initialize(MATERIAL_FILE)
+	loop.worldMaterial = loop.materials.Material("opaque")
+	loop.liquidMaterial = loop.materials.Material("liquid")
+	loop.debugMaterial = loop.materials.Material("debug")
+	loop.debug.Initialize(&loop.materials)
+	loop.hud.Initialize(&loop.materials)
+	loop.target.Initialize(&loop.materials)
+	loop.profilerGraph.Initialize(&loop.materials)
+	loop.particles.Initialize(&loop.materials)
+	loop.animations.Initialize(ATLAS_METADATA_FILE, &loop.materials)
 
 	// Create a simple triangle mesh for testing/debugging
 	loop.triangleMesh = GetTriangleMesh()
 
+	// Set up the sky pass and the fog that blends the world into it
+	loop.sky.Initialize()
+	loop.fog.InitializeDefaultValues()
+
+	// Allocate the shadow cascades
+	loop.shadowMap.Initialize()
+
+	// Load the post-processing passes
+	loop.post.Initialize()
+
 	// Initialize the game world (chunks, terrain, etc.)
 	loop.gameWorld.Initialize()
 	loop.gameWorld.currentCamera = loop.camera
 
-	// Load texture atlas containing all block textures
-	texture, err := NewTexture("atlas.png")
-	if err != nil {
-		panic(err)
-	}
-	loop.textureAtlas = texture
+	// Accept commands from the terminal
+	loop.commands.Initialize()
+	loop.RegisterCommands(&loop.commands)
+	loop.gameWorld.RegisterCommands(&loop.commands)
+	loop.shadowMap.RegisterCommands(&loop.commands)
+	loop.post.RegisterCommands(&loop.commands)
+	shaderWatcher.RegisterCommands(&loop.commands)
+	loop.materials.RegisterCommands(&loop.commands)
+	loop.debug.RegisterCommands(&loop.commands)
+	loop.hud.RegisterCommands(&loop.commands)
+	profiler.RegisterCommands(&loop.commands, &loop.profilerGraph)
+	loop.particles.RegisterCommands(&loop.commands)
+	loop.animations.RegisterCommands(&loop.commands, &loop.materials)
+	loop.commands.ListenStdin()
 }
 
 // CursorMove handles mouse movement input for camera rotation.
@@ -93,25 +150,80 @@ func (loop *GameLoop) CursorMove(xpos, ypos float64) {
 	loop.cursorPrevPosY = ypos
 }
 
-// Clear resets the framebuffer and sets up render state for a new frame.
-// Sets background color, enables depth testing, and clears color/depth buffers.
-func (loop *GameLoop) Clear() {
-	// Clear both color and depth buffers
-	gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
+// MousePress handles mouse clicks. Called by GLFW once per button press.
+// button: The pressed button
+func (loop *GameLoop) MousePress(button glfw.MouseButton) {
+	if button == glfw.MouseButtonLeft {
+		loop.BreakTargetBlock()
+	}
+}
 
-	// Enable depth testing for proper 3D rendering
-	gl.Enable(gl.DEPTH_TEST)
-	gl.DepthFunc(gl.LESS) // Standard depth comparison (near objects obscure far ones)
+// BreakTargetBlock removes the block under the crosshair and scatters its debris.
+// Returns: Whether a block was in reach
+func (loop *GameLoop) BreakTargetBlock() bool {
+	if !loop.target.found {
+		return false
+	}
+	block := loop.target.hit.block
+	blockID := loop.gameWorld.BreakBlock(block)
+	loop.particles.EmitBlockDebris(block, blockID)
 
-	// Set clear color (background color)
-	gl.ClearColor(
-		loop.clearColor[0], loop.clearColor[1],
-		loop.clearColor[2], loop.clearColor[3])
+	// Aim at whatever is behind the block right away
+	loop.target.Update(&loop.gameWorld, loop.camera)
+	return true
+}
+
+// KeyPress handles hotkeys. Called by GLFW once per key press.
+// key: The pressed key
+func (loop *GameLoop) KeyPress(key glfw.Key) {
+	switch key {
+	case glfw.KeyF1:
+		loop.hud.visible = !loop.hud.visible
+	case glfw.KeyF2:
+		loop.screenshotQueued = true
+	case glfw.KeyF3:
+		loop.debug.Toggle("wireframe")
+	case glfw.KeyF4:
+		loop.debug.Toggle("borders")
+	case glfw.KeyF5:
+		loop.debug.Toggle("normals")
+	case glfw.KeyF6:
+		loop.debug.Toggle("states")
+	case glfw.KeyF7:
+		loop.debug.Toggle("faces")
+	case glfw.KeyF8:
+		loop.profilerGraph.visible = !loop.profilerGraph.visible
+	}
+}
+
+// RegisterCommands adds the game loop commands ("screenshot") to a registry.
+func (loop *GameLoop) RegisterCommands(registry *CommandRegistry) {
+	registry.Register("screenshot", "screenshot - save the next frame to "+SCREENSHOT_DIRECTORY+" (also F2)", func(args []string) (string, error) {
+		loop.screenshotQueued = true
+		return "screenshot queued", nil
+	})
+	registry.Register("break", "break - break the block under the crosshair (also left click)", func(args []string) (string, error) {
+		if !loop.BreakTargetBlock() {
+			return "", fmt.Errorf("no block in reach")
+		}
+		return "block broken", nil
+	})
+}
+
+// Clear resets the framebuffer for a new frame.
+// Sets background color and clears color/depth buffers; everything drawn
+// afterwards sets its own render state through its material.
+func (loop *GameLoop) Clear() {
+	// Depth writes must be on, otherwise the depth buffer is not cleared
+	glState.Apply(RENDER_STATE_OPAQUE)
+
+	// Clear both color and depth buffers to the background color
+	renderBackend.Clear(gl.COLOR_BUFFER_BIT|gl.DEPTH_BUFFER_BIT, loop.clearColor)
 }
 
 // UpdateCameraMatrices recalculates projection and model matrices
-// based on current window size and camera state.
-// Should be called whenever window is resized or camera FOV changes.
+// based on current window size and camera state, and uploads the camera
+// uniform buffer. Called once per frame before anything is drawn.
 func (loop *GameLoop) UpdateCameraMatrices() {
 	windowWidth, windowHeight := loop.window.width, loop.window.height
 
@@ -120,61 +232,214 @@ func (loop *GameLoop) UpdateCameraMatrices() {
 	loop.projection = mgl32.Perspective(
 		mgl32.DegToRad(loop.camera.FOV),
 		float32(windowWidth)/float32(windowHeight),
-		0.01, 1000.0,
+		CAMERA_NEAR, CAMERA_FAR,
 	)
 
-	// Identity model matrix (no world transform applied by default)
+	// Identity model matrix (meshes placed in the world use UseMaterialAt)
 	loop.model = mgl32.Ident4()
+
+	// Share the camera with all programs. Rendering is camera-relative, so the
+	// view matrix is only the camera rotation and the camera sits at the origin
+	view := loop.camera.GetViewMatrix()
+	loop.cameraUniforms = CameraUniforms{
+		projection:               loop.projection,
+		view:                     view,
+		skyInverseViewProjection: loop.projection.Mul4(view.Mat3().Mat4()).Inv(),
+		position:                 mgl32.Vec3{},
+		near:                     CAMERA_NEAR,
+		far:                      CAMERA_FAR,
+	}
+	data := [CAMERA_UNIFORM_FLOATS]float32{}
+	loop.cameraUniforms.Pack(&data)
+	loop.cameraBuffer.Update(data[:])
 }
 
-// AssignCameraMatrices uploads the current camera, projection, and model matrices
-// to the currently active shader program's uniform variables.
+// AssignCameraMatrices uploads the model matrix and the lighting data to the
+// currently active shader program. Projection, view and camera position come
+// from the camera uniform buffer.
 func (loop *GameLoop) AssignCameraMatrices() {
 	shader := loop.currentShader
 
-	// Upload matrices to shader uniforms
-	shader.UniformSetMat4("projection", &loop.projection)
-	cameraMatrix := loop.camera.GetViewMatrix()
-	shader.UniformSetMat4("camera", &cameraMatrix)
+	// Upload the model matrix and the matching normal matrix
+	normalMatrix := loop.model.Mat3().Inv().Transpose()
 	shader.UniformSetMat4("model", &loop.model)
+	shader.UniformSetMat3("normalMatrix", &normalMatrix)
+
+	// Upload fog parameters
+	loop.fog.AssignUniforms(shader)
+
+	// Upload the light of the current time of day
+	shader.UniformSetVec3("lightDirection", &loop.daylight.lightDirection)
+	shader.UniformSetVec3("lightColor", &loop.daylight.lightColor)
+	shader.UniformSetFloat("ambientStrength", loop.daylight.ambientStrength)
+
+	// Upload the shadow cascades rendered this frame
+	loop.shadowMap.AssignUniforms(shader)
+}
+
+// UpdateSkyAndFog applies the time of day to the sky and keeps the fog in sync
+// with it and the render distance. The background clear color matches the horizon
+// so gaps never show a different color.
+func (loop *GameLoop) UpdateSkyAndFog() {
+	loop.daylight = loop.gameWorld.time.Daylight()
+	loop.sky.sunDirection = loop.daylight.sunDirection
+	loop.sky.moonDirection = loop.daylight.moonDirection
+	loop.sky.zenithColor = loop.daylight.zenithColor
+	loop.sky.horizonColor = loop.daylight.horizonColor
+	loop.sky.groundColor = loop.daylight.groundColor
+
+	loop.fog.color = loop.sky.horizonColor
+	if loop.fog.fitToDistance {
+		loop.fog.FitToRenderDistance(loop.gameWorld.renderDistance)
+	}
+	loop.clearColor = loop.sky.horizonColor.Vec4(1.0)
+}
 
-	// Upload camera position for lighting calculations
-	shader.UniformSetVec3("viewPos", &loop.camera.position)
+// IsCameraUnderwater reports whether the camera is inside a water block.
+func (loop *GameLoop) IsCameraUnderwater() bool {
+	blockID, loaded := loop.gameWorld.GetBlock(BlockPosAt(loop.camera.position))
+	return loaded && blockID == BLOCK_WATER
 }
 
-// AssignShader activates a shader program and sets up its camera matrices.
-// shader: The shader program to activate for subsequent rendering.
-func (loop *GameLoop) AssignShader(shader *Shader) {
-	loop.currentShader = shader
-	shader.Use()                // Activate the shader program
+// UseMaterial activates a material for the following draws and uploads the
+// per-frame uniforms (model matrix, light, fog and shadows) to its shader.
+// material: The material meshes are drawn with from now on.
+func (loop *GameLoop) UseMaterial(material *Material) {
+	loop.currentShader = material.shader
+	material.Bind()             // Program, render state, textures and defaults
 	loop.AssignCameraMatrices() // Upload camera data
 }
 
+// UseMaterialAt activates a material like UseMaterial for a mesh whose
+// vertices are relative to a world position, such as a block outline.
+// material: The material meshes are drawn with from now on.
+// origin: World position the mesh vertices are relative to
+func (loop *GameLoop) UseMaterialAt(material *Material, origin mgl64.Vec3) {
+	loop.model = loop.camera.ModelMatrix(origin)
+	loop.UseMaterial(material)
+	loop.model = mgl32.Ident4()
+}
+
 // UpdateRoutine is the main game loop function called each frame.
 // Handles input processing, state updates, and rendering.
 // deltaTime: Time elapsed since last frame (in seconds).
 func (loop *GameLoop) UpdateRoutine(deltaTime float64) {
+	profiler.BeginFrame()
+	defer profiler.EndFrame()
+
+	// Run commands typed into the terminal since the last frame
+	scope := profiler.Begin("input")
+	loop.commands.ProcessPending()
+
+	// Recompile shaders whose files were edited
+	shaderWatcher.Poll()
+
+	// Count the frame for the frame rate display
+	loop.hud.Update(deltaTime)
+
 	// Process keyboard input for camera movement
 	loop.camera.ProcessKeyboard(loop.window, deltaTime)
+	scope.End()
 
-	// Clear screen and set up render state
-	loop.Clear()
+	// Advance the world simulation (fluids, remeshing) on its fixed tick
+	scope = profiler.Begin("simulation")
+	loop.gameWorld.Update(deltaTime)
+
+	// Pick the block under the crosshair
+	loop.target.Update(&loop.gameWorld, loop.camera)
+
+	// Spawn and move particles
+	loop.particles.Update(deltaTime, &loop.gameWorld, loop.camera.position)
+
+	// Show the current frames of the animated block textures
+	loop.animations.Update(deltaTime)
+
+	// Match fog and background to the current sky
+	loop.UpdateSkyAndFog()
 
 	// Update camera matrices (projection, view)
 	loop.UpdateCameraMatrices()
+	scope.End()
+
+	// Render the shadow cascades from the sun (or moon)
+	scope = profiler.BeginPass("shadows")
+	loop.shadowMap.Render(
+		loop.camera,
+		float32(loop.window.width)/float32(loop.window.height),
+		CAMERA_NEAR,
+		loop.daylight.lightDirection,
+		&loop.gameWorld,
+	)
+	scope.End()
 
-	// Activate the basic shader program
-	loop.AssignShader(&loop.basicShader)
+	// Render the scene off-screen for post-processing
+	scope = profiler.BeginPass("sky")
+	loop.post.Pass("underwater").active = loop.IsCameraUnderwater()
+	loop.post.Begin(loop.window.width, loop.window.height)
+
+	// Clear screen and set up render state
+	loop.Clear()
 
-	// Bind texture atlas to texture unit 0
-	textureUniform := gl.GetUniformLocation(loop.currentShader.ID, GLString("tex"))
-	gl.Uniform1i(textureUniform, 0)                  // Set uniform to use texture unit 0
-	gl.ActiveTexture(gl.TEXTURE0)                    // Activate texture unit 0
-	gl.BindTexture(gl.TEXTURE_2D, loop.textureAtlas) // Bind texture atlas
+	// Draw the sky gradient and sun behind everything
+	loop.sky.Render()
 
-	// Render test triangle mesh (debug/placeholder)
+	// Render test triangle mesh (debug/placeholder) at the world origin
+	loop.UseMaterialAt(loop.debugMaterial, mgl64.Vec3{})
 	loop.triangleMesh.Render()
+	scope.End()
+
+	// Render the game world (all chunks) with the block atlas
+	scope = profiler.BeginPass("terrain")
+	loop.UseMaterial(loop.debug.WorldMaterial(loop.worldMaterial))
+	loop.gameWorld.Render(loop.currentShader)
+	scope.End()
+
+	// Draw the water over the terrain, blended and without writing depth
+	scope = profiler.BeginPass("liquids")
+	loop.UseMaterial(loop.debug.WorldMaterial(loop.liquidMaterial))
+	loop.gameWorld.RenderLiquids(loop.currentShader)
+	scope.End()
+
+	// Draw the particles over the world, blended and without writing depth
+	scope = profiler.BeginPass("particles")
+	loop.particles.Render(loop)
+	scope.End()
+
+	// Draw the enabled debug overlays on top of the world
+	scope = profiler.BeginPass("overlays")
+	loop.RenderDebugOverlays()
+
+	// Outline the targeted block; hidden together with the HUD
+	if loop.hud.visible {
+		loop.target.RenderOutline(loop)
+	}
+	scope.End()
+
+	// Apply the post-processing passes and present the result
+	scope = profiler.BeginPass("post")
+	loop.post.End(CAMERA_NEAR, CAMERA_FAR)
+	scope.End()
+
+	// Draw the crosshair, the statistics and the profiler graph over the finished image
+	scope = profiler.BeginPass("hud")
+	if loop.hud.visible {
+		loop.target.RenderCrosshair(loop)
+	}
+	loop.hud.Render(loop)
+	loop.profilerGraph.Render(loop)
+	scope.End()
+
+	// Read the finished frame back before it is swapped to the screen
+	if loop.screenshotQueued {
+		loop.screenshotQueued = false
+		scope = profiler.Begin("screenshot")
+		loop.SaveScreenshot()
+		scope.End()
+	}
+}
 
-	// Render the game world (all chunks)
-	loop.gameWorld.Render()
+// Shutdown releases game systems and saves the world.
+// Called once after the main loop exits.
+func (loop *GameLoop) Shutdown() {
+	loop.gameWorld.Shutdown()
 }
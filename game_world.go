@@ -5,27 +5,130 @@
 package main
 
 import (
-	"math"
+	"cmp"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// World tick constants. The world simulation runs at a fixed rate
+// independent of the frame rate so it behaves the same on every machine.
+const (
+	WORLD_TICK_RATE      = 20  // World ticks per second
+	WORLD_MAX_FRAME_TICK = 10  // Maximum ticks run in one frame (avoids a spiral of death after a stall)
+	FLUID_TICK_INTERVAL  = 5   // World ticks between two fluid simulation steps
+	WORLD_AUTOSAVE_TICKS = 600 // World ticks between two automatic level saves (30 seconds)
+)
+
+// Default build limits of new worlds. Both are multiples of CHUNK_SIZE.
+const (
+	WORLD_DEFAULT_MIN_HEIGHT = -64 // Height of the lowest block layer (bedrock)
+	WORLD_DEFAULT_MAX_HEIGHT = 320 // Height above the highest block layer
+)
+
+// Chunk buffer arena constants.
+const (
+	WORLD_ARENA_INITIAL_VERTICES  = 1 << 21 // Initial size of the chunk vertex arena (88 MiB)
+	WORLD_ARENA_MAX_FRAGMENTATION = 0.5     // Share of free space outside the largest free range that triggers a compaction
+	WORLD_ARENA_MIN_FREE_RANGES   = 256     // Free ranges needed before fragmentation is considered at all
 )
 
 // GameWorld manages all chunks in the game world and handles dynamic
 // chunk loading/unloading based on camera position.
 type GameWorld struct {
-	chunks                     map[mgl32.Vec2]*Chunk // Map of all loaded chunks keyed by their position
-	renderChunks               []*Chunk              // Subset of chunks currently within render distance
-	currentCamera              *Camera               // Reference to the active camera for position tracking
-	renderDistance             int                   // Number of chunks to render in each direction from camera
-	closeCameraMovementRoutine chan bool             // Channel to signal shutdown of the camera tracking goroutine
+	chunks                     map[ChunkPos]*Chunk // Map of all loaded chunks keyed by their position
+	chunksMutex                sync.RWMutex        // Guards chunks, which the camera goroutine writes to
+	renderChunks               []*Chunk            // Chunks within render distance, built by the camera goroutine
+	renderCenter               ChunkPos            // Camera chunk renderChunks was built around
+	frameChunks                []*Chunk            // renderChunks as taken by Update for the current frame (main thread only)
+	cameraPosition             mgl64.Vec3          // Camera position published by Update for the camera goroutine
+	currentCamera              *Camera             // Reference to the active camera for position tracking
+	renderDistance             int                 // Number of chunks to render in each horizontal direction from camera
+	verticalDistance           int                 // Number of chunks to render above and below the camera chunk
+	minHeight                  int                 // Lower build limit: height of the lowest block layer, a multiple of CHUNK_SIZE
+	maxHeight                  int                 // Upper build limit: height above the highest block layer, a multiple of CHUNK_SIZE
+	closeCameraMovementRoutine chan bool           // Channel to signal shutdown of the camera tracking goroutine
+	fluids                     FluidSimulator      // Water simulation running on the world tick
+	tickAccumulator            float64             // Unsimulated time carried over between frames (seconds)
+	tickCount                  uint64              // Number of world ticks run so far
+	generatedChunks            []*Chunk            // Chunks that finished generating since the last tick
+	generatedMutex             sync.Mutex          // Guards generatedChunks, which generator goroutines append to
+	remeshQueue                map[ChunkPos]bool   // Chunks whose blocks changed and need a new mesh
+	remeshBatchSize            int                 // Maximum number of chunks remeshed per tick
+	time                       WorldTime           // World clock driving the day/night cycle
+	saveDirectory              string              // Directory the level data is saved to
+	seed                       int64               // Seed of the terrain noise, restored from the level data
+	ores                       []OreVein           // Ore veins placed into generated chunks, loaded from ORE_FILE
+	cameraMutex                sync.Mutex          // Guards the state shared with the camera goroutine: renderChunks, renderCenter, cameraPosition and lod
+	lod                        LODSettings         // Level of detail of the chunks by distance, read by the camera goroutine
+	forceChunkUpdate           atomic.Bool         // Makes the camera routine refresh chunks even if the camera did not move
+	occlusionEnabled           bool                // Skip chunks the camera cannot see through open space
+	occlusion                  OcclusionCuller     // Chunk visibility search run every frame
+	chunkArena                 BufferArena         // Shared vertex buffer holding all chunk meshes
+	visibleChunks              []*Chunk            // Chunks the last Render drew, RenderLiquids draws their water
+	drawnVertices              int                 // Vertices the last Render and RenderLiquids drew
+}
+
+// WorldStats summarizes the chunks and vertices of the world (see Stats).
+type WorldStats struct {
+	loaded  int // Chunks in memory
+	visible int // Chunks the last Render drew
+	pending int // Chunks within render distance still generating or waiting for their mesh
+	stored  int // Vertices of all chunk meshes in the arena
+	drawn   int // Vertices the last Render and RenderLiquids drew
+}
+
+// LODSettings decide the level of detail of a chunk from its distance to the camera chunk.
+type LODSettings struct {
+	enabled   bool   // Use reduced detail meshes for distant chunks
+	distances [3]int // Chunk distances where LOD 1, 2 and 3 (2x/4x/8x cells) start
 }
 
 // Initialize sets up the game world with default values and starts
 // the camera tracking goroutine for dynamic chunk loading.
 func (gameWorld *GameWorld) Initialize() {
-	gameWorld.renderDistance = 16 // Render 16 chunks in each direction (32x32 chunk area)
-	gameWorld.chunks = make(map[mgl32.Vec2]*Chunk)
+	// The camera goroutine reads the render distance, it may only be set before Initialize
+	if gameWorld.renderDistance == 0 {
+		gameWorld.renderDistance = 16 // Render 16 chunks in each direction of the camera chunk (33x33 chunk columns)
+	}
+	gameWorld.verticalDistance = 8 // and 8 chunks above and below it (up to 17 chunks per column)
+	gameWorld.chunks = make(map[ChunkPos]*Chunk)
+	gameWorld.remeshQueue = make(map[ChunkPos]bool)
+	gameWorld.remeshBatchSize = 4
+	gameWorld.fluids.Initialize(gameWorld)
+
+	// Full detail close to the camera, coarser meshes further out
+	gameWorld.lod = LODSettings{enabled: true, distances: [3]int{6, 10, 13}}
+	gameWorld.occlusionEnabled = true
+	gameWorld.chunkArena.Initialize(WORLD_ARENA_INITIAL_VERTICES)
+
+	// Panics if the ore file cannot be loaded, like the material file
+	ores, err := LoadOreFile(ORE_FILE)
+	if err != nil {
+		panic(err)
+	}
+	gameWorld.ores = ores
+
+	// Start a fresh clock, then restore it, the seed and the build limits from the save if
+	// there is one. The save directory, seed and build limits of a new world may be set before Initialize
+	if gameWorld.saveDirectory == "" {
+		gameWorld.saveDirectory = WORLD_SAVE_DIRECTORY
+	}
+	if gameWorld.minHeight == 0 && gameWorld.maxHeight == 0 {
+		gameWorld.minHeight, gameWorld.maxHeight = WORLD_DEFAULT_MIN_HEIGHT, WORLD_DEFAULT_MAX_HEIGHT
+	}
+	gameWorld.time.InitializeDefaultValues()
+	if err := gameWorld.LoadLevel(); err != nil {
+		fmt.Println(err)
+	}
 
 	// Start goroutine that monitors camera position and loads/unloads chunks
 	gameWorld.closeCameraMovementRoutine = gameWorld.ProcessCameraMovementRoutine()
@@ -42,45 +145,73 @@ func (gameWorld *GameWorld) ProcessCameraMovementRoutine() chan bool {
 		ticker := time.NewTicker(time.Millisecond * 300)
 
 		// Track previous camera chunk position to detect movement
-		prevXPos := 1110 // Initial sentinel value that won't match any real position
-		prevYPos := 1110
+		previousCenter := ChunkPos{}
+		started := false // The render list has been built at least once
 
 		for {
 			select {
 			case <-ticker.C:
-				// Convert camera world position to chunk coordinates
-				xPos := int(math.Round(float64(gameWorld.currentCamera.position[0] / 16.0)))
-				yPos := int(math.Round(float64(gameWorld.currentCamera.position[2] / 16.0)))
+				// The render area is centered on the chunk the camera is in. The camera
+				// position and the LOD settings are copied, the main thread changes them
+				gameWorld.cameraMutex.Lock()
+				center := ChunkPosAt(gameWorld.cameraPosition)
+				lodSettings := gameWorld.lod
+				gameWorld.cameraMutex.Unlock()
 
-				// Only update render list if camera moved to a new chunk
-				if xPos != prevXPos || yPos != prevYPos {
-					prevXPos = xPos
-					prevYPos = yPos
+				// Only update render list if camera moved to a new chunk (or a refresh was requested)
+				if !started || center != previousCenter || gameWorld.forceChunkUpdate.Swap(false) {
+					started = true
+					previousCenter = center
 
 					newRenderChunks := []*Chunk{}
 
-					// Calculate bounding box of chunks to render based on render distance
-					for x := xPos + (-gameWorld.renderDistance); x < xPos+gameWorld.renderDistance; x++ {
-						for y := yPos + (-gameWorld.renderDistance); y < yPos+gameWorld.renderDistance; y++ {
-							position := mgl32.Vec2{float32(x), float32(y)}
-
-							// Check if chunk already exists in memory
-							chunk, exists := gameWorld.chunks[position]
-							if !exists {
-								// Create and generate new chunk
-								chunk = &Chunk{}
-								chunk.position = position
-								chunk.Generate() // Starts async generation
-								gameWorld.chunks[position] = chunk
-							}
+					// Every chunk of the box around the camera chunk, column by column
+					low, high := gameWorld.renderArea(center)
+					for x := low.x; x <= high.x; x++ {
+						for z := low.z; z <= high.z; z++ {
+							for y := low.y; y <= high.y; y++ {
+								position := ChunkPos{x, y, z}
+
+								// Check if chunk already exists in memory
+								// Pick the level of detail from the distance to the camera chunk
+								lod := lodSettings.ForDistance(position.Distance(center))
 
-							// Add chunk to render list
-							newRenderChunks = append(newRenderChunks, chunk)
+								gameWorld.chunksMutex.Lock()
+								chunk, exists := gameWorld.chunks[position]
+								if !exists {
+									// Create and generate new chunk
+									chunk = &Chunk{}
+									chunk.position = position
+									chunk.world = gameWorld
+									chunk.seed = gameWorld.seed
+									chunk.ores = gameWorld.ores
+									chunk.floor = gameWorld.minHeight
+									chunk.saveDirectory = gameWorld.saveDirectory
+									chunk.lod.Store(int32(lod))
+									gameWorld.chunks[position] = chunk
+									chunk.Generate() // Starts async generation
+								}
+								gameWorld.chunksMutex.Unlock()
+
+								// Remesh existing chunks that crossed a LOD threshold
+								chunk.SetLOD(lod)
+
+								// Add chunk to render list
+								newRenderChunks = append(newRenderChunks, chunk)
+							}
 						}
 					}
 
-					// Update render list atomically
+					// Neighbours that crossed a LOD threshold change which borders are culled
+					for _, chunk := range newRenderChunks {
+						chunk.RemeshStaleBorders()
+					}
+
+					// Publish the render list, Update hands it to the next frame
+					gameWorld.cameraMutex.Lock()
 					gameWorld.renderChunks = newRenderChunks
+					gameWorld.renderCenter = center
+					gameWorld.cameraMutex.Unlock()
 				}
 
 			case <-closeChan:
@@ -94,10 +225,660 @@ func (gameWorld *GameWorld) ProcessCameraMovementRoutine() chan bool {
 	return closeChan
 }
 
-// Render draws all chunks currently within render distance.
+// renderArea returns the lowest and the highest chunk of the box loaded around
+// a camera chunk: renderDistance chunks to each side and verticalDistance chunks
+// above and below, cut off at the build limits. The box is empty (low above high)
+// when the camera is too far above or below the world.
+// center: Chunk the camera is in
+func (gameWorld *GameWorld) renderArea(center ChunkPos) (ChunkPos, ChunkPos) {
+	bottom, top := gameWorld.ChunkLayers()
+	low := ChunkPos{center.x - gameWorld.renderDistance, max(center.y-gameWorld.verticalDistance, bottom), center.z - gameWorld.renderDistance}
+	high := ChunkPos{center.x + gameWorld.renderDistance, min(center.y+gameWorld.verticalDistance, top-1), center.z + gameWorld.renderDistance}
+	return low, high
+}
+
+// ChunkLayers returns the chunk Y coordinate of the lowest chunk layer inside
+// the build limits and the one above the highest layer.
+func (gameWorld *GameWorld) ChunkLayers() (int, int) {
+	return floorDiv(gameWorld.minHeight, CHUNK_SIZE), floorDiv(gameWorld.maxHeight, CHUNK_SIZE)
+}
+
+// InBuildLimits reports whether a block lies between the world's build limits.
+func (gameWorld *GameWorld) InBuildLimits(block BlockPos) bool {
+	return block.y >= gameWorld.minHeight && block.y < gameWorld.maxHeight
+}
+
+// SetBuildLimits changes the build limits. Only allowed before Initialize,
+// chunks that already exist keep the limits they were generated with.
+// Returns an error if the limits are invalid (see checkBuildLimits).
+// minHeight: Height of the lowest block layer
+// maxHeight: Height above the highest block layer
+func (gameWorld *GameWorld) SetBuildLimits(minHeight, maxHeight int) error {
+	if err := checkBuildLimits(minHeight, maxHeight); err != nil {
+		return err
+	}
+	gameWorld.minHeight, gameWorld.maxHeight = minHeight, maxHeight
+	return nil
+}
+
+// checkBuildLimits returns an error unless both build limits are multiples
+// of CHUNK_SIZE and minHeight is below maxHeight.
+func checkBuildLimits(minHeight, maxHeight int) error {
+	if floorMod(minHeight, CHUNK_SIZE) != 0 || floorMod(maxHeight, CHUNK_SIZE) != 0 {
+		return fmt.Errorf("build limits must be multiples of %d", CHUNK_SIZE)
+	}
+	if minHeight >= maxHeight {
+		return fmt.Errorf("lower build limit %d must be below upper build limit %d", minHeight, maxHeight)
+	}
+	return nil
+}
+
+// ParseBuildLimits parses build limits given as "min,max" and checks them.
+func ParseBuildLimits(text string) (int, int, error) {
+	fields := strings.Split(text, ",")
+	if len(fields) != 2 {
+		return 0, 0, fmt.Errorf("build limits %q: expected min,max", text)
+	}
+	limits := [2]int{}
+	for i, field := range fields {
+		value, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return 0, 0, fmt.Errorf("build limits %q: invalid number %q", text, field)
+		}
+		limits[i] = value
+	}
+	if err := checkBuildLimits(limits[0], limits[1]); err != nil {
+		return 0, 0, fmt.Errorf("build limits %q: %v", text, err)
+	}
+	return limits[0], limits[1], nil
+}
+
+// Settled reports whether the world around the camera has finished loading:
+// the render area is centered on the camera, its chunks are generated and
+// meshed at their LOD, and no fluid flow or remeshing is pending. Used to take
+// reproducible pictures (see golden.go).
+func (gameWorld *GameWorld) Settled() bool {
+	center := ChunkPosAt(gameWorld.currentCamera.position)
+	low, high := gameWorld.renderArea(center)
+	gameWorld.cameraMutex.Lock()
+	renderChunks, renderCenter := gameWorld.renderChunks, gameWorld.renderCenter
+	gameWorld.cameraMutex.Unlock()
+	side := 2*gameWorld.renderDistance + 1
+	count := side * side * max(high.y-low.y+1, 0)
+	if renderCenter != center || len(renderChunks) != count {
+		return false
+	}
+	for _, chunk := range renderChunks {
+		if !chunk.MeshSettled() {
+			return false
+		}
+	}
+
+	gameWorld.generatedMutex.Lock()
+	pending := len(gameWorld.generatedChunks)
+	gameWorld.generatedMutex.Unlock()
+	return pending == 0 && len(gameWorld.remeshQueue) == 0 && gameWorld.fluids.ActiveCount() == 0
+}
+
+// Render draws the solid faces of the chunks within render distance, skipping
+// the chunks that cannot be seen from the camera when occlusion culling is enabled.
 // Called each frame from the main game loop.
-func (gameWorld *GameWorld) Render() {
-	for _, chunk := range gameWorld.renderChunks {
-		chunk.Render()
+// shader: Active shader program, receives the model matrix of every chunk
+func (gameWorld *GameWorld) Render(shader *Shader) {
+	if !gameWorld.occlusionEnabled {
+		gameWorld.RenderAll(shader)
+		return
 	}
+
+	// One column more than the render distance covers the camera leaving its chunk
+	// before the camera routine recenters the render area
+	bottom, top := gameWorld.ChunkLayers()
+	gameWorld.occlusion.Cull(gameWorld, gameWorld.currentCamera.position, gameWorld.renderDistance+1, bottom, top)
+	gameWorld.visibleChunks = gameWorld.visibleChunks[:0]
+	for _, chunk := range gameWorld.frameChunks {
+		if gameWorld.occlusion.Visible(chunk.position) {
+			gameWorld.visibleChunks = append(gameWorld.visibleChunks, chunk)
+		}
+	}
+	gameWorld.renderVisible(shader)
+}
+
+// RenderLiquids draws the water faces of the chunks the last Render drew,
+// back to front so the blended faces cover each other in the right order.
+// Chunks of a render region share one draw, so the regions are sorted first
+// and the chunks inside each region after them.
+// shader: Active shader program, receives the model matrix of every chunk
+func (gameWorld *GameWorld) RenderLiquids(shader *Shader) {
+	camera := gameWorld.currentCamera.position
+	distance := func(origin mgl64.Vec3, size float64) float64 {
+		return origin.Add(mgl64.Vec3{size / 2.0, size / 2.0, size / 2.0}).Sub(camera).LenSqr()
+	}
+	slices.SortFunc(gameWorld.visibleChunks, func(a, b *Chunk) int {
+		return cmp.Or(
+			cmp.Compare(distance(b.Origin(), CHUNK_REGION_SIZE*CHUNK_SIZE), distance(a.Origin(), CHUNK_REGION_SIZE*CHUNK_SIZE)),
+			cmp.Compare(distance(b.position.Origin().Vec3(), CHUNK_SIZE), distance(a.position.Origin().Vec3(), CHUNK_SIZE)),
+		)
+	})
+
+	for _, chunk := range gameWorld.visibleChunks {
+		chunk.QueueDraw(&gameWorld.chunkArena, gameWorld.currentCamera, CHUNK_PASS_LIQUID)
+	}
+	gameWorld.chunkArena.Draw(shader)
+	gameWorld.drawnVertices += gameWorld.chunkArena.drawn
+}
+
+// Stats counts the loaded, visible and pending chunks and the chunk vertices.
+// Visible chunks and drawn vertices refer to the last Render.
+func (gameWorld *GameWorld) Stats() WorldStats {
+	gameWorld.chunksMutex.RLock()
+	loaded := len(gameWorld.chunks)
+	gameWorld.chunksMutex.RUnlock()
+
+	stats := WorldStats{
+		loaded:  loaded,
+		visible: len(gameWorld.visibleChunks),
+		stored:  gameWorld.chunkArena.Stats().used,
+		drawn:   gameWorld.drawnVertices,
+	}
+	for _, chunk := range gameWorld.frameChunks {
+		if chunk.MeshState() != CHUNK_MESH_UPLOADED {
+			stats.pending++
+		}
+	}
+	return stats
+}
+
+// RenderAll draws the solid faces of all chunks within render distance.
+// Used when occlusion culling is disabled.
+// shader: Active shader program, receives the model matrix of every chunk
+func (gameWorld *GameWorld) RenderAll(shader *Shader) {
+	gameWorld.visibleChunks = append(gameWorld.visibleChunks[:0], gameWorld.frameChunks...)
+	gameWorld.renderVisible(shader)
+}
+
+// renderVisible draws the solid faces of the visible chunks.
+// shader: Active shader program, receives the model matrix of every chunk
+func (gameWorld *GameWorld) renderVisible(shader *Shader) {
+	for _, chunk := range gameWorld.visibleChunks {
+		chunk.QueueDraw(&gameWorld.chunkArena, gameWorld.currentCamera, CHUNK_PASS_SOLID)
+	}
+	gameWorld.chunkArena.Draw(shader)
+	gameWorld.drawnVertices = gameWorld.chunkArena.drawn
+}
+
+// RenderInBox draws the chunks within render distance that overlap the clip
+// volume of an orthographic view-projection matrix. Used by passes that see the
+// world from elsewhere than the camera and only cover part of it, such as
+// shadow cascades. Only solid faces are drawn, water casts no shadow.
+// Like every model matrix, the matrix is camera-relative.
+// shader: Active shader program, receives the model matrix of every chunk
+// viewProjection: Affine (orthographic) view-projection matrix of camera-relative positions
+func (gameWorld *GameWorld) RenderInBox(shader *Shader, viewProjection mgl32.Mat4) {
+	// Half the size of a chunk's box along each clip axis, the same for every chunk
+	half := float32(CHUNK_SIZE) / 2.0
+	extent := mgl32.Vec3{}
+	for row := range 3 {
+		for column := range 3 {
+			extent[row] += mgl32.Abs(viewProjection.At(row, column)) * half
+		}
+	}
+
+	for _, chunk := range gameWorld.frameChunks {
+		center := chunk.position.Origin().Vec3().Add(mgl64.Vec3{float64(half), float64(half), float64(half)})
+		clip := viewProjection.Mul4x1(gameWorld.currentCamera.RelativePosition(center).Vec4(1.0))
+		if mgl32.Abs(clip[0])-extent[0] > 1.0 || mgl32.Abs(clip[1])-extent[1] > 1.0 || mgl32.Abs(clip[2])-extent[2] > 1.0 {
+			continue
+		}
+		chunk.QueueDraw(&gameWorld.chunkArena, gameWorld.currentCamera, CHUNK_PASS_SOLID)
+	}
+	gameWorld.chunkArena.Draw(shader)
+}
+
+// CompactArenaIfFragmented compacts the chunk arena when its free space is split
+// into many small ranges. Called once per frame from Update, before anything is drawn.
+func (gameWorld *GameWorld) CompactArenaIfFragmented() {
+	stats := gameWorld.chunkArena.Stats()
+	if stats.freeRanges >= WORLD_ARENA_MIN_FREE_RANGES && stats.Fragmentation() > WORLD_ARENA_MAX_FRAGMENTATION {
+		gameWorld.chunkArena.Compact(stats.capacity)
+	}
+}
+
+// ChunkVisibility returns the visibility of a chunk (SectionGraph implementation).
+func (gameWorld *GameWorld) ChunkVisibility(position ChunkPos) (SectionVisibility, bool) {
+	chunk := gameWorld.GetChunk(position)
+	if chunk == nil {
+		return 0, false
+	}
+	return chunk.Visibility()
+}
+
+// abs returns the absolute value of an integer.
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+// ForDistance returns the level of detail for a chunk the given number
+// of chunks away from the camera chunk (Chebyshev distance in 3D).
+func (settings LODSettings) ForDistance(distance int) int {
+	if !settings.enabled {
+		return 0
+	}
+
+	lod := 0
+	for level, threshold := range settings.distances {
+		if distance >= threshold {
+			lod = level + 1
+		}
+	}
+	return lod
+}
+
+// GetChunk returns the loaded chunk at a chunk position,
+// or nil if that chunk has not been created yet.
+func (gameWorld *GameWorld) GetChunk(position ChunkPos) *Chunk {
+	gameWorld.chunksMutex.RLock()
+	defer gameWorld.chunksMutex.RUnlock()
+	return gameWorld.chunks[position]
+}
+
+// getGeneratedChunk returns the chunk containing a block together with the
+// block's position inside that chunk, or nil if the block is not available.
+func (gameWorld *GameWorld) getGeneratedChunk(block BlockPos) (*Chunk, LocalPos) {
+	chunk := gameWorld.GetChunk(block.Chunk())
+	if chunk == nil || !chunk.isGenerated.Load() {
+		return nil, LocalPos{}
+	}
+	return chunk, block.Local()
+}
+
+// GetBlock returns the block ID at a world position and whether that block
+// belongs to a generated chunk.
+func (gameWorld *GameWorld) GetBlock(block BlockPos) (int, bool) {
+	chunk, local := gameWorld.getGeneratedChunk(block)
+	if chunk == nil {
+		return BLOCK_AIR, false
+	}
+	return chunk.Block(local), true
+}
+
+// SetBlock replaces the block ID at a world position, queues the owning
+// chunk for remeshing and marks it for saving. Unloaded positions are ignored.
+// A block on the chunk border also queues the neighbouring chunk meshed against it.
+func (gameWorld *GameWorld) SetBlock(block BlockPos, blockID int) {
+	chunk, local := gameWorld.getGeneratedChunk(block)
+	if chunk == nil {
+		return
+	}
+	chunk.SetBlock(local, blockID)
+	chunk.isModified = true
+	gameWorld.remeshQueue[chunk.position] = true
+
+	for _, neighbourBlock := range block.Neighbours() {
+		neighbour, _ := gameWorld.getGeneratedChunk(neighbourBlock)
+		if neighbour != nil && neighbour != chunk && neighbour.lod.Load() == chunk.lod.Load() {
+			gameWorld.remeshQueue[neighbour.position] = true
+		}
+	}
+}
+
+// BreakBlock replaces the block at a world position with air and
+// lets water next to it flow in.
+// Returns: The ID of the removed block (BLOCK_AIR if nothing was there)
+func (gameWorld *GameWorld) BreakBlock(block BlockPos) int {
+	blockID, loaded := gameWorld.GetBlock(block)
+	if !loaded || blockID == BLOCK_AIR {
+		return BLOCK_AIR
+	}
+	gameWorld.SetBlock(block, BLOCK_AIR)
+	gameWorld.fluids.WakeNeighbours(block)
+	return blockID
+}
+
+// GetFluidLevel returns the fluid level stored at a world position.
+func (gameWorld *GameWorld) GetFluidLevel(block BlockPos) int {
+	chunk, local := gameWorld.getGeneratedChunk(block)
+	if chunk == nil {
+		return 0
+	}
+	return chunk.FluidLevel(local)
+}
+
+// SetFluidLevel stores the fluid level at a world position.
+func (gameWorld *GameWorld) SetFluidLevel(block BlockPos, level int) {
+	chunk, local := gameWorld.getGeneratedChunk(block)
+	if chunk == nil {
+		return
+	}
+	chunk.SetFluidLevel(local, level)
+	chunk.isModified = true
+}
+
+// NotifyChunkGenerated queues a chunk whose generation just finished.
+// Called from the generator goroutine; the chunk is picked up on the next tick.
+func (gameWorld *GameWorld) NotifyChunkGenerated(chunk *Chunk) {
+	gameWorld.generatedMutex.Lock()
+	gameWorld.generatedChunks = append(gameWorld.generatedChunks, chunk)
+	gameWorld.generatedMutex.Unlock()
+}
+
+// wakeChunkBorders wakes water on both sides of a freshly generated chunk's
+// faces wherever it touches air across the face, so fluid flows between
+// chunks that were generated at different times.
+func (gameWorld *GameWorld) wakeChunkBorders(chunk *Chunk) {
+	// wakeIfFlowing wakes a water cell when the cell across the border is air
+	wakeIfFlowing := func(block, across BlockPos) {
+		blockID, _ := gameWorld.GetBlock(block)
+		if blockID != BLOCK_WATER {
+			return
+		}
+		acrossID, loaded := gameWorld.GetBlock(across)
+		if loaded && acrossID == BLOCK_AIR {
+			gameWorld.fluids.Wake(block)
+		}
+	}
+
+	// The 16x16 blocks of each face against the blocks across it
+	for _, offset := range blockNeighbourOffsets {
+		step := [3]int{offset.x, offset.y, offset.z}
+		axis := slices.IndexFunc(step[:], func(value int) bool { return value != 0 })
+		cell := [3]int{}
+		if step[axis] > 0 {
+			cell[axis] = CHUNK_SIZE - 1
+		}
+		for u := range CHUNK_SIZE {
+			for v := range CHUNK_SIZE {
+				cell[(axis+1)%3], cell[(axis+2)%3] = u, v
+				inside := chunk.position.Block(LocalPos{cell[0], cell[1], cell[2]})
+				across := inside.Add(offset)
+				wakeIfFlowing(inside, across)
+				wakeIfFlowing(across, inside)
+			}
+		}
+	}
+}
+
+// Update advances the world simulation by deltaTime seconds using a fixed tick.
+// Also compacts the chunk arena when needed. Called each frame from the main game loop.
+func (gameWorld *GameWorld) Update(deltaTime float64) {
+	gameWorld.SyncCameraRoutine()
+
+	tickLength := 1.0 / float64(WORLD_TICK_RATE)
+	gameWorld.tickAccumulator += deltaTime
+
+	ticks := 0
+	for gameWorld.tickAccumulator >= tickLength {
+		gameWorld.tickAccumulator -= tickLength
+		gameWorld.Tick()
+
+		// Drop the remaining time if we fall too far behind
+		ticks++
+		if ticks >= WORLD_MAX_FRAME_TICK {
+			gameWorld.tickAccumulator = 0
+			break
+		}
+	}
+
+	gameWorld.CompactArenaIfFragmented()
+}
+
+// SyncCameraRoutine publishes the camera position to the camera goroutine and
+// takes the newest render list for the frame, so everything drawn in one frame
+// comes from the same list. Called each frame from Update.
+func (gameWorld *GameWorld) SyncCameraRoutine() {
+	gameWorld.cameraMutex.Lock()
+	defer gameWorld.cameraMutex.Unlock()
+	gameWorld.cameraPosition = gameWorld.currentCamera.position
+	gameWorld.frameChunks = gameWorld.renderChunks
+}
+
+// Tick runs a single fixed world step: picks up new chunks, advances
+// the fluid simulation and remeshes a batch of changed chunks.
+func (gameWorld *GameWorld) Tick() {
+	gameWorld.tickCount++
+
+	// Connect freshly generated chunks to the simulation
+	gameWorld.generatedMutex.Lock()
+	generated := gameWorld.generatedChunks
+	gameWorld.generatedChunks = nil
+	gameWorld.generatedMutex.Unlock()
+	for _, chunk := range generated {
+		gameWorld.wakeChunkBorders(chunk)
+
+		// The neighbours meshed before the chunk was ready show walls towards it
+		for _, position := range chunk.position.Neighbours() {
+			if neighbour := gameWorld.GetChunk(position); neighbour != nil {
+				neighbour.RemeshStaleBorders()
+			}
+		}
+		chunk.RemeshStaleBorders()
+	}
+
+	// Advance the day/night cycle
+	gameWorld.time.Advance()
+
+	// Fluids flow slower than the world ticks
+	if gameWorld.tickCount%FLUID_TICK_INTERVAL == 0 {
+		scope := profiler.Begin("fluids")
+		gameWorld.fluids.Tick()
+		scope.End()
+	}
+
+	// Periodically save the level and the changed chunks so they survive crashes
+	if gameWorld.tickCount%WORLD_AUTOSAVE_TICKS == 0 {
+		if err := gameWorld.Save(); err != nil {
+			fmt.Println(err)
+		}
+	}
+
+	scope := profiler.Begin("remesh")
+	gameWorld.RemeshQueuedChunks(gameWorld.remeshBatchSize)
+	scope.End()
+}
+
+// RemeshQueuedChunks rebuilds the meshes of up to maxChunks queued chunks,
+// in a fixed order. The new meshes are uploaded on the next render.
+func (gameWorld *GameWorld) RemeshQueuedChunks(maxChunks int) {
+	positions := make([]ChunkPos, 0, len(gameWorld.remeshQueue))
+	for position := range gameWorld.remeshQueue {
+		positions = append(positions, position)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		return positions[i].Less(positions[j])
+	})
+
+	for i, position := range positions {
+		if i >= maxChunks {
+			break
+		}
+		delete(gameWorld.remeshQueue, position)
+
+		gameWorld.chunksMutex.RLock()
+		chunk := gameWorld.chunks[position]
+		gameWorld.chunksMutex.RUnlock()
+		if chunk != nil {
+			chunk.UpdateMesh()
+		}
+	}
+}
+
+// Shutdown stops the camera tracking goroutine and saves the level and the changed chunks.
+// Called once when the application exits.
+func (gameWorld *GameWorld) Shutdown() {
+	close(gameWorld.closeCameraMovementRoutine)
+	if err := gameWorld.Save(); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// worldTimeNames maps the names accepted by "time set" to times of day.
+var worldTimeNames = map[string]float64{
+	"sunrise":  WORLD_TIME_SUNRISE,
+	"day":      WORLD_TIME_DEFAULT,
+	"noon":     WORLD_TIME_NOON,
+	"sunset":   WORLD_TIME_SUNSET,
+	"night":    WORLD_TIME_SUNSET + 1000,
+	"midnight": WORLD_TIME_MIDNIGHT,
+}
+
+// RegisterCommands adds the world commands ("time", "lod", "occlusion", "arena", "seed", "ores", "save") to a registry.
+func (gameWorld *GameWorld) RegisterCommands(registry *CommandRegistry) {
+	registry.Register(
+		"time",
+		"time <query | set <ticks|sunrise|day|noon|sunset|night|midnight> | add <ticks> | rate <multiplier> | freeze | unfreeze>",
+		func(args []string) (string, error) {
+			if len(args) == 0 {
+				return "", fmt.Errorf("missing subcommand")
+			}
+
+			worldTime := &gameWorld.time
+			switch args[0] {
+			case "query":
+			case "freeze":
+				worldTime.frozen = true
+			case "unfreeze":
+				worldTime.frozen = false
+			case "set", "add", "rate":
+				if len(args) != 2 {
+					return "", fmt.Errorf("%s expects one value", args[0])
+				}
+				value, named := worldTimeNames[args[1]]
+				if !named || args[0] != "set" {
+					parsed, err := parseFiniteFloat(args[1])
+					if err != nil {
+						return "", err
+					}
+					value = parsed
+				}
+
+				switch args[0] {
+				case "set":
+					worldTime.Set(value)
+				case "add":
+					worldTime.Set(worldTime.ticks + value)
+				case "rate":
+					if value < 0 {
+						return "", fmt.Errorf("rate must not be negative")
+					}
+					worldTime.rate = value
+				}
+			default:
+				return "", fmt.Errorf("unknown subcommand %q", args[0])
+			}
+
+			return fmt.Sprintf("day %d, time %.0f, rate %g, frozen %v",
+				worldTime.day, worldTime.ticks, worldTime.rate, worldTime.frozen), nil
+		},
+	)
+
+	registry.Register(
+		"lod",
+		"lod <on | off | <lod1 distance> <lod2 distance> <lod3 distance>> - distances in chunks",
+		func(args []string) (string, error) {
+			gameWorld.cameraMutex.Lock()
+			defer gameWorld.cameraMutex.Unlock()
+
+			switch {
+			case len(args) == 1 && args[0] == "on":
+				gameWorld.lod.enabled = true
+			case len(args) == 1 && args[0] == "off":
+				gameWorld.lod.enabled = false
+			case len(args) == 3:
+				distances := [3]int{}
+				for i, arg := range args {
+					distance, err := strconv.Atoi(arg)
+					if err != nil || distance < 1 {
+						return "", fmt.Errorf("invalid distance %q", arg)
+					}
+					if i > 0 && distance < distances[i-1] {
+						return "", fmt.Errorf("distances must not decrease")
+					}
+					distances[i] = distance
+				}
+				gameWorld.lod = LODSettings{enabled: true, distances: distances}
+			default:
+				return "", fmt.Errorf("expected on, off or three distances")
+			}
+
+			// Re-evaluate every chunk's level on the next camera check
+			gameWorld.forceChunkUpdate.Store(true)
+			return fmt.Sprintf("lod %v, distances %v", gameWorld.lod.enabled, gameWorld.lod.distances), nil
+		},
+	)
+
+	registry.Register("occlusion", "occlusion <on | off | stats>", func(args []string) (string, error) {
+		if len(args) != 1 {
+			return "", fmt.Errorf("expected one argument")
+		}
+		switch args[0] {
+		case "on":
+			gameWorld.occlusionEnabled = true
+		case "off":
+			gameWorld.occlusionEnabled = false
+		case "stats":
+			if !gameWorld.occlusionEnabled {
+				return "occlusion culling is off", nil
+			}
+			visible := 0
+			for _, chunk := range gameWorld.frameChunks {
+				if gameWorld.occlusion.Visible(chunk.position) {
+					visible++
+				}
+			}
+			return fmt.Sprintf("%d of %d chunks visible", visible, len(gameWorld.frameChunks)), nil
+		default:
+			return "", fmt.Errorf("unknown argument %q", args[0])
+		}
+		return fmt.Sprintf("occlusion %v", gameWorld.occlusionEnabled), nil
+	})
+
+	registry.Register("arena", "arena [compact] - chunk vertex buffer usage", func(args []string) (string, error) {
+		switch {
+		case len(args) == 0:
+		case len(args) == 1 && args[0] == "compact":
+			gameWorld.chunkArena.Compact(gameWorld.chunkArena.Stats().capacity)
+		default:
+			return "", fmt.Errorf("expected no argument or compact")
+		}
+		return gameWorld.chunkArena.Stats().String(), nil
+	})
+
+	registry.Register("seed", "seed - print the seed the terrain is generated from", func(args []string) (string, error) {
+		return fmt.Sprintf("seed %d", gameWorld.seed), nil
+	})
+
+	registry.Register("ores", "ores - list the ore veins and count the ore blocks of the loaded chunks", func(args []string) (string, error) {
+		// Count every block type in the generated chunks, they only change on the main thread
+		counts := map[int]int{}
+		gameWorld.chunksMutex.RLock()
+		for _, chunk := range gameWorld.chunks {
+			if !chunk.isGenerated.Load() || chunk.blocks == nil {
+				continue
+			}
+			for x := range CHUNK_SIZE {
+				for z := range CHUNK_SIZE {
+					for y := range CHUNK_SIZE {
+						counts[chunk.blocks.ids[x][z][y]]++
+					}
+				}
+			}
+		}
+		gameWorld.chunksMutex.RUnlock()
+
+		lines := []string{}
+		for _, ore := range gameWorld.ores {
+			lines = append(lines, fmt.Sprintf("%s: heights %d to %d, %g veins of %d blocks per chunk, %d loaded",
+				BlockName(ore.blockID), ore.minHeight, ore.maxHeight, ore.veinsPerChunk, ore.veinSize, counts[ore.blockID]))
+		}
+		return strings.Join(lines, "\n"), nil
+	})
+
+	registry.Register("save", "save - write the level data and the changed chunks to disk", func(args []string) (string, error) {
+		if err := gameWorld.Save(); err != nil {
+			return "", err
+		}
+		return "saved to " + gameWorld.saveDirectory, nil
+	})
 }
@@ -1,5 +1,5 @@
-// Provides utility functions for OpenGL graphics operations.
-// Includes mesh creation helpers, OpenGL string utilities, and texture loading.
+// Provides utility functions for graphics operations.
+// Includes mesh creation helpers, OpenGL string utilities, texture loading and PNG output.
 
 package main
 
@@ -8,7 +8,7 @@ import (
 	"image"
 	"image/draw"
 	_ "image/jpeg" // Register JPEG decoder
-	_ "image/png"  // Register PNG decoder
+	"image/png"    // PNG decoder and encoder
 	"os"
 
 	"github.com/go-gl/gl/v3.3-core/gl"
@@ -45,9 +45,28 @@ func GetTriangleMesh() Mesh {
 		mgl32.Vec2{0.0, 0.0},      // Texture coordinates
 	)
 
-	// Prepare the mesh for OpenGL rendering
+	// Prepare the mesh for rendering
 	mesh.PrepareArrayData() // Organizes vertex data into arrays
-	mesh.UpdateVAO()        // Creates Vertex Array Object and buffers
+	mesh.UpdateVAO()        // Uploads the vertices to a GPU buffer
+
+	return mesh
+}
+
+// GetFullscreenTriangleMesh creates a single triangle that covers the whole screen.
+// Positions are given directly in clip space (-1..1), so the vertex shader can pass
+// them through unchanged. Used by full-screen passes such as the sky.
+func GetFullscreenTriangleMesh() Mesh {
+	mesh := Mesh{}
+	color := mgl32.Vec3{1.0, 1.0, 1.0}
+	normal := mgl32.Vec3{0.0, 0.0, 1.0}
+
+	// One oversized triangle is cheaper than a quad (no diagonal seam)
+	mesh.AddVertex(mgl32.Vec3{-1.0, -1.0, 0.0}, color, normal, mgl32.Vec2{0.0, 0.0})
+	mesh.AddVertex(mgl32.Vec3{3.0, -1.0, 0.0}, color, normal, mgl32.Vec2{2.0, 0.0})
+	mesh.AddVertex(mgl32.Vec3{-1.0, 3.0, 0.0}, color, normal, mgl32.Vec2{0.0, 2.0})
+
+	mesh.PrepareArrayData()
+	mesh.UpdateVAO()
 
 	return mesh
 }
@@ -60,57 +79,66 @@ func GLString(str string) *uint8 {
 	return gl.Str(str + "\x00")
 }
 
-// NewTexture loads an image file from disk and creates an OpenGL texture.
+// LoadImageRGBA loads an image file from disk and converts it to RGBA.
 // file: Path to the image file (supports PNG and JPEG formats)
-// Returns: OpenGL texture ID and any error encountered
-func NewTexture(file string) (uint32, error) {
+// Returns: Image with tightly packed rows and any error encountered
+func LoadImageRGBA(file string) (*image.RGBA, error) {
 	// Open image file
 	imgFile, err := os.Open(file)
 	if err != nil {
-		return 0, fmt.Errorf("texture %q not found on disk: %v", file, err)
+		return nil, fmt.Errorf("texture %q not found on disk: %v", file, err)
 	}
 	defer imgFile.Close()
 
 	// Decode image using registered decoders (PNG/JPEG)
 	img, _, err := image.Decode(imgFile)
 	if err != nil {
-		return 0, fmt.Errorf("failed to decode image %q: %v", file, err)
+		return nil, fmt.Errorf("failed to decode image %q: %v", file, err)
 	}
 
-	// Convert image to RGBA format (required by OpenGL)
+	// Convert image to RGBA format (required by the texture upload)
 	rgba := image.NewRGBA(img.Bounds())
 	if rgba.Stride != rgba.Rect.Size().X*4 {
-		return 0, fmt.Errorf("unsupported stride: got %d, expected %d",
+		return nil, fmt.Errorf("unsupported stride: got %d, expected %d",
 			rgba.Stride, rgba.Rect.Size().X*4)
 	}
 
 	// Draw source image onto RGBA canvas
 	draw.Draw(rgba, rgba.Bounds(), img, image.Point{0, 0}, draw.Src)
+	return rgba, nil
+}
 
-	// Generate OpenGL texture
-	var texture uint32
-	gl.GenTextures(1, &texture)
-	gl.ActiveTexture(gl.TEXTURE0)
-	gl.BindTexture(gl.TEXTURE_2D, texture)
-
-	// Set texture parameters for pixelated/minecraft-style look
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)   // Nearest-neighbor filtering
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)   // No interpolation
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE) // Clamp texture coordinates
-	gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
-
-	// Upload texture data to GPU
-	gl.TexImage2D(
-		gl.TEXTURE_2D,             // Target
-		0,                         // Mipmap level (0 = base)
-		gl.RGBA,                   // Internal format
-		int32(rgba.Rect.Size().X), // Width
-		int32(rgba.Rect.Size().Y), // Height
-		0,                         // Border (must be 0)
-		gl.RGBA,                   // Format of pixel data
-		gl.UNSIGNED_BYTE,          // Data type
-		gl.Ptr(rgba.Pix),          // Pointer to pixel data
-	)
+// SaveImagePNG writes an image to a PNG file.
+// file: Path of the file to create or overwrite
+// img: Image to write
+func SaveImagePNG(file string, img image.Image) error {
+	output, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("failed to create image %q: %v", file, err)
+	}
+	if err := png.Encode(output, img); err != nil {
+		output.Close()
+		return fmt.Errorf("failed to encode image %q: %v", file, err)
+	}
+	return output.Close()
+}
+
+// NewTexture loads an image file from disk and creates a texture.
+// file: Path to the image file (supports PNG and JPEG formats)
+// Returns: Texture ID and any error encountered
+func NewTexture(file string) (uint32, error) {
+	rgba, err := LoadImageRGBA(file)
+	if err != nil {
+		return 0, err
+	}
 
+	// Nearest-neighbor filtering for a pixelated/minecraft-style look
+	texture := renderBackend.CreateTexture(TextureDescription{
+		target: gl.TEXTURE_2D,
+		width:  rgba.Rect.Size().X,
+		height: rgba.Rect.Size().Y,
+		format: TEXTURE_FORMAT_RGBA8,
+		pixels: rgba.Pix,
+	})
 	return texture, nil
 }
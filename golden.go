@@ -0,0 +1,214 @@
+// Implements golden-image tests of the terrain.
+// A fixed set of camera poses is rendered with the software rasterizer (see
+// render_backend_software.go), so the pictures do not depend on a GPU, and
+// compared with reference images checked into the golden directory. Small
+// per-pixel differences are tolerated so harmless changes in rounding do not
+// fail the comparison. The comparison runs as TestGolden; refresh the
+// references with "go test -run TestGolden -update-golden" after an intended
+// visual change.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// Golden-image test constants.
+const (
+	GOLDEN_DIRECTORY       = "golden"        // Directory holding the reference images
+	GOLDEN_WIDTH           = 320             // Width of the rendered images in pixels
+	GOLDEN_HEIGHT          = 180             // Height of the rendered images in pixels
+	GOLDEN_RENDER_DISTANCE = 6               // Render distance in chunks, small to keep loading fast
+	GOLDEN_TOLERANCE       = 8               // Largest channel difference (0-255) that still counts as equal
+	GOLDEN_MAX_DIFFERENT   = 0.002           // Share of pixels allowed to differ by more than the tolerance
+	GOLDEN_SETTLE_TIMEOUT  = 5 * time.Minute // Longest wait for the world around a pose to load
+)
+
+// GoldenCase is a camera pose and time of day rendered by the golden-image tests.
+type GoldenCase struct {
+	name      string     // Reference image name (without extension)
+	pose      CameraPose // Camera position and direction
+	timeOfDay float64    // World time in ticks
+}
+
+// goldenCases lists the poses of the golden-image tests, all in the world with seed 0.
+var goldenCases = []GoldenCase{
+	{"spawn_morning", CameraPose{mgl64.Vec3{0.0, 75.0, 0.0}, 275.0, -15.0}, WORLD_TIME_DEFAULT},
+	{"coast_noon", CameraPose{mgl64.Vec3{0.0, 90.0, 0.0}, 95.0, -30.0}, WORLD_TIME_NOON},
+	{"ground_sunset", CameraPose{mgl64.Vec3{-20.0, 62.0, 25.0}, 140.0, -5.0}, WORLD_TIME_SUNSET},
+}
+
+// ImageDiff summarizes the differences between two images of equal size.
+type ImageDiff struct {
+	pixels    int             // Pixels with a channel differing by more than the tolerance
+	total     int             // Pixels compared
+	maxDelta  int             // Largest channel difference found (0-255)
+	bounds    image.Rectangle // Smallest rectangle containing the differing pixels
+	tolerance int             // Tolerance the comparison used
+}
+
+// CompareImages compares two images channel by channel.
+// expected, actual: Images to compare, must have the same size
+// tolerance: Largest channel difference (0-255) that counts as equal
+func CompareImages(expected, actual image.Image, tolerance int) (ImageDiff, error) {
+	size := expected.Bounds().Size()
+	if actual.Bounds().Size() != size {
+		return ImageDiff{}, fmt.Errorf("image size %v differs from expected %v", actual.Bounds().Size(), size)
+	}
+
+	diff := ImageDiff{total: size.X * size.Y, tolerance: tolerance}
+	for y := range size.Y {
+		for x := range size.X {
+			delta := colorDelta(
+				expected.At(expected.Bounds().Min.X+x, expected.Bounds().Min.Y+y),
+				actual.At(actual.Bounds().Min.X+x, actual.Bounds().Min.Y+y),
+			)
+			diff.maxDelta = max(diff.maxDelta, delta)
+			if delta > tolerance {
+				diff.pixels++
+				diff.bounds = diff.bounds.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	return diff, nil
+}
+
+// colorDelta returns the largest difference between the RGBA channels of two colors (0-255).
+func colorDelta(a, b color.Color) int {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+	delta := 0
+	for _, channel := range [][2]uint32{{ar, br}, {ag, bg}, {ab, bb}, {aa, ba}} {
+		delta = max(delta, abs(int(channel[0]>>8)-int(channel[1]>>8)))
+	}
+	return delta
+}
+
+// Share returns the share of compared pixels that differ (0 to 1).
+func (diff ImageDiff) Share() float64 {
+	if diff.total == 0 {
+		return 0.0
+	}
+	return float64(diff.pixels) / float64(diff.total)
+}
+
+// String describes the differences.
+func (diff ImageDiff) String() string {
+	if diff.pixels == 0 {
+		return fmt.Sprintf("identical within tolerance %d (max delta %d)", diff.tolerance, diff.maxDelta)
+	}
+	return fmt.Sprintf("%d of %d pixels (%.2f%%) differ by more than %d, max delta %d, in %v",
+		diff.pixels, diff.total, diff.Share()*100.0, diff.tolerance, diff.maxDelta, diff.bounds)
+}
+
+// DiffImage visualizes the differences: the expected image dimmed, with the
+// pixels that differ by more than the tolerance in red.
+// expected, actual: Images of the same size
+// tolerance: Largest channel difference (0-255) that counts as equal
+func DiffImage(expected, actual image.Image, tolerance int) *image.RGBA {
+	bounds := expected.Bounds()
+	output := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := range bounds.Dy() {
+		for x := range bounds.Dx() {
+			expectedColor := expected.At(bounds.Min.X+x, bounds.Min.Y+y)
+			if colorDelta(expectedColor, actual.At(actual.Bounds().Min.X+x, actual.Bounds().Min.Y+y)) > tolerance {
+				output.SetRGBA(x, y, color.RGBA{255, 0, 0, 255})
+				continue
+			}
+			gray := color.GrayModel.Convert(expectedColor).(color.Gray).Y / 3
+			output.SetRGBA(x, y, color.RGBA{gray, gray, gray, 255})
+		}
+	}
+	return output
+}
+
+// GoldenRenderer renders golden cases with the software rasterizer in a fresh world.
+type GoldenRenderer struct {
+	backend       *SoftwareBackend // Backend the game loop renders with
+	loop          *GameLoop        // Game loop of the world
+	saveDirectory string           // Temporary directory of the world, removed by Close
+}
+
+// NewGoldenRenderer creates a fresh world in a temporary directory, so the
+// player's save cannot change the pictures, and a game loop rendering it on
+// the software rasterizer.
+// Must run before anything else created GPU resources, it replaces renderBackend.
+func NewGoldenRenderer() (*GoldenRenderer, error) {
+	saveDirectory, err := os.MkdirTemp("", "golden-world")
+	if err != nil {
+		return nil, err
+	}
+
+	renderer := &GoldenRenderer{
+		backend:       NewSoftwareBackend(GOLDEN_WIDTH, GOLDEN_HEIGHT),
+		loop:          &GameLoop{},
+		saveDirectory: saveDirectory,
+	}
+	renderBackend = renderer.backend
+
+	renderer.loop.gameWorld.saveDirectory = saveDirectory
+	renderer.loop.gameWorld.renderDistance = GOLDEN_RENDER_DISTANCE
+	renderer.loop.Initialize(&Window{width: GOLDEN_WIDTH, height: GOLDEN_HEIGHT})
+	renderer.loop.hud.visible = false // Pictures show the world only
+	return renderer, nil
+}
+
+// Render moves the camera to a case's pose, waits until the world around it
+// has settled and renders one frame.
+// goldenCase: Pose to render
+func (renderer *GoldenRenderer) Render(goldenCase GoldenCase) (*image.RGBA, error) {
+	renderer.loop.ApplyCameraPose(goldenCase.pose, goldenCase.timeOfDay)
+	if err := renderer.loop.RenderSettledFrame(GOLDEN_SETTLE_TIMEOUT, renderer.backend.Reset); err != nil {
+		return nil, err
+	}
+	renderer.backend.Reset()
+	return renderer.backend.Image(), nil
+}
+
+// Close removes the world directory.
+func (renderer *GoldenRenderer) Close() {
+	os.RemoveAll(renderer.saveDirectory)
+}
+
+// CompareGoldenImage compares a rendered image with the reference image of its
+// case. A failed comparison leaves the rendered and diff images in the
+// temporary directory and names them in the error.
+// directory: Directory of the reference images
+// goldenCase: Case the image shows
+// img: Rendered image
+func CompareGoldenImage(directory string, goldenCase GoldenCase, img image.Image) (ImageDiff, error) {
+	expected, err := LoadImageRGBA(filepath.Join(directory, goldenCase.name+".png"))
+	if err != nil {
+		return ImageDiff{}, fmt.Errorf("%v (run with -update-golden to create it)", err)
+	}
+	diff, err := CompareImages(expected, img, GOLDEN_TOLERANCE)
+	if err != nil {
+		return diff, err
+	}
+	if diff.Share() > GOLDEN_MAX_DIFFERENT {
+		actualFile := filepath.Join(os.TempDir(), "golden_"+goldenCase.name+"_actual.png")
+		diffFile := filepath.Join(os.TempDir(), "golden_"+goldenCase.name+"_diff.png")
+		SaveImagePNG(actualFile, img)
+		SaveImagePNG(diffFile, DiffImage(expected, img, GOLDEN_TOLERANCE))
+		return diff, fmt.Errorf("%v, see %s and %s", diff, actualFile, diffFile)
+	}
+	return diff, nil
+}
+
+// UpdateGoldenImage writes a rendered image as the new reference of its case.
+// directory: Directory of the reference images
+// goldenCase: Case the image shows
+// img: Rendered image
+func UpdateGoldenImage(directory string, goldenCase GoldenCase, img image.Image) error {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return err
+	}
+	return SaveImagePNG(filepath.Join(directory, goldenCase.name+".png"), img)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"testing"
+)
+
+// updateGolden makes TestGolden write the rendered images as new references.
+var updateGolden = flag.Bool("update-golden", false, "overwrite the reference images of TestGolden instead of comparing")
+
+// TestGolden renders every golden case with the software rasterizer and
+// compares it with its reference image in the golden directory.
+func TestGolden(t *testing.T) {
+	if testing.Short() {
+		t.Skip("golden images load and render a world on the CPU")
+	}
+
+	previous := renderBackend
+	renderer, err := NewGoldenRenderer()
+	t.Cleanup(func() {
+		renderBackend = previous
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer renderer.Close()
+
+	for _, goldenCase := range goldenCases {
+		img, err := renderer.Render(goldenCase)
+		if err != nil {
+			t.Errorf("%s: %v", goldenCase.name, err)
+			continue
+		}
+
+		if *updateGolden {
+			if err := UpdateGoldenImage(GOLDEN_DIRECTORY, goldenCase, img); err != nil {
+				t.Errorf("%s: %v", goldenCase.name, err)
+			}
+			t.Logf("%s: reference updated", goldenCase.name)
+			continue
+		}
+
+		diff, err := CompareGoldenImage(GOLDEN_DIRECTORY, goldenCase, img)
+		if err != nil {
+			t.Errorf("%s: %v", goldenCase.name, err)
+			continue
+		}
+		t.Logf("%s: %v", goldenCase.name, diff)
+	}
+}
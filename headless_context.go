@@ -0,0 +1,103 @@
+//go:build linux
+
+// Implements an OpenGL context without a window for off-screen rendering.
+// EGL is asked for a surfaceless display (Mesa's EGL_MESA_platform_surfaceless,
+// which also works without a display server) and falls back to the default
+// display. The context has no default framebuffer, so everything has to be
+// drawn into framebuffer objects (see capture.go).
+
+package main
+
+/*
+#cgo LDFLAGS: -lEGL
+#include <EGL/egl.h>
+#include <EGL/eglext.h>
+
+#ifndef EGL_PLATFORM_SURFACELESS_MESA
+#define EGL_PLATFORM_SURFACELESS_MESA 0x31DD
+#endif
+
+static EGLDisplay headlessDisplay = EGL_NO_DISPLAY;
+static EGLContext headlessContext = EGL_NO_CONTEXT;
+
+// headlessCreateContext creates an OpenGL 3.3 core context and makes it current.
+// Returns 0 on success, otherwise the step that failed.
+static int headlessCreateContext(void) {
+	PFNEGLGETPLATFORMDISPLAYEXTPROC getPlatformDisplay =
+		(PFNEGLGETPLATFORMDISPLAYEXTPROC)eglGetProcAddress("eglGetPlatformDisplayEXT");
+	if (getPlatformDisplay != NULL) {
+		headlessDisplay = getPlatformDisplay(EGL_PLATFORM_SURFACELESS_MESA, EGL_DEFAULT_DISPLAY, NULL);
+	}
+	EGLint major, minor;
+	if (headlessDisplay == EGL_NO_DISPLAY || !eglInitialize(headlessDisplay, &major, &minor)) {
+		headlessDisplay = eglGetDisplay(EGL_DEFAULT_DISPLAY);
+		if (headlessDisplay == EGL_NO_DISPLAY || !eglInitialize(headlessDisplay, &major, &minor)) {
+			return 1;
+		}
+	}
+
+	EGLint configAttributes[] = { EGL_RENDERABLE_TYPE, EGL_OPENGL_BIT, EGL_NONE };
+	EGLConfig config = NULL;
+	EGLint configCount = 0;
+	if (!eglChooseConfig(headlessDisplay, configAttributes, &config, 1, &configCount)) {
+		return 2;
+	}
+	if (!eglBindAPI(EGL_OPENGL_API)) {
+		return 3;
+	}
+
+	EGLint contextAttributes[] = {
+		EGL_CONTEXT_MAJOR_VERSION, 3,
+		EGL_CONTEXT_MINOR_VERSION, 3,
+		EGL_CONTEXT_OPENGL_PROFILE_MASK, EGL_CONTEXT_OPENGL_CORE_PROFILE_BIT,
+		EGL_NONE,
+	};
+	headlessContext = eglCreateContext(headlessDisplay, configCount > 0 ? config : NULL, EGL_NO_CONTEXT, contextAttributes);
+	if (headlessContext == EGL_NO_CONTEXT) {
+		return 4;
+	}
+	if (!eglMakeCurrent(headlessDisplay, EGL_NO_SURFACE, EGL_NO_SURFACE, headlessContext)) {
+		return 5;
+	}
+	return 0;
+}
+
+// headlessDestroyContext releases the context and the display.
+static void headlessDestroyContext(void) {
+	if (headlessDisplay == EGL_NO_DISPLAY) {
+		return;
+	}
+	eglMakeCurrent(headlessDisplay, EGL_NO_SURFACE, EGL_NO_SURFACE, EGL_NO_CONTEXT);
+	if (headlessContext != EGL_NO_CONTEXT) {
+		eglDestroyContext(headlessDisplay, headlessContext);
+	}
+	eglTerminate(headlessDisplay);
+	headlessDisplay = EGL_NO_DISPLAY;
+	headlessContext = EGL_NO_CONTEXT;
+}
+*/
+import "C"
+
+import "fmt"
+
+// headlessContextSteps names the step of headlessCreateContext that failed.
+var headlessContextSteps = map[C.int]string{
+	1: "no EGL display",
+	2: "no EGL config for OpenGL",
+	3: "EGL cannot bind the OpenGL API",
+	4: "no OpenGL 3.3 core context",
+	5: "surfaceless contexts are not supported",
+}
+
+// CreateHeadlessContext makes an OpenGL 3.3 context without a window current
+// on the calling thread, which must be locked to its OS thread (see main.go).
+// Returns a function that destroys the context again.
+func CreateHeadlessContext() (func(), error) {
+	if step := C.headlessCreateContext(); step != 0 {
+		eglError := int(C.eglGetError())
+		C.headlessDestroyContext()
+		return nil, fmt.Errorf("failed to create headless OpenGL context: %s (EGL error 0x%x)",
+			headlessContextSteps[step], eglError)
+	}
+	return func() { C.headlessDestroyContext() }, nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+// Headless rendering needs EGL, which is only wired up on Linux.
+
+package main
+
+import "errors"
+
+// CreateHeadlessContext is not available on this platform.
+func CreateHeadlessContext() (func(), error) {
+	return nil, errors.New("headless rendering is only supported on Linux (EGL)")
+}
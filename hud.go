@@ -0,0 +1,142 @@
+// Implements the heads-up display: frame rate, camera and world statistics
+// and the targeted block drawn as text in the top left corner over the
+// finished frame. F1 or the "hud" command shows or hides it together with the
+// crosshair and the block outline (see block_target.go).
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// HUD constants.
+const (
+	HUD_SAMPLE_INTERVAL = 0.5 // Seconds over which frame times are averaged
+	HUD_MARGIN          = 4   // Distance of the text block from the window corner in font pixels
+	HUD_PADDING         = 3   // Background border around the text in font pixels
+	HUD_SCALE_HEIGHT    = 540 // Window height per font scale step (2x from 1080 pixels)
+)
+
+// Colors of the HUD.
+var (
+	HUD_TEXT_COLOR       = mgl32.Vec3{1.0, 1.0, 1.0} // Text
+	HUD_BACKGROUND_COLOR = mgl32.Vec3{0.0, 0.0, 0.0} // Half transparent box behind the text
+)
+
+// HUD collects frame statistics and draws the on-screen text.
+type HUD struct {
+	visible      bool         // Draw the HUD
+	text         TextRenderer // Batched text of the HUD
+	frames       int          // Frames counted in the current sample
+	sampleTime   float64      // Seconds counted in the current sample
+	worstFrame   float64      // Longest frame of the current sample (seconds)
+	fps          float64      // Frames per second of the last sample
+	frameTime    float64      // Average frame time of the last sample (milliseconds)
+	maxFrameTime float64      // Longest frame time of the last sample (milliseconds)
+}
+
+// Initialize sets up the text renderer. The HUD starts visible.
+// materials: Library holding the "text" material
+func (hud *HUD) Initialize(materials *MaterialLibrary) {
+	hud.visible = true
+	hud.text.Initialize(materials)
+}
+
+// Update adds a frame to the frame time statistics, which are refreshed
+// every HUD_SAMPLE_INTERVAL seconds so the numbers stay readable.
+// deltaTime: Duration of the last frame in seconds
+func (hud *HUD) Update(deltaTime float64) {
+	hud.frames++
+	hud.sampleTime += deltaTime
+	hud.worstFrame = max(hud.worstFrame, deltaTime)
+	if hud.sampleTime < HUD_SAMPLE_INTERVAL {
+		return
+	}
+
+	hud.fps = float64(hud.frames) / hud.sampleTime
+	hud.frameTime = hud.sampleTime / float64(hud.frames) * 1000.0
+	hud.maxFrameTime = hud.worstFrame * 1000.0
+	hud.frames = 0
+	hud.sampleTime = 0.0
+	hud.worstFrame = 0.0
+}
+
+// Lines returns the HUD text, one entry per line.
+// loop: Game loop whose camera and world are described
+func (hud *HUD) Lines(loop *GameLoop) []string {
+	camera := loop.camera
+	position := camera.position
+	block := BlockPosAt(position)
+	chunk, local := block.Chunk(), block.Local()
+	stats := loop.gameWorld.Stats()
+
+	return []string{
+		fmt.Sprintf("%.0f fps, %.1f ms (max %.1f ms)", hud.fps, hud.frameTime, hud.maxFrameTime),
+		fmt.Sprintf("XYZ %.2f / %.2f / %.2f", position[0], position[1], position[2]),
+		fmt.Sprintf("Chunk %s (block %d, %d, %d in chunk)", chunk, local.x, local.y, local.z),
+		fmt.Sprintf("Facing %s (yaw %.1f, pitch %.1f)", facingAxis(camera.front), camera.yaw, camera.pitch),
+		fmt.Sprintf("Chunks %d loaded, %d visible, %d pending", stats.loaded, stats.visible, stats.pending),
+		fmt.Sprintf("Vertices %s stored, %s drawn", formatCount(stats.stored), formatCount(stats.drawn)),
+		fmt.Sprintf("Particles %d, weather %s", len(loop.particles.particles), loop.particles.weather),
+		loop.target.Describe(),
+	}
+}
+
+// Render draws the HUD over the current framebuffer.
+// loop: Game loop whose camera and world are described
+func (hud *HUD) Render(loop *GameLoop) {
+	if !hud.visible {
+		return
+	}
+
+	text := &hud.text
+	text.scale = float32(max(1, loop.window.height/HUD_SCALE_HEIGHT))
+	text.Clear()
+
+	block := strings.Join(hud.Lines(loop), "\n")
+	width, height := text.Measure(block)
+	margin := HUD_MARGIN * text.scale
+	padding := HUD_PADDING * text.scale
+	text.AddBackground(margin, margin, width+2.0*padding, height+2.0*padding, HUD_BACKGROUND_COLOR)
+	text.AddText(block, margin+padding, margin+padding, HUD_TEXT_COLOR)
+	text.Render(loop, loop.window.width, loop.window.height)
+}
+
+// RegisterCommands adds the "hud" command to a registry.
+func (hud *HUD) RegisterCommands(registry *CommandRegistry) {
+	registry.Register("hud", "hud <on|off> - show or hide the on-screen statistics, crosshair and block outline (also F1)", func(args []string) (string, error) {
+		if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+			return "", fmt.Errorf("expected on or off")
+		}
+		hud.visible = args[0] == "on"
+		return fmt.Sprintf("hud %v", hud.visible), nil
+	})
+}
+
+// facingAxis names the horizontal world axis closest to a direction, such as "+X".
+// front: View direction
+func facingAxis(front mgl32.Vec3) string {
+	axis, component := "X", front[0]
+	if math.Abs(float64(front[2])) > math.Abs(float64(front[0])) {
+		axis, component = "Z", front[2]
+	}
+	if component < 0.0 {
+		return "-" + axis
+	}
+	return "+" + axis
+}
+
+// formatCount shortens a large count for display, such as 1.25M or 310.4K.
+func formatCount(count int) string {
+	switch {
+	case count >= 1000000:
+		return fmt.Sprintf("%.2fM", float64(count)/1000000.0)
+	case count >= 1000:
+		return fmt.Sprintf("%.1fK", float64(count)/1000.0)
+	}
+	return fmt.Sprintf("%d", count)
+}
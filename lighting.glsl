@@ -0,0 +1,22 @@
+// Light of the current time of day (see world_time.go)
+#pragma once
+
+uniform vec3 lightDirection; // Direction TO the light source (normalized)
+uniform vec3 lightColor;
+uniform float ambientStrength;
+
+// Ambient light (keeps a little light even when the sun is down)
+vec3 ambientLight() {
+    return ambientStrength * vec3(1.0, 1.0, 1.0);
+}
+
+// Diffuse plus Blinn-Phong specular light from the sun or moon
+vec3 directLight(vec3 norm, vec3 viewDir, float diffuseStrength, float specularStrength, float shininess) {
+    float diff = max(dot(norm, lightDirection), 0.0);
+    vec3 diffuse = diff * lightColor * diffuseStrength;
+
+    vec3 halfwayDir = normalize(lightDirection + viewDir);
+    float spec = pow(max(dot(norm, halfwayDir), 0.0), shininess);
+    vec3 specular = specularStrength * spec * lightColor;
+    return diffuse + specular;
+}
@@ -4,6 +4,9 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"os"
 	"runtime"
 )
 
@@ -11,6 +14,17 @@ import (
 var window Window     // Main application window (handles GLFW, input, rendering context)
 var gameLoop GameLoop // Central game loop (handles updates, rendering, game state)
 
+// Command line flags
+var seedFlag = flag.Int64("seed", 0, "terrain seed of a new world (a saved world keeps its seed)")
+var buildLimitsFlag = flag.String("build-limits", "", "build limits of a new world as min,max heights in multiples of 16, such as -64,320 (a saved world keeps its limits)")
+var captureFlag = flag.String("capture", "", "render one frame off-screen without a window, write it to this PNG file and exit")
+var panoramaFlag = flag.String("panorama", "", "render a cubemap panorama off-screen, write <prefix>_px.png ... <prefix>_nz.png and <prefix>_cross.png and exit")
+var cameraFlag = flag.String("camera", CAPTURE_DEFAULT_CAMERA, "camera pose of -capture and -panorama: x,y,z or x,y,z,yaw,pitch")
+var timeFlag = flag.String("time", "day", "time of day of -capture and -panorama: ticks or sunrise, day, noon, sunset, night, midnight")
+var sizeFlag = flag.String("size", "1280x720", "image size of -capture")
+var panoramaSizeFlag = flag.Int("panorama-size", 1024, "edge length of the -panorama faces in pixels")
+var renderDistanceFlag = flag.Int("render-distance", 0, "render distance of -capture and -panorama in chunks (0 keeps the default)")
+
 // init is called before main() and performs critical initialization.
 // It ensures OpenGL/GLFW functions run on the main thread as required by most windowing systems.
 func init() {
@@ -23,13 +37,44 @@ func init() {
 // main is the application entry point.
 // Initializes all game systems, sets up the window, and enters the main game loop.
 func main() {
+	flag.Parse()
+
+	// Captures render a fresh world off-screen and never open a window
+	if *captureFlag != "" || *panoramaFlag != "" {
+		options, err := captureOptionsFromFlags()
+		if err == nil {
+			err = RunCapture(options)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// The build limits of a new world are checked before a window opens
+	minHeight, maxHeight, err := buildLimitsFromFlags()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	// Initialize the application window with specified dimensions and title
 	// 1280x720 is a common HD resolution for games
 	window.Initialize(1280, 720, "Voxel Terrain")
 
 	// Initialize the game loop with reference to the window
 	// This sets up OpenGL, shaders, camera, textures, and world generation
+	gameLoop.gameWorld.seed = *seedFlag
+	gameLoop.gameWorld.minHeight, gameLoop.gameWorld.maxHeight = minHeight, maxHeight
 	gameLoop.Initialize(&window)
+	if flagPassed("seed") && gameLoop.gameWorld.seed != *seedFlag {
+		fmt.Printf("the saved world keeps its seed %d, -seed only applies to new worlds\n", gameLoop.gameWorld.seed)
+	}
+	if flagPassed("build-limits") && (gameLoop.gameWorld.minHeight != minHeight || gameLoop.gameWorld.maxHeight != maxHeight) {
+		fmt.Printf("the saved world keeps its build limits %d,%d, -build-limits only applies to new worlds\n",
+			gameLoop.gameWorld.minHeight, gameLoop.gameWorld.maxHeight)
+	}
 
 	// Register the game loop's update routine as a callback
 	// This function will be called every frame to update and render the game
@@ -38,4 +83,63 @@ func main() {
 	// Enter the main update/render loop
 	// This function blocks until the window is closed
 	window.EnterUpdateLoop()
+
+	// Save the world and release resources
+	gameLoop.Shutdown()
+	window.Terminate()
+}
+
+// flagPassed reports whether a flag was given on the command line.
+// name: Flag name without the dash
+func flagPassed(name string) bool {
+	passed := false
+	flag.Visit(func(f *flag.Flag) {
+		passed = passed || f.Name == name
+	})
+	return passed
+}
+
+// buildLimitsFromFlags returns the build limits given with -build-limits,
+// or zero for both when the flag is not set (the world then uses its defaults).
+func buildLimitsFromFlags() (int, int, error) {
+	if *buildLimitsFlag == "" {
+		return 0, 0, nil
+	}
+	return ParseBuildLimits(*buildLimitsFlag)
+}
+
+// captureOptionsFromFlags collects the options of an off-screen capture.
+func captureOptionsFromFlags() (CaptureOptions, error) {
+	pose, err := ParseCameraPose(*cameraFlag)
+	if err != nil {
+		return CaptureOptions{}, err
+	}
+	timeOfDay, err := ParseTimeOfDay(*timeFlag)
+	if err != nil {
+		return CaptureOptions{}, err
+	}
+	width, height, err := ParseImageSize(*sizeFlag)
+	if err != nil {
+		return CaptureOptions{}, err
+	}
+	if *panoramaSizeFlag <= 0 {
+		return CaptureOptions{}, fmt.Errorf("invalid panorama size %d", *panoramaSizeFlag)
+	}
+	minHeight, maxHeight, err := buildLimitsFromFlags()
+	if err != nil {
+		return CaptureOptions{}, err
+	}
+
+	return CaptureOptions{
+		seed:           *seedFlag,
+		pose:           pose,
+		timeOfDay:      timeOfDay,
+		width:          width,
+		height:         height,
+		renderDistance: *renderDistanceFlag,
+		buildLimits:    [2]int{minHeight, maxHeight},
+		screenshotFile: *captureFlag,
+		panoramaPrefix: *panoramaFlag,
+		panoramaSize:   *panoramaSizeFlag,
+	}, nil
 }
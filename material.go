@@ -0,0 +1,339 @@
+// Implements materials: everything needed to draw a mesh besides its vertices.
+// A material bundles a shader variant, texture bindings, the render state and
+// default uniform values. Materials are defined in materials.json and applied
+// through the GL state cache, so switching between similar materials only
+// issues the calls that actually change something.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// MATERIAL_FILE is the data file the materials are loaded from.
+const MATERIAL_FILE = "materials.json"
+
+// MATERIAL_MAX_TEXTURES is the number of texture units available to a material.
+// Units from SHADOW_TEXTURE_UNIT on are bound by the renderer itself.
+const MATERIAL_MAX_TEXTURES = SHADOW_TEXTURE_UNIT
+
+// MaterialTexture is a texture bound while a material is in use.
+type MaterialTexture struct {
+	uniform string // Sampler uniform the texture is read through
+	unit    uint32 // Texture unit
+	texture uint32 // OpenGL texture ID
+}
+
+// MaterialUniform is a default value of a float or vector uniform.
+type MaterialUniform struct {
+	name   string    // Uniform name in the shader
+	values []float32 // One to four components (float, vec2, vec3, vec4)
+}
+
+// Material describes how a mesh is drawn.
+type Material struct {
+	name     string            // Name in the material file
+	shader   *Shader           // Shader variant
+	textures []MaterialTexture // Textures bound to units 0, 1, ...
+	state    RenderState       // Depth, blend, cull and polygon state
+	uniforms []MaterialUniform // Default uniform values, sorted by name
+}
+
+// MaterialTextureDefinition is a texture entry of the material file.
+type MaterialTextureDefinition struct {
+	Uniform string `json:"uniform"` // Sampler uniform name
+	File    string `json:"file"`    // Image file
+}
+
+// MaterialDefinition is a material entry of the material file.
+type MaterialDefinition struct {
+	Vertex     string                      `json:"vertex"`     // Base name of the vertex shader file
+	Fragment   string                      `json:"fragment"`   // Base name of the fragment shader file
+	Defines    []string                    `json:"defines"`    // Shader variant defines
+	Textures   []MaterialTextureDefinition `json:"textures"`   // Bound to units 0, 1, ... in order
+	Depth      string                      `json:"depth"`      // "less" (default), "lequal", "always" or "off"
+	DepthWrite *bool                       `json:"depthWrite"` // Write depth (default true)
+	Blend      string                      `json:"blend"`      // "none" (default), "alpha" or "additive"
+	Cull       string                      `json:"cull"`       // "none" (default), "back" or "front"
+	Wireframe  bool                        `json:"wireframe"`  // Draw polygon outlines only
+	Uniforms   map[string][]float32        `json:"uniforms"`   // Default values of float/vec2/vec3/vec4 uniforms
+}
+
+// MaterialLibrary holds the materials loaded from the material file.
+type MaterialLibrary struct {
+	file      string               // Path of the material file
+	materials map[string]*Material // Materials by name
+	textures  map[string]uint32    // Textures loaded so far by file name
+}
+
+// ParseMaterialDefinitions decodes and checks the content of a material file.
+// Unknown fields are rejected so typos do not silently fall back to defaults.
+// content: JSON object mapping material names to definitions
+func ParseMaterialDefinitions(content []byte) (map[string]MaterialDefinition, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+
+	definitions := map[string]MaterialDefinition{}
+	if err := decoder.Decode(&definitions); err != nil {
+		return nil, err
+	}
+
+	for name, definition := range definitions {
+		if err := definition.Validate(); err != nil {
+			return nil, fmt.Errorf("material %q: %v", name, err)
+		}
+	}
+	return definitions, nil
+}
+
+// Validate checks the fields that are not checked by decoding.
+func (definition *MaterialDefinition) Validate() error {
+	if definition.Vertex == "" || definition.Fragment == "" {
+		return fmt.Errorf("vertex and fragment shaders are required")
+	}
+	if len(definition.Textures) > MATERIAL_MAX_TEXTURES {
+		return fmt.Errorf("%d textures, at most %d are supported", len(definition.Textures), MATERIAL_MAX_TEXTURES)
+	}
+	for _, texture := range definition.Textures {
+		if texture.Uniform == "" || texture.File == "" {
+			return fmt.Errorf("textures need a uniform and a file")
+		}
+	}
+	for name, values := range definition.Uniforms {
+		if len(values) < 1 || len(values) > 4 {
+			return fmt.Errorf("uniform %q: expected 1 to 4 values, got %d", name, len(values))
+		}
+	}
+	_, err := definition.RenderState()
+	return err
+}
+
+// RenderState converts the depth, blend, cull and wireframe settings.
+func (definition *MaterialDefinition) RenderState() (RenderState, error) {
+	state := RENDER_STATE_OPAQUE
+
+	switch definition.Depth {
+	case "", "less":
+		state.depthFunc = gl.LESS
+	case "lequal":
+		state.depthFunc = gl.LEQUAL
+	case "always":
+		state.depthFunc = gl.ALWAYS
+	case "off":
+		state.depthTest = false
+	default:
+		return state, fmt.Errorf("unknown depth %q (expected less, lequal, always or off)", definition.Depth)
+	}
+	if definition.DepthWrite != nil {
+		state.depthWrite = *definition.DepthWrite
+	}
+
+	switch definition.Blend {
+	case "", "none":
+	case "alpha":
+		state.blend = true
+		state.blendSource, state.blendDestination = gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA
+	case "additive":
+		state.blend = true
+		state.blendSource, state.blendDestination = gl.SRC_ALPHA, gl.ONE
+	default:
+		return state, fmt.Errorf("unknown blend %q (expected none, alpha or additive)", definition.Blend)
+	}
+
+	switch definition.Cull {
+	case "", "none":
+	case "back":
+		state.cull, state.cullFace = true, gl.BACK
+	case "front":
+		state.cull, state.cullFace = true, gl.FRONT
+	default:
+		return state, fmt.Errorf("unknown cull %q (expected none, back or front)", definition.Cull)
+	}
+
+	state.wireframe = definition.Wireframe
+	return state, nil
+}
+
+// Initialize loads the material file.
+// Panics if it cannot be loaded, since nothing could be drawn.
+// file: Path of the material file
+func (library *MaterialLibrary) Initialize(file string) {
+	library.file = file
+	library.materials = map[string]*Material{}
+	library.textures = map[string]uint32{}
+	if err := library.Load(); err != nil {
+		panic(err)
+	}
+}
+
+// Load reads the material file and (re)builds every material in it.
+// Materials keep their address, so pointers handed out earlier see the new
+// definition. On error nothing changes.
+func (library *MaterialLibrary) Load() error {
+	content, err := os.ReadFile(library.file)
+	if err != nil {
+		return fmt.Errorf("failed to read materials: %v", err)
+	}
+	definitions, err := ParseMaterialDefinitions(content)
+	if err != nil {
+		return fmt.Errorf("%s: %v", library.file, err)
+	}
+
+	// Build everything first so a missing texture leaves the old materials intact
+	built := map[string]Material{}
+	for name, definition := range definitions {
+		material, err := library.build(name, definition)
+		if err != nil {
+			return fmt.Errorf("%s: material %q: %v", library.file, name, err)
+		}
+		built[name] = material
+	}
+
+	for name, material := range built {
+		if existing, found := library.materials[name]; found {
+			*existing = material
+		} else {
+			library.materials[name] = &material
+		}
+	}
+	return nil
+}
+
+// build creates the GL resources of one material.
+// Shader variants and textures are shared between materials.
+func (library *MaterialLibrary) build(name string, definition MaterialDefinition) (Material, error) {
+	state, err := definition.RenderState()
+	if err != nil {
+		return Material{}, err
+	}
+
+	shader, err := GetShaderVariant(definition.Vertex, definition.Fragment, definition.Defines...)
+	if err != nil {
+		return Material{}, err
+	}
+	material := Material{name: name, shader: shader, state: state}
+
+	for unit, textureDefinition := range definition.Textures {
+		texture, loaded := library.textures[textureDefinition.File]
+		if !loaded {
+			texture, err = NewTexture(textureDefinition.File)
+			if err != nil {
+				return Material{}, err
+			}
+			library.textures[textureDefinition.File] = texture
+		}
+		material.textures = append(material.textures, MaterialTexture{textureDefinition.Uniform, uint32(unit), texture})
+	}
+
+	for uniformName, values := range definition.Uniforms {
+		material.uniforms = append(material.uniforms, MaterialUniform{uniformName, values})
+	}
+	sort.Slice(material.uniforms, func(a, b int) bool {
+		return material.uniforms[a].name < material.uniforms[b].name
+	})
+	return material, nil
+}
+
+// Material returns a material by name.
+// Panics if the material file does not define it.
+// name: Material name
+func (library *MaterialLibrary) Material(name string) *Material {
+	material, found := library.materials[name]
+	if !found {
+		panic(fmt.Errorf("%s: no material %q", library.file, name))
+	}
+	return material
+}
+
+// Texture returns the texture loaded from an image file by any material.
+// file: Image file as named in the material file
+func (library *MaterialLibrary) Texture(file string) (uint32, bool) {
+	texture, found := library.textures[file]
+	return texture, found
+}
+
+// Bind makes the material current: program, render state, textures and
+// default uniforms. Uniforms set afterwards override the defaults.
+func (material *Material) Bind() {
+	material.shader.Use()
+	glState.Apply(material.state)
+
+	for _, texture := range material.textures {
+		glState.BindTexture(texture.unit, gl.TEXTURE_2D, texture.texture)
+		material.shader.UniformSetSampler(texture.uniform, int32(texture.unit))
+	}
+
+	for _, uniform := range material.uniforms {
+		values := uniform.values
+		switch len(values) {
+		case 1:
+			material.shader.UniformSetFloat(uniform.name, values[0])
+		case 2:
+			material.shader.UniformSetVec2(uniform.name, (*mgl32.Vec2)(values))
+		case 3:
+			material.shader.UniformSetVec3(uniform.name, (*mgl32.Vec3)(values))
+		case 4:
+			material.shader.UniformSetVec4(uniform.name, (*mgl32.Vec4)(values))
+		}
+	}
+}
+
+// String summarizes the material for the "materials" command.
+func (material *Material) String() string {
+	state := material.state
+	flags := []string{}
+	if !state.depthTest {
+		flags = append(flags, "no depth test")
+	}
+	if !state.depthWrite {
+		flags = append(flags, "no depth write")
+	}
+	if state.blend {
+		flags = append(flags, "blend")
+	}
+	if state.cull {
+		flags = append(flags, "cull")
+	}
+	if state.wireframe {
+		flags = append(flags, "wireframe")
+	}
+	return fmt.Sprintf("%s: %s, %d textures, %d uniforms [%s]",
+		material.name, material.shader.Name(), len(material.textures), len(material.uniforms), strings.Join(flags, ", "))
+}
+
+// RegisterCommands adds the "materials" command to a registry.
+func (library *MaterialLibrary) RegisterCommands(registry *CommandRegistry) {
+	registry.Register("materials", "materials [reload | stats]", func(args []string) (string, error) {
+		switch {
+		case len(args) == 0:
+			names := make([]string, 0, len(library.materials))
+			for name := range library.materials {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			lines := []string{}
+			for _, name := range names {
+				lines = append(lines, library.materials[name].String())
+			}
+			return strings.Join(lines, "\n"), nil
+		case len(args) == 1 && args[0] == "reload":
+			if err := library.Load(); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d materials loaded", len(library.materials)), nil
+		case len(args) == 1 && args[0] == "stats":
+			return glState.Stats(), nil
+		default:
+			return "", fmt.Errorf("expected reload or stats")
+		}
+	})
+}
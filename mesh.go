@@ -1,10 +1,9 @@
-// Implements mesh data structures and OpenGL rendering operations.
-// The Mesh struct handles vertex data storage, VAO/VBO management, and rendering.
+// Implements mesh data structures and rendering operations.
+// The Mesh struct handles vertex data storage, its GPU vertex buffer, and rendering.
 
 package main
 
 import (
-	"github.com/go-gl/gl/v3.3-core/gl"
 	"github.com/go-gl/mathgl/mgl32"
 )
 
@@ -18,11 +17,11 @@ type MeshVertex struct {
 }
 
 // Mesh represents a collection of vertices that form a 3D object.
-// It manages OpenGL vertex array objects (VAO) and vertex buffer objects (VBO).
+// It owns a vertex buffer of the render backend.
 type Mesh struct {
 	vertices  []MeshVertex // Raw vertex data (CPU-side)
 	arrayData []float32    // Flattened vertex data for GPU upload
-	VAO       uint32       // OpenGL Vertex Array Object ID
+	buffer    VertexBuffer // GPU copy of arrayData (zero until uploaded)
 }
 
 // AddVertex appends a new vertex to the mesh.
@@ -59,7 +58,7 @@ func appendVec2ToArray(array []float32, vec *mgl32.Vec2) []float32 {
 }
 
 // PrepareArrayData converts the mesh's vertex data into a flat float32 array
-// suitable for uploading to the GPU via OpenGL buffer objects.
+// suitable for uploading to the GPU.
 // Each vertex consists of 11 float32 values: position(3), color(3), normal(3), UV(2)
 func (mesh *Mesh) PrepareArrayData() {
 	vertices := []float32{}
@@ -75,63 +74,37 @@ func (mesh *Mesh) PrepareArrayData() {
 	mesh.arrayData = vertices
 }
 
-// UpdateVAO creates or updates the OpenGL Vertex Array Object and Vertex Buffer Object
-// for this mesh. This should be called after vertex data has been prepared
-// and before rendering.
+// UpdateVAO creates or updates the GPU vertex buffer of this mesh.
+// This should be called after vertex data has been prepared
+// and before rendering. The buffer is reused so remeshing does not leak it.
 func (mesh *Mesh) UpdateVAO() {
-	vertices := mesh.arrayData
-
-	// Create and bind Vertex Array Object (VAO)
-	// VAO stores the vertex attribute configuration
-	var vao uint32
-	gl.GenVertexArrays(1, &vao)
-	gl.BindVertexArray(vao)
-	mesh.VAO = vao
-
-	// Create and bind Vertex Buffer Object (VBO)
-	// VBO stores the actual vertex data
-	var vbo uint32
-	gl.GenBuffers(1, &vbo)
-	gl.BindBuffer(gl.ARRAY_BUFFER, vbo)
-
-	// Upload vertex data to GPU (4 bytes per float32)
-	gl.BufferData(gl.ARRAY_BUFFER, len(vertices)*4, gl.Ptr(vertices), gl.STATIC_DRAW)
-
-	// Configure vertex attribute pointers
-	// These tell OpenGL how to interpret the interleaved vertex data
-
-	// Attribute 0: Position (3 floats)
-	gl.EnableVertexAttribArray(0)
-	gl.VertexAttribPointerWithOffset(0, 3, gl.FLOAT, false, 11*4, 0)
-
-	// Attribute 1: Color (3 floats)
-	gl.EnableVertexAttribArray(1)
-	gl.VertexAttribPointerWithOffset(1, 3, gl.FLOAT, false, 11*4, 3*4)
-
-	// Attribute 2: Normal (3 floats)
-	gl.EnableVertexAttribArray(2)
-	gl.VertexAttribPointerWithOffset(2, 3, gl.FLOAT, false, 11*4, 6*4)
-
-	// Attribute 3: UV coordinates (2 floats)
-	gl.EnableVertexAttribArray(3)
-	gl.VertexAttribPointerWithOffset(3, 2, gl.FLOAT, false, 11*4, 9*4)
-
-	// Unbind VBO and VAO (good practice to avoid accidental modifications)
-	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
-	gl.BindVertexArray(0)
-}
+	// Create the buffer on first upload
+	if mesh.buffer == (VertexBuffer{}) {
+		mesh.buffer = renderBackend.CreateVertexBuffer(0)
+	}
 
-// BindMesh binds this mesh's VAO for rendering.
-// Must be called before gl.DrawArrays or gl.DrawElements.
-func (mesh *Mesh) BindMesh() {
-	gl.BindVertexArray(mesh.VAO)
+	// Upload vertex data to GPU
+	renderBackend.UploadVertices(mesh.buffer, mesh.arrayData)
 }
 
-// Render draws the mesh using OpenGL's draw arrays command.
-// Assumes the mesh's VAO is properly configured and vertex data is uploaded.
+// Render draws the mesh as triangles.
+// Assumes the vertex data is uploaded (see UpdateVAO).
 // Uses triangle primitive type - vertices should be in groups of 3.
 func (mesh *Mesh) Render() {
-	mesh.BindMesh()
 	// Draw all vertices as triangles (3 vertices per triangle)
-	gl.DrawArrays(gl.TRIANGLES, 0, int32(len(mesh.vertices)))
+	renderBackend.DrawTriangles(mesh.buffer, 0, int32(len(mesh.vertices)))
+}
+
+// RenderInstanced draws the mesh as triangles once per instance of an
+// instance buffer created over the mesh's vertex buffer.
+// instances: Instance buffer holding the per-instance attributes
+// count: Number of instances to draw
+func (mesh *Mesh) RenderInstanced(instances InstanceBuffer, count int) {
+	renderBackend.DrawTrianglesInstanced(instances, 0, int32(len(mesh.vertices)), int32(count))
+}
+
+// RenderLines draws the mesh as line segments, vertices in pairs.
+// Assumes the vertex data is uploaded (see UpdateVAO).
+func (mesh *Mesh) RenderLines() {
+	renderBackend.DrawLines(mesh.buffer, 0, int32(len(mesh.vertices)))
 }
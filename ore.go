@@ -0,0 +1,172 @@
+// Implements ore veins. The ore file (ores.json) lists the ores placed into
+// generated terrain: the ore block, the heights its veins start at, how many
+// blocks a vein has, how many veins start in a chunk and which blocks a vein
+// may replace. The veins starting in a chunk only depend on the world seed and
+// the chunk position, and every chunk cuts the veins of its 26 neighbours to
+// its own blocks as well, so a vein crossing a chunk border ends up the same
+// whatever order the chunks are generated in.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+)
+
+// ORE_FILE is the data file the ore veins are loaded from.
+const ORE_FILE = "ores.json"
+
+// OreDefinition is an ore entry of the ore file.
+type OreDefinition struct {
+	Block         string   `json:"block"`         // Name of the ore block, such as "coal ore"
+	MinHeight     int      `json:"minHeight"`     // Lowest height a vein starts at
+	MaxHeight     int      `json:"maxHeight"`     // Highest height a vein starts at
+	VeinSize      int      `json:"veinSize"`      // Blocks grown per vein, 1 to CHUNK_SIZE
+	VeinsPerChunk float64  `json:"veinsPerChunk"` // Veins started per chunk, a fraction is the chance of one more
+	Replaces      []string `json:"replaces"`      // Names of the host blocks a vein may replace
+}
+
+// OreVein is an ore of the ore file with its block names resolved.
+type OreVein struct {
+	blockID       int          // Ore block placed
+	minHeight     int          // Lowest height a vein starts at
+	maxHeight     int          // Highest height a vein starts at
+	veinSize      int          // Blocks grown per vein
+	veinsPerChunk float64      // Veins started per chunk, a fraction is the chance of one more
+	hosts         map[int]bool // Block IDs a vein may replace
+	salt          uint64       // Position in the ore file, gives every ore its own random stream
+}
+
+// ParseOreFile decodes and checks an ore file.
+// Veins grow at most CHUNK_SIZE blocks, so they never reach past the
+// neighbours of the chunk they start in.
+// content: File content
+func ParseOreFile(content []byte) ([]OreVein, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+
+	definitions := []OreDefinition{}
+	if err := decoder.Decode(&definitions); err != nil {
+		return nil, err
+	}
+
+	ores := make([]OreVein, 0, len(definitions))
+	for i, definition := range definitions {
+		blockID, found := BlockByName(definition.Block)
+		if !found || blockID == BLOCK_AIR {
+			return nil, fmt.Errorf("ore %d: unknown block %q", i, definition.Block)
+		}
+		if definition.MinHeight > definition.MaxHeight {
+			return nil, fmt.Errorf("%s: minHeight %d is above maxHeight %d", definition.Block, definition.MinHeight, definition.MaxHeight)
+		}
+		if definition.VeinSize < 1 || definition.VeinSize > CHUNK_SIZE {
+			return nil, fmt.Errorf("%s: veinSize must be between 1 and %d", definition.Block, CHUNK_SIZE)
+		}
+		if definition.VeinsPerChunk < 0 {
+			return nil, fmt.Errorf("%s: veinsPerChunk must not be negative", definition.Block)
+		}
+		if len(definition.Replaces) == 0 {
+			return nil, fmt.Errorf("%s: replaces lists no blocks", definition.Block)
+		}
+
+		ore := OreVein{
+			blockID:       blockID,
+			minHeight:     definition.MinHeight,
+			maxHeight:     definition.MaxHeight,
+			veinSize:      definition.VeinSize,
+			veinsPerChunk: definition.VeinsPerChunk,
+			hosts:         map[int]bool{},
+			salt:          uint64(i),
+		}
+		for _, name := range definition.Replaces {
+			hostID, found := BlockByName(name)
+			if !found {
+				return nil, fmt.Errorf("%s: unknown host block %q", definition.Block, name)
+			}
+			ore.hosts[hostID] = true
+		}
+		ores = append(ores, ore)
+	}
+	return ores, nil
+}
+
+// LoadOreFile reads and checks an ore file.
+// file: Path of the ore file
+func LoadOreFile(file string) ([]OreVein, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ore file: %v", err)
+	}
+	ores, err := ParseOreFile(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return ores, nil
+}
+
+// GrowVeins calls visit for every block of the veins starting in a chunk,
+// which may lie in the chunk's neighbours. A block can be visited twice.
+// source: Chunk the veins start in
+// seed: World seed
+// visit: Called with the world position of each vein block
+func (ore *OreVein) GrowVeins(source ChunkPos, seed int64, visit func(block BlockPos)) {
+	origin := source.Origin()
+	if origin.y > ore.maxHeight || origin.y+CHUNK_SIZE <= ore.minHeight {
+		return
+	}
+
+	random := rand.New(rand.NewPCG(source.Hash(seed), ore.salt))
+	count := int(ore.veinsPerChunk)
+	if random.Float64() < ore.veinsPerChunk-float64(count) {
+		count++
+	}
+
+	vein := [CHUNK_SIZE]BlockPos{}
+	for range count {
+		start := origin.Add(BlockPos{random.IntN(CHUNK_SIZE), random.IntN(CHUNK_SIZE), random.IntN(CHUNK_SIZE)})
+		if start.y < ore.minHeight || start.y > ore.maxHeight {
+			continue
+		}
+
+		// Grow a blob: every new block is next to a random earlier one
+		vein[0] = start
+		visit(start)
+		for size := 1; size < ore.veinSize; size++ {
+			vein[size] = vein[random.IntN(size)].Add(blockNeighbourOffsets[random.IntN(len(blockNeighbourOffsets))])
+			visit(vein[size])
+		}
+	}
+}
+
+// placeOres replaces host blocks of the chunk with the ores of every vein
+// reaching into it, ore by ore in the order of the ore file.
+func (chunk *Chunk) placeOres() {
+	if chunk.blocks == nil {
+		return
+	}
+
+	for i := range chunk.ores {
+		ore := &chunk.ores[i]
+		place := func(block BlockPos) {
+			// The floor layer stays bedrock
+			if block.Chunk() != chunk.position || block.y <= chunk.floor {
+				return
+			}
+			local := block.Local()
+			if ore.hosts[chunk.Block(local)] {
+				chunk.SetBlock(local, ore.blockID)
+			}
+		}
+
+		for x := -1; x <= 1; x++ {
+			for y := -1; y <= 1; y++ {
+				for z := -1; z <= 1; z++ {
+					ore.GrowVeins(chunk.position.Add(x, y, z), chunk.seed, place)
+				}
+			}
+		}
+	}
+}
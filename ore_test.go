@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// generateOreChunks generates chunks in the given order, concurrently if asked,
+// and returns their ore blocks by world position.
+func generateOreChunks(positions []ChunkPos, ores []OreVein, concurrent bool) map[BlockPos]int {
+	chunks := make([]*Chunk, len(positions))
+	group := sync.WaitGroup{}
+	for i, position := range positions {
+		chunks[i] = &Chunk{position: position, seed: 42, floor: -64, ores: ores}
+		if concurrent {
+			group.Go(chunks[i].generateTerrain)
+		} else {
+			chunks[i].generateTerrain()
+		}
+	}
+	group.Wait()
+
+	oreBlocks := map[BlockPos]int{}
+	for _, chunk := range chunks {
+		for x := range CHUNK_SIZE {
+			for y := range CHUNK_SIZE {
+				for z := range CHUNK_SIZE {
+					local := LocalPos{x, y, z}
+					if blockID := chunk.Block(local); blockID >= BLOCK_COAL_ORE && blockID <= BLOCK_DIAMOND_ORE {
+						oreBlocks[chunk.position.Block(local)] = blockID
+					}
+				}
+			}
+		}
+	}
+	return oreBlocks
+}
+
+// TestOreVeinsIndependentOfOrder generates a 3x3x3 block of chunks in two
+// different orders and checks that every ore block ends up the same.
+func TestOreVeinsIndependentOfOrder(t *testing.T) {
+	ores, err := LoadOreFile(ORE_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	positions := []ChunkPos{}
+	for x := -1; x <= 1; x++ {
+		for y := -1; y <= 1; y++ {
+			for z := -1; z <= 1; z++ {
+				positions = append(positions, ChunkPos{x, y, z})
+			}
+		}
+	}
+	reversed := make([]ChunkPos, len(positions))
+	for i, position := range positions {
+		reversed[len(positions)-1-i] = position
+	}
+
+	first := generateOreChunks(positions, ores, false)
+	second := generateOreChunks(reversed, ores, true)
+	if len(first) == 0 {
+		t.Fatal("no ore generated")
+	}
+	if len(first) != len(second) {
+		t.Errorf("%d ore blocks in the first order, %d in the second", len(first), len(second))
+	}
+	for block, blockID := range first {
+		if second[block] != blockID {
+			t.Errorf("block %v is %d in the first order and %d in the second", block, blockID, second[block])
+		}
+	}
+
+	// A vein cut by a chunk border continues in the neighbour
+	crossing := false
+	for block := range first {
+		for _, neighbour := range block.Neighbours() {
+			if _, found := first[neighbour]; found && neighbour.Chunk() != block.Chunk() {
+				crossing = true
+			}
+		}
+	}
+	if !crossing {
+		t.Errorf("no vein crosses a chunk border")
+	}
+}
+
+// TestParseOreFileErrors checks that invalid ore files are rejected with the reason.
+func TestParseOreFileErrors(t *testing.T) {
+	cases := []struct {
+		content string // Ore file
+		message string // Part of the expected error
+	}{
+		{`[{"block": "ruby ore", "minHeight": 0, "maxHeight": 10, "veinSize": 4, "veinsPerChunk": 1, "replaces": ["stone"]}]`, `unknown block "ruby ore"`},
+		{`[{"block": "air", "minHeight": 0, "maxHeight": 10, "veinSize": 4, "veinsPerChunk": 1, "replaces": ["stone"]}]`, `unknown block "air"`},
+		{`[{"block": "coal ore", "minHeight": 10, "maxHeight": 0, "veinSize": 4, "veinsPerChunk": 1, "replaces": ["stone"]}]`, "minHeight 10 is above maxHeight 0"},
+		{`[{"block": "coal ore", "minHeight": 0, "maxHeight": 10, "veinSize": 17, "veinsPerChunk": 1, "replaces": ["stone"]}]`, "veinSize must be between 1 and 16"},
+		{`[{"block": "coal ore", "minHeight": 0, "maxHeight": 10, "veinSize": 0, "veinsPerChunk": 1, "replaces": ["stone"]}]`, "veinSize must be between 1 and 16"},
+		{`[{"block": "coal ore", "minHeight": 0, "maxHeight": 10, "veinSize": 4, "veinsPerChunk": -1, "replaces": ["stone"]}]`, "veinsPerChunk must not be negative"},
+		{`[{"block": "coal ore", "minHeight": 0, "maxHeight": 10, "veinSize": 4, "veinsPerChunk": 1, "replaces": []}]`, "replaces lists no blocks"},
+		{`[{"block": "coal ore", "minHeight": 0, "maxHeight": 10, "veinSize": 4, "veinsPerChunk": 1, "replaces": ["marble"]}]`, `unknown host block "marble"`},
+		{`[{"block": "coal ore", "minHeight": 0, "maxHeight": 10, "veinSize": 4, "veinsPerChunk": 1, "replaces": ["stone"], "color": "black"}]`, `unknown field "color"`},
+		{`{"block": "coal ore"}`, "cannot unmarshal"},
+	}
+	for _, testCase := range cases {
+		_, err := ParseOreFile([]byte(testCase.content))
+		if err == nil || !strings.Contains(err.Error(), testCase.message) {
+			t.Errorf("%s: error %v, expected %q", testCase.content, err, testCase.message)
+		}
+	}
+
+	ores, err := ParseOreFile([]byte(`[{"block": "iron ore", "minHeight": -64, "maxHeight": 64, "veinSize": 8, "veinsPerChunk": 5, "replaces": ["stone", "dirt"]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ores) != 1 || ores[0].blockID != BLOCK_IRON_ORE || !ores[0].hosts[BLOCK_STONE] || !ores[0].hosts[BLOCK_DIRT] || ores[0].hosts[BLOCK_GRASS] {
+		t.Errorf("parsed %+v", ores)
+	}
+}
@@ -0,0 +1,347 @@
+// Implements a CPU particle system: particles move under gravity and drag,
+// bounce off (or stop at) solid blocks and die after their lifetime. They are
+// drawn in one instanced call as quads facing the camera, textured with a
+// part of a block atlas tile or in a plain color.
+// Emitters spawn particles continuously around a point or the camera; the
+// rain and snow emitters are switched with the "weather" command, and
+// breaking a block scatters debris of its texture.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// Particle constants.
+const (
+	PARTICLE_MAX             = 8192  // Particles alive at once; new ones are dropped beyond it
+	PARTICLE_GRAVITY         = 20.0  // Downward acceleration in blocks per second squared
+	PARTICLE_BOUNCE          = 0.25  // Share of the speed kept when bouncing off a block
+	PARTICLE_GROUND_FRICTION = 0.5   // Share of the horizontal speed kept on every ground contact
+	PARTICLE_SHRINK_TIME     = 0.25  // Seconds over which a particle shrinks away before it dies
+	PARTICLE_INSTANCE_FLOATS = 14    // Floats per instance: position(3), size(3), tile(4), color(4)
+	PARTICLE_DEBRIS_SPLIT    = 4     // Debris pieces per block edge (4×4×4 per broken block)
+	PARTICLE_DEBRIS_TILE     = 0.25  // Share of the atlas tile a debris piece shows
+	WEATHER_RADIUS           = 24.0  // Half size of the area around the camera rain and snow fall in
+	WEATHER_HEIGHT           = 20.0  // Height above the camera rain and snow start at
+	WEATHER_NONE             = "off" // Weather without an emitter
+)
+
+// Particle is one simulated particle.
+type Particle struct {
+	position     mgl64.Vec3 // Centre in world space
+	velocity     mgl32.Vec3 // Blocks per second
+	size         mgl32.Vec2 // Width and height in blocks
+	tile         mgl32.Vec4 // Atlas rectangle (u, v, width, height); zero width draws the plain color
+	color        mgl32.Vec4 // Tint and opacity
+	gravity      float32    // Multiple of PARTICLE_GRAVITY pulling the particle down
+	drag         float32    // Share of the speed lost per second
+	lifetime     float32    // Seconds the particle lives
+	age          float32    // Seconds since the particle was spawned
+	upright      bool       // Keep the quad vertical (rain streaks) instead of facing the camera fully
+	dieOnContact bool       // Remove the particle when it touches a block instead of bouncing
+}
+
+// ParticleEmitter spawns copies of a particle at random points of a box.
+type ParticleEmitter struct {
+	name         string     // Name shown by commands
+	rate         float32    // Particles per second
+	origin       mgl64.Vec3 // Centre of the spawn box in world space
+	followCamera bool       // Move the origin to the camera every frame
+	offset       mgl32.Vec3 // Offset of the spawn box from the origin
+	extent       mgl32.Vec3 // Half size of the spawn box
+	template     Particle   // Particle spawned, moved to a random point of the box
+	jitter       mgl32.Vec3 // Largest random change of the velocity per axis
+	accumulator  float32    // Fractional particles carried over to the next frame
+}
+
+// ParticleSystem simulates and draws all particles.
+type ParticleSystem struct {
+	particles []Particle                  // Living particles
+	emitters  []*ParticleEmitter          // Active emitters
+	weather   string                      // Name of the weather emitter, WEATHER_NONE for none
+	material  *Material                   // "particles" material
+	quad      Mesh                        // Unit quad every particle is an instance of
+	instances InstanceBuffer              // Per-particle attributes, rebuilt every frame
+	data      []float32                   // CPU copy of the instance attributes
+	presets   map[string]*ParticleEmitter // Weather emitters by name
+}
+
+// Initialize creates the quad and the instance buffer.
+// materials: Library holding the "particles" material
+func (system *ParticleSystem) Initialize(materials *MaterialLibrary) {
+	system.material = materials.Material("particles")
+	system.weather = WEATHER_NONE
+	system.data = make([]float32, 0, PARTICLE_MAX*PARTICLE_INSTANCE_FLOATS)
+	system.presets = map[string]*ParticleEmitter{
+		"rain": rainEmitter(),
+		"snow": snowEmitter(),
+	}
+
+	// Corners from -0.5 to 0.5; the tile's v runs downwards like on block faces
+	normal := mgl32.Vec3{0.0, 0.0, 1.0}
+	white := mgl32.Vec3{1.0, 1.0, 1.0}
+	for _, corner := range [6]mgl32.Vec2{{0, 0}, {1, 0}, {1, 1}, {0, 0}, {1, 1}, {0, 1}} {
+		position := mgl32.Vec3{corner[0] - 0.5, corner[1] - 0.5, 0.0}
+		system.quad.AddVertex(position, white, normal, mgl32.Vec2{corner[0], 1.0 - corner[1]})
+	}
+	system.quad.PrepareArrayData()
+	system.quad.UpdateVAO()
+	system.instances = renderBackend.CreateInstanceBuffer(system.quad.buffer, []int{3, 3, 4, 4})
+}
+
+// Spawn adds a particle unless PARTICLE_MAX particles are alive.
+// particle: Particle to add
+func (system *ParticleSystem) Spawn(particle Particle) {
+	if len(system.particles) >= PARTICLE_MAX {
+		return
+	}
+	system.particles = append(system.particles, particle)
+}
+
+// EmitBlockDebris scatters PARTICLE_DEBRIS_SPLIT³ pieces of a block's texture
+// from its cells outwards, as when the block is broken.
+// block: World position of the block
+// blockID: Block type whose side texture the pieces show
+func (system *ParticleSystem) EmitBlockDebris(block BlockPos, blockID int) {
+	data, found := blockData[blockID]
+	if !found {
+		return
+	}
+	tile := data.FaceUV(FACE_SIDE0)
+	origin := block.Vec3()
+	center := mgl32.Vec3{0.5, 0.5, 0.5}
+	pieceUV := float32(BLOCK_DATA_UV_SPACE * PARTICLE_DEBRIS_TILE)
+
+	for i := range PARTICLE_DEBRIS_SPLIT * PARTICLE_DEBRIS_SPLIT * PARTICLE_DEBRIS_SPLIT {
+		cell := mgl32.Vec3{
+			float32(i%PARTICLE_DEBRIS_SPLIT) + 0.5,
+			float32(i/PARTICLE_DEBRIS_SPLIT%PARTICLE_DEBRIS_SPLIT) + 0.5,
+			float32(i/(PARTICLE_DEBRIS_SPLIT*PARTICLE_DEBRIS_SPLIT)) + 0.5,
+		}
+		local := cell.Mul(1.0 / PARTICLE_DEBRIS_SPLIT)
+		velocity := local.Sub(center).Mul(4.0).Add(randomVec3(mgl32.Vec3{1.0, 1.0, 1.0}))
+		velocity[1] += 2.0
+		size := 0.1 + 0.08*rand.Float32()
+
+		system.Spawn(Particle{
+			position: origin.Add(vec3To64(local)),
+			velocity: velocity,
+			size:     mgl32.Vec2{size, size},
+			tile: mgl32.Vec4{
+				(tile[0] + rand.Float32()*(1.0-PARTICLE_DEBRIS_TILE)) * BLOCK_DATA_UV_SPACE,
+				(tile[1] + rand.Float32()*(1.0-PARTICLE_DEBRIS_TILE)) * BLOCK_DATA_UV_SPACE,
+				pieceUV,
+				pieceUV,
+			},
+			color:    mgl32.Vec4{1.0, 1.0, 1.0, 1.0},
+			gravity:  1.0,
+			drag:     0.5,
+			lifetime: 0.8 + 0.8*rand.Float32(),
+		})
+	}
+}
+
+// SetWeather replaces the weather emitter.
+// name: "rain", "snow" or WEATHER_NONE
+func (system *ParticleSystem) SetWeather(name string) error {
+	emitter, found := system.presets[name]
+	if !found && name != WEATHER_NONE {
+		return fmt.Errorf("unknown weather %q", name)
+	}
+	for i, active := range system.emitters {
+		if active.name == system.weather {
+			system.emitters = append(system.emitters[:i], system.emitters[i+1:]...)
+			break
+		}
+	}
+	if found {
+		system.emitters = append(system.emitters, emitter)
+	}
+	system.weather = name
+	return nil
+}
+
+// Update runs the emitters and moves the particles.
+// deltaTime: Seconds since the last frame
+// gameWorld: World the particles collide with
+// cameraPosition: Position the camera-following emitters move to
+func (system *ParticleSystem) Update(deltaTime float64, gameWorld *GameWorld, cameraPosition mgl64.Vec3) {
+	dt := float32(deltaTime)
+	for _, emitter := range system.emitters {
+		if emitter.followCamera {
+			emitter.origin = cameraPosition
+		}
+		emitter.accumulator += emitter.rate * dt
+		for ; emitter.accumulator >= 1.0; emitter.accumulator-- {
+			particle := emitter.template
+			particle.position = emitter.origin.Add(vec3To64(emitter.offset.Add(randomVec3(emitter.extent))))
+			particle.velocity = particle.velocity.Add(randomVec3(emitter.jitter))
+			system.Spawn(particle)
+		}
+	}
+
+	alive := system.particles[:0]
+	for _, particle := range system.particles {
+		if particle.Step(dt, gameWorld) {
+			alive = append(alive, particle)
+		}
+	}
+	system.particles = alive
+}
+
+// Step advances a particle by one frame and reports whether it is still alive.
+// Each axis moves separately, so a particle hitting a wall still falls and
+// one landing on the ground still slides.
+// dt: Seconds since the last frame
+// gameWorld: World the particle collides with
+func (particle *Particle) Step(dt float32, gameWorld *GameWorld) bool {
+	particle.age += dt
+	if particle.age >= particle.lifetime || particle.position[1] < 0.0 {
+		return false
+	}
+
+	particle.velocity[1] -= PARTICLE_GRAVITY * particle.gravity * dt
+	particle.velocity = particle.velocity.Mul(max(1.0-particle.drag*dt, 0.0))
+
+	for axis := range 3 {
+		moved := particle.position
+		moved[axis] += float64(particle.velocity[axis] * dt)
+
+		// Vertically the bottom or top edge touches first, horizontally the centre
+		probe := moved
+		if axis == 1 {
+			probe[1] += math.Copysign(float64(particle.size[1])*0.5, float64(particle.velocity[1]))
+		}
+		if !particleBlocked(gameWorld, probe, particle.dieOnContact) {
+			particle.position = moved
+			continue
+		}
+		if particle.dieOnContact {
+			return false
+		}
+		particle.velocity[axis] *= -PARTICLE_BOUNCE
+		if axis == 1 {
+			particle.velocity[0] *= PARTICLE_GROUND_FRICTION
+			particle.velocity[2] *= PARTICLE_GROUND_FRICTION
+		}
+	}
+	return true
+}
+
+// particleBlocked reports whether a point lies in a solid block. Water stops
+// particles that die on contact (rain on a lake) but not bouncing ones.
+// gameWorld: World to look up
+// point: Point in world space
+// stopInWater: Count water as blocking
+func particleBlocked(gameWorld *GameWorld, point mgl64.Vec3, stopInWater bool) bool {
+	blockID, _ := gameWorld.GetBlock(BlockPosAt(point))
+	return blockID != BLOCK_AIR && (blockID != BLOCK_WATER || stopInWater)
+}
+
+// Render draws all particles with one instanced call. Instance positions are
+// camera-relative like every other vertex.
+// loop: Game loop providing the material setup
+func (system *ParticleSystem) Render(loop *GameLoop) {
+	if len(system.particles) == 0 {
+		return
+	}
+
+	system.data = system.data[:0]
+	for _, particle := range system.particles {
+		// Shrink away at the end of the lifetime instead of popping out
+		scale := min((particle.lifetime-particle.age)/PARTICLE_SHRINK_TIME, 1.0)
+		upright := float32(0.0)
+		if particle.upright {
+			upright = 1.0
+		}
+		position := loop.camera.RelativePosition(particle.position)
+		system.data = append(system.data,
+			position[0], position[1], position[2],
+			particle.size[0]*scale, particle.size[1]*scale, upright,
+			particle.tile[0], particle.tile[1], particle.tile[2], particle.tile[3],
+			particle.color[0], particle.color[1], particle.color[2], particle.color[3],
+		)
+	}
+	renderBackend.UploadInstances(system.instances, system.data)
+
+	loop.UseMaterial(system.material)
+	system.quad.RenderInstanced(system.instances, len(system.particles))
+}
+
+// RegisterCommands adds the "particles" and "weather" commands to a registry.
+func (system *ParticleSystem) RegisterCommands(registry *CommandRegistry) {
+	registry.Register("particles", "particles [clear] - count or remove the particles", func(args []string) (string, error) {
+		switch {
+		case len(args) == 0:
+			return fmt.Sprintf("%d particles, %d emitters, weather %s", len(system.particles), len(system.emitters), system.weather), nil
+		case len(args) == 1 && args[0] == "clear":
+			system.particles = system.particles[:0]
+			return "particles cleared", nil
+		}
+		return "", fmt.Errorf("invalid arguments")
+	})
+	registry.Register("weather", "weather <off|rain|snow> - let rain or snow fall around the camera", func(args []string) (string, error) {
+		if len(args) != 1 {
+			return "", fmt.Errorf("expected off, rain or snow")
+		}
+		if err := system.SetWeather(args[0]); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("weather %s", system.weather), nil
+	})
+}
+
+// rainEmitter creates the rain emitter: thin upright streaks falling fast
+// and vanishing on the first block or water surface they touch.
+func rainEmitter() *ParticleEmitter {
+	return &ParticleEmitter{
+		name:         "rain",
+		rate:         1500.0,
+		followCamera: true,
+		offset:       mgl32.Vec3{0.0, WEATHER_HEIGHT, 0.0},
+		extent:       mgl32.Vec3{WEATHER_RADIUS, 4.0, WEATHER_RADIUS},
+		jitter:       mgl32.Vec3{0.0, 2.0, 0.0},
+		template: Particle{
+			velocity:     mgl32.Vec3{0.0, -18.0, 0.0},
+			size:         mgl32.Vec2{0.03, 0.6},
+			color:        mgl32.Vec4{0.6, 0.65, 0.8, 0.5},
+			lifetime:     3.0,
+			upright:      true,
+			dieOnContact: true,
+		},
+	}
+}
+
+// snowEmitter creates the snow emitter: small flakes drifting slowly down.
+func snowEmitter() *ParticleEmitter {
+	return &ParticleEmitter{
+		name:         "snow",
+		rate:         400.0,
+		followCamera: true,
+		offset:       mgl32.Vec3{0.0, WEATHER_HEIGHT, 0.0},
+		extent:       mgl32.Vec3{WEATHER_RADIUS, 4.0, WEATHER_RADIUS},
+		jitter:       mgl32.Vec3{0.6, 0.4, 0.6},
+		template: Particle{
+			velocity:     mgl32.Vec3{0.0, -2.0, 0.0},
+			size:         mgl32.Vec2{0.08, 0.08},
+			color:        mgl32.Vec4{1.0, 1.0, 1.0, 0.9},
+			lifetime:     14.0,
+			dieOnContact: true,
+		},
+	}
+}
+
+// randomVec3 returns a random vector with each component between -extent and extent.
+func randomVec3(extent mgl32.Vec3) mgl32.Vec3 {
+	return mgl32.Vec3{
+		(rand.Float32()*2.0 - 1.0) * extent[0],
+		(rand.Float32()*2.0 - 1.0) * extent[1],
+		(rand.Float32()*2.0 - 1.0) * extent[2],
+	}
+}
@@ -0,0 +1,305 @@
+// Implements the off-screen scene framebuffer and the post-processing chain.
+// The scene is rendered into an HDR (16-bit float) framebuffer. A chain of small
+// full-screen passes then ping-pongs between two targets, and the last enabled
+// pass writes to the framebuffer that was bound before the scene (the window).
+// Each pass is one fragment shader (post_<name>.glsl_frag) plus float parameters.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Texture units used by the post passes.
+const (
+	POST_SOURCE_TEXTURE_UNIT = 0 // Output of the previous pass (or the scene)
+	POST_DEPTH_TEXTURE_UNIT  = 1 // Scene depth
+)
+
+// RenderTarget is a framebuffer with a color texture and an optional depth texture.
+type RenderTarget struct {
+	framebuffer  uint32 // OpenGL framebuffer ID
+	colorTexture uint32 // RGBA16F color attachment
+	depthTexture uint32 // Depth attachment (0 if the target has none)
+	width        int    // Width in pixels
+	height       int    // Height in pixels
+}
+
+// PostParameter is a named float uniform of a post pass.
+type PostParameter struct {
+	name  string  // Uniform name in the pass shader
+	value float32 // Current value
+}
+
+// PostPass is one full-screen step of the post-processing chain.
+type PostPass struct {
+	name       string          // Name used by commands and for the shader file (post_<name>)
+	shader     Shader          // Pass shader program
+	enabled    bool            // Toggled by the user
+	active     bool            // Set by the game each frame for passes that depend on the situation
+	parameters []PostParameter // Float uniforms uploaded before the pass runs
+}
+
+// PostChain renders the scene off-screen and applies the post passes.
+type PostChain struct {
+	enabled           bool            // Render through the chain at all (off renders straight to the window)
+	scene             RenderTarget    // HDR scene color and depth
+	pingPong          [2]RenderTarget // Intermediate targets alternated between passes
+	passes            []*PostPass     // Passes in the order they run
+	copyShader        Shader          // Copies the scene when every pass is disabled
+	mesh              Mesh            // Full-screen triangle
+	outputFramebuffer uint32          // Framebuffer bound before the scene, receives the final image
+	rendering         bool            // Set between Begin and End while the scene target is bound
+}
+
+// Create allocates the framebuffer and its attachments.
+// width, height: Size in pixels
+// withDepth: Also attach a depth texture
+func (target *RenderTarget) Create(width, height int, withDepth bool) {
+	target.width = width
+	target.height = height
+
+	// Linear filtering so passes such as FXAA can sample between pixels
+	target.colorTexture = renderBackend.CreateTexture(TextureDescription{
+		target: gl.TEXTURE_2D, width: width, height: height, format: TEXTURE_FORMAT_RGBA16F, linear: true,
+	})
+
+	// A depth texture rather than a renderbuffer, passes may read it
+	if withDepth {
+		target.depthTexture = renderBackend.CreateTexture(TextureDescription{
+			target: gl.TEXTURE_2D, width: width, height: height, format: TEXTURE_FORMAT_DEPTH24,
+		})
+	}
+
+	framebuffer, err := renderBackend.CreateFramebuffer(target.colorTexture, target.depthTexture)
+	if err != nil {
+		panic(fmt.Errorf("render target: %v", err))
+	}
+	target.framebuffer = framebuffer
+}
+
+// Delete releases the framebuffer and its attachments.
+func (target *RenderTarget) Delete() {
+	if target.framebuffer == 0 {
+		return
+	}
+	renderBackend.DeleteFramebuffer(target.framebuffer)
+	glState.DeleteTexture(target.colorTexture)
+	if target.depthTexture != 0 {
+		glState.DeleteTexture(target.depthTexture)
+	}
+	*target = RenderTarget{}
+}
+
+// Initialize loads the pass shaders with their default parameters.
+// Render targets are created on the first Begin, once the window size is known.
+func (chain *PostChain) Initialize() {
+	chain.enabled = true
+	chain.mesh = GetFullscreenTriangleMesh()
+	chain.copyShader.LoadFiles("post", "post_copy")
+
+	chain.AddPass("underwater", true, []PostParameter{
+		{"tintR", 0.2}, {"tintG", 0.45}, {"tintB", 0.7}, // Color multiplied into the scene
+		{"density", 0.06}, // How quickly the view fades into the tint with distance
+	})
+	// Tonemapping and gamma are off by default: the block textures and lighting
+	// are authored for display directly, so they only pay off with brighter lights
+	chain.AddPass("tonemap", false, []PostParameter{
+		{"exposure", 1.0}, // Scene brightness multiplier before the curve
+		{"operator", 2.0}, // 0 = clamp, 1 = Reinhard, 2 = ACES filmic
+	})
+	chain.AddPass("gamma", false, []PostParameter{
+		{"gamma", 2.2}, // Display gamma
+	})
+	chain.AddPass("fxaa", true, []PostParameter{
+		{"spanMax", 8.0},           // Longest blur span in pixels
+		{"reduceMul", 1.0 / 8.0},   // Blur span reduction proportional to local luma
+		{"reduceMin", 1.0 / 128.0}, // Minimum blur span reduction
+	})
+	chain.AddPass("vignette", true, []PostParameter{
+		{"strength", 0.25}, // Darkening at the corners (0 = none)
+		{"radius", 0.75},   // Distance from the center where darkening starts
+		{"softness", 0.45}, // Width of the transition
+	})
+
+	// The underwater tint only runs while the camera is in water
+	chain.Pass("underwater").active = false
+}
+
+// AddPass loads a pass shader (post.glsl_vert + post_<name>.glsl_frag) and appends it to the chain.
+// name: Pass name
+// enabled: Whether the pass runs by default
+// parameters: Float uniforms with their default values
+func (chain *PostChain) AddPass(name string, enabled bool, parameters []PostParameter) {
+	pass := &PostPass{name: name, enabled: enabled, active: true, parameters: parameters}
+	pass.shader.LoadFiles("post", "post_"+name)
+	chain.passes = append(chain.passes, pass)
+}
+
+// Pass returns the pass with the given name, or nil if there is none.
+func (chain *PostChain) Pass(name string) *PostPass {
+	for _, pass := range chain.passes {
+		if pass.name == name {
+			return pass
+		}
+	}
+	return nil
+}
+
+// SetParameter changes a parameter of the pass.
+// Returns an error if the pass has no parameter with that name.
+func (pass *PostPass) SetParameter(name string, value float32) error {
+	for i := range pass.parameters {
+		if pass.parameters[i].name == name {
+			pass.parameters[i].value = value
+			return nil
+		}
+	}
+	return fmt.Errorf("pass %q has no parameter %q", pass.name, name)
+}
+
+// Resize recreates the render targets for a new window size.
+// width, height: New size in pixels
+func (chain *PostChain) Resize(width, height int) {
+	chain.scene.Delete()
+	chain.pingPong[0].Delete()
+	chain.pingPong[1].Delete()
+
+	chain.scene.Create(width, height, true)
+	chain.pingPong[0].Create(width, height, false)
+	chain.pingPong[1].Create(width, height, false)
+}
+
+// Begin redirects rendering into the HDR scene target, rebuilding the targets
+// when the window size changed. Does nothing while the chain is disabled.
+// width, height: Current window size in pixels
+func (chain *PostChain) Begin(width, height int) {
+	renderBackend.Viewport(0, 0, width, height)
+	if !chain.enabled || width <= 0 || height <= 0 {
+		return
+	}
+
+	// Remember where the final image has to go
+	chain.outputFramebuffer = renderBackend.DrawFramebuffer()
+
+	if chain.scene.width != width || chain.scene.height != height {
+		chain.Resize(width, height)
+	}
+
+	renderBackend.BindFramebuffer(chain.scene.framebuffer)
+	chain.rendering = true
+}
+
+// End runs the enabled passes over the scene and writes the result to the
+// framebuffer that was bound at Begin.
+// near, far: Camera clip planes, used by passes that read the scene depth
+func (chain *PostChain) End(near, far float32) {
+	if !chain.rendering {
+		return
+	}
+	chain.rendering = false
+
+	passes := []*PostPass{}
+	for _, pass := range chain.passes {
+		if pass.enabled && pass.active {
+			passes = append(passes, pass)
+		}
+	}
+
+	glState.Apply(RENDER_STATE_FULLSCREEN)
+
+	// The scene depth is available to every pass
+	glState.BindTexture(POST_DEPTH_TEXTURE_UNIT, gl.TEXTURE_2D, chain.scene.depthTexture)
+
+	source := chain.scene.colorTexture
+	texelSize := mgl32.Vec2{1.0 / float32(chain.scene.width), 1.0 / float32(chain.scene.height)}
+	if len(passes) == 0 {
+		chain.runPass(&chain.copyShader, nil, source, chain.outputFramebuffer, texelSize, near, far)
+	}
+	for i, pass := range passes {
+		// The last pass writes to the output, the others alternate between the ping-pong targets
+		target := chain.outputFramebuffer
+		if i < len(passes)-1 {
+			target = chain.pingPong[i%2].framebuffer
+		}
+		chain.runPass(&pass.shader, pass.parameters, source, target, texelSize, near, far)
+		source = chain.pingPong[i%2].colorTexture
+	}
+}
+
+// runPass draws the full-screen triangle with a pass shader.
+// shader: Pass shader
+// parameters: Float uniforms to upload
+// source: Color texture the pass reads
+// target: Framebuffer the pass writes to
+// texelSize: Size of one pixel in texture coordinates
+// near, far: Camera clip planes
+func (chain *PostChain) runPass(shader *Shader, parameters []PostParameter, source, target uint32, texelSize mgl32.Vec2, near, far float32) {
+	renderBackend.BindFramebuffer(target)
+
+	glState.BindTexture(POST_SOURCE_TEXTURE_UNIT, gl.TEXTURE_2D, source)
+
+	shader.Use()
+	shader.UniformSetSampler("source", POST_SOURCE_TEXTURE_UNIT)
+	shader.UniformSetSampler("sceneDepth", POST_DEPTH_TEXTURE_UNIT)
+	shader.UniformSetVec2("texelSize", &texelSize)
+	shader.UniformSetFloat("near", near)
+	shader.UniformSetFloat("far", far)
+	for _, parameter := range parameters {
+		shader.UniformSetFloat(parameter.name, parameter.value)
+	}
+
+	chain.mesh.Render()
+}
+
+// RegisterCommands adds the "post" command to a registry.
+func (chain *PostChain) RegisterCommands(registry *CommandRegistry) {
+	registry.Register(
+		"post",
+		"post [on | off | <pass> <on|off> | <pass> <parameter> <value>] - list or configure the post-processing passes",
+		func(args []string) (string, error) {
+			switch {
+			case len(args) == 0:
+			case len(args) == 1 && (args[0] == "on" || args[0] == "off"):
+				chain.enabled = args[0] == "on"
+			case len(args) == 2 && (args[1] == "on" || args[1] == "off"):
+				pass := chain.Pass(args[0])
+				if pass == nil {
+					return "", fmt.Errorf("unknown pass %q", args[0])
+				}
+				pass.enabled = args[1] == "on"
+			case len(args) == 3:
+				pass := chain.Pass(args[0])
+				if pass == nil {
+					return "", fmt.Errorf("unknown pass %q", args[0])
+				}
+				// Values beyond float32 would turn into infinities in the uniform
+				value, err := parseFiniteFloat(args[2])
+				if err != nil || math.Abs(value) > math.MaxFloat32 {
+					return "", fmt.Errorf("invalid value %q", args[2])
+				}
+				if err := pass.SetParameter(args[1], float32(value)); err != nil {
+					return "", err
+				}
+			default:
+				return "", fmt.Errorf("invalid arguments")
+			}
+
+			// List the chain in the order it runs
+			lines := []string{fmt.Sprintf("post processing %v", chain.enabled)}
+			for _, pass := range chain.passes {
+				parameters := make([]string, 0, len(pass.parameters))
+				for _, parameter := range pass.parameters {
+					parameters = append(parameters, fmt.Sprintf("%s=%g", parameter.name, parameter.value))
+				}
+				lines = append(lines, fmt.Sprintf("  %-10s %-3v %s", pass.name, pass.enabled, strings.Join(parameters, " ")))
+			}
+			return strings.Join(lines, "\n"), nil
+		},
+	)
+}
@@ -0,0 +1,372 @@
+// Implements a scoped frame profiler.
+// Three kinds of scopes are measured:
+//   - CPU scopes around the stages of the game loop (main thread only)
+//   - GPU scopes around render passes, timed with timestamp queries that are
+//     read back a few frames later so the CPU never waits for the GPU
+//   - job scopes around background work such as chunk generation and meshing,
+//     which may run on any goroutine and get a lane each while they run
+//
+// The last PROFILER_HISTORY_FRAMES frames are kept for the on-screen graph
+// (see profiler_graph.go) and can be written as a Chrome trace
+// (chrome://tracing or https://ui.perfetto.dev) with the "profile trace" command.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Profiler constants.
+const (
+	PROFILER_HISTORY_FRAMES     = 240             // Frames kept for the graph and the trace
+	PROFILER_MAX_PENDING_GPU    = 256             // GPU scopes waiting for their queries before new ones are skipped
+	PROFILER_STAGE_DEPTH        = 1               // Nesting depth of the stages shown in the graph (0 is the frame)
+	PROFILER_TRACE_DIRECTORY    = "traces"        // Directory "profile trace" writes to by default
+	PROFILER_LANE_MAIN          = 0               // Lane of CPU scopes on the main thread
+	PROFILER_LANE_GPU           = 1               // Lane of GPU scopes
+	PROFILER_LANE_FIRST_JOB     = 2               // First lane of job scopes
+	PROFILER_TRACE_PROCESS_NAME = "voxel terrain" // Process name shown in the trace viewer
+)
+
+// ProfileEvent is one finished measurement.
+type ProfileEvent struct {
+	name     string        // Scope name
+	lane     int           // PROFILER_LANE_* or a job lane
+	depth    int           // Nesting depth on the main thread (0 for GPU and job scopes)
+	frame    uint64        // Frame the scope belongs to
+	start    time.Duration // Start since the profiler epoch
+	duration time.Duration // Length of the scope
+}
+
+// ProfileSample is the time of one stage in a frame.
+type ProfileSample struct {
+	name     string        // Stage name
+	duration time.Duration // Time spent in the stage
+}
+
+// ProfileFrame holds the stage times of one frame for the graph.
+type ProfileFrame struct {
+	number uint64          // Frame number
+	total  time.Duration   // CPU time of the whole frame
+	cpu    []ProfileSample // Top-level CPU stages in order
+	gpu    []ProfileSample // GPU passes in order, filled in when their queries are read back
+}
+
+// ProfileScope is a running measurement, finished with End.
+// The zero value (returned while profiling is off) does nothing.
+type ProfileScope struct {
+	profiler *Profiler     // Profiler the scope reports to (nil if not measured)
+	name     string        // Scope name
+	lane     int           // Lane the scope runs on
+	depth    int           // Nesting depth on the main thread
+	start    time.Duration // Start since the profiler epoch
+	gpuBegin uint32        // Timestamp query at the start (0 if the GPU is not timed)
+}
+
+// pendingGPUScope is a GPU scope whose timestamps have not been read back yet.
+type pendingGPUScope struct {
+	name   string        // Scope name
+	frame  uint64        // Frame the scope belongs to
+	begin  uint32        // Timestamp query at the start
+	end    uint32        // Timestamp query at the end
+	offset time.Duration // CPU time minus GPU time when the frame began
+}
+
+// Profiler collects scope timings. Use the package-level profiler.
+type Profiler struct {
+	enabled    bool                                  // Measure scopes at all
+	mutex      sync.Mutex                            // Guards everything below, job scopes end on any goroutine
+	epoch      time.Time                             // Time all events are relative to
+	frame      uint64                                // Number of the running frame
+	frameStart time.Duration                         // Start of the running frame
+	depth      int                                   // Nesting depth of main-thread scopes
+	gpuOffset  time.Duration                         // CPU time minus GPU time, measured when the frame began
+	events     []ProfileEvent                        // Events of the last PROFILER_HISTORY_FRAMES frames
+	frames     [PROFILER_HISTORY_FRAMES]ProfileFrame // Graph data, indexed by frame number modulo the history size
+	pending    []pendingGPUScope                     // GPU scopes in issue order
+	queries    []uint32                              // Query objects free for reuse
+	jobLanes   []bool                                // Job lanes in use
+}
+
+// profiler is the profiler of the game. It starts enabled.
+var profiler = Profiler{enabled: true, epoch: time.Now()}
+
+// now returns the time since the epoch.
+func (profiler *Profiler) now() time.Duration {
+	return time.Since(profiler.epoch)
+}
+
+// BeginFrame starts a frame: reads back finished GPU scopes and drops events
+// that fell out of the history. Called at the start of every game loop frame.
+func (profiler *Profiler) BeginFrame() {
+	if !profiler.enabled {
+		return
+	}
+	profiler.mutex.Lock()
+	defer profiler.mutex.Unlock()
+
+	profiler.collectGPUScopes()
+	profiler.frameStart = profiler.now()
+	profiler.depth = PROFILER_STAGE_DEPTH
+	profiler.gpuOffset = profiler.frameStart - time.Duration(renderBackend.GPUTimestamp())
+	profiler.frames[profiler.frame%PROFILER_HISTORY_FRAMES] = ProfileFrame{number: profiler.frame}
+
+	oldest := profiler.frame - min(profiler.frame, PROFILER_HISTORY_FRAMES-1)
+	profiler.events = slices.DeleteFunc(profiler.events, func(event ProfileEvent) bool {
+		return event.frame < oldest
+	})
+}
+
+// EndFrame finishes the frame started by BeginFrame.
+func (profiler *Profiler) EndFrame() {
+	if !profiler.enabled {
+		return
+	}
+	profiler.mutex.Lock()
+	defer profiler.mutex.Unlock()
+
+	duration := profiler.now() - profiler.frameStart
+	profiler.events = append(profiler.events, ProfileEvent{"frame", PROFILER_LANE_MAIN, 0, profiler.frame, profiler.frameStart, duration})
+	profiler.frames[profiler.frame%PROFILER_HISTORY_FRAMES].total = duration
+	profiler.depth = 0
+	profiler.frame++
+}
+
+// Begin starts a CPU scope on the main thread. Scopes nest; the outermost
+// scopes of a frame are its stages.
+// name: Scope name
+func (profiler *Profiler) Begin(name string) ProfileScope {
+	if !profiler.enabled {
+		return ProfileScope{}
+	}
+	profiler.mutex.Lock()
+	defer profiler.mutex.Unlock()
+
+	scope := ProfileScope{profiler: profiler, name: name, lane: PROFILER_LANE_MAIN, depth: profiler.depth, start: profiler.now()}
+	profiler.depth++
+	return scope
+}
+
+// BeginPass starts a CPU scope on the main thread that also times the GPU
+// commands issued until End.
+// name: Scope name
+func (profiler *Profiler) BeginPass(name string) ProfileScope {
+	scope := profiler.Begin(name)
+	if scope.profiler == nil {
+		return scope
+	}
+	profiler.mutex.Lock()
+	defer profiler.mutex.Unlock()
+
+	// Skip GPU timing when results stop coming back, rather than piling up queries
+	if len(profiler.pending) < PROFILER_MAX_PENDING_GPU {
+		scope.gpuBegin = profiler.query()
+		renderBackend.QueryTimestamp(scope.gpuBegin)
+	}
+	return scope
+}
+
+// BeginJob starts a scope on any goroutine. Each running job gets the lowest
+// free lane, so concurrent jobs show up side by side in the trace.
+// name: Scope name
+func (profiler *Profiler) BeginJob(name string) ProfileScope {
+	profiler.mutex.Lock()
+	defer profiler.mutex.Unlock()
+	if !profiler.enabled {
+		return ProfileScope{}
+	}
+
+	lane := slices.Index(profiler.jobLanes, false)
+	if lane < 0 {
+		lane = len(profiler.jobLanes)
+		profiler.jobLanes = append(profiler.jobLanes, false)
+	}
+	profiler.jobLanes[lane] = true
+	return ProfileScope{profiler: profiler, name: name, lane: PROFILER_LANE_FIRST_JOB + lane, start: profiler.now()}
+}
+
+// End finishes the scope and records it.
+func (scope ProfileScope) End() {
+	profiler := scope.profiler
+	if profiler == nil {
+		return
+	}
+	profiler.mutex.Lock()
+	defer profiler.mutex.Unlock()
+
+	duration := profiler.now() - scope.start
+	profiler.events = append(profiler.events, ProfileEvent{scope.name, scope.lane, scope.depth, profiler.frame, scope.start, duration})
+
+	switch {
+	case scope.lane >= PROFILER_LANE_FIRST_JOB:
+		profiler.jobLanes[scope.lane-PROFILER_LANE_FIRST_JOB] = false
+		return
+	case scope.depth == PROFILER_STAGE_DEPTH:
+		frame := &profiler.frames[profiler.frame%PROFILER_HISTORY_FRAMES]
+		frame.cpu = append(frame.cpu, ProfileSample{scope.name, duration})
+	}
+	profiler.depth = scope.depth
+
+	if scope.gpuBegin != 0 {
+		end := profiler.query()
+		renderBackend.QueryTimestamp(end)
+		profiler.pending = append(profiler.pending, pendingGPUScope{scope.name, profiler.frame, scope.gpuBegin, end, profiler.gpuOffset})
+	}
+}
+
+// query returns a free query object, creating one if none is left.
+func (profiler *Profiler) query() uint32 {
+	if count := len(profiler.queries); count > 0 {
+		query := profiler.queries[count-1]
+		profiler.queries = profiler.queries[:count-1]
+		return query
+	}
+	return renderBackend.CreateQuery()
+}
+
+// collectGPUScopes records the GPU scopes whose timestamps are available.
+// The GPU finishes commands in order, so collection stops at the first pending one.
+func (profiler *Profiler) collectGPUScopes() {
+	collected := 0
+	for _, scope := range profiler.pending {
+		end, available := renderBackend.QueryResult(scope.end)
+		if !available {
+			break
+		}
+		begin, _ := renderBackend.QueryResult(scope.begin)
+		collected++
+		profiler.queries = append(profiler.queries, scope.begin, scope.end)
+
+		duration := time.Duration(end - min(begin, end))
+		profiler.events = append(profiler.events, ProfileEvent{scope.name, PROFILER_LANE_GPU, 0, scope.frame, scope.offset + time.Duration(begin), duration})
+		if frame := &profiler.frames[scope.frame%PROFILER_HISTORY_FRAMES]; frame.number == scope.frame {
+			frame.gpu = append(frame.gpu, ProfileSample{scope.name, duration})
+		}
+	}
+	profiler.pending = slices.Delete(profiler.pending, 0, collected)
+}
+
+// History returns copies of the finished frames of the history, oldest first.
+func (profiler *Profiler) History() []ProfileFrame {
+	profiler.mutex.Lock()
+	defer profiler.mutex.Unlock()
+
+	history := []ProfileFrame{}
+	for number := profiler.frame - min(profiler.frame, PROFILER_HISTORY_FRAMES-1); number < profiler.frame; number++ {
+		frame := profiler.frames[number%PROFILER_HISTORY_FRAMES]
+		if frame.number != number {
+			continue
+		}
+		frame.cpu = slices.Clone(frame.cpu)
+		frame.gpu = slices.Clone(frame.gpu)
+		history = append(history, frame)
+	}
+	return history
+}
+
+// traceEvent is an event of the Chrome trace event format.
+type traceEvent struct {
+	Name      string         `json:"name"`           // Event name
+	Category  string         `json:"cat,omitempty"`  // "cpu", "gpu" or "job"
+	Phase     string         `json:"ph"`             // "X" for complete events, "M" for metadata
+	Timestamp float64        `json:"ts"`             // Start in microseconds
+	Duration  float64        `json:"dur,omitempty"`  // Length in microseconds
+	Process   int            `json:"pid"`            // Always 1
+	Thread    int            `json:"tid"`            // Lane
+	Args      map[string]any `json:"args,omitempty"` // Frame number or metadata values
+}
+
+// WriteTrace writes the events of the history as a Chrome trace JSON file.
+// file: Output file
+func (profiler *Profiler) WriteTrace(file string) error {
+	profiler.mutex.Lock()
+	events := slices.Clone(profiler.events)
+	lanes := PROFILER_LANE_FIRST_JOB + len(profiler.jobLanes)
+	profiler.mutex.Unlock()
+
+	trace := []traceEvent{
+		{Name: "process_name", Phase: "M", Process: 1, Args: map[string]any{"name": PROFILER_TRACE_PROCESS_NAME}},
+	}
+	for lane := range lanes {
+		name := fmt.Sprintf("job lane %d", lane-PROFILER_LANE_FIRST_JOB+1)
+		switch lane {
+		case PROFILER_LANE_MAIN:
+			name = "main thread"
+		case PROFILER_LANE_GPU:
+			name = "GPU"
+		}
+		trace = append(trace, traceEvent{Name: "thread_name", Phase: "M", Process: 1, Thread: lane, Args: map[string]any{"name": name}})
+	}
+
+	slices.SortStableFunc(events, func(a, b ProfileEvent) int {
+		return int(a.start - b.start)
+	})
+	for _, event := range events {
+		category := "cpu"
+		if event.lane == PROFILER_LANE_GPU {
+			category = "gpu"
+		} else if event.lane >= PROFILER_LANE_FIRST_JOB {
+			category = "job"
+		}
+		trace = append(trace, traceEvent{
+			Name:      event.name,
+			Category:  category,
+			Phase:     "X",
+			Timestamp: float64(event.start.Nanoseconds()) / 1000.0,
+			Duration:  float64(event.duration.Nanoseconds()) / 1000.0,
+			Process:   1,
+			Thread:    event.lane,
+			Args:      map[string]any{"frame": event.frame},
+		})
+	}
+
+	data, err := json.Marshal(map[string]any{"traceEvents": trace, "displayTimeUnit": "ms"})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+// RegisterCommands adds the "profile" command to a registry.
+func (profiler *Profiler) RegisterCommands(registry *CommandRegistry, graph *ProfilerGraph) {
+	registry.Register(
+		"profile",
+		"profile <on | off | graph <on|off> | trace [file]> - frame profiler, F8 shows the graph",
+		func(args []string) (string, error) {
+			switch {
+			case len(args) == 1 && (args[0] == "on" || args[0] == "off"):
+				profiler.mutex.Lock()
+				profiler.enabled = args[0] == "on"
+				profiler.mutex.Unlock()
+				return fmt.Sprintf("profiler %v", profiler.enabled), nil
+			case len(args) == 2 && args[0] == "graph" && (args[1] == "on" || args[1] == "off"):
+				graph.visible = args[1] == "on"
+				return fmt.Sprintf("profile graph %v", graph.visible), nil
+			case len(args) >= 1 && args[0] == "trace" && len(args) <= 2:
+				file := ""
+				if len(args) == 2 {
+					file = args[1]
+				} else {
+					var err error
+					if file, err = timestampedFile(PROFILER_TRACE_DIRECTORY, ".json", time.Now()); err != nil {
+						return "", err
+					}
+				}
+				if !strings.HasSuffix(file, ".json") {
+					file += ".json"
+				}
+				if err := profiler.WriteTrace(file); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("trace of the last %d frames written to %s", PROFILER_HISTORY_FRAMES, file), nil
+			}
+			return "", fmt.Errorf("invalid arguments")
+		},
+	)
+}
@@ -0,0 +1,184 @@
+// Implements the on-screen graph of the frame profiler: one bar per frame of
+// the profiler history, stacked from the stage times, for the CPU on the left
+// and the GPU on the right, with a table of average stage times above.
+// F8 or "profile graph on" shows it.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Profiler graph constants.
+const (
+	PROFILER_GRAPH_HEIGHT = 100     // Height of a graph in pixels (before scaling)
+	PROFILER_GRAPH_TOP_MS = 33.3    // Frame time at the top of the graph in milliseconds (30 fps)
+	PROFILER_GRAPH_MARGIN = 4       // Distance from the window edges and between the parts in pixels (before scaling)
+	PROFILER_GRAPH_OTHER  = "other" // Name of the CPU time outside any stage
+)
+
+// Colors of the profiler graph.
+var (
+	PROFILER_GRAPH_BACKGROUND  = mgl32.Vec3{0.05, 0.05, 0.05} // Behind the bars
+	PROFILER_GRAPH_LINE_COLOR  = mgl32.Vec3{0.5, 0.5, 0.5}    // Line at 16.7 ms (60 fps)
+	PROFILER_GRAPH_OTHER_COLOR = mgl32.Vec3{0.35, 0.35, 0.35} // CPU time outside any stage
+	PROFILER_GRAPH_TEXT_COLOR  = mgl32.Vec3{1.0, 1.0, 1.0}    // Table header
+)
+
+// PROFILER_GRAPH_COLORS colors the stages in order of their first appearance.
+var PROFILER_GRAPH_COLORS = []mgl32.Vec3{
+	{0.90, 0.30, 0.25},
+	{0.95, 0.65, 0.20},
+	{0.95, 0.90, 0.30},
+	{0.40, 0.80, 0.30},
+	{0.30, 0.75, 0.85},
+	{0.35, 0.45, 0.95},
+	{0.70, 0.40, 0.90},
+	{0.90, 0.45, 0.70},
+}
+
+// ProfilerGraph draws the history of the profiler.
+type ProfilerGraph struct {
+	visible  bool         // Draw the graph
+	material *Material    // "screen" material for the bars
+	bars     Mesh         // Bars, rebuilt every frame
+	text     TextRenderer // Table of stage times
+	stages   []string     // Stage names in order of first appearance, which picks their colors
+}
+
+// Initialize looks up the materials. The graph starts hidden.
+// materials: Library holding the "screen" and "text" materials
+func (graph *ProfilerGraph) Initialize(materials *MaterialLibrary) {
+	graph.material = materials.Material("screen")
+	graph.text.Initialize(materials)
+}
+
+// color returns the color of a stage.
+// name: Stage name
+func (graph *ProfilerGraph) color(name string) mgl32.Vec3 {
+	if name == PROFILER_GRAPH_OTHER {
+		return PROFILER_GRAPH_OTHER_COLOR
+	}
+	for i, stage := range graph.stages {
+		if stage == name {
+			return PROFILER_GRAPH_COLORS[i%len(PROFILER_GRAPH_COLORS)]
+		}
+	}
+	graph.stages = append(graph.stages, name)
+	return PROFILER_GRAPH_COLORS[(len(graph.stages)-1)%len(PROFILER_GRAPH_COLORS)]
+}
+
+// Render draws the graph in the bottom left corner of the current framebuffer.
+// loop: Game loop providing the material setup and window size
+func (graph *ProfilerGraph) Render(loop *GameLoop) {
+	if !graph.visible {
+		return
+	}
+	history := profiler.History()
+	width, height := loop.window.width, loop.window.height
+	scale := max(1, height/HUD_SCALE_HEIGHT)
+	graphWidth := PROFILER_HISTORY_FRAMES * scale
+	graphHeight := PROFILER_GRAPH_HEIGHT * scale
+	margin := PROFILER_GRAPH_MARGIN * scale
+	bottom := height - margin
+	top := bottom - graphHeight
+	cpuLeft := margin
+	gpuLeft := cpuLeft + graphWidth + margin
+
+	graph.bars.vertices = graph.bars.vertices[:0]
+	rect := func(x0, y0, x1, y1 int, color mgl32.Vec3) {
+		addScreenRect(&graph.bars, x0, y0, x1, y1, width, height, color)
+	}
+	pixels := func(duration time.Duration) int {
+		return int(duration.Seconds() * 1000.0 / PROFILER_GRAPH_TOP_MS * float64(graphHeight))
+	}
+	stack := func(x int, samples []ProfileSample) {
+		y := bottom
+		for _, sample := range samples {
+			color := graph.color(sample.name) // Even if clipped, so the table lists every stage
+			next := max(y-pixels(sample.duration), top)
+			if next < y {
+				rect(x, next, x+scale, y, color)
+			}
+			y = next
+		}
+	}
+
+	rect(cpuLeft, top, cpuLeft+graphWidth, bottom, PROFILER_GRAPH_BACKGROUND)
+	rect(gpuLeft, top, gpuLeft+graphWidth, bottom, PROFILER_GRAPH_BACKGROUND)
+
+	// The newest frame is on the right, the time outside stages on top of the CPU bars
+	cpuTotals := map[string]time.Duration{}
+	gpuTotals := map[string]time.Duration{}
+	var cpuSum, gpuSum, cpuWorst, gpuWorst time.Duration
+	for i, frame := range history {
+		column := (PROFILER_HISTORY_FRAMES - len(history) + i) * scale
+		staged := time.Duration(0)
+		for _, sample := range frame.cpu {
+			staged += sample.duration
+			cpuTotals[sample.name] += sample.duration
+		}
+		other := ProfileSample{PROFILER_GRAPH_OTHER, max(frame.total-staged, 0)}
+		stack(cpuLeft+column, append(frame.cpu, other))
+		stack(gpuLeft+column, frame.gpu)
+
+		gpuFrame := time.Duration(0)
+		for _, sample := range frame.gpu {
+			gpuFrame += sample.duration
+			gpuTotals[sample.name] += sample.duration
+		}
+		cpuSum += frame.total
+		gpuSum += gpuFrame
+		cpuWorst = max(cpuWorst, frame.total)
+		gpuWorst = max(gpuWorst, gpuFrame)
+	}
+
+	line := bottom - pixels(time.Second/60)
+	rect(cpuLeft, line, cpuLeft+graphWidth, line+scale, PROFILER_GRAPH_LINE_COLOR)
+	rect(gpuLeft, line, gpuLeft+graphWidth, line+scale, PROFILER_GRAPH_LINE_COLOR)
+
+	graph.bars.PrepareArrayData()
+	graph.bars.UpdateVAO()
+	loop.UseMaterial(graph.material)
+	graph.bars.Render()
+
+	// Table of the average stage times above the graphs
+	frames := max(len(history), 1)
+	milliseconds := func(duration time.Duration) float64 {
+		return duration.Seconds() * 1000.0 / float64(frames)
+	}
+	header := fmt.Sprintf("%-12s %8s %8s   (%d frames, top %.1f ms, line 16.7 ms)", "stage", "cpu ms", "gpu ms", len(history), PROFILER_GRAPH_TOP_MS)
+	rows := []string{}
+	colors := []mgl32.Vec3{}
+	for _, stage := range graph.stages {
+		cpu, gpu := "-", "-"
+		if total, found := cpuTotals[stage]; found {
+			cpu = fmt.Sprintf("%.2f", milliseconds(total))
+		}
+		if total, found := gpuTotals[stage]; found {
+			gpu = fmt.Sprintf("%.2f", milliseconds(total))
+		}
+		rows = append(rows, fmt.Sprintf("%-12s %8s %8s", stage, cpu, gpu))
+		colors = append(colors, graph.color(stage))
+	}
+	rows = append(rows, fmt.Sprintf("%-12s %8.2f %8.2f", "frame", milliseconds(cpuSum), milliseconds(gpuSum)))
+	rows = append(rows, fmt.Sprintf("%-12s %8.2f %8.2f", "worst", cpuWorst.Seconds()*1000.0, gpuWorst.Seconds()*1000.0))
+	colors = append(colors, PROFILER_GRAPH_TEXT_COLOR, PROFILER_GRAPH_TEXT_COLOR)
+
+	text := &graph.text
+	text.scale = float32(scale)
+	text.Clear()
+	tableWidth, _ := text.Measure(header)
+	lineHeight := text.LineHeight()
+	y := float32(top-margin) - float32(len(rows)+1)*lineHeight
+	x := float32(cpuLeft)
+	text.AddBackground(x, y-float32(margin), tableWidth+2.0*float32(margin), float32(len(rows)+1)*lineHeight+float32(margin), HUD_BACKGROUND_COLOR)
+	text.AddText(header, x+float32(margin), y, PROFILER_GRAPH_TEXT_COLOR)
+	for i, row := range rows {
+		text.AddText(row, x+float32(margin), y+float32(i+1)*lineHeight, colors[i])
+	}
+	text.Render(loop, width, height)
+}
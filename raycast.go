@@ -0,0 +1,82 @@
+// Implements block picking: a ray walks the block grid cell by cell
+// (Amanatides & Woo, "A Fast Voxel Traversal Algorithm") until it enters a
+// solid block. Air and water are passed through, so the camera can target the
+// ground below a lake.
+
+package main
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// RaycastHit describes the block a ray stopped at.
+type RaycastHit struct {
+	block    BlockPos // World position of the hit block
+	normal   [3]int   // Normal of the face the ray entered through (zero if it started inside the block)
+	blockID  int      // Type of the hit block
+	distance float32  // Distance from the ray origin to the entry point in blocks
+}
+
+// Raycast finds the first solid block along a ray.
+// Returns false if the ray leaves the loaded world or gets longer than maxDistance.
+// origin: Start of the ray in world space
+// direction: Direction of the ray, normalized
+// maxDistance: Longest distance searched in blocks
+func (gameWorld *GameWorld) Raycast(origin mgl64.Vec3, direction mgl32.Vec3, maxDistance float32) (RaycastHit, bool) {
+	block := [3]int{}
+	step := [3]int{}
+	boundary := [3]float64{} // Ray distance to the next cell boundary on each axis
+	delta := [3]float64{}    // Ray distance between two cell boundaries on each axis
+	for axis := range 3 {
+		start := origin[axis]
+		component := float64(direction[axis])
+		block[axis] = int(math.Floor(start))
+		switch {
+		case component > 0.0:
+			step[axis] = 1
+			delta[axis] = 1.0 / component
+			boundary[axis] = (float64(block[axis]+1) - start) / component
+		case component < 0.0:
+			step[axis] = -1
+			delta[axis] = -1.0 / component
+			boundary[axis] = (start - float64(block[axis])) / -component
+		default:
+			delta[axis] = math.Inf(1)
+			boundary[axis] = math.Inf(1)
+		}
+	}
+
+	normal := [3]int{}
+	distance := 0.0
+	for distance <= float64(maxDistance) {
+		// Above and below the world is air, unloaded chunks end the search
+		cell := BlockPos{block[0], block[1], block[2]}
+		if gameWorld.InBuildLimits(cell) {
+			blockID, loaded := gameWorld.GetBlock(cell)
+			if !loaded {
+				return RaycastHit{}, false
+			}
+			if blockID != BLOCK_AIR && blockID != BLOCK_WATER {
+				return RaycastHit{cell, normal, blockID, float32(distance)}, true
+			}
+		}
+
+		// Cross the nearest cell boundary
+		axis := 0
+		if boundary[1] < boundary[axis] {
+			axis = 1
+		}
+		if boundary[2] < boundary[axis] {
+			axis = 2
+		}
+		distance = boundary[axis]
+		block[axis] += step[axis]
+		boundary[axis] += delta[axis]
+		normal = [3]int{}
+		normal[axis] = -step[axis]
+	}
+	return RaycastHit{}, false
+}
@@ -0,0 +1,176 @@
+// Defines the interface between the engine and the graphics API.
+// Everything that talks to the GPU (meshes, the chunk buffer arena, shaders,
+// textures, render targets and the state cache) goes through renderBackend, so
+// swapping in the RecordingBackend runs the same code without an OpenGL context.
+// Enum values (texture targets, depth functions, clear masks, uniform types)
+// are the OpenGL constants; they are plain numbers and need no context.
+
+package main
+
+import (
+	"image"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// TextureFormat is the storage format of a texture.
+type TextureFormat int
+
+// Texture formats.
+const (
+	TEXTURE_FORMAT_RGBA8   TextureFormat = iota // 8-bit color, e.g. images loaded from disk
+	TEXTURE_FORMAT_RGBA16F                      // Half-float HDR color
+	TEXTURE_FORMAT_DEPTH24                      // 24-bit depth
+)
+
+// TextureDescription describes a texture to create.
+type TextureDescription struct {
+	target  uint32        // gl.TEXTURE_2D or gl.TEXTURE_2D_ARRAY
+	width   int           // Width in texels
+	height  int           // Height in texels
+	layers  int           // Number of layers of an array texture
+	format  TextureFormat // Storage format
+	linear  bool          // Linear instead of nearest filtering
+	compare bool          // Depth comparison for shadow samplers (depth formats only)
+	pixels  []uint8       // Initial RGBA8 texels, nil leaves the texture uninitialized
+}
+
+// VertexBuffer is a buffer of interleaved mesh vertices (see MeshVertex) that
+// is ready to be drawn. In OpenGL it is a vertex buffer and its vertex array object.
+type VertexBuffer struct {
+	array  uint32 // Vertex array object
+	buffer uint32 // Buffer object holding the vertices
+}
+
+// INSTANCE_ATTRIBUTE_FIRST is the attribute location of the first instance
+// attribute; locations below it hold the mesh vertex attributes.
+const INSTANCE_ATTRIBUTE_FIRST = 4
+
+// InstanceBuffer is a buffer of per-instance attributes drawn together with
+// the vertices of a VertexBuffer. In OpenGL it is a buffer object and a vertex
+// array object reading the vertices from one buffer and the instances from the other.
+type InstanceBuffer struct {
+	array  uint32 // Vertex array object
+	buffer uint32 // Buffer object holding the instance attributes
+	floats int    // Floats per instance
+}
+
+// RenderBackend is the set of GPU operations the engine uses.
+// All methods must be called from the thread that owns the context.
+type RenderBackend interface {
+	// Init loads the API and reports its version.
+	Init() (string, error)
+
+	// CreateVertexBuffer allocates an uninitialized buffer for a number of vertices.
+	CreateVertexBuffer(vertices int) VertexBuffer
+	// UploadVertices replaces the contents and size of a buffer.
+	UploadVertices(buffer VertexBuffer, data []float32)
+	// WriteVertices overwrites part of a buffer starting at a vertex.
+	WriteVertices(buffer VertexBuffer, firstVertex int, data []float32)
+	// CopyVertices copies ranges of vertices between two buffers.
+	CopyVertices(source, destination VertexBuffer, moves []ArenaMove)
+	// DeleteVertexBuffer releases a buffer.
+	DeleteVertexBuffer(buffer VertexBuffer)
+	// DrawTriangles draws a range of vertices as triangles.
+	DrawTriangles(buffer VertexBuffer, first, count int32)
+	// MultiDrawTriangles draws several ranges of vertices as triangles in one call.
+	MultiDrawTriangles(buffer VertexBuffer, firsts, counts []int32)
+	// DrawLines draws a range of vertices as separate line segments (two vertices each).
+	DrawLines(buffer VertexBuffer, first, count int32)
+
+	// CreateInstanceBuffer creates an empty instance buffer drawn over the
+	// vertices of a vertex buffer. The instance attributes are tightly packed
+	// floats and bound from INSTANCE_ATTRIBUTE_FIRST on, one location each.
+	// attributes: Number of components of each instance attribute (1-4)
+	CreateInstanceBuffer(vertices VertexBuffer, attributes []int) InstanceBuffer
+	// UploadInstances replaces the contents and size of an instance buffer.
+	UploadInstances(buffer InstanceBuffer, data []float32)
+	// DeleteInstanceBuffer releases an instance buffer (not the vertex buffer it draws).
+	DeleteInstanceBuffer(buffer InstanceBuffer)
+	// DrawTrianglesInstanced draws a range of vertices as triangles once per instance.
+	DrawTrianglesInstanced(buffer InstanceBuffer, first, count, instances int32)
+
+	// CompileProgram compiles and links a vertex and a fragment shader.
+	// Compilation failures are returned as *ShaderCompileError.
+	CompileProgram(vertexSource, fragmentSource string) (uint32, error)
+	// DeleteProgram releases a program.
+	DeleteProgram(program uint32)
+	// UseProgram makes a program current.
+	UseProgram(program uint32)
+	// ProgramUniforms lists the active uniforms of a program, outside uniform blocks.
+	ProgramUniforms(program uint32) map[string]*ShaderUniform
+	// BindUniformBlock connects a uniform block of a program to a binding point,
+	// if the program declares it.
+	BindUniformBlock(program uint32, name string, binding uint32)
+	// SetUniformInt sets an int, bool or sampler uniform of the current program.
+	SetUniformInt(location int32, value int32)
+	// SetUniformFloat sets a float uniform of the current program.
+	SetUniformFloat(location int32, value float32)
+	// SetUniformFloats sets count elements of a float, vector or matrix uniform.
+	SetUniformFloats(location int32, glType uint32, count int32, values []float32)
+
+	// CreateUniformBuffer allocates a uniform buffer bound to a binding point.
+	CreateUniformBuffer(binding uint32, floats int) uint32
+	// WriteUniformBuffer uploads new contents to a uniform buffer.
+	WriteUniformBuffer(buffer uint32, data []float32)
+
+	// CreateTexture allocates a texture. Texture bindings are left unchanged.
+	CreateTexture(description TextureDescription) uint32
+	// WriteTexture replaces a rectangle of an RGBA8 2D texture. Texture bindings are left unchanged.
+	// pixels: Tightly packed RGBA rows of the rectangle
+	WriteTexture(texture uint32, x, y, width, height int, pixels []uint8)
+	// DeleteTexture releases a texture.
+	DeleteTexture(texture uint32)
+	// ActiveTexture selects the texture unit BindTexture binds to.
+	ActiveTexture(unit uint32)
+	// BindTexture binds a texture to the active texture unit.
+	BindTexture(target, texture uint32)
+
+	// CreateFramebuffer creates a framebuffer rendering into textures (0 for none).
+	// A framebuffer without a color texture draws depth only.
+	CreateFramebuffer(color, depth uint32) (uint32, error)
+	// AttachDepthLayer renders the depth of a framebuffer into one layer of an array texture.
+	AttachDepthLayer(framebuffer, texture uint32, layer int)
+	// DeleteFramebuffer releases a framebuffer (not its textures).
+	DeleteFramebuffer(framebuffer uint32)
+	// BindFramebuffer directs drawing into a framebuffer (0 is the window).
+	BindFramebuffer(framebuffer uint32)
+	// DrawFramebuffer returns the framebuffer drawing currently goes to.
+	DrawFramebuffer() uint32
+	// Viewport sets the area of the framebuffer drawn into.
+	Viewport(x, y, width, height int)
+	// Clear fills the color and/or depth buffer (gl.COLOR_BUFFER_BIT, gl.DEPTH_BUFFER_BIT).
+	Clear(mask uint32, color mgl32.Vec4)
+	// ReadPixels reads the color of a framebuffer (0 is the window) back as
+	// an 8-bit image, top row first.
+	ReadPixels(framebuffer uint32, width, height int) *image.RGBA
+
+	// CreateQuery creates a query object for GPU timestamps.
+	CreateQuery() uint32
+	// QueryTimestamp stores the GPU time in a query once all previous commands have completed.
+	QueryTimestamp(query uint32)
+	// QueryResult returns the GPU time stored in a query (nanoseconds) and
+	// whether it is available yet, without waiting for the GPU.
+	QueryResult(query uint32) (uint64, bool)
+	// GPUTimestamp returns the current GPU time (nanoseconds) on the clock queries use.
+	GPUTimestamp() uint64
+
+	// SetCapability enables or disables a capability such as gl.DEPTH_TEST.
+	SetCapability(capability uint32, enabled bool)
+	// DepthFunc sets the depth comparison.
+	DepthFunc(function uint32)
+	// DepthMask enables or disables depth writes.
+	DepthMask(write bool)
+	// BlendFunc sets the blend factors.
+	BlendFunc(source, destination uint32)
+	// CullFace selects the faces removed by culling.
+	CullFace(face uint32)
+	// PolygonMode switches between filled polygons and outlines.
+	PolygonMode(wireframe bool)
+	// PolygonOffset sets the depth offset of polygons (gl.POLYGON_OFFSET_FILL).
+	PolygonOffset(factor, units float32)
+}
+
+// renderBackend executes all GPU work. Replace it before anything is
+// initialized to run without OpenGL.
+var renderBackend RenderBackend = &GLBackend{}
@@ -0,0 +1,603 @@
+// Implements the render backend with OpenGL 3.3 core.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"unsafe"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// GLBackend renders with the OpenGL context current on the calling thread.
+type GLBackend struct{}
+
+// glTextureFormats maps texture formats to (internal format, format, type).
+var glTextureFormats = map[TextureFormat][3]uint32{
+	TEXTURE_FORMAT_RGBA8:   {gl.RGBA, gl.RGBA, gl.UNSIGNED_BYTE},
+	TEXTURE_FORMAT_RGBA16F: {gl.RGBA16F, gl.RGBA, gl.FLOAT},
+	TEXTURE_FORMAT_DEPTH24: {gl.DEPTH_COMPONENT24, gl.DEPTH_COMPONENT, gl.FLOAT},
+}
+
+// glTextureBindingQueries maps texture targets to the query of their current binding.
+var glTextureBindingQueries = map[uint32]uint32{
+	gl.TEXTURE_2D:       gl.TEXTURE_BINDING_2D,
+	gl.TEXTURE_2D_ARRAY: gl.TEXTURE_BINDING_2D_ARRAY,
+}
+
+// Init loads the OpenGL function pointers of the current context.
+func (backend *GLBackend) Init() (string, error) {
+	if err := gl.Init(); err != nil {
+		return "", err
+	}
+	return gl.GoStr(gl.GetString(gl.VERSION)), nil
+}
+
+// CreateVertexBuffer allocates a vertex buffer and a vertex array object
+// describing the mesh vertex layout.
+func (backend *GLBackend) CreateVertexBuffer(vertices int) VertexBuffer {
+	buffer := VertexBuffer{}
+	gl.GenVertexArrays(1, &buffer.array)
+	gl.GenBuffers(1, &buffer.buffer)
+
+	gl.BindVertexArray(buffer.array)
+	gl.BindBuffer(gl.ARRAY_BUFFER, buffer.buffer)
+	gl.BufferData(gl.ARRAY_BUFFER, vertices*MESH_VERTEX_FLOATS*4, nil, gl.STATIC_DRAW)
+	configureMeshVertexAttributes()
+
+	// Unbind VBO and VAO (good practice to avoid accidental modifications)
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	gl.BindVertexArray(0)
+	return buffer
+}
+
+// configureMeshVertexAttributes tells OpenGL how to interpret interleaved mesh vertices
+// in the buffer bound to GL_ARRAY_BUFFER. The target VAO must be bound.
+func configureMeshVertexAttributes() {
+	stride := int32(MESH_VERTEX_FLOATS * 4)
+
+	// Attribute 0: Position (3 floats)
+	gl.EnableVertexAttribArray(0)
+	gl.VertexAttribPointerWithOffset(0, 3, gl.FLOAT, false, stride, 0)
+
+	// Attribute 1: Color (3 floats)
+	gl.EnableVertexAttribArray(1)
+	gl.VertexAttribPointerWithOffset(1, 3, gl.FLOAT, false, stride, 3*4)
+
+	// Attribute 2: Normal (3 floats)
+	gl.EnableVertexAttribArray(2)
+	gl.VertexAttribPointerWithOffset(2, 3, gl.FLOAT, false, stride, 6*4)
+
+	// Attribute 3: UV coordinates (2 floats)
+	gl.EnableVertexAttribArray(3)
+	gl.VertexAttribPointerWithOffset(3, 2, gl.FLOAT, false, stride, 9*4)
+}
+
+// UploadVertices replaces the contents of a vertex buffer (4 bytes per float32).
+func (backend *GLBackend) UploadVertices(buffer VertexBuffer, data []float32) {
+	gl.BindBuffer(gl.ARRAY_BUFFER, buffer.buffer)
+	if len(data) == 0 {
+		gl.BufferData(gl.ARRAY_BUFFER, 0, nil, gl.STATIC_DRAW)
+	} else {
+		gl.BufferData(gl.ARRAY_BUFFER, len(data)*4, gl.Ptr(data), gl.STATIC_DRAW)
+	}
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+}
+
+// WriteVertices overwrites part of a vertex buffer.
+func (backend *GLBackend) WriteVertices(buffer VertexBuffer, firstVertex int, data []float32) {
+	gl.BindBuffer(gl.ARRAY_BUFFER, buffer.buffer)
+	gl.BufferSubData(gl.ARRAY_BUFFER, firstVertex*MESH_VERTEX_FLOATS*4, len(data)*4, gl.Ptr(data))
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+}
+
+// CopyVertices copies vertex ranges on the GPU without a round trip through memory.
+func (backend *GLBackend) CopyVertices(source, destination VertexBuffer, moves []ArenaMove) {
+	gl.BindBuffer(gl.COPY_READ_BUFFER, source.buffer)
+	gl.BindBuffer(gl.COPY_WRITE_BUFFER, destination.buffer)
+	for _, move := range moves {
+		gl.CopyBufferSubData(
+			gl.COPY_READ_BUFFER, gl.COPY_WRITE_BUFFER,
+			move.from*MESH_VERTEX_FLOATS*4, move.to*MESH_VERTEX_FLOATS*4, move.count*MESH_VERTEX_FLOATS*4,
+		)
+	}
+	gl.BindBuffer(gl.COPY_READ_BUFFER, 0)
+	gl.BindBuffer(gl.COPY_WRITE_BUFFER, 0)
+}
+
+// DeleteVertexBuffer releases the buffer and its vertex array object.
+func (backend *GLBackend) DeleteVertexBuffer(buffer VertexBuffer) {
+	gl.DeleteVertexArrays(1, &buffer.array)
+	gl.DeleteBuffers(1, &buffer.buffer)
+}
+
+// DrawTriangles draws a range of vertices as triangles.
+func (backend *GLBackend) DrawTriangles(buffer VertexBuffer, first, count int32) {
+	gl.BindVertexArray(buffer.array)
+	gl.DrawArrays(gl.TRIANGLES, first, count)
+	gl.BindVertexArray(0)
+}
+
+// MultiDrawTriangles draws all ranges with one glMultiDrawArrays call.
+func (backend *GLBackend) MultiDrawTriangles(buffer VertexBuffer, firsts, counts []int32) {
+	if len(firsts) == 0 {
+		return
+	}
+	gl.BindVertexArray(buffer.array)
+	gl.MultiDrawArrays(gl.TRIANGLES, &firsts[0], &counts[0], int32(len(firsts)))
+	gl.BindVertexArray(0)
+}
+
+// DrawLines draws a range of vertices as line segments.
+func (backend *GLBackend) DrawLines(buffer VertexBuffer, first, count int32) {
+	gl.BindVertexArray(buffer.array)
+	gl.DrawArrays(gl.LINES, first, count)
+	gl.BindVertexArray(0)
+}
+
+// CreateInstanceBuffer creates a vertex array object that reads the mesh
+// vertices from one buffer and advances through a new instance buffer once per instance.
+func (backend *GLBackend) CreateInstanceBuffer(vertices VertexBuffer, attributes []int) InstanceBuffer {
+	buffer := InstanceBuffer{}
+	for _, components := range attributes {
+		buffer.floats += components
+	}
+	gl.GenVertexArrays(1, &buffer.array)
+	gl.GenBuffers(1, &buffer.buffer)
+
+	gl.BindVertexArray(buffer.array)
+	gl.BindBuffer(gl.ARRAY_BUFFER, vertices.buffer)
+	configureMeshVertexAttributes()
+
+	gl.BindBuffer(gl.ARRAY_BUFFER, buffer.buffer)
+	stride := int32(buffer.floats * 4)
+	offset := 0
+	for i, components := range attributes {
+		location := uint32(INSTANCE_ATTRIBUTE_FIRST + i)
+		gl.EnableVertexAttribArray(location)
+		gl.VertexAttribPointerWithOffset(location, int32(components), gl.FLOAT, false, stride, uintptr(offset*4))
+		gl.VertexAttribDivisor(location, 1)
+		offset += components
+	}
+
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	gl.BindVertexArray(0)
+	return buffer
+}
+
+// UploadInstances replaces the contents of an instance buffer. The data
+// changes every frame, so it is uploaded as a stream.
+func (backend *GLBackend) UploadInstances(buffer InstanceBuffer, data []float32) {
+	gl.BindBuffer(gl.ARRAY_BUFFER, buffer.buffer)
+	if len(data) == 0 {
+		gl.BufferData(gl.ARRAY_BUFFER, 0, nil, gl.STREAM_DRAW)
+	} else {
+		gl.BufferData(gl.ARRAY_BUFFER, len(data)*4, gl.Ptr(data), gl.STREAM_DRAW)
+	}
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+}
+
+// DeleteInstanceBuffer releases the vertex array object and the instance buffer.
+func (backend *GLBackend) DeleteInstanceBuffer(buffer InstanceBuffer) {
+	gl.DeleteVertexArrays(1, &buffer.array)
+	gl.DeleteBuffers(1, &buffer.buffer)
+}
+
+// DrawTrianglesInstanced draws a range of vertices once per instance.
+func (backend *GLBackend) DrawTrianglesInstanced(buffer InstanceBuffer, first, count, instances int32) {
+	if instances == 0 {
+		return
+	}
+	gl.BindVertexArray(buffer.array)
+	gl.DrawArraysInstanced(gl.TRIANGLES, first, count, instances)
+	gl.BindVertexArray(0)
+}
+
+// CompileProgram compiles vertex and fragment shader source code and links them into a program.
+func (backend *GLBackend) CompileProgram(vertexSource, fragmentSource string) (uint32, error) {
+	// Compile vertex shader
+	vertexShader, err := compileGLShader(vertexSource, gl.VERTEX_SHADER)
+	if err != nil {
+		return 0, err
+	}
+	defer gl.DeleteShader(vertexShader)
+
+	// Compile fragment shader
+	fragmentShader, err := compileGLShader(fragmentSource, gl.FRAGMENT_SHADER)
+	if err != nil {
+		return 0, err
+	}
+	defer gl.DeleteShader(fragmentShader)
+
+	// Create shader program
+	program := gl.CreateProgram()
+
+	// Attach shaders to program
+	gl.AttachShader(program, vertexShader)
+	gl.AttachShader(program, fragmentShader)
+
+	// Link program (combines shaders into executable)
+	gl.LinkProgram(program)
+
+	// Check linking status
+	var status int32
+	gl.GetProgramiv(program, gl.LINK_STATUS, &status)
+	if status == gl.FALSE {
+		// Get error log
+		var logLength int32
+		gl.GetProgramiv(program, gl.INFO_LOG_LENGTH, &logLength)
+
+		log := strings.Repeat("\x00", int(logLength+1))
+		gl.GetProgramInfoLog(program, logLength, nil, gl.Str(log))
+		gl.DeleteProgram(program)
+
+		return 0, fmt.Errorf("failed to link program: %v", strings.TrimRight(log, "\x00"))
+	}
+
+	// The individual shaders are released by the deferred calls,
+	// they stay alive as long as the program uses them
+	return program, nil
+}
+
+// compileGLShader compiles a single shader from source code.
+// source: GLSL source code for the shader
+// shaderType: Type of shader (gl.VERTEX_SHADER, gl.FRAGMENT_SHADER, etc.)
+// Returns: OpenGL shader ID or a *ShaderCompileError if compilation fails
+func compileGLShader(source string, shaderType uint32) (uint32, error) {
+	// Create shader object
+	shader := gl.CreateShader(shaderType)
+
+	// Upload source code to GPU (glShaderSource reads up to the null terminator)
+	csources, free := gl.Strs(source + "\x00")
+	gl.ShaderSource(shader, 1, csources, nil)
+	free() // Free C strings
+
+	// Compile shader
+	gl.CompileShader(shader)
+
+	// Check compilation status
+	var status int32
+	gl.GetShaderiv(shader, gl.COMPILE_STATUS, &status)
+	if status == gl.FALSE {
+		// Get compilation error log
+		var logLength int32
+		gl.GetShaderiv(shader, gl.INFO_LOG_LENGTH, &logLength)
+
+		log := strings.Repeat("\x00", int(logLength+1))
+		gl.GetShaderInfoLog(shader, logLength, nil, gl.Str(log))
+		gl.DeleteShader(shader)
+
+		return 0, &ShaderCompileError{shaderType, strings.TrimRight(log, "\x00")}
+	}
+
+	return shader, nil
+}
+
+// DeleteProgram releases a program.
+func (backend *GLBackend) DeleteProgram(program uint32) {
+	gl.DeleteProgram(program)
+}
+
+// UseProgram makes a program current.
+func (backend *GLBackend) UseProgram(program uint32) {
+	gl.UseProgram(program)
+}
+
+// ProgramUniforms reflects the active uniforms of a linked program.
+// Uniforms inside uniform blocks have no location and are left out.
+func (backend *GLBackend) ProgramUniforms(program uint32) map[string]*ShaderUniform {
+	var count, maxLength int32
+	gl.GetProgramiv(program, gl.ACTIVE_UNIFORMS, &count)
+	gl.GetProgramiv(program, gl.ACTIVE_UNIFORM_MAX_LENGTH, &maxLength)
+
+	uniforms := make(map[string]*ShaderUniform, count)
+	nameBuffer := make([]uint8, maxLength+1)
+	for index := range uint32(count) {
+		var length, size int32
+		var glType uint32
+		gl.GetActiveUniform(program, index, maxLength+1, &length, &size, &glType, &nameBuffer[0])
+		name := string(nameBuffer[:length])
+
+		location := gl.GetUniformLocation(program, GLString(name))
+		if location < 0 {
+			continue
+		}
+
+		// Arrays are reported as "name[0]", setters use the plain name
+		name = strings.TrimSuffix(name, "[0]")
+		uniforms[name] = &ShaderUniform{name, glType, size, location, false}
+	}
+	return uniforms
+}
+
+// BindUniformBlock connects a uniform block to a binding point if the program declares it.
+func (backend *GLBackend) BindUniformBlock(program uint32, name string, binding uint32) {
+	index := gl.GetUniformBlockIndex(program, GLString(name))
+	if index != gl.INVALID_INDEX {
+		gl.UniformBlockBinding(program, index, binding)
+	}
+}
+
+// SetUniformInt sets an int, bool or sampler uniform.
+func (backend *GLBackend) SetUniformInt(location int32, value int32) {
+	gl.Uniform1i(location, value)
+}
+
+// SetUniformFloat sets a float uniform.
+func (backend *GLBackend) SetUniformFloat(location int32, value float32) {
+	gl.Uniform1f(location, value)
+}
+
+// SetUniformFloats sets count elements of a float, vector or matrix uniform.
+func (backend *GLBackend) SetUniformFloats(location int32, glType uint32, count int32, values []float32) {
+	switch glType {
+	case gl.FLOAT:
+		gl.Uniform1fv(location, count, &values[0])
+	case gl.FLOAT_VEC2:
+		gl.Uniform2fv(location, count, &values[0])
+	case gl.FLOAT_VEC3:
+		gl.Uniform3fv(location, count, &values[0])
+	case gl.FLOAT_VEC4:
+		gl.Uniform4fv(location, count, &values[0])
+	case gl.FLOAT_MAT3:
+		gl.UniformMatrix3fv(location, count, false, &values[0])
+	case gl.FLOAT_MAT4:
+		gl.UniformMatrix4fv(location, count, false, &values[0])
+	}
+}
+
+// CreateUniformBuffer allocates a uniform buffer and binds it to a binding point.
+func (backend *GLBackend) CreateUniformBuffer(binding uint32, floats int) uint32 {
+	var buffer uint32
+	gl.GenBuffers(1, &buffer)
+	gl.BindBuffer(gl.UNIFORM_BUFFER, buffer)
+	gl.BufferData(gl.UNIFORM_BUFFER, floats*4, nil, gl.DYNAMIC_DRAW)
+	gl.BindBuffer(gl.UNIFORM_BUFFER, 0)
+	gl.BindBufferBase(gl.UNIFORM_BUFFER, binding, buffer)
+	return buffer
+}
+
+// WriteUniformBuffer uploads new contents to a uniform buffer.
+func (backend *GLBackend) WriteUniformBuffer(buffer uint32, data []float32) {
+	gl.BindBuffer(gl.UNIFORM_BUFFER, buffer)
+	gl.BufferSubData(gl.UNIFORM_BUFFER, 0, len(data)*4, gl.Ptr(data))
+	gl.BindBuffer(gl.UNIFORM_BUFFER, 0)
+}
+
+// CreateTexture allocates a texture with clamped coordinates. The texture
+// previously bound to the active unit is bound again afterwards, so the state
+// cache stays correct.
+func (backend *GLBackend) CreateTexture(description TextureDescription) uint32 {
+	target := description.target
+	var previous int32
+	gl.GetIntegerv(glTextureBindingQueries[target], &previous)
+
+	var texture uint32
+	gl.GenTextures(1, &texture)
+	gl.BindTexture(target, texture)
+
+	formats := glTextureFormats[description.format]
+	var pixels unsafe.Pointer
+	if description.pixels != nil {
+		pixels = gl.Ptr(description.pixels)
+	}
+	width, height := int32(description.width), int32(description.height)
+	if target == gl.TEXTURE_2D_ARRAY {
+		gl.TexImage3D(target, 0, int32(formats[0]), width, height, int32(description.layers), 0, formats[1], formats[2], pixels)
+	} else {
+		gl.TexImage2D(target, 0, int32(formats[0]), width, height, 0, formats[1], formats[2], pixels)
+	}
+
+	filter := int32(gl.NEAREST)
+	if description.linear {
+		filter = gl.LINEAR
+	}
+	gl.TexParameteri(target, gl.TEXTURE_MIN_FILTER, filter)
+	gl.TexParameteri(target, gl.TEXTURE_MAG_FILTER, filter)
+	gl.TexParameteri(target, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+	gl.TexParameteri(target, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+	if description.compare {
+		gl.TexParameteri(target, gl.TEXTURE_COMPARE_MODE, gl.COMPARE_REF_TO_TEXTURE)
+		gl.TexParameteri(target, gl.TEXTURE_COMPARE_FUNC, gl.LEQUAL)
+	}
+
+	gl.BindTexture(target, uint32(previous))
+	return texture
+}
+
+// WriteTexture replaces a rectangle of a 2D texture. Like CreateTexture, it
+// binds the previous texture again afterwards.
+func (backend *GLBackend) WriteTexture(texture uint32, x, y, width, height int, pixels []uint8) {
+	var previous int32
+	gl.GetIntegerv(gl.TEXTURE_BINDING_2D, &previous)
+	gl.BindTexture(gl.TEXTURE_2D, texture)
+	gl.TexSubImage2D(gl.TEXTURE_2D, 0, int32(x), int32(y), int32(width), int32(height), gl.RGBA, gl.UNSIGNED_BYTE, gl.Ptr(pixels))
+	gl.BindTexture(gl.TEXTURE_2D, uint32(previous))
+}
+
+// DeleteTexture releases a texture.
+func (backend *GLBackend) DeleteTexture(texture uint32) {
+	gl.DeleteTextures(1, &texture)
+}
+
+// ActiveTexture selects the texture unit BindTexture binds to.
+func (backend *GLBackend) ActiveTexture(unit uint32) {
+	gl.ActiveTexture(gl.TEXTURE0 + unit)
+}
+
+// BindTexture binds a texture to the active texture unit.
+func (backend *GLBackend) BindTexture(target, texture uint32) {
+	gl.BindTexture(target, texture)
+}
+
+// CreateFramebuffer creates a framebuffer rendering into 2D textures.
+// The draw framebuffer binding is left unchanged.
+func (backend *GLBackend) CreateFramebuffer(color, depth uint32) (uint32, error) {
+	previous := backend.DrawFramebuffer()
+
+	var framebuffer uint32
+	gl.GenFramebuffers(1, &framebuffer)
+	gl.BindFramebuffer(gl.FRAMEBUFFER, framebuffer)
+	defer gl.BindFramebuffer(gl.FRAMEBUFFER, previous)
+
+	if color != 0 {
+		gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.COLOR_ATTACHMENT0, gl.TEXTURE_2D, color, 0)
+	} else {
+		gl.DrawBuffer(gl.NONE)
+		gl.ReadBuffer(gl.NONE)
+	}
+	if depth != 0 {
+		gl.FramebufferTexture2D(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, gl.TEXTURE_2D, depth, 0)
+	}
+
+	// Framebuffers without attachments get them later (see AttachDepthLayer)
+	if color == 0 && depth == 0 {
+		return framebuffer, nil
+	}
+	if status := gl.CheckFramebufferStatus(gl.FRAMEBUFFER); status != gl.FRAMEBUFFER_COMPLETE {
+		gl.DeleteFramebuffers(1, &framebuffer)
+		return 0, fmt.Errorf("framebuffer incomplete: 0x%x", status)
+	}
+	return framebuffer, nil
+}
+
+// AttachDepthLayer renders the depth of the bound framebuffer into one layer of an array texture.
+func (backend *GLBackend) AttachDepthLayer(framebuffer, texture uint32, layer int) {
+	gl.BindFramebuffer(gl.FRAMEBUFFER, framebuffer)
+	gl.FramebufferTextureLayer(gl.FRAMEBUFFER, gl.DEPTH_ATTACHMENT, texture, 0, int32(layer))
+}
+
+// DeleteFramebuffer releases a framebuffer.
+func (backend *GLBackend) DeleteFramebuffer(framebuffer uint32) {
+	gl.DeleteFramebuffers(1, &framebuffer)
+}
+
+// BindFramebuffer directs drawing (and reading) into a framebuffer.
+func (backend *GLBackend) BindFramebuffer(framebuffer uint32) {
+	gl.BindFramebuffer(gl.FRAMEBUFFER, framebuffer)
+}
+
+// DrawFramebuffer returns the framebuffer drawing currently goes to.
+func (backend *GLBackend) DrawFramebuffer() uint32 {
+	var framebuffer int32
+	gl.GetIntegerv(gl.DRAW_FRAMEBUFFER_BINDING, &framebuffer)
+	return uint32(framebuffer)
+}
+
+// Viewport sets the area of the framebuffer drawn into.
+func (backend *GLBackend) Viewport(x, y, width, height int) {
+	gl.Viewport(int32(x), int32(y), int32(width), int32(height))
+}
+
+// Clear fills the color and/or depth buffer.
+func (backend *GLBackend) Clear(mask uint32, color mgl32.Vec4) {
+	gl.ClearColor(color[0], color[1], color[2], color[3])
+	gl.Clear(mask)
+}
+
+// ReadPixels reads the color of a framebuffer back, leaving the read binding unchanged.
+// Alpha is set to opaque, the window's alpha channel is undefined.
+func (backend *GLBackend) ReadPixels(framebuffer uint32, width, height int) *image.RGBA {
+	var previous int32
+	gl.GetIntegerv(gl.READ_FRAMEBUFFER_BINDING, &previous)
+	gl.BindFramebuffer(gl.READ_FRAMEBUFFER, framebuffer)
+	defer gl.BindFramebuffer(gl.READ_FRAMEBUFFER, uint32(previous))
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	if width <= 0 || height <= 0 {
+		return img
+	}
+	gl.PixelStorei(gl.PACK_ALIGNMENT, 1)
+	gl.ReadPixels(0, 0, int32(width), int32(height), gl.RGBA, gl.UNSIGNED_BYTE, unsafe.Pointer(&img.Pix[0]))
+
+	// OpenGL returns the bottom row first
+	row := make([]uint8, img.Stride)
+	for y := range height / 2 {
+		top := img.Pix[y*img.Stride : (y+1)*img.Stride]
+		bottom := img.Pix[(height-1-y)*img.Stride : (height-y)*img.Stride]
+		copy(row, top)
+		copy(top, bottom)
+		copy(bottom, row)
+	}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 255
+	}
+	return img
+}
+
+// CreateQuery creates a query object.
+func (backend *GLBackend) CreateQuery() uint32 {
+	var query uint32
+	gl.GenQueries(1, &query)
+	return query
+}
+
+// QueryTimestamp records a GPU timestamp into a query.
+func (backend *GLBackend) QueryTimestamp(query uint32) {
+	gl.QueryCounter(query, gl.TIMESTAMP)
+}
+
+// QueryResult returns the timestamp of a query if the GPU has written it.
+func (backend *GLBackend) QueryResult(query uint32) (uint64, bool) {
+	var available int32
+	gl.GetQueryObjectiv(query, gl.QUERY_RESULT_AVAILABLE, &available)
+	if available == gl.FALSE {
+		return 0, false
+	}
+	var result uint64
+	gl.GetQueryObjectui64v(query, gl.QUERY_RESULT, &result)
+	return result, true
+}
+
+// GPUTimestamp returns the current GPU time.
+func (backend *GLBackend) GPUTimestamp() uint64 {
+	var timestamp int64
+	gl.GetInteger64v(gl.TIMESTAMP, &timestamp)
+	return uint64(timestamp)
+}
+
+// SetCapability enables or disables a GL capability.
+func (backend *GLBackend) SetCapability(capability uint32, enabled bool) {
+	if enabled {
+		gl.Enable(capability)
+	} else {
+		gl.Disable(capability)
+	}
+}
+
+// DepthFunc sets the depth comparison.
+func (backend *GLBackend) DepthFunc(function uint32) {
+	gl.DepthFunc(function)
+}
+
+// DepthMask enables or disables depth writes.
+func (backend *GLBackend) DepthMask(write bool) {
+	gl.DepthMask(write)
+}
+
+// BlendFunc sets the blend factors.
+func (backend *GLBackend) BlendFunc(source, destination uint32) {
+	gl.BlendFunc(source, destination)
+}
+
+// CullFace selects the faces removed by culling.
+func (backend *GLBackend) CullFace(face uint32) {
+	gl.CullFace(face)
+}
+
+// PolygonMode switches between filled polygons and outlines.
+func (backend *GLBackend) PolygonMode(wireframe bool) {
+	mode := uint32(gl.FILL)
+	if wireframe {
+		mode = gl.LINE
+	}
+	gl.PolygonMode(gl.FRONT_AND_BACK, mode)
+}
+
+// PolygonOffset sets the depth offset of polygons.
+func (backend *GLBackend) PolygonOffset(factor, units float32) {
+	gl.PolygonOffset(factor, units)
+}
@@ -0,0 +1,403 @@
+// Implements a render backend that records calls instead of drawing.
+// It needs no OpenGL context or window, so meshing, streaming and whole
+// frames of the game loop can run headless and be checked afterwards by
+// looking at the recorded calls.
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"regexp"
+	"strconv"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// RenderCall is one recorded backend call.
+type RenderCall struct {
+	name string // Method name, e.g. "DrawTriangles"
+	args []any  // Arguments in call order (slices are copied)
+}
+
+// RecordingBackend is a RenderBackend that draws nothing.
+// Objects get increasing IDs, vertex buffers remember their size, and
+// programs report the uniforms declared in their source.
+type RecordingBackend struct {
+	calls       []RenderCall                         // Every call made so far
+	nextID      uint32                               // Last ID handed out
+	vertices    map[uint32]int                       // Vertices stored per vertex buffer
+	uniforms    map[uint32]map[string]*ShaderUniform // Declared uniforms per program
+	framebuffer uint32                               // Framebuffer drawing goes to
+}
+
+// recordingUniformPattern matches plain uniform declarations, e.g. "uniform mat4 lights[4];".
+var recordingUniformPattern = regexp.MustCompile(`(?m)^\s*uniform\s+(\w+)\s+(\w+)\s*(?:\[\s*(\w+)\s*\])?\s*;`)
+
+// recordingDefinePattern matches object-like defines, used for array sizes.
+var recordingDefinePattern = regexp.MustCompile(`(?m)^\s*#define\s+(\w+)\s+(\d+)\s*$`)
+
+// NewRecordingBackend creates an empty recording backend.
+func NewRecordingBackend() *RecordingBackend {
+	return &RecordingBackend{
+		vertices: map[uint32]int{},
+		uniforms: map[uint32]map[string]*ShaderUniform{},
+	}
+}
+
+// record appends a call to the log.
+func (backend *RecordingBackend) record(name string, args ...any) {
+	backend.calls = append(backend.calls, RenderCall{name, args})
+}
+
+// newID hands out the next object ID.
+func (backend *RecordingBackend) newID() uint32 {
+	backend.nextID++
+	return backend.nextID
+}
+
+// Calls returns the recorded calls of one method, or all calls for "".
+// name: Method name
+func (backend *RecordingBackend) Calls(name string) []RenderCall {
+	calls := []RenderCall{}
+	for _, call := range backend.calls {
+		if name == "" || call.name == name {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Count returns how often a method was called.
+// name: Method name
+func (backend *RecordingBackend) Count(name string) int {
+	return len(backend.Calls(name))
+}
+
+// DrawnVertices returns the number of vertices submitted by all draw calls.
+func (backend *RecordingBackend) DrawnVertices() int {
+	total := 0
+	for _, call := range backend.calls {
+		switch call.name {
+		case "DrawTriangles", "DrawLines":
+			total += int(call.args[2].(int32))
+		case "DrawTrianglesInstanced":
+			total += int(call.args[2].(int32)) * int(call.args[3].(int32))
+		case "MultiDrawTriangles":
+			for _, count := range call.args[2].([]int32) {
+				total += int(count)
+			}
+		}
+	}
+	return total
+}
+
+// Reset forgets the recorded calls but keeps the objects.
+func (backend *RecordingBackend) Reset() {
+	backend.calls = nil
+}
+
+// Init reports the backend name in place of a version.
+func (backend *RecordingBackend) Init() (string, error) {
+	backend.record("Init")
+	return "recording (no OpenGL)", nil
+}
+
+// CreateVertexBuffer records the buffer's size.
+func (backend *RecordingBackend) CreateVertexBuffer(vertices int) VertexBuffer {
+	buffer := VertexBuffer{backend.newID(), backend.newID()}
+	backend.vertices[buffer.buffer] = vertices
+	backend.record("CreateVertexBuffer", vertices)
+	return buffer
+}
+
+// UploadVertices records the new size of the buffer.
+func (backend *RecordingBackend) UploadVertices(buffer VertexBuffer, data []float32) {
+	backend.vertices[buffer.buffer] = len(data) / MESH_VERTEX_FLOATS
+	backend.record("UploadVertices", buffer, len(data)/MESH_VERTEX_FLOATS)
+}
+
+// WriteVertices checks the write fits into the buffer.
+func (backend *RecordingBackend) WriteVertices(buffer VertexBuffer, firstVertex int, data []float32) {
+	count := len(data) / MESH_VERTEX_FLOATS
+	if firstVertex < 0 || firstVertex+count > backend.vertices[buffer.buffer] {
+		panic(fmt.Errorf("vertex write %d+%d outside buffer of %d vertices", firstVertex, count, backend.vertices[buffer.buffer]))
+	}
+	backend.record("WriteVertices", buffer, firstVertex, count)
+}
+
+// CopyVertices records the copies.
+func (backend *RecordingBackend) CopyVertices(source, destination VertexBuffer, moves []ArenaMove) {
+	backend.record("CopyVertices", source, destination, append([]ArenaMove{}, moves...))
+}
+
+// DeleteVertexBuffer forgets the buffer.
+func (backend *RecordingBackend) DeleteVertexBuffer(buffer VertexBuffer) {
+	delete(backend.vertices, buffer.buffer)
+	backend.record("DeleteVertexBuffer", buffer)
+}
+
+// DrawTriangles records a draw.
+func (backend *RecordingBackend) DrawTriangles(buffer VertexBuffer, first, count int32) {
+	backend.record("DrawTriangles", buffer, first, count)
+}
+
+// MultiDrawTriangles records a multi-draw.
+func (backend *RecordingBackend) MultiDrawTriangles(buffer VertexBuffer, firsts, counts []int32) {
+	backend.record("MultiDrawTriangles", buffer, append([]int32{}, firsts...), append([]int32{}, counts...))
+}
+
+// DrawLines records a line draw.
+func (backend *RecordingBackend) DrawLines(buffer VertexBuffer, first, count int32) {
+	backend.record("DrawLines", buffer, first, count)
+}
+
+// CreateInstanceBuffer records the instance layout.
+func (backend *RecordingBackend) CreateInstanceBuffer(vertices VertexBuffer, attributes []int) InstanceBuffer {
+	buffer := InstanceBuffer{array: backend.newID(), buffer: backend.newID()}
+	for _, components := range attributes {
+		buffer.floats += components
+	}
+	backend.record("CreateInstanceBuffer", vertices, append([]int{}, attributes...))
+	return buffer
+}
+
+// UploadInstances records the number of instances.
+func (backend *RecordingBackend) UploadInstances(buffer InstanceBuffer, data []float32) {
+	backend.record("UploadInstances", buffer, len(data)/buffer.floats)
+}
+
+// DeleteInstanceBuffer records the deletion.
+func (backend *RecordingBackend) DeleteInstanceBuffer(buffer InstanceBuffer) {
+	backend.record("DeleteInstanceBuffer", buffer)
+}
+
+// DrawTrianglesInstanced records an instanced draw.
+func (backend *RecordingBackend) DrawTrianglesInstanced(buffer InstanceBuffer, first, count, instances int32) {
+	backend.record("DrawTrianglesInstanced", buffer, first, count, instances)
+}
+
+// CompileProgram always succeeds and remembers the uniforms declared in the source.
+// Uniforms inside uniform blocks are skipped, like real reflection does.
+func (backend *RecordingBackend) CompileProgram(vertexSource, fragmentSource string) (uint32, error) {
+	program := backend.newID()
+	uniforms := map[string]*ShaderUniform{}
+	for _, source := range []string{vertexSource, fragmentSource} {
+		defines := map[string]int{}
+		for _, match := range recordingDefinePattern.FindAllStringSubmatch(source, -1) {
+			defines[match[1]], _ = strconv.Atoi(match[2])
+		}
+
+		for _, match := range recordingUniformPattern.FindAllStringSubmatch(source, -1) {
+			glType, known := recordingUniformType(match[1])
+			if !known {
+				continue
+			}
+			size := int32(1)
+			if match[3] != "" {
+				if value, err := strconv.Atoi(match[3]); err == nil {
+					size = int32(value)
+				} else if value, found := defines[match[3]]; found {
+					size = int32(value)
+				}
+			}
+			uniforms[match[2]] = &ShaderUniform{match[2], glType, size, int32(len(uniforms)), false}
+		}
+	}
+	backend.uniforms[program] = uniforms
+	backend.record("CompileProgram", program)
+	return program, nil
+}
+
+// recordingUniformType maps a GLSL type name to its GL type.
+func recordingUniformType(name string) (uint32, bool) {
+	for glType, typeName := range shaderUniformTypeNames {
+		if typeName == name {
+			return glType, true
+		}
+	}
+	return 0, false
+}
+
+// DeleteProgram forgets the program.
+func (backend *RecordingBackend) DeleteProgram(program uint32) {
+	delete(backend.uniforms, program)
+	backend.record("DeleteProgram", program)
+}
+
+// UseProgram records the program switch.
+func (backend *RecordingBackend) UseProgram(program uint32) {
+	backend.record("UseProgram", program)
+}
+
+// ProgramUniforms returns the uniforms found when the program was compiled.
+func (backend *RecordingBackend) ProgramUniforms(program uint32) map[string]*ShaderUniform {
+	uniforms := map[string]*ShaderUniform{}
+	for name, uniform := range backend.uniforms[program] {
+		copied := *uniform
+		uniforms[name] = &copied
+	}
+	return uniforms
+}
+
+// BindUniformBlock records the binding.
+func (backend *RecordingBackend) BindUniformBlock(program uint32, name string, binding uint32) {
+	backend.record("BindUniformBlock", program, name, binding)
+}
+
+// SetUniformInt records the value.
+func (backend *RecordingBackend) SetUniformInt(location int32, value int32) {
+	backend.record("SetUniformInt", location, value)
+}
+
+// SetUniformFloat records the value.
+func (backend *RecordingBackend) SetUniformFloat(location int32, value float32) {
+	backend.record("SetUniformFloat", location, value)
+}
+
+// SetUniformFloats records the values.
+func (backend *RecordingBackend) SetUniformFloats(location int32, glType uint32, count int32, values []float32) {
+	backend.record("SetUniformFloats", location, glType, count, append([]float32{}, values...))
+}
+
+// CreateUniformBuffer hands out a buffer ID.
+func (backend *RecordingBackend) CreateUniformBuffer(binding uint32, floats int) uint32 {
+	buffer := backend.newID()
+	backend.record("CreateUniformBuffer", buffer, binding, floats)
+	return buffer
+}
+
+// WriteUniformBuffer records the contents.
+func (backend *RecordingBackend) WriteUniformBuffer(buffer uint32, data []float32) {
+	backend.record("WriteUniformBuffer", buffer, append([]float32{}, data...))
+}
+
+// CreateTexture hands out a texture ID.
+func (backend *RecordingBackend) CreateTexture(description TextureDescription) uint32 {
+	texture := backend.newID()
+	description.pixels = nil
+	backend.record("CreateTexture", texture, description)
+	return texture
+}
+
+// WriteTexture records the rectangle written.
+func (backend *RecordingBackend) WriteTexture(texture uint32, x, y, width, height int, pixels []uint8) {
+	backend.record("WriteTexture", texture, x, y, width, height)
+}
+
+// DeleteTexture records the deletion.
+func (backend *RecordingBackend) DeleteTexture(texture uint32) {
+	backend.record("DeleteTexture", texture)
+}
+
+// ActiveTexture records the unit switch.
+func (backend *RecordingBackend) ActiveTexture(unit uint32) {
+	backend.record("ActiveTexture", unit)
+}
+
+// BindTexture records the binding.
+func (backend *RecordingBackend) BindTexture(target, texture uint32) {
+	backend.record("BindTexture", target, texture)
+}
+
+// CreateFramebuffer hands out a framebuffer ID.
+func (backend *RecordingBackend) CreateFramebuffer(color, depth uint32) (uint32, error) {
+	framebuffer := backend.newID()
+	backend.record("CreateFramebuffer", framebuffer, color, depth)
+	return framebuffer, nil
+}
+
+// AttachDepthLayer records the attachment.
+func (backend *RecordingBackend) AttachDepthLayer(framebuffer, texture uint32, layer int) {
+	backend.framebuffer = framebuffer
+	backend.record("AttachDepthLayer", framebuffer, texture, layer)
+}
+
+// DeleteFramebuffer records the deletion.
+func (backend *RecordingBackend) DeleteFramebuffer(framebuffer uint32) {
+	backend.record("DeleteFramebuffer", framebuffer)
+}
+
+// BindFramebuffer remembers the framebuffer for DrawFramebuffer.
+func (backend *RecordingBackend) BindFramebuffer(framebuffer uint32) {
+	backend.framebuffer = framebuffer
+	backend.record("BindFramebuffer", framebuffer)
+}
+
+// DrawFramebuffer returns the last bound framebuffer.
+func (backend *RecordingBackend) DrawFramebuffer() uint32 {
+	return backend.framebuffer
+}
+
+// Viewport records the viewport.
+func (backend *RecordingBackend) Viewport(x, y, width, height int) {
+	backend.record("Viewport", x, y, width, height)
+}
+
+// Clear records the clear.
+func (backend *RecordingBackend) Clear(mask uint32, color mgl32.Vec4) {
+	backend.record("Clear", mask, color)
+}
+
+// ReadPixels records the read and returns a black image.
+func (backend *RecordingBackend) ReadPixels(framebuffer uint32, width, height int) *image.RGBA {
+	backend.record("ReadPixels", framebuffer, width, height)
+	return image.NewRGBA(image.Rect(0, 0, width, height))
+}
+
+// CreateQuery records the creation and returns a new ID.
+func (backend *RecordingBackend) CreateQuery() uint32 {
+	query := backend.newID()
+	backend.record("CreateQuery", query)
+	return query
+}
+
+// QueryTimestamp records the timestamp request.
+func (backend *RecordingBackend) QueryTimestamp(query uint32) {
+	backend.record("QueryTimestamp", query)
+}
+
+// QueryResult returns time 0, available at once; nothing is drawn, so GPU work takes no time.
+func (backend *RecordingBackend) QueryResult(query uint32) (uint64, bool) {
+	return 0, true
+}
+
+// GPUTimestamp returns time 0 (see QueryResult).
+func (backend *RecordingBackend) GPUTimestamp() uint64 {
+	return 0
+}
+
+// SetCapability records the change.
+func (backend *RecordingBackend) SetCapability(capability uint32, enabled bool) {
+	backend.record("SetCapability", capability, enabled)
+}
+
+// DepthFunc records the change.
+func (backend *RecordingBackend) DepthFunc(function uint32) {
+	backend.record("DepthFunc", function)
+}
+
+// DepthMask records the change.
+func (backend *RecordingBackend) DepthMask(write bool) {
+	backend.record("DepthMask", write)
+}
+
+// BlendFunc records the change.
+func (backend *RecordingBackend) BlendFunc(source, destination uint32) {
+	backend.record("BlendFunc", source, destination)
+}
+
+// CullFace records the change.
+func (backend *RecordingBackend) CullFace(face uint32) {
+	backend.record("CullFace", face)
+}
+
+// PolygonMode records the change.
+func (backend *RecordingBackend) PolygonMode(wireframe bool) {
+	backend.record("PolygonMode", wireframe)
+}
+
+// PolygonOffset records the change.
+func (backend *RecordingBackend) PolygonOffset(factor, units float32) {
+	backend.record("PolygonOffset", factor, units)
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// useRecordingBackend swaps in a recording backend for the rest of the test.
+func useRecordingBackend(t *testing.T) *RecordingBackend {
+	backend := NewRecordingBackend()
+	previous := renderBackend
+	renderBackend = backend
+	t.Cleanup(func() {
+		renderBackend = previous
+	})
+	return backend
+}
+
+// modelMatrices returns the values uploaded to a shader's "model" uniform.
+func modelMatrices(backend *RecordingBackend, shader *Shader) []mgl32.Mat4 {
+	matrices := []mgl32.Mat4{}
+	for _, call := range backend.Calls("SetUniformFloats") {
+		if call.args[0].(int32) == shader.uniforms["model"].location {
+			matrices = append(matrices, mgl32.Mat4(call.args[3].([]float32)))
+		}
+	}
+	return matrices
+}
+
+// TestRecordingBackendChunkDraw meshes two chunks, draws them through the
+// buffer arena and checks the recorded uploads and draws.
+func TestRecordingBackendChunkDraw(t *testing.T) {
+	backend := useRecordingBackend(t)
+
+	shader := Shader{}
+	shader.LoadFile("basic")
+	if _, found := shader.uniforms["model"]; !found {
+		t.Fatal("basic shader declares no model uniform")
+	}
+
+	// A 2x2x2 cube shows 6 faces of 4 quads, a single block 6 quads
+	cube := &Chunk{position: ChunkPos{0, 3, 0}}
+	for _, local := range []LocalPos{{0, 0, 0}, {1, 0, 0}, {0, 1, 0}, {1, 1, 0}, {0, 0, 1}, {1, 0, 1}, {0, 1, 1}, {1, 1, 1}} {
+		cube.SetBlock(local, BLOCK_STONE)
+	}
+	single := &Chunk{position: ChunkPos{-1, 3, 2}}
+	single.SetBlock(LocalPos{15, 0, 0}, BLOCK_DIRT)
+	neighbour := &Chunk{position: ChunkPos{1, 3, 0}}
+	neighbour.SetBlock(LocalPos{0, 0, 0}, BLOCK_DIRT)
+	chunks := []*Chunk{cube, single, neighbour}
+	expected := []int{24 * 6, 6 * 6, 6 * 6}
+	for _, chunk := range chunks {
+		chunk.UpdateMesh()
+	}
+
+	// Vertices are relative to the region origin, (0, 0, 0) and (-128, 0, 0)
+	corners := []mgl32.Vec3{{0, 48, 0}, {127, 48, 32}, {16, 48, 0}}
+	for i, chunk := range chunks {
+		corner := mgl32.Vec3{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32}
+		for vertex := 0; vertex < len(chunk.mesh.arrayData); vertex += MESH_VERTEX_FLOATS {
+			for axis := range 3 {
+				corner[axis] = min(corner[axis], chunk.mesh.arrayData[vertex+axis])
+			}
+		}
+		if corner != corners[i] {
+			t.Errorf("chunk %v mesh starts at %v, expected %v", chunk.position, corner, corners[i])
+		}
+	}
+
+	camera := Camera{}
+	camera.InitializeDefaultValues()
+	arena := BufferArena{}
+	arena.Initialize(1024)
+	backend.Reset()
+
+	shader.Use()
+	for _, chunk := range chunks {
+		chunk.QueueDraw(&arena, &camera, CHUNK_PASS_SOLID)
+	}
+	arena.Draw(&shader)
+
+	// Each mesh is written once, back to back
+	writes := backend.Calls("WriteVertices")
+	if len(writes) != len(chunks) {
+		t.Fatalf("%d vertex writes, expected %d", len(writes), len(chunks))
+	}
+	offset := 0
+	for i, write := range writes {
+		if first, count := write.args[1].(int), write.args[2].(int); first != offset || count != expected[i] {
+			t.Errorf("write %d of %d vertices at %d, expected %d at %d", i, count, first, expected[i], offset)
+		}
+		offset += expected[i]
+	}
+
+	// One multi-draw per region, the cube and its neighbour share a batch
+	regions := []*Chunk{cube, single}
+	if count := backend.Count("MultiDrawTriangles"); count != len(regions) {
+		t.Errorf("%d multi-draws, expected %d", count, len(regions))
+	}
+	if counts := backend.Calls("MultiDrawTriangles")[0].args[2].([]int32); len(counts) != 2 {
+		t.Errorf("first batch draws %v, expected the cube and its neighbour", counts)
+	}
+	if drawn := backend.DrawnVertices(); drawn != offset {
+		t.Errorf("%d vertices drawn, expected %d", drawn, offset)
+	}
+	matrices := modelMatrices(backend, &shader)
+	if len(matrices) != len(regions) {
+		t.Fatalf("%d model matrices, expected %d", len(matrices), len(regions))
+	}
+	for i, chunk := range regions {
+		origin := camera.RelativePosition(chunk.Origin())
+		if !matrices[i].ApproxEqual(mgl32.Translate3D(origin.Elem())) {
+			t.Errorf("chunk %v model matrix %v, expected a translation to %v", chunk.position, matrices[i], origin)
+		}
+	}
+
+	// A second frame draws the same ranges without uploading again
+	backend.Reset()
+	for _, chunk := range chunks {
+		chunk.QueueDraw(&arena, &camera, CHUNK_PASS_SOLID)
+	}
+	arena.Draw(&shader)
+	if count := backend.Count("WriteVertices"); count != 0 {
+		t.Errorf("%d vertex writes for unchanged meshes", count)
+	}
+	if drawn := backend.DrawnVertices(); drawn != offset {
+		t.Errorf("%d vertices drawn again, expected %d", drawn, offset)
+	}
+}
+
+// TestRecordingBackendArenaGrows checks that a full arena is grown and its
+// blocks copied into the new buffer.
+func TestRecordingBackendArenaGrows(t *testing.T) {
+	backend := useRecordingBackend(t)
+
+	arena := BufferArena{}
+	arena.Initialize(8)
+	first := arena.Store(nil, make([]float32, 6*MESH_VERTEX_FLOATS))
+	second := arena.Store(nil, make([]float32, 6*MESH_VERTEX_FLOATS))
+
+	if count := backend.Count("CreateVertexBuffer"); count != 2 {
+		t.Fatalf("%d vertex buffers created, expected 2", count)
+	}
+	if size := backend.Calls("CreateVertexBuffer")[1].args[0].(int); size != 16 {
+		t.Errorf("arena grew to %d vertices, expected 16", size)
+	}
+	if count := backend.Count("DeleteVertexBuffer"); count != 1 {
+		t.Errorf("%d vertex buffers deleted, expected 1", count)
+	}
+	moves := backend.Calls("CopyVertices")[0].args[2].([]ArenaMove)
+	if len(moves) != 1 || moves[0] != (ArenaMove{0, 0, 6}) {
+		t.Errorf("copies %v, expected the first block in place", moves)
+	}
+	if first.offset != 0 || second.offset != 6 {
+		t.Errorf("blocks at %d and %d, expected 0 and 6", first.offset, second.offset)
+	}
+}
+
+// TestRecordingBackendLiquidPass checks that water faces are meshed after the
+// solid ones and drawn by their own pass, and that water hides water faces only.
+func TestRecordingBackendLiquidPass(t *testing.T) {
+	backend := useRecordingBackend(t)
+
+	shader := Shader{}
+	shader.LoadFile("basic")
+
+	// A stone block under two water blocks: the stone shows all 6 faces, the
+	// water 9, without the face on the stone and the two between the water blocks
+	chunk := &Chunk{position: ChunkPos{0, 3, 0}}
+	chunk.SetBlock(LocalPos{5, 5, 5}, BLOCK_STONE)
+	chunk.SetBlock(LocalPos{5, 6, 5}, BLOCK_WATER)
+	chunk.SetBlock(LocalPos{6, 6, 5}, BLOCK_WATER)
+	chunk.UpdateMesh()
+	if chunk.liquidFirst != 6*6 || len(chunk.mesh.arrayData) != (6+9)*6*MESH_VERTEX_FLOATS {
+		t.Fatalf("water faces from vertex %d of %d, expected %d of %d",
+			chunk.liquidFirst, len(chunk.mesh.arrayData)/MESH_VERTEX_FLOATS, 6*6, (6+9)*6)
+	}
+
+	camera := Camera{}
+	camera.InitializeDefaultValues()
+	arena := BufferArena{}
+	arena.Initialize(1024)
+	shader.Use()
+
+	passes := []struct {
+		pass  ChunkPass // Pass drawn
+		first int32     // Expected first vertex
+		count int32     // Expected vertex count
+	}{
+		{CHUNK_PASS_SOLID, 0, 6 * 6},
+		{CHUNK_PASS_LIQUID, 6 * 6, 9 * 6},
+	}
+	for _, testCase := range passes {
+		backend.Reset()
+		chunk.QueueDraw(&arena, &camera, testCase.pass)
+		arena.Draw(&shader)
+		draws := backend.Calls("MultiDrawTriangles")
+		if len(draws) != 1 {
+			t.Fatalf("pass %d: %d multi-draws, expected 1", testCase.pass, len(draws))
+		}
+		firsts, counts := draws[0].args[1].([]int32), draws[0].args[2].([]int32)
+		if len(firsts) != 1 || firsts[0] != testCase.first || counts[0] != testCase.count {
+			t.Errorf("pass %d draws %v %v, expected %d vertices at %d", testCase.pass, firsts, counts, testCase.count, testCase.first)
+		}
+	}
+}
+
+// TestChunkBordersAgainstNeighbours checks that the faces between two solid
+// chunks are culled at the same LOD only and that a LOD change of the
+// neighbour marks the border stale.
+func TestChunkBordersAgainstNeighbours(t *testing.T) {
+	gameWorld := &GameWorld{chunks: map[ChunkPos]*Chunk{}}
+	solid := func(position ChunkPos) *Chunk {
+		chunk := &Chunk{position: position, world: gameWorld}
+		for x := range CHUNK_SIZE {
+			for y := range CHUNK_SIZE {
+				for z := range CHUNK_SIZE {
+					chunk.SetBlock(LocalPos{x, y, z}, BLOCK_STONE)
+				}
+			}
+		}
+		chunk.isGenerated.Store(true)
+		gameWorld.chunks[position] = chunk
+		return chunk
+	}
+	chunk := solid(ChunkPos{0, 3, 0})
+	neighbour := solid(ChunkPos{1, 3, 0})
+	faces := func() int {
+		return len(chunk.mesh.arrayData) / MESH_VERTEX_FLOATS / 6
+	}
+
+	// The face towards the neighbour is hidden, the other five are walls
+	chunk.UpdateMesh()
+	if faces() != 5*CHUNK_SIZE*CHUNK_SIZE {
+		t.Errorf("%d faces next to a solid neighbour, expected %d", faces(), 5*CHUNK_SIZE*CHUNK_SIZE)
+	}
+	if chunk.BordersStale() {
+		t.Errorf("borders stale right after meshing")
+	}
+
+	// A neighbour at another LOD leaves the wall as a skirt
+	neighbour.lod.Store(1)
+	if !chunk.BordersStale() {
+		t.Errorf("borders not stale after the neighbour changed its LOD")
+	}
+	chunk.UpdateMesh()
+	if faces() != 6*CHUNK_SIZE*CHUNK_SIZE || chunk.BordersStale() {
+		t.Errorf("%d faces next to a coarser neighbour, expected %d", faces(), 6*CHUNK_SIZE*CHUNK_SIZE)
+	}
+}
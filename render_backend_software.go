@@ -0,0 +1,709 @@
+// Implements a render backend that rasterizes on the CPU.
+// It draws the world the way basic.glsl_vert/basic.glsl_frag do: the same mesh
+// vertices, the camera matrices from the "Camera" uniform buffer, perspective
+// correct texture coordinates into the atlas, a depth buffer and the same
+// lighting and fog. Programs that are not variants of the basic shader (sky,
+// shadows, post passes, debug overlays) and line draws are not executed. The result does not depend on a GPU
+// or driver, which makes it suitable for golden-image tests (see golden.go).
+
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"regexp"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// SOFTWARE_VARYINGS is the number of floats interpolated per vertex:
+// world position (3), normal (3), vertex color (3) and UV (2).
+const SOFTWARE_VARYINGS = 11
+
+// softwareVertex is a vertex after the vertex stage.
+type softwareVertex struct {
+	clip     mgl32.Vec4                 // Clip space position
+	varyings [SOFTWARE_VARYINGS]float32 // Values interpolated across the triangle
+}
+
+// softwareTexture is the CPU copy of an RGBA8 texture.
+type softwareTexture struct {
+	width, height int     // Size in texels
+	pixels        []uint8 // RGBA rows, first row at v = 0
+}
+
+// softwareShading holds the uniform values of one draw, read once per draw.
+type softwareShading struct {
+	model, viewProjection           mgl32.Mat4       // Vertex transform
+	normalMatrix                    mgl32.Mat3       // Normal transform
+	cameraPosition                  mgl32.Vec3       // Camera position in world space
+	texture                         *softwareTexture // Sampled "tex" texture (nil samples white)
+	lightDirection                  mgl32.Vec3       // Direction to the sun or moon
+	lightColor                      mgl32.Vec3       // Color of the direct light
+	ambientStrength                 float32          // Strength of the ambient light
+	diffuseStrength                 float32          // Material diffuse factor
+	specularStrength                float32          // Material specular factor
+	shininess                       float32          // Material specular exponent
+	opacity                         float32          // Alpha multiplier of TRANSLUCENT variants
+	fogMode                         int              // 0 off, 1 linear, 2 exponential
+	fogStart, fogEnd                float32          // Linear fog distances
+	fogDensity                      float32          // Exponential fog density
+	fogColor                        mgl32.Vec3       // Color the world fades into
+	withFog, alphaTest, translucent bool             // Variant defines
+}
+
+// SoftwareBackend is a RenderBackend that rasterizes basic shader draws into
+// a color and depth buffer in memory. Every framebuffer with a color texture
+// (and the window) draws into that one buffer; the viewport is always the
+// full buffer. Calls are recorded like with the RecordingBackend.
+type SoftwareBackend struct {
+	*RecordingBackend
+
+	width, height int          // Size of the color and depth buffer
+	color         []mgl32.Vec4 // Color buffer, bottom row first like OpenGL
+	depth         []float32    // Window space depth (0 near, 1 far)
+
+	buffers           map[uint32][]float32           // Vertex data per vertex buffer
+	uniformBuffers    map[uint32][]float32           // Uniform buffer contents
+	uniformBindings   map[uint32]uint32              // Uniform buffer bound to each binding point
+	textures          map[uint32]*softwareTexture    // RGBA8 textures with data
+	colorFramebuffers map[uint32]bool                // Framebuffers with a color texture
+	defines           map[uint32]map[string]bool     // Defines of each program's fragment shader
+	values            map[uint32]map[int32][]float32 // Uniform values by program and location
+	program           uint32                         // Program in use
+	activeUnit        uint32                         // Active texture unit
+	units             map[uint32]uint32              // Texture bound to each unit
+
+	depthTest        bool   // Test fragments against the depth buffer
+	depthFunc        uint32 // gl.LESS, gl.LEQUAL or gl.ALWAYS
+	depthWrite       bool   // Write the depth of drawn fragments
+	blend            bool   // Blend fragments with the color buffer
+	blendSource      uint32 // Source blend factor
+	blendDestination uint32 // Destination blend factor
+	cull             bool   // Skip faces pointing in cullFace's direction
+	cullFace         uint32 // gl.BACK or gl.FRONT
+	wireframe        bool   // Wireframe draws are skipped
+
+	triangles int // Triangles rasterized so far
+	fragments int // Fragments written so far
+}
+
+// softwareDefinePattern matches the define lines the preprocessor injects.
+var softwareDefinePattern = regexp.MustCompile(`(?m)^\s*#define\s+(\w+)`)
+
+// NewSoftwareBackend creates a backend drawing into a buffer of the given size.
+// width, height: Size in pixels
+func NewSoftwareBackend(width, height int) *SoftwareBackend {
+	backend := &SoftwareBackend{
+		RecordingBackend:  NewRecordingBackend(),
+		width:             width,
+		height:            height,
+		color:             make([]mgl32.Vec4, width*height),
+		depth:             make([]float32, width*height),
+		buffers:           map[uint32][]float32{},
+		uniformBuffers:    map[uint32][]float32{},
+		uniformBindings:   map[uint32]uint32{},
+		textures:          map[uint32]*softwareTexture{},
+		colorFramebuffers: map[uint32]bool{},
+		defines:           map[uint32]map[string]bool{},
+		values:            map[uint32]map[int32][]float32{},
+		units:             map[uint32]uint32{},
+		depthFunc:         gl.LESS,
+		depthWrite:        true,
+		blendSource:       gl.ONE,
+		blendDestination:  gl.ZERO,
+		cullFace:          gl.BACK,
+	}
+	for i := range backend.depth {
+		backend.depth[i] = 1.0
+	}
+	return backend
+}
+
+// Image returns the color buffer as an image, top row first.
+// Colors are clamped to 0..1; no tone mapping or gamma is applied.
+func (backend *SoftwareBackend) Image() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, backend.width, backend.height))
+	for y := range backend.height {
+		row := backend.height - 1 - y
+		for x := range backend.width {
+			c := backend.color[row*backend.width+x]
+			img.SetRGBA(x, y, color.RGBA{
+				softwareChannel(c[0]), softwareChannel(c[1]), softwareChannel(c[2]), 255,
+			})
+		}
+	}
+	return img
+}
+
+// ReadPixels returns the color buffer, whatever framebuffer is asked for.
+// The image always has the size of the buffer.
+func (backend *SoftwareBackend) ReadPixels(framebuffer uint32, width, height int) *image.RGBA {
+	backend.record("ReadPixels", framebuffer, width, height)
+	return backend.Image()
+}
+
+// softwareChannel converts a color channel to 8 bits.
+func softwareChannel(value float32) uint8 {
+	return uint8(mgl32.Clamp(value, 0.0, 1.0)*255.0 + 0.5)
+}
+
+// CreateVertexBuffer allocates the CPU copy of a buffer.
+func (backend *SoftwareBackend) CreateVertexBuffer(vertices int) VertexBuffer {
+	buffer := backend.RecordingBackend.CreateVertexBuffer(vertices)
+	backend.buffers[buffer.buffer] = make([]float32, vertices*MESH_VERTEX_FLOATS)
+	return buffer
+}
+
+// UploadVertices replaces the buffer's data.
+func (backend *SoftwareBackend) UploadVertices(buffer VertexBuffer, data []float32) {
+	backend.RecordingBackend.UploadVertices(buffer, data)
+	backend.buffers[buffer.buffer] = append([]float32{}, data...)
+}
+
+// WriteVertices overwrites part of the buffer's data.
+func (backend *SoftwareBackend) WriteVertices(buffer VertexBuffer, firstVertex int, data []float32) {
+	backend.RecordingBackend.WriteVertices(buffer, firstVertex, data)
+	copy(backend.buffers[buffer.buffer][firstVertex*MESH_VERTEX_FLOATS:], data)
+}
+
+// CopyVertices copies vertex ranges between buffers.
+func (backend *SoftwareBackend) CopyVertices(source, destination VertexBuffer, moves []ArenaMove) {
+	backend.RecordingBackend.CopyVertices(source, destination, moves)
+	from, to := backend.buffers[source.buffer], backend.buffers[destination.buffer]
+	for _, move := range moves {
+		copy(to[move.to*MESH_VERTEX_FLOATS:(move.to+move.count)*MESH_VERTEX_FLOATS],
+			from[move.from*MESH_VERTEX_FLOATS:(move.from+move.count)*MESH_VERTEX_FLOATS])
+	}
+}
+
+// DeleteVertexBuffer releases the buffer's data.
+func (backend *SoftwareBackend) DeleteVertexBuffer(buffer VertexBuffer) {
+	backend.RecordingBackend.DeleteVertexBuffer(buffer)
+	delete(backend.buffers, buffer.buffer)
+}
+
+// DrawTriangles rasterizes a range of vertices.
+func (backend *SoftwareBackend) DrawTriangles(buffer VertexBuffer, first, count int32) {
+	backend.RecordingBackend.DrawTriangles(buffer, first, count)
+	if shading := backend.shading(); shading != nil {
+		backend.drawRange(shading, backend.buffers[buffer.buffer], first, count)
+	}
+}
+
+// MultiDrawTriangles rasterizes several ranges of vertices.
+func (backend *SoftwareBackend) MultiDrawTriangles(buffer VertexBuffer, firsts, counts []int32) {
+	backend.RecordingBackend.MultiDrawTriangles(buffer, firsts, counts)
+	if shading := backend.shading(); shading != nil {
+		for i := range firsts {
+			backend.drawRange(shading, backend.buffers[buffer.buffer], firsts[i], counts[i])
+		}
+	}
+}
+
+// CompileProgram remembers the defines of the fragment shader, which select the basic shader variant.
+func (backend *SoftwareBackend) CompileProgram(vertexSource, fragmentSource string) (uint32, error) {
+	program, err := backend.RecordingBackend.CompileProgram(vertexSource, fragmentSource)
+	defines := map[string]bool{}
+	for _, match := range softwareDefinePattern.FindAllStringSubmatch(fragmentSource, -1) {
+		defines[match[1]] = true
+	}
+	backend.defines[program] = defines
+	backend.values[program] = map[int32][]float32{}
+	return program, err
+}
+
+// DeleteProgram forgets the program's uniform values.
+func (backend *SoftwareBackend) DeleteProgram(program uint32) {
+	backend.RecordingBackend.DeleteProgram(program)
+	delete(backend.defines, program)
+	delete(backend.values, program)
+}
+
+// UseProgram selects the program whose uniforms are set and used.
+func (backend *SoftwareBackend) UseProgram(program uint32) {
+	backend.RecordingBackend.UseProgram(program)
+	backend.program = program
+}
+
+// SetUniformInt stores the value for the program in use.
+func (backend *SoftwareBackend) SetUniformInt(location int32, value int32) {
+	backend.RecordingBackend.SetUniformInt(location, value)
+	backend.setUniform(location, []float32{float32(value)})
+}
+
+// SetUniformFloat stores the value for the program in use.
+func (backend *SoftwareBackend) SetUniformFloat(location int32, value float32) {
+	backend.RecordingBackend.SetUniformFloat(location, value)
+	backend.setUniform(location, []float32{value})
+}
+
+// SetUniformFloats stores the values for the program in use.
+func (backend *SoftwareBackend) SetUniformFloats(location int32, glType uint32, count int32, values []float32) {
+	backend.RecordingBackend.SetUniformFloats(location, glType, count, values)
+	backend.setUniform(location, append([]float32{}, values...))
+}
+
+// setUniform stores a uniform value of the program in use.
+func (backend *SoftwareBackend) setUniform(location int32, values []float32) {
+	if programValues, found := backend.values[backend.program]; found {
+		programValues[location] = values
+	}
+}
+
+// CreateUniformBuffer allocates the buffer's data and binds it.
+func (backend *SoftwareBackend) CreateUniformBuffer(binding uint32, floats int) uint32 {
+	buffer := backend.RecordingBackend.CreateUniformBuffer(binding, floats)
+	backend.uniformBuffers[buffer] = make([]float32, floats)
+	backend.uniformBindings[binding] = buffer
+	return buffer
+}
+
+// WriteUniformBuffer stores the buffer's contents.
+func (backend *SoftwareBackend) WriteUniformBuffer(buffer uint32, data []float32) {
+	backend.RecordingBackend.WriteUniformBuffer(buffer, data)
+	copy(backend.uniformBuffers[buffer], data)
+}
+
+// CreateTexture keeps a copy of RGBA8 texture data, the only kind that is sampled.
+func (backend *SoftwareBackend) CreateTexture(description TextureDescription) uint32 {
+	texture := backend.RecordingBackend.CreateTexture(description)
+	if description.format == TEXTURE_FORMAT_RGBA8 && description.pixels != nil {
+		backend.textures[texture] = &softwareTexture{
+			description.width, description.height, append([]uint8{}, description.pixels...),
+		}
+	}
+	return texture
+}
+
+// WriteTexture updates the copy of a texture, so animated tiles show the current frame.
+func (backend *SoftwareBackend) WriteTexture(texture uint32, x, y, width, height int, pixels []uint8) {
+	backend.RecordingBackend.WriteTexture(texture, x, y, width, height, pixels)
+	stored, found := backend.textures[texture]
+	if !found {
+		return
+	}
+	for row := range height {
+		start := ((y+row)*stored.width + x) * 4
+		copy(stored.pixels[start:start+width*4], pixels[row*width*4:(row+1)*width*4])
+	}
+}
+
+// DeleteTexture releases the texture's data.
+func (backend *SoftwareBackend) DeleteTexture(texture uint32) {
+	backend.RecordingBackend.DeleteTexture(texture)
+	delete(backend.textures, texture)
+}
+
+// ActiveTexture selects the unit BindTexture binds to.
+func (backend *SoftwareBackend) ActiveTexture(unit uint32) {
+	backend.RecordingBackend.ActiveTexture(unit)
+	backend.activeUnit = unit
+}
+
+// BindTexture binds a texture to the active unit.
+func (backend *SoftwareBackend) BindTexture(target, texture uint32) {
+	backend.RecordingBackend.BindTexture(target, texture)
+	backend.units[backend.activeUnit] = texture
+}
+
+// CreateFramebuffer remembers whether the framebuffer has a color texture.
+func (backend *SoftwareBackend) CreateFramebuffer(color, depth uint32) (uint32, error) {
+	framebuffer, err := backend.RecordingBackend.CreateFramebuffer(color, depth)
+	backend.colorFramebuffers[framebuffer] = color != 0
+	return framebuffer, err
+}
+
+// drawsToColor reports whether the bound framebuffer is the color buffer.
+func (backend *SoftwareBackend) drawsToColor() bool {
+	framebuffer := backend.DrawFramebuffer()
+	return framebuffer == 0 || backend.colorFramebuffers[framebuffer]
+}
+
+// Clear fills the color and/or depth buffer if the bound framebuffer draws into them.
+func (backend *SoftwareBackend) Clear(mask uint32, clearColor mgl32.Vec4) {
+	backend.RecordingBackend.Clear(mask, clearColor)
+	if !backend.drawsToColor() {
+		return
+	}
+	if mask&gl.COLOR_BUFFER_BIT != 0 {
+		for i := range backend.color {
+			backend.color[i] = clearColor
+		}
+	}
+	if mask&gl.DEPTH_BUFFER_BIT != 0 && backend.depthWrite {
+		for i := range backend.depth {
+			backend.depth[i] = 1.0
+		}
+	}
+}
+
+// SetCapability tracks depth testing, blending and culling.
+func (backend *SoftwareBackend) SetCapability(capability uint32, enabled bool) {
+	backend.RecordingBackend.SetCapability(capability, enabled)
+	switch capability {
+	case gl.DEPTH_TEST:
+		backend.depthTest = enabled
+	case gl.BLEND:
+		backend.blend = enabled
+	case gl.CULL_FACE:
+		backend.cull = enabled
+	}
+}
+
+// DepthFunc sets the depth comparison.
+func (backend *SoftwareBackend) DepthFunc(function uint32) {
+	backend.RecordingBackend.DepthFunc(function)
+	backend.depthFunc = function
+}
+
+// DepthMask enables or disables depth writes.
+func (backend *SoftwareBackend) DepthMask(write bool) {
+	backend.RecordingBackend.DepthMask(write)
+	backend.depthWrite = write
+}
+
+// BlendFunc sets the blend factors.
+func (backend *SoftwareBackend) BlendFunc(source, destination uint32) {
+	backend.RecordingBackend.BlendFunc(source, destination)
+	backend.blendSource, backend.blendDestination = source, destination
+}
+
+// CullFace selects the faces removed by culling.
+func (backend *SoftwareBackend) CullFace(face uint32) {
+	backend.RecordingBackend.CullFace(face)
+	backend.cullFace = face
+}
+
+// PolygonMode switches wireframe drawing, which the rasterizer skips.
+func (backend *SoftwareBackend) PolygonMode(wireframe bool) {
+	backend.RecordingBackend.PolygonMode(wireframe)
+	backend.wireframe = wireframe
+}
+
+// uniform returns the value of a uniform of the program in use, nil if it is
+// not declared or was never set.
+func (backend *SoftwareBackend) uniform(name string) []float32 {
+	declared, found := backend.uniforms[backend.program][name]
+	if !found {
+		return nil
+	}
+	return backend.values[backend.program][declared.location]
+}
+
+// uniformFloat returns a float uniform of the program in use (0 if unset).
+func (backend *SoftwareBackend) uniformFloat(name string) float32 {
+	if values := backend.uniform(name); len(values) > 0 {
+		return values[0]
+	}
+	return 0.0
+}
+
+// uniformVec3 returns a vec3 uniform of the program in use (zero if unset).
+func (backend *SoftwareBackend) uniformVec3(name string) mgl32.Vec3 {
+	if values := backend.uniform(name); len(values) >= 3 {
+		return mgl32.Vec3{values[0], values[1], values[2]}
+	}
+	return mgl32.Vec3{}
+}
+
+// shading collects the uniforms of the current draw. Returns nil when the draw
+// is not rasterized: the program is not a basic shader variant, the target is
+// not the color buffer, or polygons are drawn as outlines.
+func (backend *SoftwareBackend) shading() *softwareShading {
+	declared := backend.uniforms[backend.program]
+	for _, name := range []string{"model", "normalMatrix", "tex", "diffuseStrength"} {
+		if _, found := declared[name]; !found {
+			return nil
+		}
+	}
+	if !backend.drawsToColor() || backend.wireframe {
+		return nil
+	}
+
+	// Camera matrices come from the shared uniform buffer, like in camera.glsl
+	camera := backend.uniformBuffers[backend.uniformBindings[CAMERA_UNIFORM_BINDING]]
+	if len(camera) < CAMERA_UNIFORM_FLOATS {
+		return nil
+	}
+	projection, view := mgl32.Mat4{}, mgl32.Mat4{}
+	copy(projection[:], camera[0:16])
+	copy(view[:], camera[16:32])
+
+	shading := &softwareShading{
+		viewProjection:   projection.Mul4(view),
+		cameraPosition:   mgl32.Vec3{camera[48], camera[49], camera[50]},
+		lightDirection:   backend.uniformVec3("lightDirection"),
+		lightColor:       backend.uniformVec3("lightColor"),
+		ambientStrength:  backend.uniformFloat("ambientStrength"),
+		diffuseStrength:  backend.uniformFloat("diffuseStrength"),
+		specularStrength: backend.uniformFloat("specularStrength"),
+		shininess:        backend.uniformFloat("shininess"),
+		opacity:          backend.uniformFloat("opacity"),
+		fogMode:          int(backend.uniformFloat("fogMode")),
+		fogStart:         backend.uniformFloat("fogStart"),
+		fogEnd:           backend.uniformFloat("fogEnd"),
+		fogDensity:       backend.uniformFloat("fogDensity"),
+		fogColor:         backend.uniformVec3("fogColor"),
+		withFog:          backend.defines[backend.program]["WITH_FOG"],
+		alphaTest:        backend.defines[backend.program]["ALPHA_TEST"],
+		translucent:      backend.defines[backend.program]["TRANSLUCENT"],
+	}
+	shading.model = mgl32.Ident4()
+	if values := backend.uniform("model"); len(values) == 16 {
+		copy(shading.model[:], values)
+	}
+	shading.normalMatrix = mgl32.Ident3()
+	if values := backend.uniform("normalMatrix"); len(values) == 9 {
+		copy(shading.normalMatrix[:], values)
+	}
+	if unit := backend.uniform("tex"); len(unit) > 0 {
+		shading.texture = backend.textures[backend.units[uint32(unit[0])]]
+	}
+	return shading
+}
+
+// drawRange runs the vertex stage over a range of vertices and rasterizes the triangles.
+func (backend *SoftwareBackend) drawRange(shading *softwareShading, data []float32, first, count int32) {
+	triangle := [3]softwareVertex{}
+	for i := range count - count%3 {
+		offset := int(first+i) * MESH_VERTEX_FLOATS
+		vertex := data[offset : offset+MESH_VERTEX_FLOATS]
+
+		// basic.glsl_vert: world position, normal, color and UV
+		world := shading.model.Mul4x1(mgl32.Vec4{vertex[0], vertex[1], vertex[2], 1.0})
+		normal := shading.normalMatrix.Mul3x1(mgl32.Vec3{vertex[6], vertex[7], vertex[8]})
+		out := &triangle[i%3]
+		out.clip = shading.viewProjection.Mul4x1(world)
+		out.varyings = [SOFTWARE_VARYINGS]float32{
+			world[0], world[1], world[2],
+			normal[0], normal[1], normal[2],
+			vertex[3], vertex[4], vertex[5],
+			vertex[9], vertex[10],
+		}
+
+		if i%3 == 2 {
+			backend.drawTriangle(shading, triangle)
+		}
+	}
+}
+
+// drawTriangle clips a triangle against the near and far planes and rasterizes what is left.
+func (backend *SoftwareBackend) drawTriangle(shading *softwareShading, triangle [3]softwareVertex) {
+	polygon := clipSoftwarePolygon(triangle[:], 1.0)
+	polygon = clipSoftwarePolygon(polygon, -1.0)
+	for i := 1; i+1 < len(polygon); i++ {
+		backend.rasterize(shading, polygon[0], polygon[i], polygon[i+1])
+	}
+}
+
+// clipSoftwarePolygon keeps the part of a convex polygon on the inside of the
+// near (side 1, z >= -w) or far (side -1, z <= w) plane in clip space.
+func clipSoftwarePolygon(polygon []softwareVertex, side float32) []softwareVertex {
+	distance := func(vertex *softwareVertex) float32 {
+		return side*vertex.clip[2] + vertex.clip[3]
+	}
+
+	clipped := make([]softwareVertex, 0, len(polygon)+1)
+	for i := range polygon {
+		current, next := &polygon[i], &polygon[(i+1)%len(polygon)]
+		currentDistance, nextDistance := distance(current), distance(next)
+		if currentDistance >= 0 {
+			clipped = append(clipped, *current)
+		}
+		if (currentDistance >= 0) != (nextDistance >= 0) {
+			// Attributes are linear in clip space, so the intersection is a plain lerp
+			t := currentDistance / (currentDistance - nextDistance)
+			vertex := softwareVertex{clip: current.clip.Add(next.clip.Sub(current.clip).Mul(t))}
+			for j := range vertex.varyings {
+				vertex.varyings[j] = current.varyings[j] + (next.varyings[j]-current.varyings[j])*t
+			}
+			clipped = append(clipped, vertex)
+		}
+	}
+	return clipped
+}
+
+// rasterize fills the pixels whose centers lie inside a triangle, testing and
+// writing depth and interpolating the varyings with perspective correction.
+func (backend *SoftwareBackend) rasterize(shading *softwareShading, a, b, c softwareVertex) {
+	vertices := [3]*softwareVertex{&a, &b, &c}
+	var screen [3]mgl32.Vec3 // Window x, y (origin bottom left) and depth
+	var inverseW [3]float32
+	for i, vertex := range vertices {
+		inverseW[i] = 1.0 / vertex.clip[3]
+		screen[i] = mgl32.Vec3{
+			(vertex.clip[0]*inverseW[i]*0.5 + 0.5) * float32(backend.width),
+			(vertex.clip[1]*inverseW[i]*0.5 + 0.5) * float32(backend.height),
+			vertex.clip[2]*inverseW[i]*0.5 + 0.5,
+		}
+	}
+
+	edge := func(from, to mgl32.Vec3, x, y float32) float32 {
+		return (to[0]-from[0])*(y-from[1]) - (to[1]-from[1])*(x-from[0])
+	}
+	area := edge(screen[0], screen[1], screen[2][0], screen[2][1])
+	if area == 0 || math.IsNaN(float64(area)) {
+		return
+	}
+
+	// Counter-clockwise triangles face the viewer, as in OpenGL
+	if backend.cull {
+		front := area > 0
+		if (backend.cullFace == gl.BACK && !front) || (backend.cullFace == gl.FRONT && front) {
+			return
+		}
+	}
+	backend.triangles++
+
+	minX := max(int(math.Floor(float64(min(screen[0][0], screen[1][0], screen[2][0])))), 0)
+	maxX := min(int(math.Ceil(float64(max(screen[0][0], screen[1][0], screen[2][0])))), backend.width-1)
+	minY := max(int(math.Floor(float64(min(screen[0][1], screen[1][1], screen[2][1])))), 0)
+	maxY := min(int(math.Ceil(float64(max(screen[0][1], screen[1][1], screen[2][1])))), backend.height-1)
+
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			centerX, centerY := float32(x)+0.5, float32(y)+0.5
+			weights := [3]float32{
+				edge(screen[1], screen[2], centerX, centerY) / area,
+				edge(screen[2], screen[0], centerX, centerY) / area,
+				edge(screen[0], screen[1], centerX, centerY) / area,
+			}
+			if weights[0] < 0 || weights[1] < 0 || weights[2] < 0 {
+				continue
+			}
+
+			// Depth is linear in window space
+			index := y*backend.width + x
+			depth := weights[0]*screen[0][2] + weights[1]*screen[1][2] + weights[2]*screen[2][2]
+			if backend.depthTest && !backend.depthPasses(depth, backend.depth[index]) {
+				continue
+			}
+
+			// Varyings are linear in clip space, divide by w to interpolate them
+			perspective := [3]float32{}
+			total := float32(0.0)
+			for i := range perspective {
+				perspective[i] = weights[i] * inverseW[i]
+				total += perspective[i]
+			}
+			varyings := [SOFTWARE_VARYINGS]float32{}
+			for j := range varyings {
+				varyings[j] = (perspective[0]*a.varyings[j] + perspective[1]*b.varyings[j] + perspective[2]*c.varyings[j]) / total
+			}
+
+			fragment, keep := shading.shade(&varyings)
+			if !keep {
+				continue
+			}
+			if backend.blend {
+				destination := backend.color[index]
+				sourceFactor := softwareBlendFactor(backend.blendSource, fragment[3])
+				destinationFactor := softwareBlendFactor(backend.blendDestination, fragment[3])
+				fragment = fragment.Mul(sourceFactor).Add(destination.Mul(destinationFactor))
+			}
+			backend.color[index] = fragment
+			// Like OpenGL, depth is only written while depth testing is on
+			if backend.depthTest && backend.depthWrite {
+				backend.depth[index] = depth
+			}
+			backend.fragments++
+		}
+	}
+}
+
+// depthPasses applies the depth comparison.
+func (backend *SoftwareBackend) depthPasses(depth, stored float32) bool {
+	switch backend.depthFunc {
+	case gl.LEQUAL:
+		return depth <= stored
+	case gl.ALWAYS:
+		return true
+	default:
+		return depth < stored
+	}
+}
+
+// softwareBlendFactor evaluates the blend factors used by the materials.
+func softwareBlendFactor(factor uint32, sourceAlpha float32) float32 {
+	switch factor {
+	case gl.ZERO:
+		return 0.0
+	case gl.SRC_ALPHA:
+		return sourceAlpha
+	case gl.ONE_MINUS_SRC_ALPHA:
+		return 1.0 - sourceAlpha
+	default:
+		return 1.0
+	}
+}
+
+// sample reads the texel at a texture coordinate with nearest filtering and
+// clamped coordinates, like the atlas is set up on the GPU.
+func (texture *softwareTexture) sample(u, v float32) mgl32.Vec4 {
+	x := min(max(int(math.Floor(float64(u*float32(texture.width)))), 0), texture.width-1)
+	y := min(max(int(math.Floor(float64(v*float32(texture.height)))), 0), texture.height-1)
+	texel := texture.pixels[(y*texture.width+x)*4:]
+	return mgl32.Vec4{float32(texel[0]), float32(texel[1]), float32(texel[2]), float32(texel[3])}.Mul(1.0 / 255.0)
+}
+
+// shade computes a fragment's color the way basic.glsl_frag does, without
+// shadows. Returns false for fragments the ALPHA_TEST variant discards.
+func (shading *softwareShading) shade(varyings *[SOFTWARE_VARYINGS]float32) (mgl32.Vec4, bool) {
+	position := mgl32.Vec3{varyings[0], varyings[1], varyings[2]}
+	normal := mgl32.Vec3{varyings[3], varyings[4], varyings[5]}
+	vertexColor := mgl32.Vec3{varyings[6], varyings[7], varyings[8]}
+
+	texColor := mgl32.Vec4{1.0, 1.0, 1.0, 1.0}
+	if shading.texture != nil {
+		texColor = shading.texture.sample(varyings[9], varyings[10])
+	}
+	if shading.alphaTest && texColor[3] < 0.5 {
+		return mgl32.Vec4{}, false
+	}
+
+	// lighting.glsl: ambient plus diffuse and Blinn-Phong specular
+	norm := softwareNormalize(normal)
+	viewDirection := softwareNormalize(shading.cameraPosition.Sub(position))
+	diffuse := shading.lightColor.Mul(max(norm.Dot(shading.lightDirection), 0.0) * shading.diffuseStrength)
+	halfway := softwareNormalize(shading.lightDirection.Add(viewDirection))
+	specular := float32(math.Pow(float64(max(norm.Dot(halfway), 0.0)), float64(shading.shininess)))
+	light := mgl32.Vec3{1.0, 1.0, 1.0}.Mul(shading.ambientStrength).
+		Add(diffuse).
+		Add(shading.lightColor.Mul(shading.specularStrength * specular))
+
+	result := mgl32.Vec3{
+		light[0] * texColor[0] * vertexColor[0],
+		light[1] * texColor[1] * vertexColor[1],
+		light[2] * texColor[2] * vertexColor[2],
+	}
+
+	// fog.glsl: fade into the fog color with the distance from the camera
+	if shading.withFog {
+		distance := shading.cameraPosition.Sub(position).Len()
+		factor := float32(1.0)
+		switch shading.fogMode {
+		case 1:
+			factor = mgl32.Clamp((shading.fogEnd-distance)/(shading.fogEnd-shading.fogStart), 0.0, 1.0)
+		case 2:
+			factor = mgl32.Clamp(float32(math.Exp(float64(-shading.fogDensity*distance))), 0.0, 1.0)
+		}
+		result = shading.fogColor.Add(result.Sub(shading.fogColor).Mul(factor))
+	}
+
+	alpha := float32(1.0)
+	if shading.translucent {
+		alpha = texColor[3] * shading.opacity
+	}
+	return result.Vec4(alpha), true
+}
+
+// softwareNormalize normalizes a vector, leaving zero vectors unchanged.
+func softwareNormalize(vector mgl32.Vec3) mgl32.Vec3 {
+	if length := vector.Len(); length > 0 {
+		return vector.Mul(1.0 / length)
+	}
+	return vector
+}
@@ -0,0 +1,188 @@
+// Implements a cache of the OpenGL pipeline state.
+// Every draw states the depth, blend, cull and polygon settings it needs as a
+// RenderState, and the cache only issues the GL calls for settings that differ
+// from what the context already has. Program and texture bindings go through
+// the cache as well, so it always knows the context's state.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+)
+
+// RenderState is the fixed-function state used by a draw.
+type RenderState struct {
+	depthTest        bool   // Test fragments against the depth buffer
+	depthFunc        uint32 // Depth comparison, e.g. gl.LESS
+	depthWrite       bool   // Write the depth of drawn fragments
+	blend            bool   // Blend fragments with the framebuffer
+	blendSource      uint32 // Source blend factor, e.g. gl.SRC_ALPHA
+	blendDestination uint32 // Destination blend factor, e.g. gl.ONE_MINUS_SRC_ALPHA
+	cull             bool   // Skip faces pointing in cullFace's direction
+	cullFace         uint32 // gl.BACK or gl.FRONT
+	wireframe        bool   // Draw polygon outlines instead of filled polygons
+}
+
+// RENDER_STATE_DEFAULT is the state of a new OpenGL context.
+var RENDER_STATE_DEFAULT = RenderState{
+	depthTest:        false,
+	depthFunc:        gl.LESS,
+	depthWrite:       true,
+	blend:            false,
+	blendSource:      gl.ONE,
+	blendDestination: gl.ZERO,
+	cull:             false,
+	cullFace:         gl.BACK,
+	wireframe:        false,
+}
+
+// RENDER_STATE_OPAQUE draws solid geometry with depth testing.
+var RENDER_STATE_OPAQUE = RenderState{
+	depthTest:        true,
+	depthFunc:        gl.LESS,
+	depthWrite:       true,
+	blendSource:      gl.ONE,
+	blendDestination: gl.ZERO,
+	cullFace:         gl.BACK,
+}
+
+// RENDER_STATE_FULLSCREEN draws full-screen passes that ignore the depth buffer.
+var RENDER_STATE_FULLSCREEN = RenderState{
+	depthFunc:        gl.LESS,
+	blendSource:      gl.ONE,
+	blendDestination: gl.ZERO,
+	cullFace:         gl.BACK,
+}
+
+// glTextureBinding identifies a texture binding point.
+type glTextureBinding struct {
+	unit   uint32 // Texture unit index
+	target uint32 // Texture target, e.g. gl.TEXTURE_2D
+}
+
+// GLStateCache remembers the state of the OpenGL context to skip redundant calls.
+// Must only be used from the main thread.
+type GLStateCache struct {
+	state      RenderState                 // Current fixed-function state
+	program    uint32                      // Program in use
+	activeUnit uint32                      // Active texture unit
+	textures   map[glTextureBinding]uint32 // Bound textures (missing entries are 0)
+	issued     int                         // GL calls made
+	skipped    int                         // GL calls avoided
+}
+
+// glState tracks the state of the window's OpenGL context.
+var glState = GLStateCache{state: RENDER_STATE_DEFAULT, textures: map[glTextureBinding]uint32{}}
+
+// Apply switches the context to a render state, changing only what differs.
+// Settings of disabled features (e.g. the blend factors while blending is off)
+// are left alone until the feature is enabled.
+// state: Required state
+func (cache *GLStateCache) Apply(state RenderState) {
+	current := &cache.state
+
+	if cache.changed(state.depthTest != current.depthTest) {
+		renderBackend.SetCapability(gl.DEPTH_TEST, state.depthTest)
+		current.depthTest = state.depthTest
+	}
+	if state.depthTest && cache.changed(state.depthFunc != current.depthFunc) {
+		renderBackend.DepthFunc(state.depthFunc)
+		current.depthFunc = state.depthFunc
+	}
+	if cache.changed(state.depthWrite != current.depthWrite) {
+		renderBackend.DepthMask(state.depthWrite)
+		current.depthWrite = state.depthWrite
+	}
+
+	if cache.changed(state.blend != current.blend) {
+		renderBackend.SetCapability(gl.BLEND, state.blend)
+		current.blend = state.blend
+	}
+	if state.blend && cache.changed(state.blendSource != current.blendSource ||
+		state.blendDestination != current.blendDestination) {
+		renderBackend.BlendFunc(state.blendSource, state.blendDestination)
+		current.blendSource, current.blendDestination = state.blendSource, state.blendDestination
+	}
+
+	if cache.changed(state.cull != current.cull) {
+		renderBackend.SetCapability(gl.CULL_FACE, state.cull)
+		current.cull = state.cull
+	}
+	if state.cull && cache.changed(state.cullFace != current.cullFace) {
+		renderBackend.CullFace(state.cullFace)
+		current.cullFace = state.cullFace
+	}
+
+	if cache.changed(state.wireframe != current.wireframe) {
+		renderBackend.PolygonMode(state.wireframe)
+		current.wireframe = state.wireframe
+	}
+}
+
+// UseProgram makes a program current unless it already is.
+// program: OpenGL program ID
+func (cache *GLStateCache) UseProgram(program uint32) {
+	if cache.changed(program != cache.program) {
+		renderBackend.UseProgram(program)
+		cache.program = program
+	}
+}
+
+// DeleteProgram deletes a program and forgets it if it was in use,
+// since OpenGL may hand out its ID again.
+// program: OpenGL program ID
+func (cache *GLStateCache) DeleteProgram(program uint32) {
+	renderBackend.DeleteProgram(program)
+	if cache.program == program {
+		cache.program = 0
+	}
+}
+
+// BindTexture binds a texture to a texture unit unless it already is.
+// The active texture unit is switched as needed.
+// unit: Texture unit index (0 for gl.TEXTURE0)
+// target: Texture target, e.g. gl.TEXTURE_2D
+// texture: OpenGL texture ID (0 unbinds)
+func (cache *GLStateCache) BindTexture(unit, target, texture uint32) {
+	binding := glTextureBinding{unit, target}
+	if !cache.changed(cache.textures[binding] != texture) {
+		return
+	}
+	if unit != cache.activeUnit {
+		renderBackend.ActiveTexture(unit)
+		cache.activeUnit = unit
+	}
+	renderBackend.BindTexture(target, texture)
+	cache.textures[binding] = texture
+}
+
+// DeleteTexture deletes a texture and clears the bindings that used it.
+// texture: OpenGL texture ID
+func (cache *GLStateCache) DeleteTexture(texture uint32) {
+	renderBackend.DeleteTexture(texture)
+	for binding, bound := range cache.textures {
+		if bound == texture {
+			delete(cache.textures, binding)
+		}
+	}
+}
+
+// Stats describes how many state changes were issued and skipped so far.
+func (cache *GLStateCache) Stats() string {
+	total := max(cache.issued+cache.skipped, 1)
+	return fmt.Sprintf("%d state changes issued, %d skipped (%.0f%%)",
+		cache.issued, cache.skipped, 100*float64(cache.skipped)/float64(total))
+}
+
+// changed counts a state change as issued or skipped and reports whether it is needed.
+// differs: Whether the requested value differs from the current one
+func (cache *GLStateCache) changed(differs bool) bool {
+	if differs {
+		cache.issued++
+	} else {
+		cache.skipped++
+	}
+	return differs
+}
@@ -1,150 +1,404 @@
 // Implements OpenGL shader program management.
 // The Shader struct handles compilation, linking, and uniform management
-// for GLSL vertex and fragment shaders.
+// for GLSL vertex and fragment shaders. Sources go through a small preprocessor
+// first, which resolves #include "file" directives and injects the #defines of
+// a shader variant; compiled variants are cached by their define set.
 
 package main
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"io/fs"
 	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-gl/gl/v3.3-core/gl"
-	"github.com/go-gl/mathgl/mgl32"
 )
 
 // Shader represents an OpenGL shader program consisting of vertex and fragment shaders.
 // It provides methods for loading, compiling, and setting uniform variables.
 type Shader struct {
-	ID uint32 // OpenGL shader program ID
+	ID           uint32    // OpenGL shader program ID
+	vertexFile   string    // Path of the vertex shader source
+	fragmentFile string    // Path of the fragment shader source
+	defines      []string  // Variant defines ("NAME" or "NAME=VALUE") injected into both stages
+	dependencies []string  // Every file read by the last compilation, including includes
+	modified     time.Time // Newest modification time of the sources when they were last compiled
+
+	uniforms map[string]*ShaderUniform // Active uniforms of the linked program by name
 }
 
-// Use activates this shader program for subsequent rendering calls.
-func (shader *Shader) Use() {
-	gl.UseProgram(shader.ID)
+// ShaderSource is a preprocessed shader ready to be compiled.
+type ShaderSource struct {
+	text      string          // Source text with includes resolved and defines injected
+	sourceMap ShaderSourceMap // Origin of every line of text
+	files     []string        // Files read, the main file first
+}
+
+// ShaderPreprocessor resolves #include directives and injects variant defines.
+// It only reads files and never touches OpenGL.
+type ShaderPreprocessor struct {
+	files fs.FS // File system sources and includes are read from
+}
+
+// shaderPreprocessState holds the progress of one Preprocess call.
+type shaderPreprocessState struct {
+	files     fs.FS           // File system sources are read from
+	output    strings.Builder // Preprocessed text so far
+	sourceMap ShaderSourceMap // Origin of every line written so far
+	included  map[string]bool // Files already included (each file is included once)
+	stack     []string        // Files currently being included, outermost first
+	read      []string        // Files read, in order
+}
+
+// shaderPreprocessor reads shader sources from the working directory.
+var shaderPreprocessor = ShaderPreprocessor{os.DirFS(".")}
+
+// shaderVariants caches the programs created by LoadShaderVariant by ShaderVariantKey.
+var shaderVariants = map[string]*Shader{}
+
+// ShaderSourceLine is the origin of one line of shader source handed to OpenGL.
+type ShaderSourceLine struct {
+	file string // Source file name
+	line int    // Line number in that file (1-based)
 }
 
-// UniformSetMat4 sets a mat4 (4x4 matrix) uniform in the shader program.
-// uniformName: Name of the uniform variable in the GLSL shader
-// mat4: Pointer to the 4x4 matrix to upload
-func (shader *Shader) UniformSetMat4(uniformName string, mat4 *mgl32.Mat4) {
-	uniform := gl.GetUniformLocation(shader.ID, GLString(uniformName))
-	gl.UniformMatrix4fv(uniform, 1, false, &mat4[0])
+// ShaderSourceMap maps the lines of compiled shader source (index 0 is line 1)
+// back to the files they came from.
+type ShaderSourceMap []ShaderSourceLine
+
+// ShaderCompileError is a failed shader compilation with the driver's log.
+type ShaderCompileError struct {
+	shaderType uint32 // gl.VERTEX_SHADER or gl.FRAGMENT_SHADER
+	log        string // Info log reported by the driver
 }
 
-// UniformSetVec3 sets a vec3 (3-component vector) uniform in the shader program.
-// uniformName: Name of the uniform variable in the GLSL shader
-// vec3: Pointer to the 3-component vector to upload
-func (shader *Shader) UniformSetVec3(uniformName string, vec3 *mgl32.Vec3) {
-	uniform := gl.GetUniformLocation(shader.ID, GLString(uniformName))
-	gl.Uniform3f(uniform, vec3[0], vec3[1], vec3[2])
+// Use activates this shader program for subsequent rendering calls.
+func (shader *Shader) Use() {
+	glState.UseProgram(shader.ID)
 }
 
 // LoadFile loads vertex and fragment shaders from files and compiles them into a program.
 // fileName: Base name of the shader files (without extension)
 // Expected files: fileName.glsl_vert (vertex shader) and fileName.glsl_frag (fragment shader)
 func (shader *Shader) LoadFile(fileName string) {
-	// Read vertex shader source code
-	content, err := os.ReadFile(fileName + ".glsl_vert")
+	shader.LoadFiles(fileName, fileName)
+}
+
+// LoadFiles loads a vertex and a fragment shader with different base names,
+// so several programs can share one vertex shader. The program is watched for
+// changes of its files and recompiled at runtime.
+// Panics if the first compilation fails, since there is no program to fall back to.
+// vertexFileName: Base name of the vertex shader file (loads vertexFileName.glsl_vert)
+// fragmentFileName: Base name of the fragment shader file (loads fragmentFileName.glsl_frag)
+func (shader *Shader) LoadFiles(vertexFileName, fragmentFileName string) {
+	shader.LoadVariant(vertexFileName, fragmentFileName)
+}
+
+// LoadVariant loads a vertex and a fragment shader compiled with extra defines.
+// Panics if the first compilation fails, since there is no program to fall back to.
+// vertexFileName: Base name of the vertex shader file (loads vertexFileName.glsl_vert)
+// fragmentFileName: Base name of the fragment shader file (loads fragmentFileName.glsl_frag)
+// defines: Defines injected after #version, either "NAME" or "NAME=VALUE"
+func (shader *Shader) LoadVariant(vertexFileName, fragmentFileName string, defines ...string) {
+	if err := shader.loadVariant(vertexFileName, fragmentFileName, defines); err != nil {
+		panic(err)
+	}
+}
+
+// loadVariant compiles a variant and starts watching its files.
+func (shader *Shader) loadVariant(vertexFileName, fragmentFileName string, defines []string) error {
+	shader.vertexFile = vertexFileName + ".glsl_vert"
+	shader.fragmentFile = fragmentFileName + ".glsl_frag"
+	shader.defines = defines
+
+	if err := shader.Reload(); err != nil {
+		return err
+	}
+	shaderWatcher.Watch(shader)
+	return nil
+}
+
+// ShaderVariantKey identifies a variant by its files and define set.
+// The order of the defines does not matter.
+func ShaderVariantKey(vertexFileName, fragmentFileName string, defines []string) string {
+	sorted := append([]string{}, defines...)
+	sort.Strings(sorted)
+	return vertexFileName + "|" + fragmentFileName + "|" + strings.Join(sorted, ",")
+}
+
+// LoadShaderVariant returns the program for a variant, compiling it only the
+// first time a define set is requested. Panics if the compilation fails.
+// vertexFileName: Base name of the vertex shader file
+// fragmentFileName: Base name of the fragment shader file
+// defines: Defines injected after #version, either "NAME" or "NAME=VALUE"
+func LoadShaderVariant(vertexFileName, fragmentFileName string, defines ...string) *Shader {
+	shader, err := GetShaderVariant(vertexFileName, fragmentFileName, defines...)
 	if err != nil {
-		log.Fatal(err)
+		panic(err)
+	}
+	return shader
+}
+
+// GetShaderVariant is LoadShaderVariant for callers that can recover from
+// compilation errors, e.g. when reloading data files at runtime.
+func GetShaderVariant(vertexFileName, fragmentFileName string, defines ...string) (*Shader, error) {
+	key := ShaderVariantKey(vertexFileName, fragmentFileName, defines)
+	if shader, cached := shaderVariants[key]; cached {
+		return shader, nil
+	}
+
+	shader := &Shader{}
+	if err := shader.loadVariant(vertexFileName, fragmentFileName, defines); err != nil {
+		return nil, err
+	}
+	shaderVariants[key] = shader
+	return shader, nil
+}
+
+// Name returns the source files (and defines) of the program for messages.
+func (shader *Shader) Name() string {
+	name := shader.vertexFile + " + " + shader.fragmentFile
+	if len(shader.defines) > 0 {
+		name += " [" + strings.Join(shader.defines, " ") + "]"
 	}
-	vertexShader := string(content)
+	return name
+}
+
+// SourceModified returns the newest modification time of the program's source
+// files, including the files they include. Files that cannot be read are ignored.
+func (shader *Shader) SourceModified() time.Time {
+	files := shader.dependencies
+	if len(files) == 0 {
+		files = []string{shader.vertexFile, shader.fragmentFile}
+	}
+
+	modified := time.Time{}
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err == nil && info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+	}
+	return modified
+}
 
-	// Read fragment shader source code
-	content, err = os.ReadFile(fileName + ".glsl_frag")
+// Reload reads the source files and recompiles the program. On failure the
+// previous program stays in use and the error lists the driver's messages
+// with file names and line numbers.
+func (shader *Shader) Reload() error {
+	shader.modified = shader.SourceModified()
+
+	// Resolve includes and inject the variant defines
+	vertexShader, err := shaderPreprocessor.Preprocess(shader.vertexFile, shader.defines)
+	if err != nil {
+		return err
+	}
+	fragmentShader, err := shaderPreprocessor.Preprocess(shader.fragmentFile, shader.defines)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	fragmentShader := string(content)
+
+	// Watch every file that went into the program from now on
+	shader.dependencies = append(append([]string{}, vertexShader.files...), fragmentShader.files...)
+	shader.modified = shader.SourceModified()
 
 	// Compile and link shaders into a program
-	program, err := shader.CompileSource(vertexShader, fragmentShader)
+	program, err := renderBackend.CompileProgram(vertexShader.text, fragmentShader.text)
+	if compileError := (*ShaderCompileError)(nil); errors.As(err, &compileError) {
+		file, sourceMap := shader.vertexFile, vertexShader.sourceMap
+		if compileError.shaderType == gl.FRAGMENT_SHADER {
+			file, sourceMap = shader.fragmentFile, fragmentShader.sourceMap
+		}
+		return fmt.Errorf("failed to compile %s:\n%s", file, MapShaderLog(compileError.log, sourceMap))
+	}
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("%s: %v", shader.Name(), err)
 	}
 
+	// Swap the new program in and release the old one
+	if shader.ID != 0 {
+		glState.DeleteProgram(shader.ID)
+	}
 	shader.ID = program
+
+	// Look up the uniforms once, locations change with every link
+	shader.uniforms = renderBackend.ProgramUniforms(program)
+	BindUniformBlocks(program)
+	return nil
 }
 
-// CompileSource compiles vertex and fragment shader source code and links them into a program.
-// vertexShaderSource: GLSL source code for the vertex shader
-// fragmentShaderSource: GLSL source code for the fragment shader
-// Returns: OpenGL program ID or error if compilation/linking fails
-func (shader *Shader) CompileSource(vertexShaderSource, fragmentShaderSource string) (uint32, error) {
-	// Compile vertex shader
-	vertexShader, err := shader.CompileShader(vertexShaderSource, gl.VERTEX_SHADER)
-	if err != nil {
-		return 0, err
+// Error formats the compile error with the raw driver log.
+func (err *ShaderCompileError) Error() string {
+	stage := "vertex"
+	if err.shaderType == gl.FRAGMENT_SHADER {
+		stage = "fragment"
 	}
+	return fmt.Sprintf("failed to compile %s shader: %v", stage, err.log)
+}
 
-	// Compile fragment shader
-	fragmentShader, err := shader.CompileShader(fragmentShaderSource, gl.FRAGMENT_SHADER)
-	if err != nil {
-		return 0, err
+// Lookup returns the file and line a compiled line number came from.
+// Unknown lines are returned unchanged with an empty file name.
+// line: Line number as reported by the driver (1-based)
+func (sourceMap ShaderSourceMap) Lookup(line int) (string, int) {
+	if line < 1 || line > len(sourceMap) {
+		return "", line
 	}
+	return sourceMap[line-1].file, sourceMap[line-1].line
+}
 
-	// Create shader program
-	program := gl.CreateProgram()
+// shaderLogLocation matches the location prefix of driver log lines:
+// "0:12(5): ..." (Mesa), "0(12) : ..." (NVIDIA) and "ERROR: 0:12: ..." (AMD, Intel).
+var shaderLogLocation = regexp.MustCompile(`^((?:ERROR|WARNING): )?\d+(?::|\()(\d+)\)?(?:\((\d+)\))?`)
 
-	// Attach shaders to program
-	gl.AttachShader(program, vertexShader)
-	gl.AttachShader(program, fragmentShader)
+// MapShaderLog rewrites the locations in a driver log to "file:line" (or "file:line:column").
+// Lines without a recognized location are kept as they are.
+// log: Info log reported by the driver
+// sourceMap: Origin of each line of the compiled source
+func MapShaderLog(log string, sourceMap ShaderSourceMap) string {
+	lines := strings.Split(strings.TrimSpace(log), "\n")
+	for i, line := range lines {
+		match := shaderLogLocation.FindStringSubmatchIndex(line)
+		if match == nil {
+			continue
+		}
 
-	// Link program (combines shaders into executable)
-	gl.LinkProgram(program)
+		lineNumber, _ := strconv.Atoi(line[match[4]:match[5]])
+		file, fileLine := sourceMap.Lookup(lineNumber)
+		if file == "" {
+			continue
+		}
 
-	// Check linking status
-	var status int32
-	gl.GetProgramiv(program, gl.LINK_STATUS, &status)
-	if status == gl.FALSE {
-		// Get error log
-		var logLength int32
-		gl.GetProgramiv(program, gl.INFO_LOG_LENGTH, &logLength)
+		location := fmt.Sprintf("%s:%d", file, fileLine)
+		if match[6] >= 0 {
+			location += ":" + line[match[6]:match[7]]
+		}
+		prefix := ""
+		if match[2] >= 0 {
+			prefix = line[match[2]:match[3]]
+		}
+		lines[i] = prefix + location + line[match[1]:]
+	}
+	return strings.Join(lines, "\n")
+}
 
-		log := strings.Repeat("\x00", int(logLength+1))
-		gl.GetProgramInfoLog(program, logLength, nil, gl.Str(log))
+// Preprocess reads a shader file and resolves its #include "file" directives.
+// Include paths are relative to the including file. Every file is included at
+// most once (an automatic include guard, "#pragma once" is accepted as well),
+// and a file including itself through any chain is reported as a cycle.
+// The defines are inserted right after the #version line.
+// file: Path of the main shader file
+// defines: Defines to inject, either "NAME" or "NAME=VALUE"
+func (preprocessor *ShaderPreprocessor) Preprocess(file string, defines []string) (ShaderSource, error) {
+	state := shaderPreprocessState{files: preprocessor.files, included: map[string]bool{}}
 
-		return 0, fmt.Errorf("failed to link program: %v", log)
+	defineLines := make([]string, 0, len(defines))
+	for _, define := range defines {
+		name, value, _ := strings.Cut(define, "=")
+		if !shaderIdentifier.MatchString(name) {
+			return ShaderSource{}, fmt.Errorf("%s: invalid define %q", file, define)
+		}
+		defineLines = append(defineLines, strings.TrimSpace("#define "+name+" "+value))
 	}
 
-	// Clean up individual shaders (they're now part of the program)
-	gl.DeleteShader(vertexShader)
-	gl.DeleteShader(fragmentShader)
+	if err := state.include(path.Clean(file), defineLines); err != nil {
+		return ShaderSource{}, err
+	}
+	return ShaderSource{state.output.String(), state.sourceMap, state.read}, nil
+}
+
+// shaderIdentifier matches valid names for defines.
+var shaderIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// shaderIncludeDirective matches an include line and captures the file name.
+var shaderIncludeDirective = regexp.MustCompile(`^\s*#\s*include\s+"([^"]+)"\s*(//.*)?$`)
 
-	return program, nil
+// writeLine appends one line to the output and records where it came from.
+func (state *shaderPreprocessState) writeLine(text, file string, line int) {
+	state.output.WriteString(text)
+	state.output.WriteString("\n")
+	state.sourceMap = append(state.sourceMap, ShaderSourceLine{file, line})
 }
 
-// CompileShader compiles a single shader from source code.
-// source: GLSL source code for the shader
-// shaderType: Type of shader (gl.VERTEX_SHADER, gl.FRAGMENT_SHADER, etc.)
-// Returns: OpenGL shader ID or error if compilation fails
-func (shaderObj *Shader) CompileShader(source string, shaderType uint32) (uint32, error) {
-	// Create shader object
-	shader := gl.CreateShader(shaderType)
+// include writes a file to the output, recursing into its includes.
+// file: Cleaned path of the file
+// defineLines: Define lines to write after #version (only passed for the main file)
+func (state *shaderPreprocessState) include(file string, defineLines []string) error {
+	content, err := fs.ReadFile(state.files, file)
+	if err != nil {
+		return fmt.Errorf("failed to read shader %q: %v", file, err)
+	}
+	state.included[file] = true
+	state.read = append(state.read, file)
+	state.stack = append(state.stack, file)
+	defer func() { state.stack = state.stack[:len(state.stack)-1] }()
 
-	// Upload source code to GPU
-	csources, free := gl.Strs(source)
-	gl.ShaderSource(shader, 1, csources, nil)
-	free() // Free C strings
+	lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+
+	// Defines must follow #version, which has to come first.
+	// Sources without a #version line get them at the top.
+	isMain := len(state.stack) == 1
+	hasVersion := false
+	for _, text := range lines {
+		hasVersion = hasVersion || strings.HasPrefix(strings.TrimSpace(text), "#version")
+	}
+	if isMain && !hasVersion {
+		state.writeDefines(defineLines)
+	}
 
-	// Compile shader
-	gl.CompileShader(shader)
+	for i, text := range lines {
+		text = strings.TrimRight(text, "\r")
+		lineNumber := i + 1
+		directive := strings.TrimSpace(text)
 
-	// Check compilation status
-	var status int32
-	gl.GetShaderiv(shader, gl.COMPILE_STATUS, &status)
-	if status == gl.FALSE {
-		// Get compilation error log
-		var logLength int32
-		gl.GetShaderiv(shader, gl.INFO_LOG_LENGTH, &logLength)
+		switch {
+		case strings.HasPrefix(directive, "#version"):
+			if !isMain {
+				return fmt.Errorf("%s:%d: #version is only allowed in the main shader file", file, lineNumber)
+			}
+			state.writeLine(text, file, lineNumber)
+			state.writeDefines(defineLines)
+			continue
+		case directive == "#pragma once":
+			continue
+		}
 
-		log := strings.Repeat("\x00", int(logLength+1))
-		gl.GetShaderInfoLog(shader, logLength, nil, gl.Str(log))
+		match := shaderIncludeDirective.FindStringSubmatch(text)
+		if match == nil {
+			if strings.HasPrefix(directive, "#include") {
+				return fmt.Errorf("%s:%d: malformed #include, expected #include \"file\"", file, lineNumber)
+			}
+			state.writeLine(text, file, lineNumber)
+			continue
+		}
 
-		return 0, fmt.Errorf("failed to compile shader (type %v): %v", shaderType, log)
+		// Resolve relative to the including file
+		includeFile := path.Join(path.Dir(file), match[1])
+		for j, open := range state.stack {
+			if open == includeFile {
+				chain := append(append([]string{}, state.stack[j:]...), includeFile)
+				return fmt.Errorf("%s:%d: include cycle: %s", file, lineNumber, strings.Join(chain, " -> "))
+			}
+		}
+		if state.included[includeFile] {
+			continue
+		}
+		if err := state.include(includeFile, nil); err != nil {
+			return fmt.Errorf("%v\n  included from %s:%d", err, file, lineNumber)
+		}
 	}
+	return nil
+}
 
-	return shader, nil
+// writeDefines appends the variant define lines to the output.
+func (state *shaderPreprocessState) writeDefines(defineLines []string) {
+	for i, define := range defineLines {
+		state.writeLine(define, "<defines>", i+1)
+	}
 }
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// testShaderFiles holds a main shader with nested includes, a file included
+// twice and a file guarded with #pragma once.
+var testShaderFiles = fstest.MapFS{
+	"main.glsl":       {Data: []byte("#version 330 core\n#include \"lib/a.glsl\"\n#include \"lib/c.glsl\"\nvoid main() {}\n")},
+	"lib/a.glsl":      {Data: []byte("#include \"b.glsl\"\nfloat a;\n")},
+	"lib/b.glsl":      {Data: []byte("#pragma once\nfloat b;\n")},
+	"lib/c.glsl":      {Data: []byte("#include \"a.glsl\"\n#include \"b.glsl\"\nfloat c;\n")},
+	"cycle/main.glsl": {Data: []byte("#version 330 core\n#include \"a.glsl\"\n")},
+	"cycle/a.glsl":    {Data: []byte("#include \"b.glsl\"\n")},
+	"cycle/b.glsl":    {Data: []byte("#include \"a.glsl\"\n")},
+	"late.glsl":       {Data: []byte("// Comment before the version\n#version 330 core\nvoid main() {}\n")},
+}
+
+// TestShaderPreprocessIncludes checks that nested includes are resolved
+// relative to the including file and that every file is included once.
+func TestShaderPreprocessIncludes(t *testing.T) {
+	preprocessor := ShaderPreprocessor{testShaderFiles}
+	source, err := preprocessor.Preprocess("main.glsl", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "#version 330 core\nfloat b;\nfloat a;\nfloat c;\nvoid main() {}\n"
+	if source.text != expected {
+		t.Errorf("text %q, expected %q", source.text, expected)
+	}
+	files := []string{"main.glsl", "lib/a.glsl", "lib/b.glsl", "lib/c.glsl"}
+	if !reflect.DeepEqual(source.files, files) {
+		t.Errorf("files %v, expected %v", source.files, files)
+	}
+
+	// Every output line points back to its file and line
+	lines := []ShaderSourceLine{{"main.glsl", 1}, {"lib/b.glsl", 2}, {"lib/a.glsl", 2}, {"lib/c.glsl", 3}, {"main.glsl", 4}}
+	for i, line := range lines {
+		if file, number := source.sourceMap.Lookup(i + 1); file != line.file || number != line.line {
+			t.Errorf("line %d maps to %s:%d, expected %s:%d", i+1, file, number, line.file, line.line)
+		}
+	}
+}
+
+// TestShaderPreprocessCycle checks that an include cycle is reported with its chain.
+func TestShaderPreprocessCycle(t *testing.T) {
+	preprocessor := ShaderPreprocessor{testShaderFiles}
+	_, err := preprocessor.Preprocess("cycle/main.glsl", nil)
+	if err == nil {
+		t.Fatal("include cycle accepted")
+	}
+	chain := "cycle/b.glsl:1: include cycle: cycle/a.glsl -> cycle/b.glsl -> cycle/a.glsl"
+	if !strings.HasPrefix(err.Error(), chain) {
+		t.Errorf("error %q does not start with %q", err, chain)
+	}
+	if !strings.Contains(err.Error(), "included from cycle/main.glsl:2") {
+		t.Errorf("error %q does not name the main file", err)
+	}
+}
+
+// TestShaderPreprocessDefines checks that defines go right after #version,
+// even when the version line is not the first line.
+func TestShaderPreprocessDefines(t *testing.T) {
+	preprocessor := ShaderPreprocessor{testShaderFiles}
+	source, err := preprocessor.Preprocess("late.glsl", []string{"WITH_FOG", "CASCADES=4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "// Comment before the version\n#version 330 core\n#define WITH_FOG\n#define CASCADES 4\nvoid main() {}\n"
+	if source.text != expected {
+		t.Errorf("text %q, expected %q", source.text, expected)
+	}
+	if file, line := source.sourceMap.Lookup(4); file != "<defines>" || line != 2 {
+		t.Errorf("line 4 maps to %s:%d, expected <defines>:2", file, line)
+	}
+	if file, line := source.sourceMap.Lookup(5); file != "late.glsl" || line != 3 {
+		t.Errorf("line 5 maps to %s:%d, expected late.glsl:3", file, line)
+	}
+
+	if _, err := preprocessor.Preprocess("late.glsl", []string{"1BAD"}); err == nil {
+		t.Errorf("invalid define accepted")
+	}
+}
+
+// TestMapShaderLog checks that Mesa, NVIDIA and AMD log locations are mapped
+// back to the source files.
+func TestMapShaderLog(t *testing.T) {
+	preprocessor := ShaderPreprocessor{testShaderFiles}
+	source, err := preprocessor.Preprocess("main.glsl", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		log      string // Driver log line
+		expected string // Log line after mapping
+	}{
+		{"0:2(5): error: syntax error", "lib/b.glsl:2:5: error: syntax error"},
+		{"0(3) : error C0000: syntax error", "lib/a.glsl:2 : error C0000: syntax error"},
+		{"ERROR: 0:5: 'x' : undeclared identifier", "ERROR: main.glsl:4: 'x' : undeclared identifier"},
+		{"WARNING: 0:4: unused variable", "WARNING: lib/c.glsl:3: unused variable"},
+		{"0:99(1): error: past the end", "0:99(1): error: past the end"},
+		{"link failed", "link failed"},
+	}
+	for _, testCase := range cases {
+		if mapped := MapShaderLog(testCase.log, source.sourceMap); mapped != testCase.expected {
+			t.Errorf("%q mapped to %q, expected %q", testCase.log, mapped, testCase.expected)
+		}
+	}
+}
+
+// TestShaderVariantKey checks that the variant key ignores the define order.
+func TestShaderVariantKey(t *testing.T) {
+	a := ShaderVariantKey("basic", "basic", []string{"WITH_FOG", "ALPHA_TEST"})
+	b := ShaderVariantKey("basic", "basic", []string{"ALPHA_TEST", "WITH_FOG"})
+	if a != b {
+		t.Errorf("keys %q and %q differ", a, b)
+	}
+	if a == ShaderVariantKey("basic", "basic", []string{"WITH_FOG"}) {
+		t.Errorf("different define sets share the key %q", a)
+	}
+	if a == ShaderVariantKey("basic", "sky", []string{"WITH_FOG", "ALPHA_TEST"}) {
+		t.Errorf("different files share the key %q", a)
+	}
+}
@@ -0,0 +1,95 @@
+// Implements hot reloading of shader programs.
+// Every program loaded from files is registered with the shader watcher, which
+// polls the modification times of the source files and recompiles programs whose
+// files changed. A failed compilation keeps the last good program running.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SHADER_POLL_INTERVAL is the time between two checks of the shader files.
+const SHADER_POLL_INTERVAL = 500 * time.Millisecond
+
+// ShaderWatcher recompiles shader programs when their source files change.
+// Must only be used from the main thread, since reloading compiles GL programs.
+type ShaderWatcher struct {
+	shaders  []*Shader // Programs loaded from files
+	enabled  bool      // Poll for changes at all
+	lastPoll time.Time // Time of the last check
+}
+
+// shaderWatcher watches every program loaded with Shader.LoadFile or Shader.LoadFiles.
+var shaderWatcher = ShaderWatcher{enabled: true}
+
+// Watch adds a program to the watch list.
+// shader: Program with source files (must stay at the same address)
+func (watcher *ShaderWatcher) Watch(shader *Shader) {
+	watcher.shaders = append(watcher.shaders, shader)
+}
+
+// Poll reloads the programs whose source files changed since they were compiled.
+// Checks the files at most every SHADER_POLL_INTERVAL; called once per frame.
+func (watcher *ShaderWatcher) Poll() {
+	if !watcher.enabled || time.Since(watcher.lastPoll) < SHADER_POLL_INTERVAL {
+		return
+	}
+	watcher.lastPoll = time.Now()
+
+	for _, shader := range watcher.shaders {
+		if shader.SourceModified().After(shader.modified) {
+			watcher.reload(shader)
+		}
+	}
+}
+
+// ReloadAll recompiles every watched program, changed or not.
+// Returns the number of programs that failed to compile.
+func (watcher *ShaderWatcher) ReloadAll() int {
+	failed := 0
+	for _, shader := range watcher.shaders {
+		if !watcher.reload(shader) {
+			failed++
+		}
+	}
+	return failed
+}
+
+// reload recompiles one program and prints the outcome.
+// Returns whether the new program is in use.
+func (watcher *ShaderWatcher) reload(shader *Shader) bool {
+	if err := shader.Reload(); err != nil {
+		fmt.Printf("%v\nkeeping the previous program\n", err)
+		return false
+	}
+	fmt.Println("reloaded", shader.Name())
+	return true
+}
+
+// RegisterCommands adds the "shaders" command to a registry.
+func (watcher *ShaderWatcher) RegisterCommands(registry *CommandRegistry) {
+	registry.Register("shaders", "shaders <reload | watch <on|off> | uniforms>", func(args []string) (string, error) {
+		switch {
+		case len(args) == 1 && args[0] == "uniforms":
+			lines := []string{}
+			for _, shader := range watcher.shaders {
+				lines = append(lines, shader.Name())
+				for _, uniform := range shader.Uniforms() {
+					lines = append(lines, "  "+uniform.String())
+				}
+			}
+			return strings.Join(lines, "\n"), nil
+		case len(args) == 1 && args[0] == "reload":
+			failed := watcher.ReloadAll()
+			return fmt.Sprintf("%d programs reloaded, %d failed", len(watcher.shaders)-failed, failed), nil
+		case len(args) == 2 && args[0] == "watch" && (args[1] == "on" || args[1] == "off"):
+			watcher.enabled = args[1] == "on"
+			return fmt.Sprintf("watching %d programs: %v", len(watcher.shaders), watcher.enabled), nil
+		default:
+			return "", fmt.Errorf("expected reload, watch on|off or uniforms")
+		}
+	})
+}
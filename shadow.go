@@ -0,0 +1,303 @@
+// Implements cascaded shadow maps for the directional sun (or moon) light.
+// The camera frustum is split into several depth ranges (cascades). Each cascade
+// gets its own orthographic view from the light, rendered depth-only into one layer
+// of a depth texture array. basic.glsl_frag picks the cascade by view depth and
+// filters the shadow with PCF. Only GL 3.3 core features are used, so it also
+// runs on software drivers like Mesa's llvmpipe.
+
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// Shadow constants.
+const (
+	SHADOW_MAX_CASCADES   = 4     // Must match the array sizes in shadows.glsl
+	SHADOW_CASTER_MARGIN  = 128.0 // Extra depth behind each cascade so off-screen terrain still casts shadows
+	SHADOW_TEXTURE_UNIT   = 8     // Texture unit the shadow map is bound to (units below belong to materials)
+	SHADOW_MIN_RESOLUTION = 256   // Smallest accepted shadow map resolution
+	SHADOW_MAX_RESOLUTION = 8192  // Largest accepted shadow map resolution
+)
+
+// ShadowSettings holds the user-configurable shadow parameters.
+type ShadowSettings struct {
+	enabled      bool    // Render and sample shadows at all
+	cascadeCount int     // Number of cascades (1 to SHADOW_MAX_CASCADES)
+	resolution   int32   // Width and height of each cascade's depth map in texels
+	distance     float32 // View distance covered by all cascades together
+	splitLambda  float32 // Blend between uniform (0) and logarithmic (1) cascade splits
+	pcfRadius    int32   // PCF kernel radius in texels (1 = 3x3 samples)
+	depthBias    float32 // Constant depth bias in light clip space
+	normalOffset float32 // World-space offset along the normal before the lookup
+}
+
+// ShadowMap owns the GL resources of the shadow pass and the per-frame cascade data.
+type ShadowMap struct {
+	settings        ShadowSettings                  // Current configuration
+	shader          Shader                          // Depth-only shader (shadow.glsl_vert / shadow.glsl_frag)
+	framebuffer     uint32                          // FBO the cascades are rendered into
+	depthTexture    uint32                          // Depth texture array, one layer per cascade
+	allocatedLayers int                             // Cascade count the texture was allocated for
+	allocatedSize   int32                           // Resolution the texture was allocated for
+	matrices        [SHADOW_MAX_CASCADES]mgl32.Mat4 // Light view-projection matrix of each cascade
+	splits          [SHADOW_MAX_CASCADES]float32    // Far view depth of each cascade
+}
+
+// InitializeDefaultValues sets up four 2048x2048 cascades over 160 blocks.
+func (settings *ShadowSettings) InitializeDefaultValues() {
+	settings.enabled = true
+	settings.cascadeCount = 4
+	settings.resolution = 2048
+	settings.distance = 160.0
+	settings.splitLambda = 0.75
+	settings.pcfRadius = 1
+	settings.depthBias = 0.001
+	settings.normalOffset = 0.05
+}
+
+// Initialize loads the depth shader and allocates the shadow map.
+func (shadowMap *ShadowMap) Initialize() {
+	shadowMap.settings.InitializeDefaultValues()
+	shadowMap.shader.LoadFile("shadow")
+	framebuffer, err := renderBackend.CreateFramebuffer(0, 0)
+	if err != nil {
+		panic(fmt.Errorf("shadow map: %v", err))
+	}
+	shadowMap.framebuffer = framebuffer
+	shadowMap.allocate()
+}
+
+// allocate (re)creates the depth texture array when the cascade count
+// or resolution changed since the last allocation.
+func (shadowMap *ShadowMap) allocate() {
+	settings := &shadowMap.settings
+	if shadowMap.depthTexture != 0 &&
+		shadowMap.allocatedLayers == settings.cascadeCount &&
+		shadowMap.allocatedSize == settings.resolution {
+		return
+	}
+
+	if shadowMap.depthTexture != 0 {
+		glState.DeleteTexture(shadowMap.depthTexture)
+	}
+
+	// Linear filtering with compare mode gives free 2x2 PCF on most hardware
+	shadowMap.depthTexture = renderBackend.CreateTexture(TextureDescription{
+		target:  gl.TEXTURE_2D_ARRAY,
+		width:   int(settings.resolution),
+		height:  int(settings.resolution),
+		layers:  settings.cascadeCount,
+		format:  TEXTURE_FORMAT_DEPTH24,
+		linear:  true,
+		compare: true,
+	})
+
+	shadowMap.allocatedLayers = settings.cascadeCount
+	shadowMap.allocatedSize = settings.resolution
+}
+
+// computeSplits divides [near, distance] into cascades using the "practical split
+// scheme": a blend of logarithmic splits (good close up) and uniform splits.
+// near: Camera near plane
+func (shadowMap *ShadowMap) computeSplits(near float32) {
+	settings := &shadowMap.settings
+	far := settings.distance
+	count := float32(settings.cascadeCount)
+
+	// A tiny near plane would make the first logarithmic cascade uselessly small
+	near = max(near, 1.0)
+
+	for i := range settings.cascadeCount {
+		fraction := float32(i+1) / count
+		logarithmic := near * float32(math.Pow(float64(far/near), float64(fraction)))
+		uniform := near + (far-near)*fraction
+		shadowMap.splits[i] = settings.splitLambda*logarithmic + (1.0-settings.splitLambda)*uniform
+	}
+}
+
+// fitCascade builds the light view-projection matrix that covers the part of the
+// camera frustum between splitNear and splitFar. The cascade is fitted to the bounding
+// sphere of the slice and snapped to whole texels, so shadows do not shimmer
+// when the camera rotates or moves. Like everything drawn, the matrix works on
+// camera-relative positions.
+func (shadowMap *ShadowMap) fitCascade(camera *Camera, aspect, splitNear, splitFar float32, lightDirection mgl32.Vec3) mgl32.Mat4 {
+	// Corners of the frustum slice relative to the camera
+	projection := mgl32.Perspective(mgl32.DegToRad(camera.FOV), aspect, splitNear, splitFar)
+	inverse := projection.Mul4(camera.GetViewMatrix()).Inv()
+	corners := [8]mgl32.Vec3{}
+	center := mgl32.Vec3{}
+	for i := range 8 {
+		ndc := mgl32.Vec4{
+			float32(i&1)*2.0 - 1.0,
+			float32((i>>1)&1)*2.0 - 1.0,
+			float32((i>>2)&1)*2.0 - 1.0,
+			1.0,
+		}
+		corner := inverse.Mul4x1(ndc)
+		corners[i] = corner.Vec3().Mul(1.0 / corner[3])
+		center = center.Add(corners[i])
+	}
+	center = center.Mul(1.0 / 8.0)
+
+	// Bounding sphere radius, rounded up so it stays constant while rotating
+	radius := float32(0.0)
+	for _, corner := range corners {
+		radius = max(radius, corner.Sub(center).Len())
+	}
+	radius = float32(math.Ceil(float64(radius)))
+
+	// Look at the slice from the light, avoiding a degenerate up vector at noon
+	up := mgl32.Vec3{0.0, 1.0, 0.0}
+	if mgl32.Abs(lightDirection[1]) > 0.99 {
+		up = mgl32.Vec3{0.0, 0.0, 1.0}
+	}
+	eye := center.Add(lightDirection.Mul(radius + SHADOW_CASTER_MARGIN))
+	lightView := mgl32.LookAtV(eye, center, up)
+	lightProjection := mgl32.Ortho(-radius, radius, -radius, radius, 0.0, 2.0*radius+SHADOW_CASTER_MARGIN)
+	lightMatrix := lightProjection.Mul4(lightView)
+
+	// Snap the world origin to the texel grid and shift the projection by the rounding error.
+	// The origin is far away from a distant camera, so it is projected in float64
+	texelsPerUnit := float64(shadowMap.settings.resolution) / 2.0
+	lightMatrix64 := mgl64.Mat4{}
+	for i, value := range lightMatrix {
+		lightMatrix64[i] = float64(value)
+	}
+	origin := lightMatrix64.Mul4x1(camera.position.Mul(-1.0).Vec4(1.0))
+	snapX := math.Round(origin[0]*texelsPerUnit)/texelsPerUnit - origin[0]
+	snapY := math.Round(origin[1]*texelsPerUnit)/texelsPerUnit - origin[1]
+	lightProjection = mgl32.Translate3D(float32(snapX), float32(snapY), 0.0).Mul4(lightProjection)
+
+	return lightProjection.Mul4(lightView)
+}
+
+// Render draws the depth of the chunks inside each cascade's box into the cascade.
+// camera: Camera whose frustum the cascades cover
+// aspect: Viewport aspect ratio
+// near: Camera near plane
+// lightDirection: Direction TO the light (normalized)
+// gameWorld: World whose chunks cast shadows
+func (shadowMap *ShadowMap) Render(camera *Camera, aspect, near float32, lightDirection mgl32.Vec3, gameWorld *GameWorld) {
+	settings := &shadowMap.settings
+	if !settings.enabled {
+		return
+	}
+	shadowMap.allocate()
+	shadowMap.computeSplits(near)
+
+	shadowMap.shader.Use()
+
+	// Remember the caller's render target so it can be restored afterwards
+	previousFramebuffer := renderBackend.DrawFramebuffer()
+
+	renderBackend.BindFramebuffer(shadowMap.framebuffer)
+	renderBackend.Viewport(0, 0, int(settings.resolution), int(settings.resolution))
+	glState.Apply(RENDER_STATE_OPAQUE)
+
+	// Slope-scaled offset against shadow acne on surfaces facing away from the light
+	renderBackend.SetCapability(gl.POLYGON_OFFSET_FILL, true)
+	renderBackend.PolygonOffset(1.5, 2.0)
+
+	splitNear := near
+	for cascade := range settings.cascadeCount {
+		splitFar := shadowMap.splits[cascade]
+		shadowMap.matrices[cascade] = shadowMap.fitCascade(camera, aspect, splitNear, splitFar, lightDirection)
+		splitNear = splitFar
+
+		renderBackend.AttachDepthLayer(shadowMap.framebuffer, shadowMap.depthTexture, cascade)
+		renderBackend.Clear(gl.DEPTH_BUFFER_BIT, mgl32.Vec4{})
+		shadowMap.shader.UniformSetMat4("lightSpaceMatrix", &shadowMap.matrices[cascade])
+		gameWorld.RenderInBox(&shadowMap.shader, shadowMap.matrices[cascade])
+	}
+
+	renderBackend.SetCapability(gl.POLYGON_OFFSET_FILL, false)
+	renderBackend.BindFramebuffer(previousFramebuffer)
+}
+
+// AssignUniforms binds the shadow map and uploads the cascade data to a shader.
+// shader: Active shader program using the shadow uniforms
+func (shadowMap *ShadowMap) AssignUniforms(shader *Shader) {
+	settings := &shadowMap.settings
+
+	glState.BindTexture(SHADOW_TEXTURE_UNIT, gl.TEXTURE_2D_ARRAY, shadowMap.depthTexture)
+	shader.UniformSetSampler("shadowMap", SHADOW_TEXTURE_UNIT)
+
+	cascadeCount := int32(settings.cascadeCount)
+	if !settings.enabled {
+		cascadeCount = 0
+	}
+	shader.UniformSetInt("shadowCascadeCount", cascadeCount)
+	shader.UniformSetMat4Array("shadowMatrices", shadowMap.matrices[:])
+	shader.UniformSetFloatArray("shadowSplits", shadowMap.splits[:])
+	shader.UniformSetInt("shadowPCFRadius", settings.pcfRadius)
+	shader.UniformSetFloat("shadowDepthBias", settings.depthBias)
+	shader.UniformSetFloat("shadowNormalOffset", settings.normalOffset)
+}
+
+// RegisterCommands adds the "shadows" command to a registry.
+func (shadowMap *ShadowMap) RegisterCommands(registry *CommandRegistry) {
+	registry.Register(
+		"shadows",
+		"shadows <on | off | cascades <1-4> | resolution <texels> | distance <blocks> | pcf <radius>>",
+		func(args []string) (string, error) {
+			settings := &shadowMap.settings
+			if len(args) == 0 {
+				return "", fmt.Errorf("missing subcommand")
+			}
+
+			switch args[0] {
+			case "on":
+				settings.enabled = true
+			case "off":
+				settings.enabled = false
+			case "cascades", "resolution", "distance", "pcf":
+				if len(args) != 2 {
+					return "", fmt.Errorf("%s expects one value", args[0])
+				}
+				value, err := parseFiniteFloat(args[1])
+				if err != nil {
+					return "", err
+				}
+				if args[0] != "distance" && value != math.Trunc(value) {
+					return "", fmt.Errorf("%s must be a whole number", args[0])
+				}
+
+				switch args[0] {
+				case "cascades":
+					if value < 1 || value > SHADOW_MAX_CASCADES {
+						return "", fmt.Errorf("cascades must be between 1 and %d", SHADOW_MAX_CASCADES)
+					}
+					settings.cascadeCount = int(value)
+				case "resolution":
+					if value < SHADOW_MIN_RESOLUTION || value > SHADOW_MAX_RESOLUTION {
+						return "", fmt.Errorf("resolution must be between %d and %d",
+							SHADOW_MIN_RESOLUTION, SHADOW_MAX_RESOLUTION)
+					}
+					settings.resolution = int32(value)
+				case "distance":
+					if value <= 1 {
+						return "", fmt.Errorf("distance must be greater than 1")
+					}
+					settings.distance = float32(value)
+				case "pcf":
+					if value < 0 || value > 3 {
+						return "", fmt.Errorf("pcf radius must be between 0 and 3")
+					}
+					settings.pcfRadius = int32(value)
+				}
+			default:
+				return "", fmt.Errorf("unknown subcommand %q", args[0])
+			}
+
+			return fmt.Sprintf("shadows %v, %d cascades, %dx%d, distance %g, pcf %d",
+				settings.enabled, settings.cascadeCount, settings.resolution, settings.resolution,
+				settings.distance, settings.pcfRadius), nil
+		},
+	)
+}
@@ -0,0 +1,58 @@
+// Cascaded shadow maps (see shadow.go)
+#pragma once
+
+uniform sampler2DArrayShadow shadowMap;
+uniform int shadowCascadeCount; // 0 disables shadows
+uniform mat4 shadowMatrices[4];
+uniform float shadowSplits[4]; // Far view depth of each cascade
+uniform int shadowPCFRadius;
+uniform float shadowDepthBias;
+uniform float shadowNormalOffset;
+
+// Returns how much of the light reaches a point (1 = fully lit)
+// position: World position of the point
+// norm: Normalized surface normal
+// viewDepth: Distance of the point along the camera's view direction
+float computeShadow(vec3 position, vec3 norm, float viewDepth) {
+    if (shadowCascadeCount == 0) {
+        return 1.0;
+    }
+
+    // Pick the first cascade whose range contains this point
+    int cascade = -1;
+    for (int i = 0; i < shadowCascadeCount; i++) {
+        if (viewDepth < shadowSplits[i]) {
+            cascade = i;
+            break;
+        }
+    }
+    if (cascade < 0) {
+        return 1.0;
+    }
+
+    // Move the lookup slightly along the normal, further in coarser cascades
+    vec3 offsetPos = position + norm * shadowNormalOffset * float(cascade + 1);
+    vec4 lightPos = shadowMatrices[cascade] * vec4(offsetPos, 1.0);
+    vec3 coords = lightPos.xyz / lightPos.w * 0.5 + 0.5;
+    if (coords.z > 1.0) {
+        return 1.0;
+    }
+
+    // Percentage-closer filtering over a (2r+1)x(2r+1) texel kernel
+    vec2 texelSize = 1.0 / vec2(textureSize(shadowMap, 0).xy);
+    float lit = 0.0;
+    float samples = 0.0;
+    for (int x = -shadowPCFRadius; x <= shadowPCFRadius; x++) {
+        for (int y = -shadowPCFRadius; y <= shadowPCFRadius; y++) {
+            vec2 offset = vec2(x, y) * texelSize;
+            lit += texture(shadowMap, vec4(coords.xy + offset, float(cascade), coords.z - shadowDepthBias));
+            samples += 1.0;
+        }
+    }
+    lit /= samples;
+
+    // Fade out towards the end of the last cascade instead of cutting off
+    float lastSplit = shadowSplits[shadowCascadeCount - 1];
+    float fade = clamp((lastSplit - viewDepth) / (lastSplit * 0.1), 0.0, 1.0);
+    return mix(1.0, lit, fade);
+}
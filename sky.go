@@ -0,0 +1,114 @@
+// Implements distance fog and the procedural sky.
+// The sky is drawn as a full-screen pass before the world: a gradient from the
+// horizon color up to the zenith color plus a sun disc. Fog in the world shader
+// fades chunks into the same horizon color, hiding the edge of the render distance.
+
+package main
+
+import (
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Fog modes understood by basic.glsl_frag.
+const (
+	FOG_MODE_NONE        = 0 // Fog disabled
+	FOG_MODE_LINEAR      = 1 // Linear fade between start and end distance
+	FOG_MODE_EXPONENTIAL = 2 // Exponential fade controlled by density
+)
+
+// Fog holds the distance fog parameters uploaded to the world shader.
+type Fog struct {
+	mode          int32      // One of the FOG_MODE_* constants
+	start         float32    // Distance where linear fog begins (world units)
+	end           float32    // Distance where linear fog is fully opaque (world units)
+	density       float32    // Density for exponential fog
+	color         mgl32.Vec3 // Color fog fades into (kept in sync with the sky horizon)
+	fitToDistance bool       // Recompute start/end from the render distance every frame
+}
+
+// Sky holds the procedural sky parameters and the resources to draw it.
+type Sky struct {
+	shader        Shader     // Full-screen gradient + sun shader (sky.glsl_vert / sky.glsl_frag)
+	mesh          Mesh       // Full-screen triangle
+	zenithColor   mgl32.Vec3 // Color straight up
+	horizonColor  mgl32.Vec3 // Color at the horizon (also used as fog color)
+	groundColor   mgl32.Vec3 // Color below the horizon
+	gradientPower float32    // Curve of the zenith-horizon blend (higher = thinner horizon band)
+	sunDirection  mgl32.Vec3 // Direction TO the sun (normalized)
+	sunColor      mgl32.Vec3 // Color of the sun disc
+	sunSize       float32    // Angular radius of the sun disc in degrees
+	sunGlow       float32    // Strength of the halo around the sun
+	moonDirection mgl32.Vec3 // Direction TO the moon (normalized)
+	moonColor     mgl32.Vec3 // Color of the moon disc
+	moonSize      float32    // Angular radius of the moon disc in degrees
+}
+
+// InitializeDefaultValues sets up a clear day fog.
+func (fog *Fog) InitializeDefaultValues() {
+	fog.mode = FOG_MODE_LINEAR
+	fog.start = 150.0
+	fog.end = 250.0
+	fog.density = 0.008
+	fog.color = mgl32.Vec3{0.7, 0.8, 1.0}
+	fog.fitToDistance = true
+}
+
+// FitToRenderDistance places the linear fog so that it becomes fully opaque
+// at the edge of the loaded area and starts at 60% of that distance.
+// renderDistance: Render distance in chunks
+func (fog *Fog) FitToRenderDistance(renderDistance int) {
+	// Chunks are loaded renderDistance-1 chunks ahead on the short side,
+	// so the last full chunk ends that many chunks away
+	fog.end = float32(renderDistance-1) * 16.0
+	fog.start = fog.end * 0.6
+}
+
+// AssignUniforms uploads the fog parameters to a shader.
+// shader: Active shader program using the fog uniforms
+func (fog *Fog) AssignUniforms(shader *Shader) {
+	shader.UniformSetInt("fogMode", fog.mode)
+	shader.UniformSetFloat("fogStart", fog.start)
+	shader.UniformSetFloat("fogEnd", fog.end)
+	shader.UniformSetFloat("fogDensity", fog.density)
+	shader.UniformSetVec3("fogColor", &fog.color)
+}
+
+// Initialize loads the sky shader and builds the full-screen mesh.
+func (sky *Sky) Initialize() {
+	sky.shader.LoadFile("sky")
+	sky.mesh = GetFullscreenTriangleMesh()
+
+	// Default clear day
+	sky.zenithColor = mgl32.Vec3{0.15, 0.35, 0.85}
+	sky.horizonColor = mgl32.Vec3{0.7, 0.8, 1.0}
+	sky.groundColor = mgl32.Vec3{0.35, 0.4, 0.5}
+	sky.gradientPower = 0.5
+	sky.sunDirection = mgl32.Vec3{0.3, 1.0, 0.7}.Normalize()
+	sky.sunColor = mgl32.Vec3{1.0, 0.95, 0.8}
+	sky.sunSize = 2.5
+	sky.sunGlow = 0.4
+	sky.moonDirection = sky.sunDirection.Mul(-1.0)
+	sky.moonColor = mgl32.Vec3{0.85, 0.88, 0.95}
+	sky.moonSize = 1.8
+}
+
+// Render draws the sky behind everything else.
+// The view rays come from the camera uniform block (see CameraUniforms).
+func (sky *Sky) Render() {
+	sky.shader.Use()
+	sky.shader.UniformSetVec3("zenithColor", &sky.zenithColor)
+	sky.shader.UniformSetVec3("horizonColor", &sky.horizonColor)
+	sky.shader.UniformSetVec3("groundColor", &sky.groundColor)
+	sky.shader.UniformSetFloat("gradientPower", sky.gradientPower)
+	sky.shader.UniformSetVec3("sunDirection", &sky.sunDirection)
+	sky.shader.UniformSetVec3("sunColor", &sky.sunColor)
+	sky.shader.UniformSetFloat("sunSize", mgl32.DegToRad(sky.sunSize))
+	sky.shader.UniformSetFloat("sunGlow", sky.sunGlow)
+	sky.shader.UniformSetVec3("moonDirection", &sky.moonDirection)
+	sky.shader.UniformSetVec3("moonColor", &sky.moonColor)
+	sky.shader.UniformSetFloat("moonSize", mgl32.DegToRad(sky.moonSize))
+
+	// The sky neither tests nor writes depth, the world draws over it
+	glState.Apply(RENDER_STATE_FULLSCREEN)
+	sky.mesh.Render()
+}
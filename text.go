@@ -0,0 +1,131 @@
+// Implements screen-space text drawn from a bitmap font atlas.
+// font.png holds the printable ASCII characters (32-126) in a grid of 7x13
+// pixel cells, white on transparent, taken from the public domain X11 "fixed"
+// font. The last cell (127) is a half transparent block used for backgrounds.
+// All text of a frame is collected in one mesh and drawn with a single call.
+
+package main
+
+import (
+	"strings"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Font atlas layout constants.
+const (
+	FONT_GLYPH_WIDTH  = 7   // Width of a glyph cell in pixels, also the advance
+	FONT_GLYPH_HEIGHT = 13  // Height of a glyph cell in pixels
+	FONT_COLUMNS      = 16  // Glyph cells per atlas row
+	FONT_ROWS         = 6   // Glyph cell rows in the atlas
+	FONT_FIRST_CHAR   = 32  // Character in the first cell (space)
+	FONT_LAST_CHAR    = 126 // Last printable character in the atlas
+	FONT_SOLID_CHAR   = 127 // Cell holding the background block
+	FONT_LINE_SPACING = 2   // Extra pixels between lines (before scaling)
+)
+
+// TextRenderer batches text and background rectangles into a screen-space
+// mesh. Positions are in pixels with the origin at the top left corner.
+type TextRenderer struct {
+	material *Material // "text" material with the font atlas
+	mesh     Mesh      // Glyph quads collected since the last Clear
+	scale    float32   // Size of one font pixel in screen pixels
+}
+
+// Initialize looks up the text material and starts with an empty batch.
+// materials: Library holding the "text" material
+func (text *TextRenderer) Initialize(materials *MaterialLibrary) {
+	text.material = materials.Material("text")
+	text.scale = 1.0
+}
+
+// Clear removes everything added since the last frame.
+func (text *TextRenderer) Clear() {
+	text.mesh.vertices = text.mesh.vertices[:0]
+}
+
+// LineHeight returns the distance between two lines of text in pixels.
+func (text *TextRenderer) LineHeight() float32 {
+	return float32(FONT_GLYPH_HEIGHT+FONT_LINE_SPACING) * text.scale
+}
+
+// Measure returns the size of a text block in pixels.
+// str: Text, lines separated by '\n'
+func (text *TextRenderer) Measure(str string) (float32, float32) {
+	lines := strings.Split(str, "\n")
+	columns := 0
+	for _, line := range lines {
+		columns = max(columns, len(line))
+	}
+	width := float32(columns*FONT_GLYPH_WIDTH) * text.scale
+	height := float32(len(lines))*text.LineHeight() - FONT_LINE_SPACING*text.scale
+	return width, height
+}
+
+// AddText appends a text block. Characters outside the atlas are drawn as '?'.
+// str: Text, lines separated by '\n'
+// x, y: Top left corner in pixels
+// color: Text color
+func (text *TextRenderer) AddText(str string, x, y float32, color mgl32.Vec3) {
+	cursorX := x
+	for _, character := range str {
+		switch {
+		case character == '\n':
+			cursorX = x
+			y += text.LineHeight()
+			continue
+		case character == ' ':
+		case character < FONT_FIRST_CHAR || character > FONT_LAST_CHAR:
+			text.addGlyph('?', cursorX, y, 1.0, 1.0, color)
+		default:
+			text.addGlyph(character, cursorX, y, 1.0, 1.0, color)
+		}
+		cursorX += FONT_GLYPH_WIDTH * text.scale
+	}
+}
+
+// AddBackground appends a half transparent rectangle, drawn behind text added later.
+// x, y: Top left corner in pixels
+// width, height: Size in pixels
+// color: Rectangle color
+func (text *TextRenderer) AddBackground(x, y, width, height float32, color mgl32.Vec3) {
+	text.addGlyph(FONT_SOLID_CHAR, x, y, width/(FONT_GLYPH_WIDTH*text.scale), height/(FONT_GLYPH_HEIGHT*text.scale), color)
+}
+
+// addGlyph appends the quad of one atlas cell.
+// character: Character whose cell is drawn
+// x, y: Top left corner in pixels
+// stretchX, stretchY: Size of the quad in glyph cells
+// color: Vertex color the atlas is multiplied with
+func (text *TextRenderer) addGlyph(character rune, x, y, stretchX, stretchY float32, color mgl32.Vec3) {
+	cell := int(character) - FONT_FIRST_CHAR
+	u0 := float32(cell%FONT_COLUMNS) / FONT_COLUMNS
+	v0 := float32(cell/FONT_COLUMNS) / FONT_ROWS
+	u1 := u0 + 1.0/FONT_COLUMNS
+	v1 := v0 + 1.0/FONT_ROWS
+
+	width := FONT_GLYPH_WIDTH * text.scale * stretchX
+	height := FONT_GLYPH_HEIGHT * text.scale * stretchY
+	normal := mgl32.Vec3{0.0, 0.0, 1.0}
+	corners := [4]mgl32.Vec3{{x, y, 0.0}, {x + width, y, 0.0}, {x + width, y + height, 0.0}, {x, y + height, 0.0}}
+	uvs := [4]mgl32.Vec2{{u0, v0}, {u1, v0}, {u1, v1}, {u0, v1}}
+	for _, corner := range [6]int{0, 3, 2, 0, 2, 1} {
+		text.mesh.AddVertex(corners[corner], color, normal, uvs[corner])
+	}
+}
+
+// Render draws everything added since the last Clear on top of the current framebuffer.
+// loop: Game loop providing the material setup
+// width, height: Size of the framebuffer in pixels
+func (text *TextRenderer) Render(loop *GameLoop, width, height int) {
+	if len(text.mesh.vertices) == 0 {
+		return
+	}
+	text.mesh.PrepareArrayData()
+	text.mesh.UpdateVAO()
+
+	loop.UseMaterial(text.material)
+	screenSize := mgl32.Vec2{float32(width), float32(height)}
+	text.material.shader.UniformSetVec2("screenSize", &screenSize)
+	text.mesh.Render()
+}
@@ -0,0 +1,267 @@
+// Implements animated block textures. The atlas metadata file (atlas.json)
+// declares animation strips: the atlas tile the block faces show, the tiles
+// holding the frames, how many world ticks each frame lasts and whether a
+// frame blends into the next. Once per tick the animator copies the current
+// frame (or the blend of two frames) into the shown tile of the atlas
+// texture, so chunk meshes keep their UVs and are never rebuilt for it.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"strings"
+)
+
+// ATLAS_METADATA_FILE is the atlas metadata file loaded at startup.
+const ATLAS_METADATA_FILE = "atlas.json"
+
+// TextureAnimationFrame is a frame entry of the atlas metadata file.
+type TextureAnimationFrame struct {
+	Tile  [2]int `json:"tile"`  // Atlas tile (column, row) holding the frame
+	Ticks int    `json:"ticks"` // World ticks the frame is shown (0 uses the animation's frameTicks)
+}
+
+// TextureAnimationDefinition is an animation entry of the atlas metadata file.
+type TextureAnimationDefinition struct {
+	Name        string                  `json:"name"`        // Name shown by commands
+	Tile        [2]int                  `json:"tile"`        // Atlas tile (column, row) the block faces show
+	FrameTicks  int                     `json:"frameTicks"`  // World ticks per frame unless a frame sets its own
+	Interpolate bool                    `json:"interpolate"` // Blend each frame into the next one tick by tick
+	Frames      []TextureAnimationFrame `json:"frames"`      // Frames in playing order
+}
+
+// AtlasMetadata is the content of the atlas metadata file.
+type AtlasMetadata struct {
+	Atlas      string                       `json:"atlas"`      // Image file of the atlas, as named in materials.json
+	TileSize   int                          `json:"tileSize"`   // Edge length of a tile in texels
+	Animations []TextureAnimationDefinition `json:"animations"` // Animated tiles
+}
+
+// ParseAtlasMetadata decodes and checks an atlas metadata file. Frames without
+// their own duration get the animation's frameTicks.
+// content: File content
+// width, height: Size of the atlas image in texels
+func ParseAtlasMetadata(content []byte, width, height int) (AtlasMetadata, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+
+	metadata := AtlasMetadata{}
+	if err := decoder.Decode(&metadata); err != nil {
+		return metadata, err
+	}
+	if metadata.Atlas == "" || metadata.TileSize <= 0 {
+		return metadata, fmt.Errorf("atlas and a positive tileSize are required")
+	}
+
+	columns, rows := width/metadata.TileSize, height/metadata.TileSize
+	inside := func(tile [2]int) bool {
+		return tile[0] >= 0 && tile[0] < columns && tile[1] >= 0 && tile[1] < rows
+	}
+	shown := map[[2]int]string{}
+	for i := range metadata.Animations {
+		animation := &metadata.Animations[i]
+		if !inside(animation.Tile) {
+			return metadata, fmt.Errorf("animation %q: tile %v outside the %d×%d tile atlas", animation.Name, animation.Tile, columns, rows)
+		}
+		if other, found := shown[animation.Tile]; found {
+			return metadata, fmt.Errorf("animation %q: tile %v is already animated by %q", animation.Name, animation.Tile, other)
+		}
+		shown[animation.Tile] = animation.Name
+		if len(animation.Frames) == 0 {
+			return metadata, fmt.Errorf("animation %q: no frames", animation.Name)
+		}
+		for j := range animation.Frames {
+			frame := &animation.Frames[j]
+			if frame.Ticks == 0 {
+				frame.Ticks = animation.FrameTicks
+			}
+			if frame.Ticks <= 0 {
+				return metadata, fmt.Errorf("animation %q: frame %d needs a positive duration", animation.Name, j)
+			}
+			if !inside(frame.Tile) {
+				return metadata, fmt.Errorf("animation %q: frame %d tile %v outside the atlas", animation.Name, j, frame.Tile)
+			}
+		}
+	}
+	return metadata, nil
+}
+
+// TextureAnimation is an animation being played.
+type TextureAnimation struct {
+	definition TextureAnimationDefinition // Frames and timing
+	duration   int                        // World ticks of one cycle
+	shown      [2]int                     // Frame and blend step uploaded last ({-1, -1} before the first upload)
+}
+
+// TextureAnimator plays the animations of the block atlas.
+type TextureAnimator struct {
+	enabled    bool               // Advance the animations (off pauses them)
+	file       string             // Atlas metadata file
+	texture    uint32             // Atlas texture written to
+	atlas      *image.RGBA        // Atlas image as loaded, the frames are read from it
+	tileSize   int                // Edge length of a tile in texels
+	animations []TextureAnimation // Animations from the metadata file
+	time       float64            // Seconds the animations have played
+	tick       int64              // Tick uploaded last (-1 uploads on the next update)
+	pixels     []uint8            // Upload buffer of one tile
+}
+
+// Initialize loads the metadata file. The animations start enabled.
+// Panics if it cannot be loaded, like the material file.
+// file: Path of the atlas metadata file
+// materials: Library that loaded the atlas texture
+func (animator *TextureAnimator) Initialize(file string, materials *MaterialLibrary) {
+	animator.enabled = true
+	animator.file = file
+	if err := animator.Load(materials); err != nil {
+		panic(err)
+	}
+}
+
+// Load reads the metadata file and the atlas image. On error nothing changes.
+// materials: Library that loaded the atlas texture
+func (animator *TextureAnimator) Load(materials *MaterialLibrary) error {
+	content, err := os.ReadFile(animator.file)
+	if err != nil {
+		return fmt.Errorf("failed to read atlas metadata: %v", err)
+	}
+
+	// The atlas is named inside the file, so read it loosely first
+	header := struct {
+		Atlas string `json:"atlas"`
+	}{}
+	if err := json.Unmarshal(content, &header); err != nil {
+		return fmt.Errorf("%s: %v", animator.file, err)
+	}
+	atlas, err := LoadImageRGBA(header.Atlas)
+	if err != nil {
+		return fmt.Errorf("%s: %v", animator.file, err)
+	}
+	metadata, err := ParseAtlasMetadata(content, atlas.Rect.Dx(), atlas.Rect.Dy())
+	if err != nil {
+		return fmt.Errorf("%s: %v", animator.file, err)
+	}
+	texture, found := materials.Texture(metadata.Atlas)
+	if !found {
+		return fmt.Errorf("%s: no material uses %q", animator.file, metadata.Atlas)
+	}
+
+	animations := []TextureAnimation{}
+	for _, definition := range metadata.Animations {
+		animation := TextureAnimation{definition: definition, shown: [2]int{-1, -1}}
+		for _, frame := range definition.Frames {
+			animation.duration += frame.Ticks
+		}
+		animations = append(animations, animation)
+	}
+
+	// Tiles that are no longer animated get their texels from the file back
+	for _, old := range animator.animations {
+		tile := old.definition.Tile
+		size := animator.tileSize
+		original := atlas.SubImage(image.Rect(tile[0]*size, tile[1]*size, (tile[0]+1)*size, (tile[1]+1)*size)).(*image.RGBA)
+		pixels := make([]uint8, 0, size*size*4)
+		for y := range size {
+			pixels = append(pixels, original.Pix[y*original.Stride:y*original.Stride+size*4]...)
+		}
+		renderBackend.WriteTexture(animator.texture, tile[0]*size, tile[1]*size, size, size, pixels)
+	}
+
+	animator.texture = texture
+	animator.atlas = atlas
+	animator.tileSize = metadata.TileSize
+	animator.animations = animations
+	animator.pixels = make([]uint8, metadata.TileSize*metadata.TileSize*4)
+	animator.tick = -1
+	return nil
+}
+
+// Reset restarts every animation at its first frame, uploaded on the next
+// update. Captures reset the animations, so their pictures do not depend on
+// how long the game ran.
+func (animator *TextureAnimator) Reset() {
+	animator.time = 0.0
+	animator.tick = -1
+}
+
+// Update advances the animations and uploads the tiles whose frame changed.
+// The frames step with the world tick rate, so at most one upload per tile and tick is made.
+// deltaTime: Seconds since the last frame
+func (animator *TextureAnimator) Update(deltaTime float64) {
+	if animator.enabled {
+		animator.time += deltaTime
+	}
+	tick := int64(animator.time * WORLD_TICK_RATE)
+	if tick == animator.tick {
+		return
+	}
+	animator.tick = tick
+	for i := range animator.animations {
+		animator.upload(&animator.animations[i], tick)
+	}
+}
+
+// upload writes the frame of an animation at a tick into its tile, unless it is shown already.
+// animation: Animation to update
+// tick: Ticks since the animations started
+func (animator *TextureAnimator) upload(animation *TextureAnimation, tick int64) {
+	frames := animation.definition.Frames
+	position := int(tick % int64(animation.duration))
+	frame := 0
+	for position >= frames[frame].Ticks {
+		position -= frames[frame].Ticks
+		frame++
+	}
+	step := 0
+	if animation.definition.Interpolate {
+		step = position
+	}
+	if animation.shown == [2]int{frame, step} {
+		return
+	}
+	animation.shown = [2]int{frame, step}
+
+	// Blend towards the next frame by the share of the frame that has passed
+	weight := uint32(step * 256 / frames[frame].Ticks)
+	current, next := frames[frame].Tile, frames[(frame+1)%len(frames)].Tile
+	size := animator.tileSize
+	for y := range size {
+		for x := range size * 4 {
+			a := uint32(animator.atlas.Pix[(current[1]*size+y)*animator.atlas.Stride+current[0]*size*4+x])
+			b := uint32(animator.atlas.Pix[(next[1]*size+y)*animator.atlas.Stride+next[0]*size*4+x])
+			animator.pixels[y*size*4+x] = uint8((a*(256-weight) + b*weight) >> 8)
+		}
+	}
+	tile := animation.definition.Tile
+	renderBackend.WriteTexture(animator.texture, tile[0]*size, tile[1]*size, size, size, animator.pixels)
+}
+
+// RegisterCommands adds the "animations" command to a registry.
+// materials: Library that loaded the atlas texture, for reloading
+func (animator *TextureAnimator) RegisterCommands(registry *CommandRegistry, materials *MaterialLibrary) {
+	registry.Register("animations", "animations [on|off|reload] - list, pause or reload the animated block textures", func(args []string) (string, error) {
+		switch {
+		case len(args) == 0:
+			lines := []string{}
+			for _, animation := range animator.animations {
+				definition := animation.definition
+				lines = append(lines, fmt.Sprintf("%s: tile %d,%d, %d frames, %d ticks, interpolate %v, showing frame %d",
+					definition.Name, definition.Tile[0], definition.Tile[1], len(definition.Frames), animation.duration, definition.Interpolate, animation.shown[0]))
+			}
+			return fmt.Sprintf("animations %v\n%s", animator.enabled, strings.Join(lines, "\n")), nil
+		case len(args) == 1 && (args[0] == "on" || args[0] == "off"):
+			animator.enabled = args[0] == "on"
+			return fmt.Sprintf("animations %v", animator.enabled), nil
+		case len(args) == 1 && args[0] == "reload":
+			if err := animator.Load(materials); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d animations loaded", len(animator.animations)), nil
+		}
+		return "", fmt.Errorf("invalid arguments")
+	})
+}
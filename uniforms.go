@@ -0,0 +1,252 @@
+// Implements typed access to shader uniforms and shared uniform buffers.
+// After a program is linked its active uniforms are reflected once (name, type,
+// location), so setting a uniform is a map lookup instead of a driver query with
+// a freshly allocated C string. Per-frame camera data lives in a uniform buffer
+// bound to every program that declares the "Camera" block (see camera.glsl).
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"unsafe"
+
+	"github.com/go-gl/gl/v3.3-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Binding points of the shared uniform blocks.
+const (
+	CAMERA_UNIFORM_BINDING = 0 // "Camera" block, per-frame camera data
+)
+
+// CAMERA_UNIFORM_FLOATS is the size of the "Camera" block in std140 layout, in floats.
+const CAMERA_UNIFORM_FLOATS = 3*16 + 4 + 4
+
+// uniformBlockBindings maps the shared uniform block names to their binding points.
+var uniformBlockBindings = map[string]uint32{
+	"Camera": CAMERA_UNIFORM_BINDING,
+}
+
+// ShaderUniform is an active uniform of a linked program.
+type ShaderUniform struct {
+	name       string // Name in the GLSL source (arrays without "[0]")
+	glType     uint32 // GL type, e.g. gl.FLOAT_VEC3 or gl.SAMPLER_2D
+	size       int32  // Number of array elements (1 for non-arrays)
+	location   int32  // Location of the first element
+	mismatched bool   // A setter of the wrong type was used (reported once)
+}
+
+// shaderSamplerTypes are the GL types accepted by UniformSetSampler.
+var shaderSamplerTypes = []uint32{
+	gl.SAMPLER_2D, gl.SAMPLER_3D, gl.SAMPLER_CUBE, gl.SAMPLER_2D_ARRAY,
+	gl.SAMPLER_2D_SHADOW, gl.SAMPLER_2D_ARRAY_SHADOW,
+}
+
+// shaderUniformTypeNames maps GL types to their GLSL names for listings.
+var shaderUniformTypeNames = map[uint32]string{
+	gl.FLOAT:                   "float",
+	gl.FLOAT_VEC2:              "vec2",
+	gl.FLOAT_VEC3:              "vec3",
+	gl.FLOAT_VEC4:              "vec4",
+	gl.INT:                     "int",
+	gl.BOOL:                    "bool",
+	gl.FLOAT_MAT3:              "mat3",
+	gl.FLOAT_MAT4:              "mat4",
+	gl.SAMPLER_2D:              "sampler2D",
+	gl.SAMPLER_3D:              "sampler3D",
+	gl.SAMPLER_CUBE:            "samplerCube",
+	gl.SAMPLER_2D_ARRAY:        "sampler2DArray",
+	gl.SAMPLER_2D_SHADOW:       "sampler2DShadow",
+	gl.SAMPLER_2D_ARRAY_SHADOW: "sampler2DArrayShadow",
+}
+
+// CameraUniforms is the per-frame camera data shared by all programs.
+type CameraUniforms struct {
+	projection               mgl32.Mat4 // Perspective projection
+	view                     mgl32.Mat4 // Camera rotation, positions are already camera-relative
+	skyInverseViewProjection mgl32.Mat4 // Inverse of projection * camera rotation, for sky rays
+	position                 mgl32.Vec3 // Camera position in render space (the origin)
+	near, far                float32    // Clip plane distances
+}
+
+// UniformBuffer is a buffer object bound to a uniform block binding point.
+type UniformBuffer struct {
+	ID      uint32 // Buffer ID of the render backend
+	binding uint32 // Uniform block binding point
+	floats  int    // Size of the buffer in floats
+}
+
+// BindUniformBlocks connects the shared uniform blocks a program declares to
+// their binding points. Blocks the program does not use are skipped.
+// program: OpenGL program ID
+func BindUniformBlocks(program uint32) {
+	for name, binding := range uniformBlockBindings {
+		renderBackend.BindUniformBlock(program, name, binding)
+	}
+}
+
+// Uniforms returns the active uniforms of the program sorted by name.
+func (shader *Shader) Uniforms() []ShaderUniform {
+	uniforms := make([]ShaderUniform, 0, len(shader.uniforms))
+	for _, uniform := range shader.uniforms {
+		uniforms = append(uniforms, *uniform)
+	}
+	sort.Slice(uniforms, func(a, b int) bool {
+		return uniforms[a].name < uniforms[b].name
+	})
+	return uniforms
+}
+
+// String formats the uniform like its GLSL declaration.
+func (uniform ShaderUniform) String() string {
+	typeName, known := shaderUniformTypeNames[uniform.glType]
+	if !known {
+		typeName = fmt.Sprintf("0x%x", uniform.glType)
+	}
+	if uniform.size > 1 {
+		return fmt.Sprintf("%s %s[%d] (location %d)", typeName, uniform.name, uniform.size, uniform.location)
+	}
+	return fmt.Sprintf("%s %s (location %d)", typeName, uniform.name, uniform.location)
+}
+
+// uniformLocation returns the cached location of a uniform, or -1 when the
+// program has no such active uniform (the setter then does nothing, like GL).
+// A uniform of another type is reported once and not set.
+// uniformName: Name of the uniform in the GLSL shader
+// types: GL types the calling setter can upload
+func (shader *Shader) uniformLocation(uniformName string, types ...uint32) int32 {
+	uniform, found := shader.uniforms[uniformName]
+	if !found {
+		return -1
+	}
+	if !slices.Contains(types, uniform.glType) {
+		if !uniform.mismatched {
+			uniform.mismatched = true
+			fmt.Printf("%s: uniform %s set with the wrong type\n", shader.Name(), uniform)
+		}
+		return -1
+	}
+	return uniform.location
+}
+
+// UniformSetMat4 sets a mat4 (4x4 matrix) uniform in the shader program.
+// uniformName: Name of the uniform variable in the GLSL shader
+// mat4: Pointer to the 4x4 matrix to upload
+func (shader *Shader) UniformSetMat4(uniformName string, mat4 *mgl32.Mat4) {
+	if location := shader.uniformLocation(uniformName, gl.FLOAT_MAT4); location >= 0 {
+		renderBackend.SetUniformFloats(location, gl.FLOAT_MAT4, 1, mat4[:])
+	}
+}
+
+// UniformSetMat3 sets a mat3 (3x3 matrix) uniform in the shader program.
+// uniformName: Name of the uniform variable in the GLSL shader
+// mat3: Pointer to the 3x3 matrix to upload
+func (shader *Shader) UniformSetMat3(uniformName string, mat3 *mgl32.Mat3) {
+	if location := shader.uniformLocation(uniformName, gl.FLOAT_MAT3); location >= 0 {
+		renderBackend.SetUniformFloats(location, gl.FLOAT_MAT3, 1, mat3[:])
+	}
+}
+
+// UniformSetVec2 sets a vec2 (2-component vector) uniform in the shader program.
+// uniformName: Name of the uniform variable in the GLSL shader
+// vec2: Pointer to the 2-component vector to upload
+func (shader *Shader) UniformSetVec2(uniformName string, vec2 *mgl32.Vec2) {
+	if location := shader.uniformLocation(uniformName, gl.FLOAT_VEC2); location >= 0 {
+		renderBackend.SetUniformFloats(location, gl.FLOAT_VEC2, 1, vec2[:])
+	}
+}
+
+// UniformSetVec3 sets a vec3 (3-component vector) uniform in the shader program.
+// uniformName: Name of the uniform variable in the GLSL shader
+// vec3: Pointer to the 3-component vector to upload
+func (shader *Shader) UniformSetVec3(uniformName string, vec3 *mgl32.Vec3) {
+	if location := shader.uniformLocation(uniformName, gl.FLOAT_VEC3); location >= 0 {
+		renderBackend.SetUniformFloats(location, gl.FLOAT_VEC3, 1, vec3[:])
+	}
+}
+
+// UniformSetVec4 sets a vec4 (4-component vector) uniform in the shader program.
+// uniformName: Name of the uniform variable in the GLSL shader
+// vec4: Pointer to the 4-component vector to upload
+func (shader *Shader) UniformSetVec4(uniformName string, vec4 *mgl32.Vec4) {
+	if location := shader.uniformLocation(uniformName, gl.FLOAT_VEC4); location >= 0 {
+		renderBackend.SetUniformFloats(location, gl.FLOAT_VEC4, 1, vec4[:])
+	}
+}
+
+// UniformSetFloat sets a float uniform in the shader program.
+// uniformName: Name of the uniform variable in the GLSL shader
+// value: Value to upload
+func (shader *Shader) UniformSetFloat(uniformName string, value float32) {
+	if location := shader.uniformLocation(uniformName, gl.FLOAT); location >= 0 {
+		renderBackend.SetUniformFloat(location, value)
+	}
+}
+
+// UniformSetInt sets an int (or bool) uniform in the shader program.
+// uniformName: Name of the uniform variable in the GLSL shader
+// value: Value to upload
+func (shader *Shader) UniformSetInt(uniformName string, value int32) {
+	if location := shader.uniformLocation(uniformName, gl.INT, gl.BOOL); location >= 0 {
+		renderBackend.SetUniformInt(location, value)
+	}
+}
+
+// UniformSetSampler points a sampler uniform at a texture unit.
+// uniformName: Name of the sampler in the GLSL shader
+// unit: Texture unit index (0 for gl.TEXTURE0)
+func (shader *Shader) UniformSetSampler(uniformName string, unit int32) {
+	if location := shader.uniformLocation(uniformName, shaderSamplerTypes...); location >= 0 {
+		renderBackend.SetUniformInt(location, unit)
+	}
+}
+
+// UniformSetMat4Array sets a mat4 array uniform in the shader program.
+// uniformName: Name of the uniform array in the GLSL shader (without "[0]")
+// mat4s: Matrices to upload, starting at index 0
+func (shader *Shader) UniformSetMat4Array(uniformName string, mat4s []mgl32.Mat4) {
+	if location := shader.uniformLocation(uniformName, gl.FLOAT_MAT4); location >= 0 {
+		// The matrices are contiguous, pass them as one slice of floats
+		renderBackend.SetUniformFloats(location, gl.FLOAT_MAT4, int32(len(mat4s)), unsafe.Slice(&mat4s[0][0], len(mat4s)*16))
+	}
+}
+
+// UniformSetFloatArray sets a float array uniform in the shader program.
+// uniformName: Name of the uniform array in the GLSL shader (without "[0]")
+// values: Values to upload, starting at index 0
+func (shader *Shader) UniformSetFloatArray(uniformName string, values []float32) {
+	if location := shader.uniformLocation(uniformName, gl.FLOAT); location >= 0 {
+		renderBackend.SetUniformFloats(location, gl.FLOAT, int32(len(values)), values)
+	}
+}
+
+// Pack writes the camera data in the std140 layout of the "Camera" block.
+// data: Destination, uploaded as is
+func (camera *CameraUniforms) Pack(data *[CAMERA_UNIFORM_FLOATS]float32) {
+	// Matrices are column-major in both mgl32 and std140
+	copy(data[0:16], camera.projection[:])
+	copy(data[16:32], camera.view[:])
+	copy(data[32:48], camera.skyInverseViewProjection[:])
+
+	// vec4 cameraPosition (w unused) and vec4 cameraClip (near, far, unused)
+	data[48], data[49], data[50], data[51] = camera.position[0], camera.position[1], camera.position[2], 1.0
+	data[52], data[53], data[54], data[55] = camera.near, camera.far, 0.0, 0.0
+}
+
+// Initialize creates the buffer and binds it to a uniform block binding point.
+// binding: Binding point shared with the programs (see uniformBlockBindings)
+// floats: Size of the block in floats
+func (buffer *UniformBuffer) Initialize(binding uint32, floats int) {
+	buffer.binding = binding
+	buffer.floats = floats
+
+	buffer.ID = renderBackend.CreateUniformBuffer(binding, floats)
+}
+
+// Update uploads new contents; every program using the block sees them.
+// data: Block contents, at most the size given to Initialize
+func (buffer *UniformBuffer) Update(data []float32) {
+	renderBackend.WriteUniformBuffer(buffer.ID, data)
+}
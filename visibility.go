@@ -0,0 +1,252 @@
+// Implements cave-aware occlusion culling.
+// When a 16x16x16 chunk (a section of the world) is meshed, it records which of
+// its six faces are connected to each other through non-opaque blocks. Each frame
+// a breadth-first search starting at the camera's chunk walks this graph and
+// only chunks it reaches are drawn, so caves hidden below the surface are skipped.
+// Everything here is plain CPU code and runs without a window.
+
+package main
+
+import (
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// SectionVisibility is a 6x6 matrix of bits: bit a*6+b is set when face a of
+// a section can be seen from face b. Faces are indexed by the FACE_* constants.
+type SectionVisibility uint64
+
+// SECTION_VISIBILITY_ALL connects every face to every other face (open sections).
+const SECTION_VISIBILITY_ALL SectionVisibility = 1<<36 - 1
+
+// sectionFaceOffsets is the step in chunk coordinates (X, Y, Z) through each face.
+var sectionFaceOffsets = [6][3]int{
+	FACE_SIDE0:  {0, 0, -1},
+	FACE_SIDE1:  {-1, 0, 0},
+	FACE_SIDE2:  {1, 0, 0},
+	FACE_SIDE3:  {0, 0, 1},
+	FACE_TOP:    {0, 1, 0},
+	FACE_BOTTOM: {0, -1, 0},
+}
+
+// sectionOppositeFaces maps every face to the face on the other side of the section.
+var sectionOppositeFaces = [6]int{
+	FACE_SIDE0:  FACE_SIDE3,
+	FACE_SIDE1:  FACE_SIDE2,
+	FACE_SIDE2:  FACE_SIDE1,
+	FACE_SIDE3:  FACE_SIDE0,
+	FACE_TOP:    FACE_BOTTOM,
+	FACE_BOTTOM: FACE_TOP,
+}
+
+// Connects reports whether face a and face b are connected through the section.
+func (visibility SectionVisibility) Connects(a, b int) bool {
+	return visibility&(1<<(a*6+b)) != 0
+}
+
+// connectFaces connects every pair of faces in a bit mask of faces.
+// faces: Bit i set for every face i touched by one connected region
+func (visibility *SectionVisibility) connectFaces(faces uint8) {
+	for a := range 6 {
+		if faces&(1<<a) == 0 {
+			continue
+		}
+		for b := range 6 {
+			if faces&(1<<b) != 0 {
+				*visibility |= 1 << (a*6 + b)
+			}
+		}
+	}
+}
+
+// ComputeSectionVisibility flood fills the non-opaque blocks of a section and
+// connects the faces that each connected region touches.
+// isOpaque: Reports whether the block at local coordinates (x, y, z) blocks sight, Y is vertical
+func ComputeSectionVisibility(isOpaque func(x, y, z int) bool) SectionVisibility {
+	const size = CHUNK_SIZE
+	cellIndex := func(x, y, z int) int {
+		return (x*size+y)*size + z
+	}
+
+	visibility := SectionVisibility(0)
+	visited := [size * size * size]bool{}
+	stack := make([]int, 0, 256)
+
+	for start := range visited {
+		if visited[start] {
+			continue
+		}
+		visited[start] = true
+		if isOpaque(start/(size*size), start/size%size, start%size) {
+			continue
+		}
+
+		// Walk the connected region and collect the faces it reaches
+		faces := uint8(0)
+		stack = append(stack[:0], start)
+		for len(stack) > 0 {
+			index := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			x, y, z := index/(size*size), index/size%size, index%size
+
+			for face, offset := range sectionFaceOffsets {
+				// Offsets are (X, vertical, Z), the same order as the local coordinates
+				nx, ny, nz := x+offset[0], y+offset[1], z+offset[2]
+				if nx < 0 || nx >= size || ny < 0 || ny >= size || nz < 0 || nz >= size {
+					faces |= 1 << face
+					continue
+				}
+
+				neighbour := cellIndex(nx, ny, nz)
+				if visited[neighbour] {
+					continue
+				}
+				visited[neighbour] = true
+				if !isOpaque(nx, ny, nz) {
+					stack = append(stack, neighbour)
+				}
+			}
+		}
+
+		visibility.connectFaces(faces)
+		if visibility == SECTION_VISIBILITY_ALL {
+			break
+		}
+	}
+
+	return visibility
+}
+
+// SectionGraph provides the visibility of chunks to the culler.
+type SectionGraph interface {
+	// ChunkVisibility returns the visibility of a chunk.
+	// The second value is false when the chunk is not loaded or not meshed yet;
+	// such chunks are treated as fully open.
+	ChunkVisibility(position ChunkPos) (SectionVisibility, bool)
+}
+
+// occlusionNode is a chunk waiting in the search queue.
+type occlusionNode struct {
+	position  ChunkPos // Chunk coordinates
+	entryFace int      // Face the search entered through (-1 for the camera's chunk)
+	travelled uint8    // Bit mask of the directions taken from the camera so far
+}
+
+// OcclusionCuller finds the chunks visible from the camera.
+// Its buffers are kept between frames to avoid allocations.
+type OcclusionCuller struct {
+	origin     ChunkPos            // First chunk of the search area (lowest X, Y and Z)
+	size       int                 // Number of chunks along each horizontal side of the search area
+	layers     int                 // Number of chunk layers of the search area
+	visibility []SectionVisibility // Visibility of every chunk in the search area
+	visited    []bool              // Chunks already reached by the search, which are the visible ones
+	queue      []occlusionNode     // Breadth-first search queue
+}
+
+// chunkIndex returns the index of a chunk inside the search area buffers,
+// or -1 if the chunk lies outside the search area.
+func (culler *OcclusionCuller) chunkIndex(position ChunkPos) int {
+	x, y, z := position.x-culler.origin.x, position.y-culler.origin.y, position.z-culler.origin.z
+	if x < 0 || x >= culler.size || z < 0 || z >= culler.size || y < 0 || y >= culler.layers {
+		return -1
+	}
+	return (x*culler.size+z)*culler.layers + y
+}
+
+// Cull searches the chunks visible from the camera in a box of columns around it
+// that reaches from the bottom to the top of the world.
+// graph: Source of chunk visibility
+// cameraPosition: Camera position in world space
+// radius: Number of columns searched in each direction from the camera column
+// bottom, top: Lowest chunk layer of the world and the layer above the highest one
+func (culler *OcclusionCuller) Cull(graph SectionGraph, cameraPosition mgl64.Vec3, radius, bottom, top int) {
+	camera := ChunkPosAt(cameraPosition)
+
+	// Resize the buffers and copy the graph for the whole search area
+	culler.origin = ChunkPos{camera.x - radius, bottom, camera.z - radius}
+	culler.size = 2*radius + 1
+	culler.layers = max(top-bottom, 0)
+	chunks := culler.size * culler.size * culler.layers
+	if len(culler.visited) != chunks {
+		culler.visibility = make([]SectionVisibility, chunks)
+		culler.visited = make([]bool, chunks)
+	}
+	clear(culler.visited)
+	if chunks == 0 {
+		return
+	}
+
+	for x := range culler.size {
+		for z := range culler.size {
+			for y := range culler.layers {
+				position := culler.origin.Add(x, y, z)
+				visibility, loaded := graph.ChunkVisibility(position)
+				if !loaded {
+					visibility = SECTION_VISIBILITY_ALL
+				}
+				culler.visibility[culler.chunkIndex(position)] = visibility
+			}
+		}
+	}
+
+	// Start at the camera's chunk, or at the whole top (bottom) layer
+	// when the camera is above (below) the world
+	culler.queue = culler.queue[:0]
+	switch {
+	case camera.y >= top:
+		culler.seedLayer(top-1, FACE_TOP, FACE_BOTTOM)
+	case camera.y < bottom:
+		culler.seedLayer(bottom, FACE_BOTTOM, FACE_TOP)
+	default:
+		culler.visited[culler.chunkIndex(camera)] = true
+		culler.queue = append(culler.queue, occlusionNode{camera, -1, 0})
+	}
+
+	for head := 0; head < len(culler.queue); head++ {
+		node := culler.queue[head]
+		visibility := culler.visibility[culler.chunkIndex(node.position)]
+
+		for face, offset := range sectionFaceOffsets {
+			// Never turn back towards the camera, this keeps the search from
+			// wrapping around occluders
+			if node.travelled&(1<<sectionOppositeFaces[face]) != 0 {
+				continue
+			}
+			// Sight must pass through the chunk from the entry face to this face
+			if node.entryFace >= 0 && !visibility.Connects(node.entryFace, face) {
+				continue
+			}
+
+			position := node.position.Add(offset[0], offset[1], offset[2])
+			index := culler.chunkIndex(position)
+			if index < 0 || culler.visited[index] {
+				continue
+			}
+
+			culler.visited[index] = true
+			culler.queue = append(culler.queue, occlusionNode{
+				position, sectionOppositeFaces[face], node.travelled | 1<<face,
+			})
+		}
+	}
+}
+
+// seedLayer queues every chunk of one layer, as if entered from outside the world.
+// layer: Chunk Y coordinate of the layer to start from
+// entryFace: Face the chunks are entered through
+// direction: Direction the search travels in
+func (culler *OcclusionCuller) seedLayer(layer, entryFace, direction int) {
+	for x := range culler.size {
+		for z := range culler.size {
+			position := ChunkPos{culler.origin.x + x, layer, culler.origin.z + z}
+			culler.visited[culler.chunkIndex(position)] = true
+			culler.queue = append(culler.queue, occlusionNode{position, entryFace, 1 << direction})
+		}
+	}
+}
+
+// Visible reports whether the last search reached a chunk.
+// Chunks outside the search area are not visible.
+func (culler *OcclusionCuller) Visible(position ChunkPos) bool {
+	index := culler.chunkIndex(position)
+	return index >= 0 && culler.visited[index]
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// testSectionGraph is a SectionGraph over a fixed set of chunks.
+// Chunks missing from the map are not loaded.
+type testSectionGraph map[ChunkPos]SectionVisibility
+
+// ChunkVisibility returns the visibility of a chunk and whether it is in the map.
+func (graph testSectionGraph) ChunkVisibility(position ChunkPos) (SectionVisibility, bool) {
+	visibility, loaded := graph[position]
+	return visibility, loaded
+}
+
+// fillLayer sets the visibility of every chunk of a layer within a radius of chunk column (0, 0).
+func (graph testSectionGraph) fillLayer(layer, radius int, visibility SectionVisibility) {
+	for x := -radius; x <= radius; x++ {
+		for z := -radius; z <= radius; z++ {
+			graph[ChunkPos{x, layer, z}] = visibility
+		}
+	}
+}
+
+// TestOcclusionSlabHidesCave checks that a layer of solid chunks between the
+// camera and an open cave layer hides the cave.
+func TestOcclusionSlabHidesCave(t *testing.T) {
+	graph := testSectionGraph{}
+	graph.fillLayer(1, 2, SECTION_VISIBILITY_ALL)  // Open air around the camera
+	graph.fillLayer(0, 2, 0)                       // Solid slab
+	graph.fillLayer(-1, 2, SECTION_VISIBILITY_ALL) // Cave
+
+	culler := OcclusionCuller{}
+	culler.Cull(graph, mgl64.Vec3{8, 24, 8}, 2, -1, 2)
+
+	if !culler.Visible(ChunkPos{0, 1, 0}) {
+		t.Errorf("the camera's chunk is not visible")
+	}
+	if !culler.Visible(ChunkPos{1, 0, 1}) {
+		t.Errorf("the slab below the camera is not visible")
+	}
+	for x := -2; x <= 2; x++ {
+		for z := -2; z <= 2; z++ {
+			if culler.Visible(ChunkPos{x, -1, z}) {
+				t.Errorf("cave chunk %d, -1, %d is visible through the slab", x, z)
+			}
+		}
+	}
+}
+
+// TestSectionVisibilityLTunnel checks that an L-shaped tunnel through solid
+// rock only connects the two faces it opens onto.
+func TestSectionVisibilityLTunnel(t *testing.T) {
+	// From the -X face to the center along X, then to the +Z face along Z
+	isTunnel := func(x, y, z int) bool {
+		return y == 8 && ((z == 8 && x <= 8) || (x == 8 && z >= 8))
+	}
+	visibility := ComputeSectionVisibility(func(x, y, z int) bool {
+		return !isTunnel(x, y, z)
+	})
+
+	expected := SectionVisibility(0)
+	expected.connectFaces(1<<FACE_SIDE1 | 1<<FACE_SIDE3)
+	if visibility != expected {
+		t.Fatalf("visibility %036b, expected %036b", visibility, expected)
+	}
+	if !visibility.Connects(FACE_SIDE1, FACE_SIDE3) || !visibility.Connects(FACE_SIDE3, FACE_SIDE1) {
+		t.Errorf("the tunnel does not connect -X and +Z")
+	}
+	for _, face := range []int{FACE_SIDE0, FACE_SIDE2, FACE_TOP, FACE_BOTTOM} {
+		if visibility.Connects(FACE_SIDE1, face) {
+			t.Errorf("the tunnel connects -X with face %d", face)
+		}
+	}
+}
+
+// TestOcclusionCameraAboveWorld checks that a camera above the top of the world
+// sees the whole top layer and nothing behind it when that layer is solid.
+func TestOcclusionCameraAboveWorld(t *testing.T) {
+	graph := testSectionGraph{}
+	graph.fillLayer(1, 1, 0)
+	graph.fillLayer(0, 1, SECTION_VISIBILITY_ALL)
+
+	culler := OcclusionCuller{}
+	culler.Cull(graph, mgl64.Vec3{8, 100, 8}, 1, 0, 2)
+
+	for x := -1; x <= 1; x++ {
+		for z := -1; z <= 1; z++ {
+			if !culler.Visible(ChunkPos{x, 1, z}) {
+				t.Errorf("top layer chunk %d, 1, %d is not visible", x, z)
+			}
+			if culler.Visible(ChunkPos{x, 0, z}) {
+				t.Errorf("chunk %d, 0, %d below the solid top layer is visible", x, z)
+			}
+		}
+	}
+}
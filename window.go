@@ -11,6 +11,8 @@ type Window struct {
 	windowObj       *glfw.Window             // GLFW window object
 	updateCallbacks []func(float64)          // Functions called each frame with deltaTime
 	cursorCallbacks []func(float64, float64) // Functions called on mouse movement
+	keyCallbacks    []func(glfw.Key)         // Functions called when a key is pressed (not on release or repeat)
+	mouseCallbacks  []func(glfw.MouseButton) // Functions called when a mouse button is pressed
 }
 
 // Initialize creates and configures a new GLFW window.
@@ -46,11 +48,33 @@ func (window *Window) Initialize(startWidth, startHeight int, titleName string)
 		}
 	}
 
+	// Create key callback function for one-shot actions such as screenshots
+	keyCallback := func(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+		if action != glfw.Press {
+			return
+		}
+		for _, callback := range window.keyCallbacks {
+			callback(key)
+		}
+	}
+
+	// Create mouse button callback function for clicks such as breaking blocks
+	mouseButtonCallback := func(w *glfw.Window, button glfw.MouseButton, action glfw.Action, mods glfw.ModifierKey) {
+		if action != glfw.Press {
+			return
+		}
+		for _, callback := range window.mouseCallbacks {
+			callback(button)
+		}
+	}
+
 	// Make this window's OpenGL context current (required for GL operations)
 	windowObj.MakeContextCurrent()
 
-	// Register mouse movement callback
+	// Register mouse movement, key and mouse button callbacks
 	windowObj.SetCursorPosCallback(cursorCallback)
+	windowObj.SetKeyCallback(keyCallback)
+	windowObj.SetMouseButtonCallback(mouseButtonCallback)
 
 	// Lock cursor to window center (for FPS-style camera control)
 	windowObj.SetInputMode(glfw.CursorMode, glfw.CursorDisabled)
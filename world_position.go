@@ -0,0 +1,188 @@
+// Implements the integer positions the world is addressed with: chunks (cubic
+// sections of 16³ blocks) by ChunkPos, blocks by BlockPos in world coordinates
+// and by LocalPos inside their chunk. Conversions divide with floor semantics,
+// so block -1 lies in chunk -1 at local 15 rather than in chunk 0 at local -1.
+// All three are comparable values and can be used as map keys directly.
+
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/go-gl/mathgl/mgl64"
+)
+
+// CHUNK_SIZE is the edge length of a chunk in blocks along every axis.
+const CHUNK_SIZE = 16
+
+// CHUNK_REGION_SIZE is the edge length of a render region in chunks along every
+// axis. Chunk meshes are stored relative to their region's origin, so all
+// chunks of a region are drawn with the same model matrix.
+const CHUNK_REGION_SIZE = 8
+
+// ChunkPos is the position of a chunk in chunk coordinates.
+// Chunk (x, y, z) holds the blocks x*16 to x*16+15, y*16 to y*16+15 and z*16 to z*16+15.
+type ChunkPos struct {
+	x, y, z int // Chunk coordinates (Y is vertical)
+}
+
+// BlockPos is the position of a block in world coordinates (Y is vertical).
+type BlockPos struct {
+	x, y, z int // Block coordinates
+}
+
+// LocalPos is the position of a block inside its chunk, every axis from 0 to 15.
+type LocalPos struct {
+	x, y, z int // Block coordinates relative to the chunk origin
+}
+
+// chunkNeighbourOffsets lists the six face neighbours of a chunk: -X, +X, -Y, +Y, -Z, +Z.
+var chunkNeighbourOffsets = [6]ChunkPos{
+	{-1, 0, 0}, {1, 0, 0}, {0, -1, 0}, {0, 1, 0}, {0, 0, -1}, {0, 0, 1},
+}
+
+// blockNeighbourOffsets lists the six face neighbours: -X, +X, -Y, +Y, -Z, +Z.
+var blockNeighbourOffsets = [6]BlockPos{
+	{-1, 0, 0}, {1, 0, 0}, {0, -1, 0}, {0, 1, 0}, {0, 0, -1}, {0, 0, 1},
+}
+
+// floorDiv divides a by b rounding towards negative infinity,
+// which maps negative block coordinates to the correct chunk.
+func floorDiv(a, b int) int {
+	quotient := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		quotient--
+	}
+	return quotient
+}
+
+// floorMod returns the remainder of floorDiv, which has the sign of b.
+func floorMod(a, b int) int {
+	return a - floorDiv(a, b)*b
+}
+
+// BlockPosAt returns the block containing a point.
+// position: Point in world space
+func BlockPosAt(position mgl64.Vec3) BlockPos {
+	return BlockPos{int(math.Floor(position[0])), int(math.Floor(position[1])), int(math.Floor(position[2]))}
+}
+
+// ChunkPosAt returns the chunk containing a point.
+// position: Point in world space
+func ChunkPosAt(position mgl64.Vec3) ChunkPos {
+	return BlockPosAt(position).Chunk()
+}
+
+// Chunk returns the chunk the block lies in.
+func (block BlockPos) Chunk() ChunkPos {
+	return ChunkPos{floorDiv(block.x, CHUNK_SIZE), floorDiv(block.y, CHUNK_SIZE), floorDiv(block.z, CHUNK_SIZE)}
+}
+
+// Local returns the block's position inside its chunk.
+func (block BlockPos) Local() LocalPos {
+	return LocalPos{floorMod(block.x, CHUNK_SIZE), floorMod(block.y, CHUNK_SIZE), floorMod(block.z, CHUNK_SIZE)}
+}
+
+// Add returns the block moved by an offset.
+func (block BlockPos) Add(offset BlockPos) BlockPos {
+	return BlockPos{block.x + offset.x, block.y + offset.y, block.z + offset.z}
+}
+
+// Neighbours returns the six blocks sharing a face with the block, in the
+// order -X, +X, -Y, +Y, -Z, +Z.
+func (block BlockPos) Neighbours() [6]BlockPos {
+	neighbours := [6]BlockPos{}
+	for i, offset := range blockNeighbourOffsets {
+		neighbours[i] = block.Add(offset)
+	}
+	return neighbours
+}
+
+// Vec3 returns the world position of the block's lowest corner.
+func (block BlockPos) Vec3() mgl64.Vec3 {
+	return mgl64.Vec3{float64(block.x), float64(block.y), float64(block.z)}
+}
+
+// String formats the block as "x, y, z".
+func (block BlockPos) String() string {
+	return fmt.Sprintf("%d, %d, %d", block.x, block.y, block.z)
+}
+
+// Origin returns the chunk's first block (lowest X, Y and Z).
+func (chunk ChunkPos) Origin() BlockPos {
+	return BlockPos{chunk.x * CHUNK_SIZE, chunk.y * CHUNK_SIZE, chunk.z * CHUNK_SIZE}
+}
+
+// Region returns the first chunk (lowest X, Y and Z) of the render region
+// the chunk lies in.
+func (chunk ChunkPos) Region() ChunkPos {
+	return ChunkPos{
+		floorDiv(chunk.x, CHUNK_REGION_SIZE) * CHUNK_REGION_SIZE,
+		floorDiv(chunk.y, CHUNK_REGION_SIZE) * CHUNK_REGION_SIZE,
+		floorDiv(chunk.z, CHUNK_REGION_SIZE) * CHUNK_REGION_SIZE,
+	}
+}
+
+// Block returns the world position of a block of the chunk.
+// local: Position inside the chunk
+func (chunk ChunkPos) Block(local LocalPos) BlockPos {
+	return chunk.Origin().Add(BlockPos(local))
+}
+
+// Add returns the chunk moved by a number of chunks.
+func (chunk ChunkPos) Add(dx, dy, dz int) ChunkPos {
+	return ChunkPos{chunk.x + dx, chunk.y + dy, chunk.z + dz}
+}
+
+// Neighbours returns the six chunks sharing a face with the chunk, in the
+// order -X, +X, -Y, +Y, -Z, +Z.
+func (chunk ChunkPos) Neighbours() [6]ChunkPos {
+	neighbours := [6]ChunkPos{}
+	for i, offset := range chunkNeighbourOffsets {
+		neighbours[i] = chunk.Add(offset.x, offset.y, offset.z)
+	}
+	return neighbours
+}
+
+// Distance returns the number of chunks between two chunks along the longest
+// axis (Chebyshev distance), so the chunks within distance d form a cube.
+func (chunk ChunkPos) Distance(other ChunkPos) int {
+	return max(abs(chunk.x-other.x), abs(chunk.y-other.y), abs(chunk.z-other.z))
+}
+
+// Less orders chunks by X, then Z, then Y.
+func (chunk ChunkPos) Less(other ChunkPos) bool {
+	if chunk.x != other.x {
+		return chunk.x < other.x
+	}
+	if chunk.z != other.z {
+		return chunk.z < other.z
+	}
+	return chunk.y < other.y
+}
+
+// Hash mixes the chunk position with a seed into 64 well distributed bits
+// (SplitMix64 finalizer), for values that must only depend on the seed and
+// the chunk, not on the order chunks are generated in.
+// seed: World seed
+func (chunk ChunkPos) Hash(seed int64) uint64 {
+	hash := uint64(seed)
+	for _, value := range [3]int{chunk.x, chunk.y, chunk.z} {
+		hash += uint64(int64(value)) + 0x9e3779b97f4a7c15
+		hash = (hash ^ (hash >> 30)) * 0xbf58476d1ce4e5b9
+		hash = (hash ^ (hash >> 27)) * 0x94d049bb133111eb
+		hash ^= hash >> 31
+	}
+	return hash
+}
+
+// String formats the chunk as "x, y, z".
+func (chunk ChunkPos) String() string {
+	return fmt.Sprintf("%d, %d, %d", chunk.x, chunk.y, chunk.z)
+}
+
+// Valid reports whether the position lies inside a chunk.
+func (local LocalPos) Valid() bool {
+	return local.x >= 0 && local.x < CHUNK_SIZE && local.y >= 0 && local.y < CHUNK_SIZE && local.z >= 0 && local.z < CHUNK_SIZE
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"testing/quick"
+)
+
+// TestFloorDivMod checks floor division and its remainder against math.Floor,
+// with negative values in particular.
+func TestFloorDivMod(t *testing.T) {
+	cases := []struct {
+		a, b     int // Dividend and divisor
+		quotient int // Expected floorDiv(a, b)
+		mod      int // Expected floorMod(a, b)
+	}{
+		{0, 16, 0, 0},
+		{15, 16, 0, 15},
+		{16, 16, 1, 0},
+		{-1, 16, -1, 15},
+		{-15, 16, -1, 1},
+		{-16, 16, -1, 0},
+		{-17, 16, -2, 15},
+		{-32, 16, -2, 0},
+		{7, -2, -4, -1},
+	}
+	for _, testCase := range cases {
+		if quotient := floorDiv(testCase.a, testCase.b); quotient != testCase.quotient {
+			t.Errorf("floorDiv(%d, %d) = %d, expected %d", testCase.a, testCase.b, quotient, testCase.quotient)
+		}
+		if mod := floorMod(testCase.a, testCase.b); mod != testCase.mod {
+			t.Errorf("floorMod(%d, %d) = %d, expected %d", testCase.a, testCase.b, mod, testCase.mod)
+		}
+	}
+
+	check := func(a int32) bool {
+		quotient := floorDiv(int(a), CHUNK_SIZE)
+		mod := floorMod(int(a), CHUNK_SIZE)
+		return quotient == int(math.Floor(float64(a)/CHUNK_SIZE)) && mod >= 0 && mod < CHUNK_SIZE
+	}
+	if err := quick.Check(check, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestBlockPosChunkLocal checks that splitting a block into chunk and local
+// position and joining them again gives the block back.
+func TestBlockPosChunkLocal(t *testing.T) {
+	cases := []struct {
+		block BlockPos // Block in world coordinates
+		chunk ChunkPos // Expected chunk
+		local LocalPos // Expected position inside the chunk
+	}{
+		{BlockPos{0, 0, 0}, ChunkPos{0, 0, 0}, LocalPos{0, 0, 0}},
+		{BlockPos{-1, -1, -1}, ChunkPos{-1, -1, -1}, LocalPos{15, 15, 15}},
+		{BlockPos{-16, 63, -17}, ChunkPos{-1, 3, -2}, LocalPos{0, 15, 15}},
+		{BlockPos{1000000, -64, -1000000}, ChunkPos{62500, -4, -62500}, LocalPos{0, 0, 0}},
+	}
+	for _, testCase := range cases {
+		chunk, local := testCase.block.Chunk(), testCase.block.Local()
+		if chunk != testCase.chunk || local != testCase.local {
+			t.Errorf("block %v in chunk %v at %v, expected chunk %v at %v", testCase.block, chunk, local, testCase.chunk, testCase.local)
+		}
+	}
+
+	check := func(x, y, z int32) bool {
+		block := BlockPos{int(x), int(y), int(z)}
+		local := block.Local()
+		return local.Valid() && block.Chunk().Block(local) == block
+	}
+	if err := quick.Check(check, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestChunkPosRegion checks that regions are aligned cubes containing their chunks.
+func TestChunkPosRegion(t *testing.T) {
+	check := func(x, y, z int32) bool {
+		chunk := ChunkPos{int(x), int(y), int(z)}
+		region := chunk.Region()
+		return floorMod(region.x, CHUNK_REGION_SIZE) == 0 && floorMod(region.y, CHUNK_REGION_SIZE) == 0 && floorMod(region.z, CHUNK_REGION_SIZE) == 0 &&
+			chunk.x-region.x < CHUNK_REGION_SIZE && chunk.y-region.y < CHUNK_REGION_SIZE && chunk.z-region.z < CHUNK_REGION_SIZE &&
+			chunk.x >= region.x && chunk.y >= region.y && chunk.z >= region.z
+	}
+	if err := quick.Check(check, nil); err != nil {
+		t.Error(err)
+	}
+	if region := (ChunkPos{-1, 0, -9}).Region(); region != (ChunkPos{-8, 0, -16}) {
+		t.Errorf("region of -1, 0, -9 is %v, expected -8, 0, -16", region)
+	}
+}
+
+// TestNeighbours checks that neighbours are one step along a single axis.
+func TestNeighbours(t *testing.T) {
+	chunk := ChunkPos{-1, 0, 5}
+	for i, neighbour := range chunk.Neighbours() {
+		if chunk.Distance(neighbour) != 1 || abs(neighbour.x-chunk.x)+abs(neighbour.y-chunk.y)+abs(neighbour.z-chunk.z) != 1 {
+			t.Errorf("chunk neighbour %d of %v is %v", i, chunk, neighbour)
+		}
+	}
+
+	block := BlockPos{0, -1, 15}
+	seen := map[BlockPos]bool{}
+	for i, neighbour := range block.Neighbours() {
+		if abs(neighbour.x-block.x)+abs(neighbour.y-block.y)+abs(neighbour.z-block.z) != 1 || seen[neighbour] {
+			t.Errorf("block neighbour %d of %v is %v", i, block, neighbour)
+		}
+		seen[neighbour] = true
+	}
+}
+
+// TestChunkPosHash checks that the hash is stable, across calls and against
+// known values, and differs between neighbouring chunks and between seeds.
+func TestChunkPosHash(t *testing.T) {
+	check := func(x, y, z int32, seed int64) bool {
+		chunk := ChunkPos{int(x), int(y), int(z)}
+		hash := chunk.Hash(seed)
+		if hash != chunk.Hash(seed) || hash == chunk.Hash(seed+1) {
+			return false
+		}
+		for _, neighbour := range chunk.Neighbours() {
+			if neighbour.Hash(seed) == hash {
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(check, nil); err != nil {
+		t.Error(err)
+	}
+
+	// Veins cross chunk borders, chunks generated next to saved ones need the same values
+	pinned := []struct {
+		chunk ChunkPos // Hashed chunk
+		seed  int64    // World seed
+		hash  uint64   // Expected hash
+	}{
+		{ChunkPos{0, 0, 0}, 0, 0x238275bc38fcbe91},
+		{ChunkPos{-1, 2, -3}, 12345, 0x94cb3af1df12c046},
+	}
+	for _, testCase := range pinned {
+		if hash := testCase.chunk.Hash(testCase.seed); hash != testCase.hash {
+			t.Errorf("hash of %v with seed %d is %#x, expected %#x", testCase.chunk, testCase.seed, hash, testCase.hash)
+		}
+	}
+
+	// Swapped coordinates must not collide either
+	if (ChunkPos{1, 2, 3}).Hash(0) == (ChunkPos{3, 2, 1}).Hash(0) {
+		t.Errorf("hash ignores the order of the coordinates")
+	}
+}
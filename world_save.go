@@ -0,0 +1,114 @@
+// Implements saving and loading of world-wide state.
+// Level data (the world clock, the terrain seed and the build limits) is stored as
+// JSON in the world's save directory so it survives restarts. Changed chunks are
+// saved next to it (see chunk_save.go).
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// WORLD_SAVE_DIRECTORY is the default directory a world is saved to.
+const WORLD_SAVE_DIRECTORY = "world"
+
+// WORLD_LEVEL_FILE is the name of the level data file inside the save directory.
+const WORLD_LEVEL_FILE = "level.json"
+
+// LevelData is the on-disk form of world-wide state.
+type LevelData struct {
+	TimeOfDay  float64  `json:"timeOfDay"`  // Time of day in ticks
+	Day        int      `json:"day"`        // Number of full days passed
+	TimeRate   *float64 `json:"timeRate"`   // Day time ticks per world tick (nil in saves that predate it)
+	TimeFrozen bool     `json:"timeFrozen"` // Whether the clock is stopped
+	Seed       int64    `json:"seed"`       // Seed of the terrain noise (0 in saves that predate seeds)
+	MinHeight  int      `json:"minHeight"`  // Lower build limit (0 in saves that predate build limits)
+	MaxHeight  int      `json:"maxHeight"`  // Upper build limit (0 in saves that predate build limits)
+}
+
+// Save writes the level data and every chunk changed since it was last saved.
+// Returns the first error; a failing chunk does not stop the others.
+func (gameWorld *GameWorld) Save() error {
+	levelErr := gameWorld.SaveLevel()
+	chunksErr := gameWorld.SaveChunks()
+	if levelErr != nil {
+		return levelErr
+	}
+	return chunksErr
+}
+
+// SaveLevel writes the level data to the world's save directory.
+// Returns an error if the directory or file cannot be written.
+func (gameWorld *GameWorld) SaveLevel() error {
+	level := LevelData{
+		TimeOfDay:  gameWorld.time.ticks,
+		Day:        gameWorld.time.day,
+		TimeRate:   &gameWorld.time.rate,
+		TimeFrozen: gameWorld.time.frozen,
+		Seed:       gameWorld.seed,
+		MinHeight:  gameWorld.minHeight,
+		MaxHeight:  gameWorld.maxHeight,
+	}
+
+	content, err := json.MarshalIndent(level, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode level data: %v", err)
+	}
+
+	if err := os.MkdirAll(gameWorld.saveDirectory, 0755); err != nil {
+		return fmt.Errorf("failed to create save directory %q: %v", gameWorld.saveDirectory, err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a half-written level
+	path := filepath.Join(gameWorld.saveDirectory, WORLD_LEVEL_FILE)
+	if err := os.WriteFile(path+".tmp", content, 0644); err != nil {
+		return fmt.Errorf("failed to write level data %q: %v", path, err)
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// LoadLevel reads the level data from the world's save directory.
+// A missing file is not an error: the world simply keeps its default values.
+func (gameWorld *GameWorld) LoadLevel() error {
+	path := filepath.Join(gameWorld.saveDirectory, WORLD_LEVEL_FILE)
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read level data %q: %v", path, err)
+	}
+
+	level := LevelData{}
+	if err := json.Unmarshal(content, &level); err != nil {
+		return fmt.Errorf("failed to decode level data %q: %v", path, err)
+	}
+
+	gameWorld.time.ticks = 0
+	gameWorld.time.day = level.Day
+	gameWorld.time.Set(level.TimeOfDay)
+	gameWorld.time.frozen = level.TimeFrozen
+
+	// A missing rate keeps the default, a negative one would run the clock backwards.
+	// JSON has no NaN or infinities, out of range numbers already failed to decode.
+	if rate := level.TimeRate; rate != nil {
+		if *rate < 0 {
+			return fmt.Errorf("invalid time rate %g in level data %q", *rate, path)
+		}
+		gameWorld.time.rate = *rate
+	}
+	gameWorld.seed = level.Seed
+
+	// Saves from before build limits were stored keep the limits set before loading
+	if level.MinHeight != 0 || level.MaxHeight != 0 {
+		if err := gameWorld.SetBuildLimits(level.MinHeight, level.MaxHeight); err != nil {
+			return fmt.Errorf("invalid build limits in level data %q: %v", path, err)
+		}
+	}
+	return nil
+}
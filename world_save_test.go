@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestLoadLevelTimeRate checks that a missing time rate keeps the default
+// and that rates the clock cannot run at are rejected.
+func TestLoadLevelTimeRate(t *testing.T) {
+	cases := []struct {
+		content string  // Level file
+		rate    float64 // Expected rate after loading
+		message string  // Part of the expected error ("" for none)
+	}{
+		{`{"timeOfDay": 6000, "day": 2}`, 1.0, ""},
+		{`{"timeOfDay": 6000, "day": 2, "timeRate": 0}`, 0.0, ""},
+		{`{"timeOfDay": 6000, "day": 2, "timeRate": 2.5}`, 2.5, ""},
+		{`{"timeOfDay": 6000, "day": 2, "timeRate": -1}`, 1.0, "invalid time rate -1"},
+		{`{"timeOfDay": 6000, "day": 2, "timeRate": 1e999}`, 1.0, "failed to decode level data"},
+	}
+	for _, testCase := range cases {
+		directory := t.TempDir()
+		if err := os.WriteFile(filepath.Join(directory, WORLD_LEVEL_FILE), []byte(testCase.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		gameWorld := GameWorld{saveDirectory: directory}
+		gameWorld.time.InitializeDefaultValues()
+
+		err := gameWorld.LoadLevel()
+		if testCase.message == "" && err != nil {
+			t.Errorf("%s: %v", testCase.content, err)
+		}
+		if testCase.message != "" && (err == nil || !strings.Contains(err.Error(), testCase.message)) {
+			t.Errorf("%s: error %v, expected %q", testCase.content, err, testCase.message)
+		}
+		if gameWorld.time.rate != testCase.rate {
+			t.Errorf("%s: rate %g, expected %g", testCase.content, gameWorld.time.rate, testCase.rate)
+		}
+	}
+
+	// A saved rate of zero survives a round trip
+	gameWorld := GameWorld{saveDirectory: t.TempDir()}
+	gameWorld.time.InitializeDefaultValues()
+	gameWorld.time.rate = 0.0
+	if err := gameWorld.SaveLevel(); err != nil {
+		t.Fatal(err)
+	}
+	gameWorld.time.InitializeDefaultValues()
+	if err := gameWorld.LoadLevel(); err != nil || gameWorld.time.rate != 0.0 {
+		t.Errorf("rate %g after reloading a stopped clock (%v)", gameWorld.time.rate, err)
+	}
+}
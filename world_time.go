@@ -0,0 +1,141 @@
+// Implements the world clock and the day/night cycle.
+// WorldTime counts ticks through a day and derives the sun and moon positions,
+// the light used by the world shader and the sky colors from the time of day.
+
+package main
+
+import (
+	"math"
+
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Day cycle constants. Times are in world ticks, 0 is sunrise.
+const (
+	WORLD_DAY_TICKS      = 24000 // Length of a full day (20 minutes at 20 ticks per second)
+	WORLD_TIME_SUNRISE   = 0     // Sun on the eastern horizon
+	WORLD_TIME_NOON      = 6000  // Sun at its highest point
+	WORLD_TIME_SUNSET    = 12000 // Sun on the western horizon
+	WORLD_TIME_MIDNIGHT  = 18000 // Moon at its highest point
+	WORLD_TIME_DEFAULT   = 1000  // Time a new world starts at (early morning)
+	WORLD_SUN_AXIS_TILT  = 0.35  // Sideways offset of the sun path so it never passes straight overhead
+	WORLD_NIGHT_AMBIENT  = 0.08  // Ambient light strength at night
+	WORLD_DAY_AMBIENT    = 0.3   // Ambient light strength at day
+	WORLD_TWILIGHT_WIDTH = 0.25  // Sun elevation (sine) over which day blends into night
+)
+
+// WorldTime tracks the time of day and how fast it passes.
+type WorldTime struct {
+	ticks  float64 // Time of day in ticks (0 to WORLD_DAY_TICKS)
+	day    int     // Number of full days passed
+	rate   float64 // Ticks of day time advanced per world tick (1 = normal speed)
+	frozen bool    // When set, the time of day does not advance
+}
+
+// Daylight holds everything derived from the time of day that rendering needs.
+type Daylight struct {
+	sunDirection    mgl32.Vec3 // Direction TO the sun (normalized)
+	moonDirection   mgl32.Vec3 // Direction TO the moon (normalized)
+	lightDirection  mgl32.Vec3 // Direction TO the light that currently lights the world
+	lightColor      mgl32.Vec3 // Color of that light
+	ambientStrength float32    // Ambient light strength
+	zenithColor     mgl32.Vec3 // Sky color straight up
+	horizonColor    mgl32.Vec3 // Sky color at the horizon (and fog color)
+	groundColor     mgl32.Vec3 // Sky color below the horizon
+}
+
+// Sky palettes blended by the day/night cycle.
+var (
+	skyDayZenith       = mgl32.Vec3{0.15, 0.35, 0.85}
+	skyDayHorizon      = mgl32.Vec3{0.7, 0.8, 1.0}
+	skyDayGround       = mgl32.Vec3{0.35, 0.4, 0.5}
+	skyTwilightZenith  = mgl32.Vec3{0.2, 0.25, 0.55}
+	skyTwilightHorizon = mgl32.Vec3{0.95, 0.55, 0.3}
+	skyNightZenith     = mgl32.Vec3{0.01, 0.015, 0.05}
+	skyNightHorizon    = mgl32.Vec3{0.05, 0.07, 0.14}
+	skyNightGround     = mgl32.Vec3{0.02, 0.02, 0.04}
+	sunNoonColor       = mgl32.Vec3{1.0, 0.98, 0.92}
+	sunTwilightColor   = mgl32.Vec3{1.0, 0.6, 0.35}
+	moonLightColor     = mgl32.Vec3{0.3, 0.35, 0.5}
+)
+
+// InitializeDefaultValues starts the clock in the early morning at normal speed.
+func (worldTime *WorldTime) InitializeDefaultValues() {
+	worldTime.ticks = WORLD_TIME_DEFAULT
+	worldTime.day = 0
+	worldTime.rate = 1.0
+	worldTime.frozen = false
+}
+
+// Advance moves the clock forward by one world tick.
+func (worldTime *WorldTime) Advance() {
+	if worldTime.frozen {
+		return
+	}
+	worldTime.Set(worldTime.ticks + worldTime.rate)
+}
+
+// Set changes the time of day, wrapping it into a single day
+// and counting the days that passed (or went back).
+// ticks: New time of day in ticks (may be outside 0..WORLD_DAY_TICKS)
+func (worldTime *WorldTime) Set(ticks float64) {
+	days := math.Floor(ticks / WORLD_DAY_TICKS)
+	worldTime.day += int(days)
+	worldTime.ticks = ticks - days*WORLD_DAY_TICKS
+}
+
+// SunDirection returns the direction TO the sun at the current time.
+// The sun rises in +X, passes (almost) overhead at noon and sets in -X.
+func (worldTime *WorldTime) SunDirection() mgl32.Vec3 {
+	angle := worldTime.ticks / WORLD_DAY_TICKS * 2.0 * math.Pi
+	return mgl32.Vec3{
+		float32(math.Cos(angle)),
+		float32(math.Sin(angle)),
+		WORLD_SUN_AXIS_TILT,
+	}.Normalize()
+}
+
+// lerpVec3 blends two colors, t = 0 gives a and t = 1 gives b.
+func lerpVec3(a, b mgl32.Vec3, t float32) mgl32.Vec3 {
+	return a.Add(b.Sub(a).Mul(t))
+}
+
+// smoothstep is the GLSL smoothstep function.
+func smoothstep(edge0, edge1, x float32) float32 {
+	t := mgl32.Clamp((x-edge0)/(edge1-edge0), 0.0, 1.0)
+	return t * t * (3.0 - 2.0*t)
+}
+
+// Daylight computes light and sky colors for the current time of day.
+func (worldTime *WorldTime) Daylight() Daylight {
+	daylight := Daylight{}
+	daylight.sunDirection = worldTime.SunDirection()
+	daylight.moonDirection = daylight.sunDirection.Mul(-1.0)
+
+	// 0 at night, 1 at day, blended through twilight around the horizon
+	elevation := daylight.sunDirection[1]
+	dayAmount := smoothstep(-WORLD_TWILIGHT_WIDTH*0.5, WORLD_TWILIGHT_WIDTH, elevation)
+	// 1 when the sun is close to the horizon, used for orange tints
+	twilightAmount := 1.0 - mgl32.Clamp(mgl32.Abs(elevation)/WORLD_TWILIGHT_WIDTH, 0.0, 1.0)
+
+	// The sun lights the world while it is up, the moon takes over at night
+	if elevation > 0.0 {
+		daylight.lightDirection = daylight.sunDirection
+		daylight.lightColor = lerpVec3(sunNoonColor, sunTwilightColor, twilightAmount)
+	} else {
+		daylight.lightDirection = daylight.moonDirection
+		daylight.lightColor = moonLightColor
+	}
+	// Fade the light out towards the horizon so the switch never jumps
+	daylight.lightColor = daylight.lightColor.Mul(1.0 - twilightAmount)
+	daylight.ambientStrength = WORLD_NIGHT_AMBIENT + (WORLD_DAY_AMBIENT-WORLD_NIGHT_AMBIENT)*dayAmount
+
+	// Sky: night palette blended to day, with an orange horizon at twilight
+	daylight.zenithColor = lerpVec3(skyNightZenith, skyDayZenith, dayAmount)
+	daylight.horizonColor = lerpVec3(skyNightHorizon, skyDayHorizon, dayAmount)
+	daylight.groundColor = lerpVec3(skyNightGround, skyDayGround, dayAmount)
+	daylight.zenithColor = lerpVec3(daylight.zenithColor, skyTwilightZenith, twilightAmount*0.5)
+	daylight.horizonColor = lerpVec3(daylight.horizonColor, skyTwilightHorizon, twilightAmount*0.7)
+
+	return daylight
+}